@@ -0,0 +1,542 @@
+package bunnychat
+
+import (
+	"bytes"
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"mime/multipart"
+	"net/http"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const (
+	defaultHTTPTimeout = 10 * time.Second
+	defaultRetries     = 2
+	defaultRetryDelay  = 200 * time.Millisecond
+)
+
+// API — клиент HTTP API сервера истории. Запросы, зависящие от
+// пользователя (непрочитанные, упоминания, закрепления), выполняются от
+// имени Username.
+type API struct {
+	BaseURL  string
+	Username string
+	HTTP     *http.Client
+	// Token — токен доступа из Login или Register, отправляется
+	// заголовком Authorization. Пустой — запросы идут без него, как к
+	// серверу без входа.
+	Token string
+	// Reauth вызывается, когда сервер отверг Token (ответ 401): получает
+	// отвергнутый токен и возвращает действующий, с которым запрос
+	// повторяется один раз. nil — ошибка 401 возвращается как есть.
+	Reauth func(expired string) (string, error)
+	// Retries — сколько раз повторить идемпотентный запрос, если сервер
+	// ответил 5xx или недоступен; пауза между попытками удваивается,
+	// начиная с RetryDelay.
+	Retries    int
+	RetryDelay time.Duration
+}
+
+// APIError — ответ сервера с кодом не 2xx. Message — текст из поля error
+// ответа, если сервер его прислал.
+type APIError struct {
+	StatusCode int
+	Message    string
+}
+
+func (e *APIError) Error() string {
+	if e.Message == "" {
+		return fmt.Sprintf("сервер вернул статус %d", e.StatusCode)
+	}
+	return fmt.Sprintf("сервер вернул статус %d: %s", e.StatusCode, e.Message)
+}
+
+// Temporary сообщает, имеет ли смысл повторить запрос позже.
+func (e *APIError) Temporary() bool {
+	return e.StatusCode >= 500
+}
+
+// NewAPI принимает адрес сервера как "host:port" или полный URL
+// (http:// или https://).
+func NewAPI(server, username string) *API {
+	if !strings.Contains(server, "://") {
+		server = "http://" + server
+	}
+	return &API{
+		BaseURL:    strings.TrimRight(server, "/"),
+		Username:   username,
+		HTTP:       &http.Client{Timeout: defaultHTTPTimeout},
+		Retries:    defaultRetries,
+		RetryDelay: defaultRetryDelay,
+	}
+}
+
+// NewHTTPClient создает HTTP-клиент с таймаутом timeout (0 — по
+// умолчанию). Если указан caFile, сертификаты из него (PEM) принимаются
+// вместе с системными — для серверов с собственным центром сертификации.
+func NewHTTPClient(caFile string, timeout time.Duration) (*http.Client, error) {
+	if timeout <= 0 {
+		timeout = defaultHTTPTimeout
+	}
+	client := &http.Client{Timeout: timeout}
+	if caFile == "" {
+		return client, nil
+	}
+
+	pem, err := os.ReadFile(caFile)
+	if err != nil {
+		return nil, fmt.Errorf("ошибка чтения сертификата: %w", err)
+	}
+	pool, err := x509.SystemCertPool()
+	if err != nil {
+		pool = x509.NewCertPool()
+	}
+	if !pool.AppendCertsFromPEM(pem) {
+		return nil, fmt.Errorf("в файле %s нет сертификатов PEM", caFile)
+	}
+
+	transport := http.DefaultTransport.(*http.Transport).Clone()
+	transport.TLSClientConfig = &tls.Config{RootCAs: pool, MinVersion: tls.VersionTLS12}
+	client.Transport = transport
+	return client, nil
+}
+
+func (a *API) History(chatName string, limit int) (*HistoryResponse, error) {
+	query := url.Values{"chat": {chatName}}
+	if limit > 0 {
+		query.Set("limit", strconv.Itoa(limit))
+	}
+	if a.Username != "" {
+		query.Set("user", a.Username)
+	}
+
+	var history HistoryResponse
+	if err := a.get("/v1/chats/history", query, &history); err != nil {
+		return nil, err
+	}
+	for i := range history.Messages {
+		history.Messages[i].ChatName = chatName
+	}
+	return &history, nil
+}
+
+// HistoryBefore возвращает до limit сообщений, более ранних чем beforeID, —
+// следующую страницу старой истории.
+func (a *API) HistoryBefore(chatName string, beforeID int64, limit int) (*HistoryResponse, error) {
+	query := url.Values{
+		"chat":   {chatName},
+		"before": {strconv.FormatInt(beforeID, 10)},
+	}
+	if limit > 0 {
+		query.Set("limit", strconv.Itoa(limit))
+	}
+
+	var history HistoryResponse
+	if err := a.get("/v1/chats/history", query, &history); err != nil {
+		return nil, err
+	}
+	for i := range history.Messages {
+		history.Messages[i].ChatName = chatName
+	}
+	return &history, nil
+}
+
+// HistorySince возвращает до limit сообщений чата, пришедших после
+// since, начиная с самого раннего, — для догрузки пропущенного после
+// переподключения. Следующие страницы отдает HistoryAfter.
+func (a *API) HistorySince(chatName string, since time.Time, limit int) (*HistoryResponse, error) {
+	query := url.Values{
+		"chat":  {chatName},
+		"since": {since.Format(time.RFC3339Nano)},
+	}
+	if limit > 0 {
+		query.Set("limit", strconv.Itoa(limit))
+	}
+
+	var history HistoryResponse
+	if err := a.get("/v1/chats/history", query, &history); err != nil {
+		return nil, err
+	}
+	for i := range history.Messages {
+		history.Messages[i].ChatName = chatName
+	}
+	return &history, nil
+}
+
+// HistoryAfter возвращает до limit сообщений, более поздних чем afterID, —
+// следующую страницу пропущенного.
+func (a *API) HistoryAfter(chatName string, afterID int64, limit int) (*HistoryResponse, error) {
+	query := url.Values{
+		"chat":  {chatName},
+		"after": {strconv.FormatInt(afterID, 10)},
+	}
+	if limit > 0 {
+		query.Set("limit", strconv.Itoa(limit))
+	}
+
+	var history HistoryResponse
+	if err := a.get("/v1/chats/history", query, &history); err != nil {
+		return nil, err
+	}
+	for i := range history.Messages {
+		history.Messages[i].ChatName = chatName
+	}
+	return &history, nil
+}
+
+func (a *API) Search(q SearchQuery) (*SearchResponse, error) {
+	query := url.Values{"q": {q.Text}}
+	for _, chatName := range q.Chats {
+		query.Add("chat", chatName)
+	}
+	if q.Author != "" {
+		query.Set("author", q.Author)
+	}
+	if !q.From.IsZero() {
+		query.Set("from", q.From.Format(time.RFC3339))
+	}
+	if !q.To.IsZero() {
+		query.Set("to", q.To.Format(time.RFC3339))
+	}
+	if q.Limit > 0 {
+		query.Set("limit", strconv.Itoa(q.Limit))
+	}
+
+	var result SearchResponse
+	if err := a.get("/v1/search", query, &result); err != nil {
+		return nil, err
+	}
+	for i := range result.Results {
+		result.Results[i].Message.ChatName = result.Results[i].Chat
+	}
+	return &result, nil
+}
+
+func (a *API) Chats() (*ChatsResponse, error) {
+	var chats ChatsResponse
+	if err := a.get("/v1/chats", a.userQuery(), &chats); err != nil {
+		return nil, err
+	}
+	return &chats, nil
+}
+
+func (a *API) Chat(chatName string) (*ChatInfo, error) {
+	var info ChatInfo
+	if err := a.get(chatPath(chatName), a.userQuery(), &info); err != nil {
+		return nil, err
+	}
+	return &info, nil
+}
+
+func (a *API) Members(chatName string, onlineOnly bool) (*MembersResponse, error) {
+	query := url.Values{}
+	if onlineOnly {
+		query.Set("online", "true")
+	}
+
+	var members MembersResponse
+	if err := a.get(chatPath(chatName)+"/members", query, &members); err != nil {
+		return nil, err
+	}
+	return &members, nil
+}
+
+// MarkRead отмечает сообщения чата прочитанными до messageID включительно,
+// при messageID == 0 — до последнего сообщения.
+func (a *API) MarkRead(chatName string, messageID int64) error {
+	return a.send(http.MethodPut, chatPath(chatName)+"/read", a.userQuery(),
+		map[string]int64{"message_id": messageID})
+}
+
+// Mentions возвращает упоминания пользователя с id больше afterID,
+// от новых к старым.
+func (a *API) Mentions(afterID int64) (*MentionsResponse, error) {
+	query := a.userQuery()
+	query.Set("after", strconv.FormatInt(afterID, 10))
+
+	var mentions MentionsResponse
+	if err := a.get("/v1/mentions", query, &mentions); err != nil {
+		return nil, err
+	}
+	return &mentions, nil
+}
+
+func (a *API) Pins(chatName string) (*PinsResponse, error) {
+	var pins PinsResponse
+	if err := a.get(chatPath(chatName)+"/pins", nil, &pins); err != nil {
+		return nil, err
+	}
+	for i := range pins.Pins {
+		pins.Pins[i].Message.ChatName = chatName
+	}
+	return &pins, nil
+}
+
+func (a *API) Pin(chatName string, messageID int64) error {
+	return a.send(http.MethodPut, pinPath(chatName, messageID), a.userQuery(), nil)
+}
+
+func (a *API) Unpin(chatName string, messageID int64) error {
+	return a.send(http.MethodDelete, pinPath(chatName, messageID), nil, nil)
+}
+
+func (a *API) SetTopic(chatName, topic string) error {
+	return a.send(http.MethodPut, chatPath(chatName)+"/topic", a.userQuery(),
+		map[string]string{"topic": topic})
+}
+
+// EditMessage заменяет текст своего сообщения. Чужое сообщение сервер
+// изменить не даст — ответ *APIError с кодом 403.
+func (a *API) EditMessage(chatName string, messageID int64, body string) (*Message, error) {
+	resp, err := a.do(http.MethodPut, fmt.Sprintf("%s/messages/%d", chatPath(chatName), messageID),
+		a.userQuery(), map[string]string{"body": body})
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	var edited EditResponse
+	if err := json.NewDecoder(resp.Body).Decode(&edited); err != nil {
+		return nil, fmt.Errorf("ошибка при разборе ответа: %w", err)
+	}
+	return &edited.Message, nil
+}
+
+// Upload загружает изображение на сервер и возвращает его полный адрес
+// для вставки в сообщение. Запрос не повторяется.
+func (a *API) Upload(filename string, r io.Reader) (string, error) {
+	var data bytes.Buffer
+	form := multipart.NewWriter(&data)
+	part, err := form.CreateFormFile("file", filepath.Base(filename))
+	if err != nil {
+		return "", fmt.Errorf("ошибка подготовки файла: %w", err)
+	}
+	if _, err := io.Copy(part, r); err != nil {
+		return "", fmt.Errorf("ошибка чтения файла: %w", err)
+	}
+	if err := form.Close(); err != nil {
+		return "", fmt.Errorf("ошибка подготовки файла: %w", err)
+	}
+
+	resp, err := a.authorized(func(token string) (*http.Response, error) {
+		return a.attempt(http.MethodPost, a.BaseURL+"/v1/uploads", form.FormDataContentType(), token, data.Bytes())
+	})
+	if err != nil {
+		return "", err
+	}
+	defer resp.Body.Close()
+
+	var uploaded UploadResponse
+	if err := json.NewDecoder(resp.Body).Decode(&uploaded); err != nil {
+		return "", fmt.Errorf("ошибка при разборе ответа: %w", err)
+	}
+	return a.BaseURL + uploaded.URL, nil
+}
+
+// Register создает пользователя и сразу входит от его имени.
+func (a *API) Register(username, password string) (*Session, error) {
+	return a.authenticate("/v1/auth/register", map[string]string{"username": username, "password": password})
+}
+
+// Login входит по имени и паролю. Неверный пароль — *APIError с кодом
+// 401.
+func (a *API) Login(username, password string) (*Session, error) {
+	return a.authenticate("/v1/auth/login", map[string]string{"username": username, "password": password})
+}
+
+// Refresh обменивает токен обновления на новую пару токенов. Старая пара
+// после этого не действует.
+func (a *API) Refresh(refreshToken string) (*Session, error) {
+	return a.authenticate("/v1/auth/refresh", map[string]string{"refresh_token": refreshToken})
+}
+
+// authenticate отправляет запрос без токена: входят как раз за ним.
+func (a *API) authenticate(path string, payload interface{}) (*Session, error) {
+	data, err := json.Marshal(payload)
+	if err != nil {
+		return nil, fmt.Errorf("ошибка сериализации запроса: %w", err)
+	}
+	resp, err := a.attempt(http.MethodPost, a.BaseURL+path, "application/json", "", data)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	var session Session
+	if err := json.NewDecoder(resp.Body).Decode(&session); err != nil {
+		return nil, fmt.Errorf("ошибка при разборе ответа: %w", err)
+	}
+	return &session, nil
+}
+
+// Logout завершает сеанс Token. Токен не обновляется: истекший сеанс и
+// так завершен.
+func (a *API) Logout() error {
+	resp, err := a.attempt(http.MethodPost, a.BaseURL+"/v1/auth/logout", "", a.Token, nil)
+	if err != nil {
+		return err
+	}
+	resp.Body.Close()
+	return nil
+}
+
+func (a *API) Profile() (*User, error) {
+	var user User
+	if err := a.get("/v1/profile", nil, &user); err != nil {
+		return nil, err
+	}
+	return &user, nil
+}
+
+func (a *API) UpdateProfile(profile ProfileUpdate) (*User, error) {
+	resp, err := a.do(http.MethodPut, "/v1/profile", nil, profile)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	var user User
+	if err := json.NewDecoder(resp.Body).Decode(&user); err != nil {
+		return nil, fmt.Errorf("ошибка при разборе ответа: %w", err)
+	}
+	return &user, nil
+}
+
+func chatPath(chatName string) string {
+	return "/v1/chats/" + url.PathEscape(chatName)
+}
+
+func pinPath(chatName string, messageID int64) string {
+	return fmt.Sprintf("%s/pins/%d", chatPath(chatName), messageID)
+}
+
+func (a *API) userQuery() url.Values {
+	query := url.Values{}
+	if a.Username != "" {
+		query.Set("user", a.Username)
+	}
+	return query
+}
+
+func (a *API) get(path string, query url.Values, out interface{}) error {
+	resp, err := a.do(http.MethodGet, path, query, nil)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	if err := json.NewDecoder(resp.Body).Decode(out); err != nil {
+		return fmt.Errorf("ошибка при разборе ответа: %w", err)
+	}
+	return nil
+}
+
+func (a *API) send(method, path string, query url.Values, payload interface{}) error {
+	resp, err := a.do(method, path, query, payload)
+	if err != nil {
+		return err
+	}
+	resp.Body.Close()
+	return nil
+}
+
+func (a *API) do(method, path string, query url.Values, payload interface{}) (*http.Response, error) {
+	var data []byte
+	if payload != nil {
+		var err error
+		data, err = json.Marshal(payload)
+		if err != nil {
+			return nil, fmt.Errorf("ошибка сериализации запроса: %w", err)
+		}
+	}
+
+	target := a.BaseURL + path
+	if len(query) > 0 {
+		target += "?" + query.Encode()
+	}
+
+	// POST может создать запись повторно, остальные запросы API идемпотентны.
+	retries := a.Retries
+	if method == http.MethodPost {
+		retries = 0
+	}
+
+	return a.authorized(func(token string) (*http.Response, error) {
+		delay := a.RetryDelay
+		for attempt := 0; ; attempt++ {
+			resp, err := a.attempt(method, target, "application/json", token, data)
+			var apiErr *APIError
+			temporary := err != nil && (!errors.As(err, &apiErr) || apiErr.Temporary())
+			if !temporary || attempt >= retries {
+				return resp, err
+			}
+			time.Sleep(delay)
+			delay *= 2
+		}
+	})
+}
+
+// authorized выполняет запрос с Token, а если сервер его отверг, — еще
+// раз с токеном от Reauth.
+func (a *API) authorized(request func(token string) (*http.Response, error)) (*http.Response, error) {
+	resp, err := request(a.Token)
+	var apiErr *APIError
+	if a.Token == "" || a.Reauth == nil || !errors.As(err, &apiErr) || apiErr.StatusCode != http.StatusUnauthorized {
+		return resp, err
+	}
+	token, reauthErr := a.Reauth(a.Token)
+	if reauthErr != nil {
+		return nil, reauthErr
+	}
+	return request(token)
+}
+
+func (a *API) attempt(method, target, contentType, token string, data []byte) (*http.Response, error) {
+	var body io.Reader
+	if data != nil {
+		body = bytes.NewReader(data)
+	}
+	req, err := http.NewRequest(method, target, body)
+	if err != nil {
+		return nil, err
+	}
+	if data != nil {
+		req.Header.Set("Content-Type", contentType)
+	}
+	if token != "" {
+		req.Header.Set("Authorization", "Bearer "+token)
+	}
+
+	client := a.HTTP
+	if client == nil {
+		client = http.DefaultClient
+	}
+	resp, err := client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		defer resp.Body.Close()
+		apiErr := &APIError{StatusCode: resp.StatusCode}
+		// Тело ошибки может быть не JSON (например, от прокси) — тогда
+		// остается только код.
+		var body struct {
+			Error string `json:"error"`
+		}
+		if json.NewDecoder(io.LimitReader(resp.Body, 64<<10)).Decode(&body) == nil {
+			apiErr.Message = body.Error
+		}
+		return nil, apiErr
+	}
+	return resp, nil
+}
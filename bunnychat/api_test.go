@@ -0,0 +1,361 @@
+package bunnychat
+
+import (
+	"encoding/json"
+	"encoding/pem"
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+type recordedRequest struct {
+	method string
+	path   string
+	query  string
+	body   string
+}
+
+// newTestServer отвечает на любой запрос response и запоминает последний запрос.
+func newTestServer(t *testing.T, status int, response interface{}) (*httptest.Server, *recordedRequest) {
+	last := &recordedRequest{}
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := io.ReadAll(r.Body)
+		*last = recordedRequest{
+			method: r.Method,
+			path:   r.URL.EscapedPath(),
+			query:  r.URL.RawQuery,
+			body:   string(body),
+		}
+		w.WriteHeader(status)
+		if response != nil {
+			json.NewEncoder(w).Encode(response)
+		}
+	}))
+	t.Cleanup(server.Close)
+	return server, last
+}
+
+func TestNewAPI(t *testing.T) {
+	assert.Equal(t, "http://localhost:8080", NewAPI("localhost:8080", "alice").BaseURL)
+	assert.Equal(t, "https://chat.example.com", NewAPI("https://chat.example.com/", "alice").BaseURL)
+}
+
+func TestAPIHistory(t *testing.T) {
+	server, last := newTestServer(t, http.StatusOK, HistoryResponse{
+		Chat:       "team dev",
+		Messages:   []Message{{ID: 1, Username: "bob", Body: "привет"}},
+		LastReadID: 1,
+	})
+
+	history, err := NewAPI(server.URL, "alice&bob").History("team dev", 20)
+	require.NoError(t, err)
+
+	assert.Equal(t, "/v1/chats/history", last.path)
+	assert.Equal(t, "chat=team+dev&limit=20&user=alice%26bob", last.query)
+	require.Len(t, history.Messages, 1)
+	assert.Equal(t, "team dev", history.Messages[0].ChatName)
+	assert.Equal(t, int64(1), history.LastReadID)
+}
+
+func TestAPISearch(t *testing.T) {
+	server, last := newTestServer(t, http.StatusOK, SearchResponse{
+		Query:   "релиз",
+		Results: []SearchResult{{Chat: "team", Message: Message{ID: 4, Body: "релиз"}}},
+	})
+
+	from := time.Date(2025, 5, 24, 0, 0, 0, 0, time.UTC)
+	result, err := NewAPI(server.URL, "alice").Search(SearchQuery{
+		Text:   "релиз",
+		Chats:  []string{"team", "random"},
+		Author: "bob",
+		From:   from,
+		Limit:  10,
+	})
+	require.NoError(t, err)
+
+	assert.Equal(t, "/v1/search", last.path)
+	assert.Contains(t, last.query, "chat=team&chat=random")
+	assert.Contains(t, last.query, "author=bob")
+	assert.Contains(t, last.query, "from=2025-05-24T00%3A00%3A00Z")
+	require.Len(t, result.Results, 1)
+	assert.Equal(t, "team", result.Results[0].Message.ChatName)
+}
+
+func TestAPIRequests(t *testing.T) {
+	tests := []struct {
+		name       string
+		call       func(api *API) error
+		wantMethod string
+		wantPath   string
+		wantQuery  string
+		wantBody   string
+	}{
+		{
+			name:       "Список чатов",
+			call:       func(api *API) error { _, err := api.Chats(); return err },
+			wantMethod: http.MethodGet,
+			wantPath:   "/v1/chats",
+			wantQuery:  "user=alice",
+		},
+		{
+			name: "Догрузка пропущенных",
+			call: func(api *API) error {
+				_, err := api.HistorySince("general", time.Date(2025, 5, 24, 12, 0, 0, 5, time.UTC), 500)
+				return err
+			},
+			wantMethod: http.MethodGet,
+			wantPath:   "/v1/chats/history",
+			wantQuery:  "chat=general&limit=500&since=2025-05-24T12%3A00%3A00.000000005Z",
+		},
+		{
+			name: "Более ранняя история",
+			call: func(api *API) error {
+				_, err := api.HistoryBefore("general", 42, 20)
+				return err
+			},
+			wantMethod: http.MethodGet,
+			wantPath:   "/v1/chats/history",
+			wantQuery:  "before=42&chat=general&limit=20",
+		},
+		{
+			name:       "Участники в сети",
+			call:       func(api *API) error { _, err := api.Members("general", true); return err },
+			wantMethod: http.MethodGet,
+			wantPath:   "/v1/chats/general/members",
+			wantQuery:  "online=true",
+		},
+		{
+			name:       "Отметка прочтения",
+			call:       func(api *API) error { return api.MarkRead("general", 5) },
+			wantMethod: http.MethodPut,
+			wantPath:   "/v1/chats/general/read",
+			wantQuery:  "user=alice",
+			wantBody:   `{"message_id":5}`,
+		},
+		{
+			name:       "Упоминания",
+			call:       func(api *API) error { _, err := api.Mentions(7); return err },
+			wantMethod: http.MethodGet,
+			wantPath:   "/v1/mentions",
+			wantQuery:  "after=7&user=alice",
+		},
+		{
+			name:       "Закрепление",
+			call:       func(api *API) error { return api.Pin("general", 3) },
+			wantMethod: http.MethodPut,
+			wantPath:   "/v1/chats/general/pins/3",
+			wantQuery:  "user=alice",
+		},
+		{
+			name:       "Открепление",
+			call:       func(api *API) error { return api.Unpin("general", 3) },
+			wantMethod: http.MethodDelete,
+			wantPath:   "/v1/chats/general/pins/3",
+		},
+		{
+			name:       "Тема чата с пробелом в названии",
+			call:       func(api *API) error { return api.SetTopic("team dev", "релиз") },
+			wantMethod: http.MethodPut,
+			wantPath:   "/v1/chats/team%20dev/topic",
+			wantQuery:  "user=alice",
+			wantBody:   `{"topic":"релиз"}`,
+		},
+		{
+			name: "Изменение сообщения",
+			call: func(api *API) error {
+				_, err := api.EditMessage("dm:alice:bob", 3, "привет")
+				return err
+			},
+			wantMethod: http.MethodPut,
+			wantPath:   "/v1/chats/dm:alice:bob/messages/3",
+			wantQuery:  "user=alice",
+			wantBody:   `{"body":"привет"}`,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			server, last := newTestServer(t, http.StatusOK, map[string]interface{}{})
+
+			require.NoError(t, tt.call(NewAPI(server.URL, "alice")))
+			assert.Equal(t, tt.wantMethod, last.method)
+			assert.Equal(t, tt.wantPath, last.path)
+			assert.Equal(t, tt.wantQuery, last.query)
+			assert.Equal(t, tt.wantBody, last.body)
+		})
+	}
+}
+
+func TestAPIUpload(t *testing.T) {
+	var filename, content string
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		assert.Equal(t, "/v1/uploads", r.URL.Path)
+		file, header, err := r.FormFile("file")
+		if !assert.NoError(t, err) {
+			return
+		}
+		data, _ := io.ReadAll(file)
+		filename, content = header.Filename, string(data)
+		w.WriteHeader(http.StatusCreated)
+		json.NewEncoder(w).Encode(UploadResponse{Name: "abc.png", URL: "/v1/uploads/abc.png"})
+	}))
+	defer server.Close()
+
+	url, err := NewAPI(server.URL, "alice").Upload("/tmp/снимок.png", strings.NewReader("картинка"))
+	require.NoError(t, err)
+	assert.Equal(t, server.URL+"/v1/uploads/abc.png", url)
+	assert.Equal(t, "снимок.png", filename)
+	assert.Equal(t, "картинка", content)
+}
+
+func TestAPISession(t *testing.T) {
+	var tokens []string
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		tokens = append(tokens, r.Header.Get("Authorization"))
+		switch r.URL.Path {
+		case "/v1/auth/login":
+			var body map[string]string
+			json.NewDecoder(r.Body).Decode(&body)
+			if body["password"] != "пароль123" {
+				w.WriteHeader(http.StatusUnauthorized)
+				json.NewEncoder(w).Encode(map[string]string{"error": "invalid username or password"})
+				return
+			}
+			json.NewEncoder(w).Encode(Session{User: User{Username: body["username"]}, AccessToken: "a1", RefreshToken: "r1"})
+		case "/v1/profile":
+			if r.Header.Get("Authorization") != "Bearer a2" {
+				w.WriteHeader(http.StatusUnauthorized)
+				return
+			}
+			json.NewEncoder(w).Encode(User{Username: "alice", DisplayName: "Алиса"})
+		}
+	}))
+	defer server.Close()
+
+	api := NewAPI(server.URL, "alice")
+	_, err := api.Login("alice", "неверный")
+	var apiErr *APIError
+	require.ErrorAs(t, err, &apiErr)
+	assert.Equal(t, http.StatusUnauthorized, apiErr.StatusCode)
+
+	session, err := api.Login("alice", "пароль123")
+	require.NoError(t, err)
+	assert.Equal(t, "alice", session.User.Username)
+	assert.Equal(t, "r1", session.RefreshToken)
+
+	api.Token = session.AccessToken
+	var expired []string
+	api.Reauth = func(token string) (string, error) {
+		expired = append(expired, token)
+		return "a2", nil
+	}
+	user, err := api.Profile()
+	require.NoError(t, err)
+	assert.Equal(t, "Алиса", user.Name())
+	assert.Equal(t, []string{"a1"}, expired, "отвергнутый токен обновлен")
+	assert.Equal(t, []string{"", "", "Bearer a1", "Bearer a2"}, tokens, "вход — без токена")
+
+	api.Reauth = func(string) (string, error) { return "", errors.New("сеанс истек") }
+	_, err = api.Profile()
+	assert.EqualError(t, err, "сеанс истек")
+}
+
+func TestAPIErrorStatus(t *testing.T) {
+	server, _ := newTestServer(t, http.StatusNotFound, map[string]string{"error": "message not found"})
+
+	err := NewAPI(server.URL, "alice").Unpin("general", 42)
+	assert.EqualError(t, err, "сервер вернул статус 404: message not found")
+
+	var apiErr *APIError
+	require.ErrorAs(t, err, &apiErr)
+	assert.Equal(t, http.StatusNotFound, apiErr.StatusCode)
+	assert.False(t, apiErr.Temporary())
+}
+
+func TestAPIRetry(t *testing.T) {
+	tests := []struct {
+		name         string
+		statuses     []int
+		wantAttempts int
+		wantStatus   int
+	}{
+		{
+			name:         "Повтор после 5xx",
+			statuses:     []int{http.StatusBadGateway, http.StatusServiceUnavailable, http.StatusOK},
+			wantAttempts: 3,
+		},
+		{
+			name:         "Попытки закончились",
+			statuses:     []int{http.StatusInternalServerError, http.StatusInternalServerError, http.StatusInternalServerError},
+			wantAttempts: 3,
+			wantStatus:   http.StatusInternalServerError,
+		},
+		{
+			name:         "4xx не повторяется",
+			statuses:     []int{http.StatusBadRequest, http.StatusOK},
+			wantAttempts: 1,
+			wantStatus:   http.StatusBadRequest,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			attempts := 0
+			server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				w.WriteHeader(tt.statuses[attempts])
+				attempts++
+				w.Write([]byte(`{"chats": []}`))
+			}))
+			t.Cleanup(server.Close)
+
+			api := NewAPI(server.URL, "alice")
+			api.RetryDelay = time.Millisecond
+			_, err := api.Chats()
+
+			assert.Equal(t, tt.wantAttempts, attempts)
+			if tt.wantStatus == 0 {
+				assert.NoError(t, err)
+				return
+			}
+			var apiErr *APIError
+			require.ErrorAs(t, err, &apiErr)
+			assert.Equal(t, tt.wantStatus, apiErr.StatusCode)
+		})
+	}
+}
+
+func TestNewHTTPClient(t *testing.T) {
+	server := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte(`{"chats": []}`))
+	}))
+	t.Cleanup(server.Close)
+
+	dir := t.TempDir()
+	caFile := filepath.Join(dir, "ca.pem")
+	certPEM := pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: server.Certificate().Raw})
+	require.NoError(t, os.WriteFile(caFile, certPEM, 0o600))
+
+	api := NewAPI(server.URL, "alice")
+	api.Retries = 0
+	_, err := api.Chats()
+	assert.Error(t, err, "без сертификата сервер не должен приниматься")
+
+	api.HTTP, err = NewHTTPClient(caFile, time.Second)
+	require.NoError(t, err)
+	_, err = api.Chats()
+	assert.NoError(t, err)
+
+	emptyFile := filepath.Join(dir, "empty.pem")
+	require.NoError(t, os.WriteFile(emptyFile, []byte("не сертификат"), 0o600))
+	_, err = NewHTTPClient(emptyFile, 0)
+	assert.Error(t, err)
+}
@@ -0,0 +1,720 @@
+package bunnychat
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"strconv"
+	"sync"
+	"time"
+
+	amqp "github.com/rabbitmq/amqp091-go"
+)
+
+const (
+	DefaultHeartbeatInterval = 15 * time.Second
+	DefaultTypingInterval    = 3 * time.Second
+	DefaultMinBackoff        = time.Second
+	DefaultMaxBackoff        = 30 * time.Second
+
+	publishTimeout = 5 * time.Second
+	eventsBuffer   = 64
+	backfillLimit  = 500
+)
+
+var (
+	ErrClosed         = errors.New("клиент закрыт")
+	ErrConnectionLost = errors.New("соединение с RabbitMQ потеряно")
+)
+
+// Channel — часть *amqp.Channel, которой пользуется клиент. Выделена в
+// интерфейс, чтобы в тестах подменять брокер.
+type Channel interface {
+	ExchangeDeclare(name, kind string, durable, autoDelete, internal, noWait bool, args amqp.Table) error
+	QueueDeclare(name string, durable, autoDelete, exclusive, noWait bool, args amqp.Table) (amqp.Queue, error)
+	QueueBind(name, key, exchange string, noWait bool, args amqp.Table) error
+	QueueUnbind(name, key, exchange string, args amqp.Table) error
+	Consume(queue, consumer string, autoAck, exclusive, noLocal, noWait bool, args amqp.Table) (<-chan amqp.Delivery, error)
+	PublishWithContext(ctx context.Context, exchange, key string, mandatory, immediate bool, msg amqp.Publishing) error
+	Close() error
+}
+
+type Connection interface {
+	Channel() (Channel, error)
+	NotifyClose(receiver chan *amqp.Error) chan *amqp.Error
+	Close() error
+}
+
+type amqpConnection struct {
+	*amqp.Connection
+}
+
+func (c amqpConnection) Channel() (Channel, error) {
+	return c.Connection.Channel()
+}
+
+// DialAMQP — подключение к настоящему RabbitMQ, используется по умолчанию.
+func DialAMQP(url string) (Connection, error) {
+	conn, err := amqp.Dial(url)
+	if err != nil {
+		return nil, err
+	}
+	return amqpConnection{conn}, nil
+}
+
+type Config struct {
+	URL      string
+	Username string
+
+	HeartbeatInterval time.Duration
+	TypingInterval    time.Duration
+
+	// Пауза между попытками переподключения растет от MinBackoff до
+	// MaxBackoff.
+	MinBackoff time.Duration
+	MaxBackoff time.Duration
+
+	// API нужен, чтобы после переподключения догрузить сообщения,
+	// пропущенные за время обрыва. Без него догрузки нет.
+	API *API
+
+	// Dial по умолчанию — DialAMQP.
+	Dial func(url string) (Connection, error)
+}
+
+// session — одно подключение к брокеру с очередью клиента. После обрыва
+// создается заново.
+type session struct {
+	conn       Connection
+	ch         Channel
+	queue      string
+	deliveries <-chan amqp.Delivery
+	closed     chan *amqp.Error
+}
+
+func (s *session) close() {
+	s.ch.Close()
+	s.conn.Close()
+}
+
+// Client держит подключение к RabbitMQ и одну очередь, к которой
+// привязаны все открытые чаты. Входящие сообщения и события набора текста
+// приходят в Events; канал закрывается вместе с клиентом.
+//
+// При обрыве связи клиент переподключается сам: заново привязывает чаты,
+// отправляет сообщения, набранные без связи, и догружает пропущенные.
+type Client struct {
+	cfg Config
+
+	mu         sync.Mutex
+	session    *session
+	chats      []string
+	lastSeen   map[string]time.Time
+	lastTyping map[string]time.Time
+	outbox     []Message
+
+	// backfilled — сообщения, уже выданные при догрузке; если они придут
+	// еще и из очереди, второй раз их не показываем. Только для run.
+	backfilled map[string]bool
+
+	events    chan Event
+	done      chan struct{}
+	retry     chan struct{}
+	closeOnce sync.Once
+}
+
+func Connect(cfg Config) (*Client, error) {
+	if cfg.HeartbeatInterval <= 0 {
+		cfg.HeartbeatInterval = DefaultHeartbeatInterval
+	}
+	if cfg.TypingInterval <= 0 {
+		cfg.TypingInterval = DefaultTypingInterval
+	}
+	if cfg.MinBackoff <= 0 {
+		cfg.MinBackoff = DefaultMinBackoff
+	}
+	if cfg.MaxBackoff < cfg.MinBackoff {
+		cfg.MaxBackoff = DefaultMaxBackoff
+	}
+	if cfg.Dial == nil {
+		cfg.Dial = DialAMQP
+	}
+
+	c := &Client{
+		cfg:        cfg,
+		lastSeen:   make(map[string]time.Time),
+		lastTyping: make(map[string]time.Time),
+		events:     make(chan Event, eventsBuffer),
+		done:       make(chan struct{}),
+		retry:      make(chan struct{}, 1),
+	}
+
+	s, err := c.dial()
+	if err != nil {
+		return nil, err
+	}
+	c.session = s
+
+	go c.run(s)
+	go c.heartbeat()
+
+	return c, nil
+}
+
+func (c *Client) dial() (*session, error) {
+	conn, err := c.cfg.Dial(c.cfg.URL)
+	if err != nil {
+		return nil, fmt.Errorf("ошибка подключения к RabbitMQ: %w", err)
+	}
+
+	ch, err := conn.Channel()
+	if err != nil {
+		conn.Close()
+		return nil, fmt.Errorf("ошибка создания канала: %w", err)
+	}
+
+	s := &session{
+		conn:   conn,
+		ch:     ch,
+		closed: conn.NotifyClose(make(chan *amqp.Error, 1)),
+	}
+	if err := s.setup(); err != nil {
+		s.close()
+		return nil, err
+	}
+
+	return s, nil
+}
+
+func (s *session) setup() error {
+	if err := s.ch.ExchangeDeclare(ExchangeName, "topic", true, false, false, false, nil); err != nil {
+		return fmt.Errorf("ошибка объявления exchange: %w", err)
+	}
+
+	q, err := s.ch.QueueDeclare("", false, true, true, false, nil)
+	if err != nil {
+		return fmt.Errorf("ошибка создания очереди: %w", err)
+	}
+	s.queue = q.Name
+
+	s.deliveries, err = s.ch.Consume(q.Name, "", true, false, false, false, nil)
+	if err != nil {
+		return fmt.Errorf("ошибка подписки на сообщения: %w", err)
+	}
+
+	return nil
+}
+
+func (s *session) bind(chatName string) error {
+	for _, key := range []string{MessageKey(chatName), TypingKey(chatName), EditKey(chatName)} {
+		if err := s.ch.QueueBind(s.queue, key, ExchangeName, false, nil); err != nil {
+			return fmt.Errorf("ошибка привязки очереди: %w", err)
+		}
+	}
+	return nil
+}
+
+func (s *session) unbind(chatName string) error {
+	for _, key := range []string{MessageKey(chatName), TypingKey(chatName), EditKey(chatName)} {
+		if err := s.ch.QueueUnbind(s.queue, key, ExchangeName, nil); err != nil {
+			return fmt.Errorf("ошибка отвязки очереди: %w", err)
+		}
+	}
+	return nil
+}
+
+func (c *Client) Username() string {
+	return c.cfg.Username
+}
+
+func (c *Client) Events() <-chan Event {
+	return c.events
+}
+
+// Connected сообщает, есть ли сейчас связь с брокером.
+func (c *Client) Connected() bool {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.session != nil
+}
+
+// Pending — сколько сообщений ждут отправки до восстановления связи.
+func (c *Client) Pending() int {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return len(c.outbox)
+}
+
+// Chats возвращает открытые чаты в порядке входа.
+func (c *Client) Chats() []string {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return append([]string(nil), c.chats...)
+}
+
+func (c *Client) joined(chatName string) bool {
+	for _, name := range c.chats {
+		if name == chatName {
+			return true
+		}
+	}
+	return false
+}
+
+// Join подписывает очередь на сообщения и события набора чата и
+// сообщает серверу о присутствии. Повторный вход ничего не делает. Без
+// связи чат просто запоминается и будет привязан при переподключении.
+func (c *Client) Join(chatName string) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if c.isClosed() {
+		return ErrClosed
+	}
+	if c.joined(chatName) {
+		return nil
+	}
+
+	if c.session != nil {
+		if err := c.session.bind(chatName); err != nil {
+			return err
+		}
+		if err := c.publishPresence(chatName, PresenceJoin); err != nil {
+			log.Printf("Ошибка отправки статуса присутствия: %v", err)
+		}
+	}
+	c.chats = append(c.chats, chatName)
+	c.lastSeen[chatName] = time.Now()
+
+	return nil
+}
+
+func (c *Client) Leave(chatName string) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if c.isClosed() {
+		return ErrClosed
+	}
+	if !c.joined(chatName) {
+		return nil
+	}
+
+	if c.session != nil {
+		if err := c.session.unbind(chatName); err != nil {
+			return err
+		}
+		if err := c.publishPresence(chatName, PresenceLeave); err != nil {
+			log.Printf("Ошибка отправки статуса присутствия: %v", err)
+		}
+	}
+	for i, name := range c.chats {
+		if name == chatName {
+			c.chats = append(c.chats[:i], c.chats[i+1:]...)
+			break
+		}
+	}
+	delete(c.lastSeen, chatName)
+	delete(c.lastTyping, chatName)
+
+	return nil
+}
+
+// Send отправляет сообщение в чат. Если связи нет или отправка не
+// удалась, сообщение встает в очередь и уйдет после переподключения;
+// порядок сообщений сохраняется. Неудачная отправка рвет подключение,
+// чтобы очередь не ждала обрыва, которого может и не быть.
+func (c *Client) Send(chatName, text string) error {
+	msg := Message{
+		Username:  c.cfg.Username,
+		Body:      text,
+		Timestamp: time.Now(),
+		ChatName:  chatName,
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if c.isClosed() {
+		return ErrClosed
+	}
+
+	if c.session != nil && len(c.outbox) == 0 {
+		err := c.publishJSON(MessageKey(chatName), msg)
+		if err == nil {
+			return nil
+		}
+		log.Printf("Ошибка отправки сообщения, повторим после переподключения: %v", err)
+		c.dropSession()
+	}
+	c.outbox = append(c.outbox, msg)
+
+	return nil
+}
+
+// SendTyping сообщает собеседникам, что пользователь набирает текст.
+// Вызовы чаще TypingInterval для одного чата игнорируются, поэтому его
+// можно дергать на каждое нажатие клавиши. Без связи событие теряется.
+func (c *Client) SendTyping(chatName string) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if c.session == nil || time.Since(c.lastTyping[chatName]) < c.cfg.TypingInterval {
+		return nil
+	}
+	c.lastTyping[chatName] = time.Now()
+
+	event := TypingEvent{
+		Username:  c.cfg.Username,
+		ChatName:  chatName,
+		Timestamp: time.Now(),
+	}
+	if err := c.publishJSON(TypingKey(chatName), event); err != nil {
+		return fmt.Errorf("ошибка отправки события набора: %w", err)
+	}
+	return nil
+}
+
+// SendEdit сообщает подписчикам чата, что текст сообщения изменен. Само
+// изменение сохраняет API.EditMessage; без связи событие теряется, и
+// собеседники увидят новый текст, когда загрузят историю.
+func (c *Client) SendEdit(edit EditEvent) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if c.session == nil {
+		return nil
+	}
+	if err := c.publishJSON(EditKey(edit.ChatName), edit); err != nil {
+		return fmt.Errorf("ошибка отправки изменения сообщения: %w", err)
+	}
+	return nil
+}
+
+// dropSession закрывает текущее подключение; run увидит обрыв и
+// переподключится. Вызывается под c.mu.
+func (c *Client) dropSession() {
+	if c.session != nil {
+		c.session.close()
+		c.session = nil
+	}
+}
+
+// publishPresence и publishJSON вызываются под c.mu.
+func (c *Client) publishPresence(chatName, status string) error {
+	return c.publishJSON(PresenceKey(chatName), PresenceEvent{
+		Username:  c.cfg.Username,
+		ChatName:  chatName,
+		Status:    status,
+		Timestamp: time.Now(),
+	})
+}
+
+func (c *Client) publishJSON(routingKey string, v interface{}) error {
+	if c.session == nil {
+		return ErrConnectionLost
+	}
+
+	body, err := json.Marshal(v)
+	if err != nil {
+		return fmt.Errorf("ошибка сериализации: %w", err)
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), publishTimeout)
+	defer cancel()
+
+	return c.session.ch.PublishWithContext(ctx, ExchangeName, routingKey, false, false, amqp.Publishing{
+		ContentType: "application/json",
+		Body:        body,
+	})
+}
+
+func (c *Client) heartbeat() {
+	ticker := time.NewTicker(c.cfg.HeartbeatInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ticker.C:
+			c.mu.Lock()
+			if c.session != nil {
+				for _, chatName := range c.chats {
+					if err := c.publishPresence(chatName, PresenceHeartbeat); err != nil {
+						log.Printf("Ошибка отправки статуса присутствия: %v", err)
+					}
+				}
+			}
+			c.mu.Unlock()
+		case <-c.done:
+			return
+		}
+	}
+}
+
+// run читает очередь текущего подключения, а после обрыва
+// переподключается и догружает пропущенное.
+func (c *Client) run(s *session) {
+	defer close(c.events)
+
+	for {
+		err := c.consume(s)
+		if c.isClosed() {
+			return
+		}
+
+		c.mu.Lock()
+		c.session = nil
+		c.mu.Unlock()
+		s.close()
+
+		log.Printf("%v, переподключение…", err)
+		if !c.emit(Event{Type: EventDisconnected, Err: err}) {
+			return
+		}
+
+		s = c.reconnect()
+		if s == nil {
+			return
+		}
+		if !c.emit(Event{Type: EventReconnected}) {
+			return
+		}
+		c.backfill()
+	}
+}
+
+// consume возвращает причину обрыва или nil, если клиент закрыт.
+func (c *Client) consume(s *session) error {
+	for {
+		select {
+		case d, ok := <-s.deliveries:
+			if !ok {
+				return ErrConnectionLost
+			}
+			if !c.handle(d) {
+				return nil
+			}
+		case amqpErr := <-s.closed:
+			if amqpErr != nil {
+				return fmt.Errorf("%w: %v", ErrConnectionLost, amqpErr)
+			}
+			return ErrConnectionLost
+		case <-c.done:
+			return nil
+		}
+	}
+}
+
+// handle раскладывает доставку по событиям. Свои события набора текста
+// отбрасываются, а при переполненном буфере теряются только они:
+// сообщения и изменения ждут, пока их прочитают.
+func (c *Client) handle(d amqp.Delivery) bool {
+	event, err := DecodeEvent(d.RoutingKey, d.Body)
+	if err != nil {
+		log.Printf("%v", err)
+		return true
+	}
+
+	if event.Type == EventTyping {
+		if event.Typing.Username != c.cfg.Username {
+			select {
+			case c.events <- event:
+			default:
+			}
+		}
+		return true
+	}
+	if event.Type == EventEdited {
+		return c.emit(event)
+	}
+
+	key := backfillKey(event.Chat, event.Message)
+	if c.backfilled[key] {
+		delete(c.backfilled, key)
+		return true
+	}
+	c.markSeen(event.Chat, event.Message.Timestamp)
+
+	return c.emit(event)
+}
+
+func (c *Client) emit(event Event) bool {
+	select {
+	case c.events <- event:
+		return true
+	case <-c.done:
+		return false
+	}
+}
+
+func (c *Client) markSeen(chatName string, ts time.Time) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if seen, ok := c.lastSeen[chatName]; ok && ts.After(seen) {
+		c.lastSeen[chatName] = ts
+	}
+}
+
+func backfillKey(chatName string, msg Message) string {
+	return chatName + "\x00" + msg.Username + "\x00" + strconv.FormatInt(msg.Timestamp.UnixNano(), 10)
+}
+
+// RetryNow прерывает паузу между попытками переподключения: следующая
+// попытка начнется сразу, а пауза снова станет минимальной. Если связь
+// есть, ничего не делает.
+func (c *Client) RetryNow() {
+	if c.Connected() {
+		return
+	}
+	select {
+	case c.retry <- struct{}{}:
+	default:
+	}
+}
+
+// reconnect пытается подключиться заново, увеличивая паузу между
+// попытками. Возвращает nil, если клиент закрыли.
+func (c *Client) reconnect() *session {
+	backoff := c.cfg.MinBackoff
+	for {
+		timer := time.NewTimer(backoff)
+		select {
+		case <-timer.C:
+		case <-c.retry:
+			timer.Stop()
+			backoff = c.cfg.MinBackoff
+		case <-c.done:
+			timer.Stop()
+			return nil
+		}
+
+		s, err := c.dial()
+		if err == nil {
+			if err = c.resume(s); err == nil {
+				log.Printf("Соединение с RabbitMQ восстановлено")
+				return s
+			}
+			s.close()
+		}
+		if c.isClosed() {
+			return nil
+		}
+		log.Printf("Ошибка переподключения к RabbitMQ: %v", err)
+
+		backoff *= 2
+		if backoff > c.cfg.MaxBackoff {
+			backoff = c.cfg.MaxBackoff
+		}
+	}
+}
+
+// resume привязывает к новой очереди все открытые чаты и отправляет
+// накопленные сообщения. Если отправить их не удалось, подключение
+// бракуется, а неотправленные остаются в очереди до следующей попытки.
+func (c *Client) resume(s *session) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if c.isClosed() {
+		return ErrClosed
+	}
+	for _, chatName := range c.chats {
+		if err := s.bind(chatName); err != nil {
+			return err
+		}
+	}
+
+	c.session = s
+	for _, chatName := range c.chats {
+		if err := c.publishPresence(chatName, PresenceJoin); err != nil {
+			log.Printf("Ошибка отправки статуса присутствия: %v", err)
+		}
+	}
+	for len(c.outbox) > 0 {
+		msg := c.outbox[0]
+		if err := c.publishJSON(MessageKey(msg.ChatName), msg); err != nil {
+			c.session = nil
+			return fmt.Errorf("ошибка отправки отложенного сообщения: %w", err)
+		}
+		c.outbox = c.outbox[1:]
+	}
+
+	return nil
+}
+
+// backfill догружает с сервера сообщения, пришедшие в открытые чаты
+// после последнего полученного, страницами по backfillLimit — от самых
+// ранних к новым, пока не придет неполная страница.
+func (c *Client) backfill() {
+	if c.cfg.API == nil {
+		return
+	}
+
+	c.mu.Lock()
+	since := make(map[string]time.Time, len(c.lastSeen))
+	for chatName, ts := range c.lastSeen {
+		since[chatName] = ts
+	}
+	chats := append([]string(nil), c.chats...)
+	c.mu.Unlock()
+
+	c.backfilled = make(map[string]bool)
+	for _, chatName := range chats {
+		history, err := c.cfg.API.HistorySince(chatName, since[chatName], backfillLimit)
+		for err == nil {
+			for _, msg := range history.Messages {
+				c.backfilled[backfillKey(chatName, msg)] = true
+				c.markSeen(chatName, msg.Timestamp)
+				if !c.emit(Event{Type: EventMessage, Chat: chatName, Message: msg}) {
+					return
+				}
+			}
+			if len(history.Messages) < backfillLimit {
+				break
+			}
+			last := history.Messages[len(history.Messages)-1]
+			history, err = c.cfg.API.HistoryAfter(chatName, last.ID, backfillLimit)
+		}
+		if err != nil {
+			log.Printf("Ошибка догрузки пропущенных сообщений чата %s: %v", chatName, err)
+		}
+	}
+}
+
+func (c *Client) isClosed() bool {
+	select {
+	case <-c.done:
+		return true
+	default:
+		return false
+	}
+}
+
+// Close сообщает о выходе из всех чатов и закрывает подключение.
+// Неотправленные сообщения теряются.
+func (c *Client) Close() error {
+	c.closeOnce.Do(func() {
+		c.mu.Lock()
+		defer c.mu.Unlock()
+
+		if c.session != nil {
+			for _, chatName := range c.chats {
+				if err := c.publishPresence(chatName, PresenceLeave); err != nil {
+					log.Printf("Ошибка отправки статуса присутствия: %v", err)
+				}
+			}
+		}
+		if n := len(c.outbox); n > 0 {
+			log.Printf("Не отправлено сообщений: %d", n)
+		}
+
+		close(c.done)
+		if c.session != nil {
+			c.session.close()
+			c.session = nil
+		}
+	})
+	return nil
+}
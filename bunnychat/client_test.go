@@ -0,0 +1,324 @@
+package bunnychat
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func connectFake(t *testing.T) (*Client, *fakeChannel) {
+	client, broker := connectBroker(t, nil)
+	return client, broker.last().ch
+}
+
+func connectBroker(t *testing.T, api *API) (*Client, *fakeBroker) {
+	broker := &fakeBroker{}
+	client, err := Connect(Config{
+		URL:        "amqp://fake/",
+		Username:   "alice",
+		MinBackoff: 10 * time.Millisecond,
+		MaxBackoff: 40 * time.Millisecond,
+		API:        api,
+		Dial:       broker.dial,
+	})
+	require.NoError(t, err)
+	return client, broker
+}
+
+func receive(t *testing.T, client *Client) Event {
+	select {
+	case event, ok := <-client.Events():
+		require.True(t, ok, "канал событий закрыт")
+		return event
+	case <-time.After(time.Second):
+		t.Fatal("событие не пришло")
+		return Event{}
+	}
+}
+
+func TestJoinAndLeave(t *testing.T) {
+	client, ch := connectFake(t)
+	defer client.Close()
+
+	require.NoError(t, client.Join("general"))
+	require.NoError(t, client.Join("random"))
+	require.NoError(t, client.Join("general"))
+
+	assert.Equal(t, []string{"general", "random"}, client.Chats())
+	assert.Equal(t, map[string]bool{
+		"bunny.general":  true,
+		"typing.general": true,
+		"edit.general":   true,
+		"bunny.random":   true,
+		"typing.random":  true,
+		"edit.random":    true,
+	}, ch.bound())
+
+	require.NoError(t, client.Leave("general"))
+	assert.Equal(t, []string{"random"}, client.Chats())
+	assert.Equal(t, map[string]bool{
+		"bunny.random":  true,
+		"typing.random": true,
+		"edit.random":   true,
+	}, ch.bound())
+
+	assert.Equal(t, []string{
+		"presence.general",
+		"presence.random",
+		"presence.general",
+	}, ch.publishedKeys())
+}
+
+func TestSend(t *testing.T) {
+	client, ch := connectFake(t)
+	defer client.Close()
+
+	require.NoError(t, client.Send("general", "привет"))
+
+	require.Len(t, ch.published, 1)
+	assert.Equal(t, "bunny.general", ch.published[0].key)
+
+	var msg Message
+	require.NoError(t, json.Unmarshal(ch.published[0].body, &msg))
+	assert.Equal(t, "alice", msg.Username)
+	assert.Equal(t, "привет", msg.Body)
+	assert.Equal(t, "general", msg.ChatName)
+}
+
+func TestSendTypingRateLimit(t *testing.T) {
+	client, ch := connectFake(t)
+	defer client.Close()
+
+	require.NoError(t, client.SendTyping("general"))
+	require.NoError(t, client.SendTyping("general"))
+	require.NoError(t, client.SendTyping("random"))
+
+	assert.Equal(t, []string{"typing.general", "typing.random"}, ch.publishedKeys())
+}
+
+func TestEvents(t *testing.T) {
+	client, ch := connectFake(t)
+	defer client.Close()
+
+	ch.deliver("typing.general", []byte(`{"username":"alice","chat_name":"general"}`))
+	ch.deliver("bunny.general", []byte(`не json`))
+	ch.deliver("typing.general", []byte(`{"username":"bob","chat_name":"general"}`))
+	ch.deliver("bunny.general", []byte(`{"id":3,"username":"bob","body":"привет"}`))
+
+	event := receive(t, client)
+	assert.Equal(t, EventTyping, event.Type)
+	assert.Equal(t, "bob", event.Typing.Username)
+
+	event = receive(t, client)
+	assert.Equal(t, EventMessage, event.Type)
+	assert.Equal(t, "general", event.Chat)
+	assert.Equal(t, int64(3), event.Message.ID)
+	assert.Equal(t, "general", event.Message.ChatName)
+
+	require.NoError(t, client.SendEdit(EditEvent{ID: 3, Username: "alice", ChatName: "general", Body: "привет всем"}))
+	assert.Contains(t, ch.publishedKeys(), "edit.general")
+
+	ch.deliver("edit.general", []byte(`{"id":3,"username":"bob","body":"привет всем"}`))
+	event = receive(t, client)
+	assert.Equal(t, EventEdited, event.Type)
+	assert.Equal(t, int64(3), event.Edit.ID)
+	assert.Equal(t, "general", event.Edit.ChatName)
+	assert.Equal(t, "привет всем", event.Edit.Body)
+}
+
+func TestClose(t *testing.T) {
+	client, ch := connectFake(t)
+	require.NoError(t, client.Join("general"))
+
+	require.NoError(t, client.Close())
+	require.NoError(t, client.Close())
+
+	assert.Equal(t, []string{"presence.general", "presence.general"}, ch.publishedKeys())
+
+	select {
+	case _, ok := <-client.Events():
+		assert.False(t, ok)
+	case <-time.After(time.Second):
+		t.Fatal("канал событий не закрыт")
+	}
+
+	assert.ErrorIs(t, client.Send("general", "после закрытия"), ErrClosed)
+	assert.ErrorIs(t, client.Join("random"), ErrClosed)
+}
+
+func TestReconnectWithOutbox(t *testing.T) {
+	client, broker := connectBroker(t, nil)
+	defer client.Close()
+
+	require.NoError(t, client.Join("general"))
+	broker.fail(2)
+	broker.last().drop()
+
+	event := receive(t, client)
+	assert.Equal(t, EventDisconnected, event.Type)
+	assert.ErrorIs(t, event.Err, ErrConnectionLost)
+
+	require.NoError(t, client.Send("general", "первое"))
+	require.NoError(t, client.Send("general", "второе"))
+	assert.False(t, client.Connected())
+	assert.Equal(t, 2, client.Pending())
+
+	event = receive(t, client)
+	assert.Equal(t, EventReconnected, event.Type)
+	assert.True(t, client.Connected())
+	assert.Equal(t, 0, client.Pending())
+	assert.Equal(t, 4, broker.dialCount())
+
+	ch := broker.last().ch
+	assert.True(t, ch.bound()["bunny.general"])
+	assert.Equal(t, []string{"presence.general", "bunny.general", "bunny.general"}, ch.publishedKeys())
+
+	var first, second Message
+	require.NoError(t, json.Unmarshal(ch.published[1].body, &first))
+	require.NoError(t, json.Unmarshal(ch.published[2].body, &second))
+	assert.Equal(t, "первое", first.Body)
+	assert.Equal(t, "второе", second.Body)
+
+	ch.deliver("bunny.general", []byte(`{"username":"bob","body":"снова на связи"}`))
+	event = receive(t, client)
+	assert.Equal(t, "снова на связи", event.Message.Body)
+}
+
+func TestSendAfterPublishError(t *testing.T) {
+	client, broker := connectBroker(t, nil)
+	defer client.Close()
+
+	require.NoError(t, client.Join("general"))
+	broker.last().ch.failPublish(1)
+
+	require.NoError(t, client.Send("general", "первое"))
+	assert.Equal(t, EventDisconnected, receive(t, client).Type, "неудачная отправка рвет подключение")
+	require.NoError(t, client.Send("general", "второе"))
+
+	assert.Equal(t, EventReconnected, receive(t, client).Type)
+	require.NoError(t, client.Send("general", "третье"))
+	assert.Equal(t, 0, client.Pending())
+	assert.Equal(t, []string{"первое", "второе", "третье"}, broker.last().ch.publishedBodies("general"))
+}
+
+func TestReconnectBackfill(t *testing.T) {
+	missed := Message{
+		ID:        10,
+		Username:  "bob",
+		Body:      "пока вас не было",
+		Timestamp: time.Now().Add(time.Minute).Truncate(time.Millisecond),
+	}
+
+	var since string
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		since = r.URL.Query().Get("since")
+		json.NewEncoder(w).Encode(HistoryResponse{Chat: "general", Messages: []Message{missed}})
+	}))
+	defer server.Close()
+
+	client, broker := connectBroker(t, NewAPI(server.URL, "alice"))
+	defer client.Close()
+
+	require.NoError(t, client.Join("general"))
+	broker.last().drop()
+
+	assert.Equal(t, EventDisconnected, receive(t, client).Type)
+	assert.Equal(t, EventReconnected, receive(t, client).Type)
+
+	event := receive(t, client)
+	assert.Equal(t, EventMessage, event.Type)
+	assert.Equal(t, "пока вас не было", event.Message.Body)
+	assert.Equal(t, "general", event.Message.ChatName)
+	assert.NotEmpty(t, since)
+
+	live, err := json.Marshal(missed)
+	require.NoError(t, err)
+	ch := broker.last().ch
+	ch.deliver("bunny.general", live)
+	ch.deliver("bunny.general", []byte(`{"username":"bob","body":"новое"}`))
+
+	event = receive(t, client)
+	assert.Equal(t, "новое", event.Message.Body)
+}
+
+func TestReconnectBackfillPages(t *testing.T) {
+	base := time.Now().Add(time.Minute).Truncate(time.Millisecond)
+	missed := make([]Message, backfillLimit+1)
+	for i := range missed {
+		missed[i] = Message{
+			ID:        int64(i + 1),
+			Username:  "bob",
+			Body:      strconv.Itoa(i + 1),
+			Timestamp: base.Add(time.Duration(i) * time.Millisecond),
+		}
+	}
+
+	var mu sync.Mutex
+	var afters []string
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		page := missed[:backfillLimit]
+		if after := r.URL.Query().Get("after"); after != "" {
+			mu.Lock()
+			afters = append(afters, after)
+			mu.Unlock()
+			id, _ := strconv.Atoi(after)
+			page = missed[id:]
+		}
+		json.NewEncoder(w).Encode(HistoryResponse{Chat: "general", Messages: page})
+	}))
+	defer server.Close()
+
+	client, broker := connectBroker(t, NewAPI(server.URL, "alice"))
+	defer client.Close()
+
+	require.NoError(t, client.Join("general"))
+	broker.last().drop()
+
+	assert.Equal(t, EventDisconnected, receive(t, client).Type)
+	assert.Equal(t, EventReconnected, receive(t, client).Type)
+	for _, msg := range missed {
+		event := receive(t, client)
+		require.Equal(t, msg.Body, event.Message.Body, "пропущенное приходит по порядку, без пробелов")
+	}
+
+	mu.Lock()
+	defer mu.Unlock()
+	assert.Equal(t, []string{"500"}, afters, "после неполной страницы запросы прекращаются")
+}
+
+func TestRetryNow(t *testing.T) {
+	broker := &fakeBroker{}
+	client, err := Connect(Config{
+		URL:        "amqp://fake/",
+		Username:   "alice",
+		MinBackoff: time.Hour,
+		MaxBackoff: time.Hour,
+		Dial:       broker.dial,
+	})
+	require.NoError(t, err)
+	defer client.Close()
+
+	client.RetryNow()
+	assert.Equal(t, 1, broker.dialCount(), "при живой связи ничего не происходит")
+
+	require.NoError(t, client.Join("general"))
+	broker.fail(1)
+	broker.last().drop()
+	assert.Equal(t, EventDisconnected, receive(t, client).Type)
+
+	client.RetryNow()
+	assert.Eventually(t, func() bool { return broker.dialCount() == 2 }, time.Second, 5*time.Millisecond)
+	assert.False(t, client.Connected())
+
+	client.RetryNow()
+	assert.Equal(t, EventReconnected, receive(t, client).Type, "не ждем паузу в час")
+	assert.True(t, client.Connected())
+	assert.True(t, broker.last().ch.bound()["bunny.general"])
+}
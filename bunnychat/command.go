@@ -0,0 +1,44 @@
+package bunnychat
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// Command — команда, введенная вместо сообщения: "/topic Релиз в пятницу".
+type Command struct {
+	// Name — имя команды без косой черты.
+	Name string
+	// Args — аргументы, разделенные пробелами.
+	Args []string
+	// Text — все, что после имени команды, без пробелов по краям.
+	Text string
+}
+
+// ParseCommand разбирает строку, начинающуюся с "/". false — если это
+// обычное сообщение.
+func ParseCommand(line string) (Command, bool) {
+	line = strings.TrimSpace(line)
+	if !strings.HasPrefix(line, "/") {
+		return Command{}, false
+	}
+	fields := strings.Fields(line[1:])
+	if len(fields) == 0 || strings.HasPrefix(line, "/ ") {
+		return Command{}, false
+	}
+	return Command{
+		Name: fields[0],
+		Args: fields[1:],
+		Text: strings.TrimSpace(strings.TrimPrefix(line[1:], fields[0])),
+	}, true
+}
+
+// ParseMessageID разбирает id сообщения в команде: "12" или "#12".
+func ParseMessageID(text string) (int64, error) {
+	id, err := strconv.ParseInt(strings.TrimPrefix(text, "#"), 10, 64)
+	if err != nil || id < 1 {
+		return 0, fmt.Errorf("некорректный id сообщения: %s", text)
+	}
+	return id, nil
+}
@@ -0,0 +1,56 @@
+package bunnychat
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestParseCommand(t *testing.T) {
+	tests := []struct {
+		name   string
+		line   string
+		want   Command
+		wantOK bool
+	}{
+		{name: "Сообщение", line: "привет"},
+		{name: "Косая черта в середине", line: "и/или"},
+		{name: "Одна косая черта", line: "/"},
+		{name: "Пробел после косой черты", line: "/ привет"},
+		{
+			name:   "Без аргументов",
+			line:   "/pins",
+			want:   Command{Name: "pins", Args: []string{}},
+			wantOK: true,
+		},
+		{
+			name:   "С текстом",
+			line:   "  /topic  Релиз в пятницу ",
+			want:   Command{Name: "topic", Args: []string{"Релиз", "в", "пятницу"}, Text: "Релиз в пятницу"},
+			wantOK: true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			command, ok := ParseCommand(tt.line)
+			assert.Equal(t, tt.wantOK, ok)
+			assert.Equal(t, tt.want, command)
+		})
+	}
+}
+
+func TestParseMessageID(t *testing.T) {
+	id, err := ParseMessageID("#12")
+	assert.NoError(t, err)
+	assert.Equal(t, int64(12), id)
+
+	id, err = ParseMessageID("7")
+	assert.NoError(t, err)
+	assert.Equal(t, int64(7), id)
+
+	for _, text := range []string{"", "#", "0", "abc", "-3"} {
+		_, err := ParseMessageID(text)
+		assert.Error(t, err, text)
+	}
+}
@@ -0,0 +1,37 @@
+package bunnychat
+
+import "strings"
+
+// directPrefix начинает имя чата личной переписки: dm:<имя>:<имя>.
+// Двоеточие не может входить в имя пользователя, поэтому имена
+// участников разбираются однозначно.
+const directPrefix = "dm:"
+
+// DirectChat возвращает имя чата личной переписки двух пользователей. От
+// порядка аргументов оно не зависит.
+func DirectChat(a, b string) string {
+	if b < a {
+		a, b = b, a
+	}
+	return directPrefix + a + ":" + b
+}
+
+// DirectPeer возвращает собеседника username в чате личной переписки.
+// false — если чат не личный или username в нем не участвует.
+func DirectPeer(chatName, username string) (string, bool) {
+	names, ok := strings.CutPrefix(chatName, directPrefix)
+	if !ok {
+		return "", false
+	}
+	a, b, ok := strings.Cut(names, ":")
+	if !ok {
+		return "", false
+	}
+	switch username {
+	case a:
+		return b, true
+	case b:
+		return a, true
+	}
+	return "", false
+}
@@ -0,0 +1,99 @@
+package bunnychat
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strings"
+)
+
+const (
+	ExchangeName = "bunny.chats"
+
+	messagePrefix  = "bunny"
+	presencePrefix = "presence"
+	typingPrefix   = "typing"
+	editPrefix     = "edit"
+)
+
+var ErrUnknownEvent = errors.New("неизвестный тип события")
+
+type EventType int
+
+const (
+	EventMessage EventType = iota + 1
+	EventTyping
+	// EventDisconnected — связь с брокером потеряна, клиент
+	// переподключается. Причина — в Err.
+	EventDisconnected
+	EventReconnected
+	EventEdited
+)
+
+// Event — то, что клиент получает из очереди. Заполнено поле,
+// соответствующее Type.
+type Event struct {
+	Type    EventType
+	Chat    string
+	Message Message
+	Typing  TypingEvent
+	Edit    EditEvent
+	Err     error
+}
+
+func MessageKey(chatName string) string {
+	return messagePrefix + "." + chatName
+}
+
+func PresenceKey(chatName string) string {
+	return presencePrefix + "." + chatName
+}
+
+func TypingKey(chatName string) string {
+	return typingPrefix + "." + chatName
+}
+
+func EditKey(chatName string) string {
+	return editPrefix + "." + chatName
+}
+
+// DecodeEvent разбирает доставку по routing key: bunny.<чат> — сообщение,
+// typing.<чат> — событие набора текста, edit.<чат> — изменение сообщения.
+func DecodeEvent(routingKey string, body []byte) (Event, error) {
+	prefix, chatName, ok := strings.Cut(routingKey, ".")
+	if !ok || chatName == "" {
+		return Event{}, fmt.Errorf("%w: %s", ErrUnknownEvent, routingKey)
+	}
+
+	event := Event{Chat: chatName}
+	switch prefix {
+	case messagePrefix:
+		event.Type = EventMessage
+		if err := json.Unmarshal(body, &event.Message); err != nil {
+			return Event{}, fmt.Errorf("ошибка разбора сообщения: %w", err)
+		}
+		if event.Message.ChatName == "" {
+			event.Message.ChatName = chatName
+		}
+	case typingPrefix:
+		event.Type = EventTyping
+		if err := json.Unmarshal(body, &event.Typing); err != nil {
+			return Event{}, fmt.Errorf("ошибка разбора события набора: %w", err)
+		}
+		if event.Typing.ChatName == "" {
+			event.Typing.ChatName = chatName
+		}
+	case editPrefix:
+		event.Type = EventEdited
+		if err := json.Unmarshal(body, &event.Edit); err != nil {
+			return Event{}, fmt.Errorf("ошибка разбора изменения сообщения: %w", err)
+		}
+		if event.Edit.ChatName == "" {
+			event.Edit.ChatName = chatName
+		}
+	default:
+		return Event{}, fmt.Errorf("%w: %s", ErrUnknownEvent, routingKey)
+	}
+
+	return event, nil
+}
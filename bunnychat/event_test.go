@@ -0,0 +1,142 @@
+package bunnychat
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestDecodeEvent(t *testing.T) {
+	tests := []struct {
+		name       string
+		routingKey string
+		body       string
+		wantType   EventType
+		wantChat   string
+		wantErr    bool
+	}{
+		{
+			name:       "Сообщение",
+			routingKey: "bunny.general",
+			body:       `{"id":1,"username":"bob","body":"привет"}`,
+			wantType:   EventMessage,
+			wantChat:   "general",
+		},
+		{
+			name:       "Набор текста",
+			routingKey: "typing.random",
+			body:       `{"username":"bob"}`,
+			wantType:   EventTyping,
+			wantChat:   "random",
+		},
+		{
+			name:       "Изменение сообщения",
+			routingKey: "edit.general",
+			body:       `{"id":3,"username":"bob","body":"привет всем"}`,
+			wantType:   EventEdited,
+			wantChat:   "general",
+		},
+		{
+			name:       "Присутствие клиенту не нужно",
+			routingKey: "presence.general",
+			body:       `{"username":"bob","status":"join"}`,
+			wantErr:    true,
+		},
+		{
+			name:       "Ключ без чата",
+			routingKey: "bunny",
+			body:       `{}`,
+			wantErr:    true,
+		},
+		{
+			name:       "Некорректный JSON",
+			routingKey: "bunny.general",
+			body:       `{`,
+			wantErr:    true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			event, err := DecodeEvent(tt.routingKey, []byte(tt.body))
+			if tt.wantErr {
+				assert.Error(t, err)
+				return
+			}
+			assert.NoError(t, err)
+			assert.Equal(t, tt.wantType, event.Type)
+			assert.Equal(t, tt.wantChat, event.Chat)
+		})
+	}
+}
+
+func TestMentionsUser(t *testing.T) {
+	tests := []struct {
+		name string
+		body string
+		want bool
+	}{
+		{name: "Прямое упоминание", body: "@alice привет", want: true},
+		{name: "Упоминание в конце предложения", body: "спроси @alice.", want: true},
+		{name: "@here", body: "@here созвон", want: true},
+		{name: "@channel", body: "@channel релиз", want: true},
+		{name: "Другой пользователь", body: "@alicia привет", want: false},
+		{name: "Адрес почты", body: "bob@alice.com", want: false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			assert.Equal(t, tt.want, MentionsUser(tt.body, "alice"))
+		})
+	}
+}
+
+func TestMentionIndexes(t *testing.T) {
+	tests := []struct {
+		name string
+		body string
+		want []string
+	}{
+		{name: "Нет упоминаний", body: "привет всем"},
+		{name: "Несколько упоминаний", body: "@alice и @боб, гляньте", want: []string{"@alice", "@боб"}},
+		{name: "Пунктуация после имени", body: "спроси @alice.", want: []string{"@alice"}},
+		{name: "Адрес почты", body: "bob@alice.com", want: nil},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var got []string
+			for _, index := range MentionIndexes(tt.body) {
+				got = append(got, tt.body[index[0]:index[1]])
+			}
+			assert.Equal(t, tt.want, got)
+		})
+	}
+}
+
+func TestDirectChat(t *testing.T) {
+	assert.Equal(t, "dm:alice:bob", DirectChat("alice", "bob"))
+	assert.Equal(t, "dm:alice:bob", DirectChat("bob", "alice"), "порядок не важен")
+
+	tests := []struct {
+		name     string
+		chat     string
+		username string
+		want     string
+		wantOK   bool
+	}{
+		{name: "Собеседник первый", chat: "dm:alice:bob", username: "bob", want: "alice", wantOK: true},
+		{name: "Собеседник второй", chat: "dm:alice:bob", username: "alice", want: "bob", wantOK: true},
+		{name: "Чужая переписка", chat: "dm:alice:bob", username: "carol"},
+		{name: "Обычный канал", chat: "general", username: "alice"},
+		{name: "Неполное имя", chat: "dm:alice", username: "alice"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, ok := DirectPeer(tt.chat, tt.username)
+			assert.Equal(t, tt.wantOK, ok)
+			assert.Equal(t, tt.want, got)
+		})
+	}
+}
@@ -0,0 +1,202 @@
+package bunnychat
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"sync"
+
+	amqp "github.com/rabbitmq/amqp091-go"
+)
+
+type published struct {
+	key  string
+	body []byte
+}
+
+// fakeChannel запоминает привязки и публикации вместо брокера. Доставки
+// в очередь тест отправляет сам через deliver.
+type fakeChannel struct {
+	mu         sync.Mutex
+	bindings   map[string]bool
+	published  []published
+	deliveries chan amqp.Delivery
+	closed     bool
+	// failPublishes — сколько следующих публикаций завершатся ошибкой.
+	failPublishes int
+}
+
+func newFakeChannel() *fakeChannel {
+	return &fakeChannel{
+		bindings:   make(map[string]bool),
+		deliveries: make(chan amqp.Delivery, 16),
+	}
+}
+
+func (f *fakeChannel) ExchangeDeclare(name, kind string, durable, autoDelete, internal, noWait bool, args amqp.Table) error {
+	return nil
+}
+
+func (f *fakeChannel) QueueDeclare(name string, durable, autoDelete, exclusive, noWait bool, args amqp.Table) (amqp.Queue, error) {
+	return amqp.Queue{Name: "fake-queue"}, nil
+}
+
+func (f *fakeChannel) QueueBind(name, key, exchange string, noWait bool, args amqp.Table) error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.bindings[key] = true
+	return nil
+}
+
+func (f *fakeChannel) QueueUnbind(name, key, exchange string, args amqp.Table) error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	delete(f.bindings, key)
+	return nil
+}
+
+func (f *fakeChannel) Consume(queue, consumer string, autoAck, exclusive, noLocal, noWait bool, args amqp.Table) (<-chan amqp.Delivery, error) {
+	return f.deliveries, nil
+}
+
+func (f *fakeChannel) PublishWithContext(ctx context.Context, exchange, key string, mandatory, immediate bool, msg amqp.Publishing) error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if f.closed {
+		return amqp.ErrClosed
+	}
+	if f.failPublishes > 0 {
+		f.failPublishes--
+		return errors.New("publish timeout")
+	}
+	f.published = append(f.published, published{key: key, body: msg.Body})
+	return nil
+}
+
+func (f *fakeChannel) Close() error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if !f.closed {
+		f.closed = true
+		close(f.deliveries)
+	}
+	return nil
+}
+
+func (f *fakeChannel) deliver(key string, body []byte) {
+	f.deliveries <- amqp.Delivery{RoutingKey: key, Body: body}
+}
+
+func (f *fakeChannel) bound() map[string]bool {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	result := make(map[string]bool, len(f.bindings))
+	for k, v := range f.bindings {
+		result[k] = v
+	}
+	return result
+}
+
+func (f *fakeChannel) failPublish(n int) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.failPublishes = n
+}
+
+// publishedBodies возвращает тексты сообщений, опубликованных в чат.
+func (f *fakeChannel) publishedBodies(chatName string) []string {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	var bodies []string
+	for _, p := range f.published {
+		var msg Message
+		if p.key == MessageKey(chatName) && json.Unmarshal(p.body, &msg) == nil {
+			bodies = append(bodies, msg.Body)
+		}
+	}
+	return bodies
+}
+
+func (f *fakeChannel) publishedKeys() []string {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	keys := make([]string, 0, len(f.published))
+	for _, p := range f.published {
+		keys = append(keys, p.key)
+	}
+	return keys
+}
+
+type fakeConnection struct {
+	ch       *fakeChannel
+	mu       sync.Mutex
+	notifies []chan *amqp.Error
+}
+
+func (f *fakeConnection) Channel() (Channel, error) {
+	return f.ch, nil
+}
+
+func (f *fakeConnection) NotifyClose(receiver chan *amqp.Error) chan *amqp.Error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.notifies = append(f.notifies, receiver)
+	return receiver
+}
+
+func (f *fakeConnection) Close() error {
+	return nil
+}
+
+// drop имитирует обрыв связи со стороны брокера.
+func (f *fakeConnection) drop() {
+	f.mu.Lock()
+	for _, receiver := range f.notifies {
+		receiver <- &amqp.Error{Code: amqp.ConnectionForced, Reason: "broker restart"}
+		close(receiver)
+	}
+	f.notifies = nil
+	f.mu.Unlock()
+	f.ch.Close()
+}
+
+// fakeBroker выдает новое подключение на каждый Dial; первые failDials
+// попыток завершаются ошибкой.
+type fakeBroker struct {
+	mu        sync.Mutex
+	conns     []*fakeConnection
+	failDials int
+	dials     int
+}
+
+func (b *fakeBroker) dial(url string) (Connection, error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	b.dials++
+	if b.failDials > 0 {
+		b.failDials--
+		return nil, errors.New("connection refused")
+	}
+	conn := &fakeConnection{ch: newFakeChannel()}
+	b.conns = append(b.conns, conn)
+	return conn, nil
+}
+
+func (b *fakeBroker) last() *fakeConnection {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return b.conns[len(b.conns)-1]
+}
+
+func (b *fakeBroker) fail(n int) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.failDials = n
+}
+
+func (b *fakeBroker) dialCount() int {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return b.dials
+}
@@ -0,0 +1,32 @@
+package bunnychat
+
+import (
+	"regexp"
+	"strings"
+)
+
+var mentionPattern = regexp.MustCompile(`(?:^|[^\p{L}\p{N}_@])@([\p{L}\p{N}_][\p{L}\p{N}_.-]*)`)
+
+// MentionsUser сообщает, упомянут ли пользователь в тексте напрямую или
+// через @here / @channel.
+func MentionsUser(body, username string) bool {
+	for _, match := range mentionPattern.FindAllStringSubmatch(body, -1) {
+		switch strings.TrimRight(match[1], ".-") {
+		case username, "here", "channel":
+			return true
+		}
+	}
+	return false
+}
+
+// MentionIndexes возвращает границы упоминаний «@имя» в тексте, чтобы
+// клиенты могли их выделить. Точки и дефисы в конце имени — это
+// пунктуация, а не часть имени.
+func MentionIndexes(body string) [][2]int {
+	var indexes [][2]int
+	for _, match := range mentionPattern.FindAllStringSubmatchIndex(body, -1) {
+		name := strings.TrimRight(body[match[2]:match[3]], ".-")
+		indexes = append(indexes, [2]int{match[2] - 1, match[2] + len(name)})
+	}
+	return indexes
+}
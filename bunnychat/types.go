@@ -0,0 +1,159 @@
+// Package bunnychat — общий клиент Team Bunny Chat для CLI и GUI:
+// подключение к RabbitMQ, события чатов и HTTP API сервера истории.
+package bunnychat
+
+import "time"
+
+const (
+	PresenceJoin      = "join"
+	PresenceLeave     = "leave"
+	PresenceHeartbeat = "heartbeat"
+)
+
+type Message struct {
+	ID        int64     `json:"id,omitempty"`
+	Username  string    `json:"username"`
+	Body      string    `json:"body"`
+	Timestamp time.Time `json:"timestamp"`
+	ChatName  string    `json:"chat_name,omitempty"`
+}
+
+type PresenceEvent struct {
+	Username  string    `json:"username"`
+	ChatName  string    `json:"chat_name"`
+	Status    string    `json:"status"`
+	Timestamp time.Time `json:"timestamp"`
+}
+
+type TypingEvent struct {
+	Username  string    `json:"username"`
+	ChatName  string    `json:"chat_name"`
+	Timestamp time.Time `json:"timestamp"`
+}
+
+// EditEvent — автор изменил текст сообщения. Timestamp — время отправки
+// исходного сообщения: по нему (и автору) находят сообщение, полученное
+// из RabbitMQ без id.
+type EditEvent struct {
+	ID        int64     `json:"id"`
+	Username  string    `json:"username"`
+	ChatName  string    `json:"chat_name"`
+	Body      string    `json:"body"`
+	Timestamp time.Time `json:"timestamp"`
+}
+
+type HistoryResponse struct {
+	Chat       string    `json:"chat"`
+	Messages   []Message `json:"messages"`
+	LastReadID int64     `json:"last_read_id"`
+}
+
+type ChatInfo struct {
+	Name       string `json:"name"`
+	Topic      string `json:"topic,omitempty"`
+	Unread     int    `json:"unread"`
+	LastReadID int64  `json:"last_read_id"`
+}
+
+type ChatsResponse struct {
+	Chats []ChatInfo `json:"chats"`
+}
+
+type Member struct {
+	Username string     `json:"username"`
+	Online   bool       `json:"online"`
+	LastSeen *time.Time `json:"last_seen,omitempty"`
+}
+
+type MembersResponse struct {
+	Chat    string   `json:"chat"`
+	Members []Member `json:"members"`
+}
+
+type Pin struct {
+	Message  Message   `json:"message"`
+	PinnedBy string    `json:"pinned_by"`
+	PinnedAt time.Time `json:"pinned_at"`
+}
+
+type PinsResponse struct {
+	Chat string `json:"chat"`
+	Pins []Pin  `json:"pins"`
+}
+
+type Mention struct {
+	ID        int64     `json:"id"`
+	Chat      string    `json:"chat"`
+	MessageID int64     `json:"message_id"`
+	Username  string    `json:"username"`
+	Author    string    `json:"author"`
+	Body      string    `json:"body"`
+	Timestamp time.Time `json:"timestamp"`
+}
+
+type MentionsResponse struct {
+	User     string    `json:"user"`
+	Mentions []Mention `json:"mentions"`
+}
+
+type EditResponse struct {
+	Chat    string  `json:"chat"`
+	Message Message `json:"message"`
+}
+
+type UploadResponse struct {
+	Name string `json:"name"`
+	URL  string `json:"url"`
+}
+
+// User — профиль пользователя на сервере истории.
+type User struct {
+	Username    string    `json:"username"`
+	DisplayName string    `json:"display_name"`
+	AvatarURL   string    `json:"avatar_url"`
+	Status      string    `json:"status"`
+	CreatedAt   time.Time `json:"created_at"`
+}
+
+// Name — имя для отображения, а если оно не задано — имя пользователя.
+func (u User) Name() string {
+	if u.DisplayName != "" {
+		return u.DisplayName
+	}
+	return u.Username
+}
+
+// ProfileUpdate — то, что пользователь может изменить о себе.
+type ProfileUpdate struct {
+	DisplayName string `json:"display_name"`
+	AvatarURL   string `json:"avatar_url"`
+	Status      string `json:"status"`
+}
+
+// Session — ответ на вход: профиль и пара токенов. AccessToken истекает
+// в ExpiresAt, после этого его обменивают на новый по RefreshToken.
+type Session struct {
+	User         User      `json:"user"`
+	AccessToken  string    `json:"access_token"`
+	RefreshToken string    `json:"refresh_token"`
+	ExpiresAt    time.Time `json:"expires_at"`
+}
+
+type SearchQuery struct {
+	Text   string
+	Chats  []string
+	Author string
+	From   time.Time
+	To     time.Time
+	Limit  int
+}
+
+type SearchResult struct {
+	Chat    string  `json:"chat"`
+	Message Message `json:"message"`
+}
+
+type SearchResponse struct {
+	Query   string         `json:"query"`
+	Results []SearchResult `json:"results"`
+}
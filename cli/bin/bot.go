@@ -0,0 +1,82 @@
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"log"
+	"os/signal"
+	"syscall"
+	"time"
+
+	"team-bunny-chat/cli/bot"
+	"team-bunny-chat/cli/client"
+)
+
+// runBot запускает бота, обработчики которого — внешние программы из
+// файла -handlers.
+func runBot(args []string) error {
+	if len(args) == 0 || args[0] != "run" {
+		return usageErrorf("использование: bunny bot run -user <имя> -chat <чат>[,<чат>...] -handlers <файл>")
+	}
+
+	fs := flag.NewFlagSet("bot run", flag.ContinueOnError)
+	conn := addConnectionFlags(fs, true)
+	chatName := fs.String("chat", "", "Чаты бота через запятую")
+	handlersPath := fs.String("handlers", "", "Файл с описанием обработчиков (TOML)")
+	prefix := fs.String("prefix", "!", "Префикс команд")
+	rate := fs.Int("rate", 20, "Сколько ответов в минуту бот отправляет в один чат (0 — без ограничения)")
+	maxAge := fs.Duration("max-age", 5*time.Minute, "Не отвечать на сообщения старше этого (0 — отвечать на все)")
+	handlerTimeout := fs.Duration("handler-timeout", 30*time.Second, "Сколько ждать ответа обработчика")
+	if err := parseFlags(fs, args[1:]); err != nil {
+		return err
+	}
+	settings, err := conn.settings()
+	if err != nil {
+		return err
+	}
+	chatNames := parseChatNames(*chatName)
+	if len(chatNames) == 0 {
+		chatNames = settings.Chats
+	}
+	if settings.User == "" || len(chatNames) == 0 {
+		return usageErrorf("необходимо указать имя пользователя (-user) и название чата (-chat)")
+	}
+	if *handlersPath == "" {
+		return usageErrorf("необходимо указать файл обработчиков (-handlers)")
+	}
+	specs, err := bot.LoadSpecs(*handlersPath)
+	if err != nil {
+		return err
+	}
+
+	brokerURL, err := settings.BrokerURL()
+	if err != nil {
+		return err
+	}
+	api, err := newAPI(settings)
+	if err != nil {
+		return err
+	}
+	client, err := rabbitmq.NewClient(settings.User, chatNames, brokerURL, api)
+	if err != nil {
+		return fmt.Errorf("ошибка создания клиента: %w", err)
+	}
+	defer client.Close()
+
+	b := bot.New(client, bot.Options{
+		Prefix:         *prefix,
+		RateLimit:      *rate,
+		RateWindow:     time.Minute,
+		MaxAge:         *maxAge,
+		HandlerTimeout: *handlerTimeout,
+	})
+	if err := b.Register(specs); err != nil {
+		return usageError{msg: err.Error()}
+	}
+
+	ctx, stop := signal.NotifyContext(context.Background(), syscall.SIGINT, syscall.SIGTERM)
+	defer stop()
+	log.Printf("Бот %s запущен в чатах %v, обработчиков: %d", settings.User, chatNames, len(specs))
+	return b.Run(ctx)
+}
@@ -0,0 +1,516 @@
+package main
+
+import (
+	"encoding/csv"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"os/signal"
+	"strconv"
+	"strings"
+	"syscall"
+	"time"
+
+	"golang.org/x/term"
+
+	"team-bunny-chat/bunnychat"
+	"team-bunny-chat/cli/cache"
+	"team-bunny-chat/cli/client"
+	"team-bunny-chat/cli/config"
+	"team-bunny-chat/cli/render"
+)
+
+// Коды завершения для скриптов.
+const (
+	exitOK    = 0
+	exitError = 1
+	exitUsage = 2
+)
+
+// usageError — ошибка в аргументах командной строки; программа завершается
+// с кодом exitUsage.
+type usageError struct {
+	msg string
+}
+
+func (e usageError) Error() string {
+	return e.msg
+}
+
+func usageErrorf(format string, args ...interface{}) error {
+	return usageError{msg: fmt.Sprintf(format, args...)}
+}
+
+type command struct {
+	name        string
+	description string
+	run         func(args []string) error
+}
+
+var commands = []command{
+	{"chat", "интерактивный чат (по умолчанию)", runChat},
+	{"send", "отправить сообщение из аргументов или stdin", runSend},
+	{"history", "вывести историю чата", runHistory},
+	{"tail", "выводить новые сообщения, пока не прервут", runTail},
+	{"chats", "список чатов сервера", runChats},
+	{"bot", "запустить бота с обработчиками-программами (bot run)", runBot},
+	{"config", "просмотр и изменение файла настроек", runConfig},
+}
+
+// run выбирает подкоманду по первому аргументу; без подкоманды запускается
+// интерактивный чат, как раньше. Возвращает код завершения.
+func run(args []string) int {
+	if len(args) > 0 && args[0] == "help" {
+		printUsage()
+		return exitOK
+	}
+
+	cmd := commands[0]
+	if len(args) > 0 && !strings.HasPrefix(args[0], "-") {
+		found := false
+		for _, c := range commands {
+			if c.name == args[0] {
+				cmd, found = c, true
+				break
+			}
+		}
+		if !found {
+			fmt.Fprintf(os.Stderr, "bunny: неизвестная команда %q\n\n", args[0])
+			printUsage()
+			return exitUsage
+		}
+		args = args[1:]
+	}
+
+	err := cmd.run(args)
+	var usage usageError
+	switch {
+	case err == nil:
+		return exitOK
+	case errors.Is(err, flag.ErrHelp):
+		return exitOK
+	case errors.As(err, &usage):
+		fmt.Fprintf(os.Stderr, "bunny %s: %v\n", cmd.name, err)
+		return exitUsage
+	default:
+		fmt.Fprintf(os.Stderr, "bunny %s: %v\n", cmd.name, err)
+		return exitError
+	}
+}
+
+func printUsage() {
+	fmt.Fprintln(os.Stderr, "Использование: bunny [команда] [параметры]")
+	fmt.Fprintln(os.Stderr, "\nКоманды:")
+	for _, c := range commands {
+		fmt.Fprintf(os.Stderr, "  %-8s %s\n", c.name, c.description)
+	}
+	fmt.Fprintln(os.Stderr, "\nПараметры команды: bunny <команда> -h")
+}
+
+// connectionFlags — параметры подключения, общие для всех команд. Пустые
+// значения берутся из переменных окружения и профиля (см. settings).
+type connectionFlags struct {
+	fs       *flag.FlagSet
+	profile  *string
+	user     *string
+	rabbitmq *string
+	server   *string
+	caFile   *string
+	timeout  *string
+}
+
+func addConnectionFlags(fs *flag.FlagSet, withBroker bool) connectionFlags {
+	flags := connectionFlags{
+		fs:      fs,
+		profile: fs.String("profile", "", "Профиль из файла настроек"),
+		user:    fs.String("user", "", "Имя пользователя"),
+		server:  fs.String("server", "", "Адрес или URL сервера чата (по умолчанию "+config.DefaultServer+")"),
+		caFile:  fs.String("ca", "", "Сертификат центра сертификации (PEM) для сервера по https://"),
+		timeout: fs.String("timeout", "", "Таймаут запросов к серверу чата, например 10s"),
+	}
+	if withBroker {
+		flags.rabbitmq = fs.String("rabbitmq", "", "Адрес или URL RabbitMQ сервера (по умолчанию "+config.DefaultRabbitMQ+")")
+	}
+	return flags
+}
+
+// settings собирает итоговые параметры: флаги важнее переменных окружения
+// BUNNY_*, а те — профиля из файла настроек.
+func (c connectionFlags) settings() (config.Profile, error) {
+	path, err := config.Path()
+	if err != nil {
+		return config.Profile{}, err
+	}
+	cfg, err := config.Load(path)
+	if err != nil {
+		return config.Profile{}, err
+	}
+	_, profile, err := cfg.Select(*c.profile)
+	if err != nil {
+		return config.Profile{}, usageError{msg: err.Error()}
+	}
+	profile.ApplyEnv()
+
+	if *c.user != "" {
+		profile.User = *c.user
+	}
+	if *c.server != "" {
+		profile.Server = *c.server
+	}
+	if c.rabbitmq != nil && *c.rabbitmq != "" {
+		profile.RabbitMQ = *c.rabbitmq
+	}
+	if *c.caFile != "" {
+		profile.CAFile = *c.caFile
+	}
+	if *c.timeout != "" {
+		profile.Timeout = *c.timeout
+	}
+	return profile.WithDefaults(), nil
+}
+
+// newAPI создает клиент сервера истории по итоговым настройкам.
+func newAPI(settings config.Profile) (*bunnychat.API, error) {
+	timeout, err := settings.HTTPTimeout()
+	if err != nil {
+		return nil, usageError{msg: err.Error()}
+	}
+	return rabbitmq.NewAPI(settings.Server, settings.User, rabbitmq.HTTPOptions{
+		CAFile:  settings.CAFile,
+		Timeout: timeout,
+	})
+}
+
+// openCache открывает зашифрованный кэш истории пользователя. Пароль
+// берется из cache_passphrase, а если он не задан, спрашивается в терминале.
+func openCache(settings config.Profile) (*cache.Cache, error) {
+	if settings.User == "" {
+		return nil, usageErrorf("для кэша необходимо указать имя пользователя (-user)")
+	}
+	passphrase, err := settings.CachePassword()
+	if err != nil {
+		return nil, err
+	}
+	if passphrase == "" {
+		stdin := int(os.Stdin.Fd())
+		if !term.IsTerminal(stdin) {
+			return nil, usageErrorf("не задан пароль кэша (cache_passphrase или BUNNY_CACHE_PASSPHRASE)")
+		}
+		fmt.Fprint(os.Stderr, "Пароль кэша: ")
+		data, err := term.ReadPassword(stdin)
+		fmt.Fprintln(os.Stderr)
+		if err != nil {
+			return nil, fmt.Errorf("ошибка чтения пароля: %w", err)
+		}
+		passphrase = string(data)
+	}
+
+	path, err := cache.DefaultPath(settings.Server, settings.User)
+	if err != nil {
+		return nil, err
+	}
+	c, err := cache.Open(path, passphrase)
+	if errors.Is(err, cache.ErrWrongPassphrase) {
+		return nil, fmt.Errorf("%w (чтобы начать заново, удалите %s)", err, path)
+	}
+	return c, err
+}
+
+// newRenderer создает оформитель сообщений для стандартного вывода: цвет
+// отключается флагом -no-color, настройкой no_color, переменной NO_COLOR
+// и при выводе не в терминал.
+func newRenderer(settings config.Profile, noColor bool) *render.Renderer {
+	return render.New(render.Options{
+		Color:      render.ColorEnabled(noColor || settings.NoColor, os.Stdout),
+		Width:      render.TerminalWidth(os.Stdout),
+		Username:   settings.User,
+		TimeFormat: settings.TimeFormat,
+		ShowChat:   true,
+	})
+}
+
+// isFlagSet сообщает, указан ли флаг в командной строке явно.
+func isFlagSet(fs *flag.FlagSet, name string) bool {
+	set := false
+	fs.Visit(func(f *flag.Flag) {
+		if f.Name == name {
+			set = true
+		}
+	})
+	return set
+}
+
+func parseFlags(fs *flag.FlagSet, args []string) error {
+	if err := fs.Parse(args); err != nil {
+		if errors.Is(err, flag.ErrHelp) {
+			return err
+		}
+		return usageError{msg: err.Error()}
+	}
+	return nil
+}
+
+func checkFormat(format string, allowed ...string) error {
+	if !containsChat(allowed, format) {
+		return usageErrorf("неизвестный формат %q, допустимые: %s", format, strings.Join(allowed, ", "))
+	}
+	return nil
+}
+
+func runSend(args []string) error {
+	fs := flag.NewFlagSet("send", flag.ContinueOnError)
+	conn := addConnectionFlags(fs, true)
+	chatName := fs.String("chat", "", "Название чата (по умолчанию первый чат профиля)")
+	if err := parseFlags(fs, args); err != nil {
+		return err
+	}
+	settings, err := conn.settings()
+	if err != nil {
+		return err
+	}
+	if *chatName == "" && len(settings.Chats) > 0 {
+		*chatName = settings.Chats[0]
+	}
+	if settings.User == "" || *chatName == "" {
+		return usageErrorf("необходимо указать имя пользователя (-user) и название чата (-chat)")
+	}
+	brokerURL, err := settings.BrokerURL()
+	if err != nil {
+		return err
+	}
+	api, err := newAPI(settings)
+	if err != nil {
+		return err
+	}
+
+	text := strings.Join(fs.Args(), " ")
+	if text == "" {
+		data, err := io.ReadAll(os.Stdin)
+		if err != nil {
+			return fmt.Errorf("ошибка чтения stdin: %w", err)
+		}
+		text = strings.TrimRight(string(data), "\r\n")
+	}
+	if strings.TrimSpace(text) == "" {
+		return usageErrorf("пустое сообщение")
+	}
+
+	client, err := rabbitmq.NewClient(settings.User, []string{*chatName}, brokerURL, api)
+	if err != nil {
+		return fmt.Errorf("ошибка создания клиента: %w", err)
+	}
+	defer client.Close()
+
+	if err := client.SendMessage(text); err != nil {
+		return fmt.Errorf("ошибка отправки сообщения: %w", err)
+	}
+	// Без связи сообщение осталось бы в очереди и пропало при выходе.
+	if client.Pending() > 0 {
+		return errors.New("сообщение не отправлено: соединение потеряно")
+	}
+	return nil
+}
+
+func runHistory(args []string) error {
+	fs := flag.NewFlagSet("history", flag.ContinueOnError)
+	conn := addConnectionFlags(fs, false)
+	chatName := fs.String("chat", "", "Название чата")
+	limit := fs.Int("limit", 50, "Сколько последних сообщений вывести")
+	format := fs.String("format", "text", "Формат вывода: text, json или csv")
+	noColor := fs.Bool("no-color", false, "Не выделять текст цветом")
+	offline := fs.Bool("offline", false, "Читать из локального кэша, не обращаясь к серверу")
+	if err := parseFlags(fs, args); err != nil {
+		return err
+	}
+	settings, err := conn.settings()
+	if err != nil {
+		return err
+	}
+	if *chatName == "" && len(settings.Chats) > 0 {
+		*chatName = settings.Chats[0]
+	}
+	if *chatName == "" {
+		return usageErrorf("необходимо указать название чата (-chat)")
+	}
+	if *limit <= 0 {
+		return usageErrorf("-limit должен быть положительным")
+	}
+	if err := checkFormat(*format, "text", "json", "csv"); err != nil {
+		return err
+	}
+
+	renderer := newRenderer(settings, *noColor)
+
+	if *offline {
+		c, err := openCache(settings)
+		if err != nil {
+			return err
+		}
+		defer c.Close()
+		messages, err := c.Recent(*chatName, *limit)
+		if err != nil {
+			return err
+		}
+		return writeMessages(os.Stdout, *format, messages, renderer)
+	}
+
+	api, err := newAPI(settings)
+	if err != nil {
+		return err
+	}
+	history, err := rabbitmq.GetChatHistory(api, *chatName, *limit)
+	if err != nil {
+		return err
+	}
+	return writeMessages(os.Stdout, *format, history.Messages, renderer)
+}
+
+func runTail(args []string) error {
+	fs := flag.NewFlagSet("tail", flag.ContinueOnError)
+	conn := addConnectionFlags(fs, true)
+	chatName := fs.String("chat", "", "Название чата или несколько чатов через запятую")
+	format := fs.String("format", "text", "Формат вывода: text или jsonl")
+	noColor := fs.Bool("no-color", false, "Не выделять текст цветом")
+	if err := parseFlags(fs, args); err != nil {
+		return err
+	}
+	settings, err := conn.settings()
+	if err != nil {
+		return err
+	}
+	chatNames := parseChatNames(*chatName)
+	if len(chatNames) == 0 {
+		chatNames = settings.Chats
+	}
+	if settings.User == "" || len(chatNames) == 0 {
+		return usageErrorf("необходимо указать имя пользователя (-user) и название чата (-chat)")
+	}
+	if err := checkFormat(*format, "text", "jsonl"); err != nil {
+		return err
+	}
+	brokerURL, err := settings.BrokerURL()
+	if err != nil {
+		return err
+	}
+	api, err := newAPI(settings)
+	if err != nil {
+		return err
+	}
+
+	client, err := rabbitmq.NewClient(settings.User, chatNames, brokerURL, api)
+	if err != nil {
+		return fmt.Errorf("ошибка создания клиента: %w", err)
+	}
+	defer client.Close()
+
+	renderer := newRenderer(settings, *noColor)
+	sigChan := make(chan os.Signal, 1)
+	signal.Notify(sigChan, syscall.SIGINT, syscall.SIGTERM)
+
+	go func() {
+		for state := range client.States() {
+			if state.Connected {
+				fmt.Fprintln(os.Stderr, "* Соединение восстановлено")
+			} else {
+				fmt.Fprintf(os.Stderr, "* Соединение потеряно (%v), переподключение…\n", state.Err)
+			}
+		}
+	}()
+
+	for {
+		select {
+		case <-sigChan:
+			return nil
+		case msg, ok := <-client.Messages():
+			if !ok {
+				return errors.New("соединение закрыто")
+			}
+			if err := writeMessages(os.Stdout, *format, []rabbitmq.Message{msg}, renderer); err != nil {
+				return err
+			}
+		}
+	}
+}
+
+func runChats(args []string) error {
+	fs := flag.NewFlagSet("chats", flag.ContinueOnError)
+	conn := addConnectionFlags(fs, false)
+	format := fs.String("format", "text", "Формат вывода: text или json")
+	if err := parseFlags(fs, args); err != nil {
+		return err
+	}
+	if err := checkFormat(*format, "text", "json"); err != nil {
+		return err
+	}
+	settings, err := conn.settings()
+	if err != nil {
+		return err
+	}
+
+	api, err := newAPI(settings)
+	if err != nil {
+		return err
+	}
+	chats, err := api.Chats()
+	if err != nil {
+		return fmt.Errorf("ошибка при получении списка чатов: %w", err)
+	}
+
+	if *format == "json" {
+		return json.NewEncoder(os.Stdout).Encode(chats.Chats)
+	}
+	// Название, число непрочитанных и тема через табуляцию — удобно для cut и awk.
+	for _, chat := range chats.Chats {
+		if _, err := fmt.Printf("%s\t%d\t%s\n", chat.Name, chat.Unread, chat.Topic); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// writeMessages выводит сообщения в одном из форматов: text — как в
+// интерактивном чате (через renderer); json — массив; jsonl — по объекту
+// на строку; csv — с заголовком.
+func writeMessages(w io.Writer, format string, messages []rabbitmq.Message, renderer *render.Renderer) error {
+	switch format {
+	case "json":
+		if messages == nil {
+			messages = []rabbitmq.Message{}
+		}
+		encoder := json.NewEncoder(w)
+		encoder.SetIndent("", "  ")
+		return encoder.Encode(messages)
+	case "jsonl":
+		encoder := json.NewEncoder(w)
+		for _, msg := range messages {
+			if err := encoder.Encode(msg); err != nil {
+				return err
+			}
+		}
+		return nil
+	case "csv":
+		writer := csv.NewWriter(w)
+		writer.Write([]string{"id", "chat", "timestamp", "username", "body"})
+		for _, msg := range messages {
+			writer.Write([]string{
+				strconv.FormatInt(msg.ID, 10),
+				msg.ChatName,
+				msg.Timestamp.Format(time.RFC3339),
+				msg.Username,
+				msg.Body,
+			})
+		}
+		writer.Flush()
+		return writer.Error()
+	default:
+		for _, msg := range messages {
+			if _, err := fmt.Fprintln(w, renderer.Message(msg)); err != nil {
+				return err
+			}
+		}
+		return nil
+	}
+}
@@ -0,0 +1,249 @@
+package main
+
+import (
+	"bytes"
+	"os"
+	"path/filepath"
+	"strings"
+	"syscall"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"team-bunny-chat/bunnychat"
+	"team-bunny-chat/cli/client"
+	"team-bunny-chat/cli/render"
+)
+
+// commandEnv отключает файл настроек и переменные BUNNY_*, чтобы команды
+// видели только флаги теста.
+func commandEnv(t *testing.T) {
+	t.Setenv("BUNNY_CONFIG", filepath.Join(t.TempDir(), "config.toml"))
+	for _, env := range []string{
+		"BUNNY_PROFILE", "BUNNY_USER", "BUNNY_SERVER", "BUNNY_RABBITMQ", "BUNNY_CREDENTIALS",
+		"BUNNY_CA_FILE", "BUNNY_TIMEOUT", "BUNNY_CACHE_PASSPHRASE", "BUNNY_CHATS",
+	} {
+		t.Setenv(env, "")
+	}
+}
+
+// stdFile подменяет один из стандартных потоков файлом с содержимым
+// content и возвращает функцию, читающую файл.
+func stdFile(t *testing.T, std **os.File, content string) func() string {
+	path := filepath.Join(t.TempDir(), "std")
+	require.NoError(t, os.WriteFile(path, []byte(content), 0o600))
+	f, err := os.OpenFile(path, os.O_RDWR|os.O_APPEND, 0)
+	require.NoError(t, err)
+	previous := *std
+	*std = f
+	t.Cleanup(func() {
+		*std = previous
+		f.Close()
+	})
+	return func() string {
+		data, err := os.ReadFile(path)
+		require.NoError(t, err)
+		return string(data)
+	}
+}
+
+// runCommand запускает bunny с аргументами args и вводом stdin и
+// возвращает код завершения, stdout и stderr.
+func runCommand(t *testing.T, stdin string, args ...string) (int, string, string) {
+	stdFile(t, &os.Stdin, stdin)
+	stdout := stdFile(t, &os.Stdout, "")
+	stderr := stdFile(t, &os.Stderr, "")
+	code := run(args)
+	return code, stdout(), stderr()
+}
+
+func TestRunExitCodes(t *testing.T) {
+	commandEnv(t)
+	useFakeBroker(t)
+	server := newHistoryServer(t)
+	down := "127.0.0.1:1"
+
+	tests := []struct {
+		name   string
+		args   []string
+		stdin  string
+		want   int
+		stderr string
+	}{
+		{name: "Справка", args: []string{"help"}, want: exitOK, stderr: "Команды:"},
+		{name: "Справка по команде", args: []string{"history", "-h"}, want: exitOK, stderr: "-limit"},
+		{name: "Неизвестная команда", args: []string{"post"}, want: exitUsage, stderr: `неизвестная команда "post"`},
+		{name: "Неизвестный флаг", args: []string{"chats", "-verbose"}, want: exitUsage},
+		{name: "Нет профиля", args: []string{"chats", "-profile", "prod"}, want: exitUsage, stderr: `профиль "prod" не найден`},
+
+		{name: "send", args: []string{"send", "-server", server.URL, "-user", "alice", "-chat", "general", "всем", "привет"}, want: exitOK},
+		{name: "send из stdin", args: []string{"send", "-server", server.URL, "-user", "alice", "-chat", "general"}, stdin: "из скрипта\n", want: exitOK},
+		{name: "send без чата", args: []string{"send", "-server", server.URL, "-user", "alice", "привет"}, want: exitUsage},
+		{name: "send без пользователя", args: []string{"send", "-server", server.URL, "-chat", "general", "привет"}, want: exitUsage},
+		{name: "send пустое сообщение", args: []string{"send", "-server", server.URL, "-user", "alice", "-chat", "general"}, stdin: " \n", want: exitUsage, stderr: "пустое сообщение"},
+		{name: "send с неверным таймаутом", args: []string{"send", "-server", server.URL, "-user", "alice", "-chat", "general", "-timeout", "скоро", "привет"}, want: exitUsage},
+
+		{name: "history", args: []string{"history", "-server", server.URL, "-chat", "general"}, want: exitOK},
+		{name: "history без чата", args: []string{"history", "-server", server.URL}, want: exitUsage},
+		{name: "history с неверным лимитом", args: []string{"history", "-server", server.URL, "-chat", "general", "-limit", "0"}, want: exitUsage},
+		{name: "history в неизвестном формате", args: []string{"history", "-server", server.URL, "-chat", "general", "-format", "xml"}, want: exitUsage, stderr: `неизвестный формат "xml"`},
+		{name: "history без сервера", args: []string{"history", "-server", down, "-chat", "general"}, want: exitError},
+
+		{name: "tail без пользователя", args: []string{"tail", "-server", server.URL, "-chat", "general"}, want: exitUsage},
+		{name: "tail в формате json", args: []string{"tail", "-server", server.URL, "-user", "alice", "-chat", "general", "-format", "json"}, want: exitUsage},
+
+		{name: "chats", args: []string{"chats", "-server", server.URL}, want: exitOK},
+		{name: "chats в формате csv", args: []string{"chats", "-server", server.URL, "-format", "csv"}, want: exitUsage},
+		{name: "chats без сервера", args: []string{"chats", "-server", down}, want: exitError, stderr: "ошибка при получении списка чатов"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			code, _, stderr := runCommand(t, tt.stdin, tt.args...)
+			assert.Equal(t, tt.want, code, stderr)
+			assert.Contains(t, stderr, tt.stderr)
+		})
+	}
+}
+
+func TestRunOutput(t *testing.T) {
+	commandEnv(t)
+	broker := useFakeBroker(t)
+	server := newHistoryServer(t)
+
+	_, _, _ = runCommand(t, "", "send", "-server", server.URL, "-user", "alice", "-chat", "dev", "сборка", "готова")
+	_, _, _ = runCommand(t, "строка 1\nстрока 2\n", "send", "-server", server.URL, "-user", "alice", "-chat", "dev")
+	assert.Equal(t, []string{"сборка готова", "строка 1\nстрока 2"}, broker.sent("dev"))
+
+	_, stdout, _ := runCommand(t, "", "history", "-server", server.URL, "-chat", "general", "-format", "csv")
+	lines := strings.Split(strings.TrimSpace(stdout), "\n")
+	require.Len(t, lines, 4)
+	assert.Equal(t, "id,chat,timestamp,username,body", lines[0])
+	assert.Equal(t, "1,general,2025-05-24T12:01:00Z,bob,general 1", lines[1])
+
+	_, stdout, _ = runCommand(t, "", "chats", "-server", server.URL)
+	assert.Equal(t, "general\t0\t\ndev\t2\t\n", stdout, "название, непрочитанные и тема через табуляцию")
+
+	_, stdout, _ = runCommand(t, "", "chats", "-server", server.URL, "-format", "json")
+	assert.JSONEq(t, `[{"name":"general","unread":0,"last_read_id":0},{"name":"dev","unread":2,"last_read_id":0}]`, stdout)
+}
+
+func TestRunTail(t *testing.T) {
+	commandEnv(t)
+	broker := useFakeBroker(t)
+	server := newHistoryServer(t)
+
+	stdFile(t, &os.Stdin, "")
+	stdout := stdFile(t, &os.Stdout, "")
+	stdFile(t, &os.Stderr, "")
+
+	done := make(chan int)
+	go func() {
+		done <- run([]string{"tail", "-server", server.URL, "-user", "alice", "-chat", "general,dev", "-format", "jsonl"})
+	}()
+
+	msg := bunnychat.Message{ID: 7, ChatName: "dev", Username: "bob", Body: "деплой", Timestamp: time.Date(2025, 5, 24, 12, 0, 0, 0, time.UTC)}
+	broker.deliver(msg)
+	require.Eventually(t, func() bool { return stdout() != "" }, 5*time.Second, 10*time.Millisecond)
+	assert.JSONEq(t, `{"id":7,"chat_name":"dev","username":"bob","body":"деплой","timestamp":"2025-05-24T12:00:00Z"}`, stdout())
+
+	// Сообщение уже выведено, значит tail ждет сигнала и прерывание не
+	// завершит тестовый процесс.
+	require.NoError(t, syscall.Kill(os.Getpid(), syscall.SIGINT))
+	select {
+	case code := <-done:
+		assert.Equal(t, exitOK, code, "прерывание — обычное завершение")
+	case <-time.After(5 * time.Second):
+		t.Fatal("tail не завершился по сигналу")
+	}
+}
+
+func TestCheckFormat(t *testing.T) {
+	tests := []struct {
+		name    string
+		format  string
+		allowed []string
+		wantErr string
+	}{
+		{name: "Допустимый формат", format: "json", allowed: []string{"text", "json"}},
+		{name: "Недопустимый формат", format: "csv", allowed: []string{"text", "json"}, wantErr: `неизвестный формат "csv", допустимые: text, json`},
+		{name: "Пустой формат", format: "", allowed: []string{"text"}, wantErr: `неизвестный формат "", допустимые: text`},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := checkFormat(tt.format, tt.allowed...)
+			if tt.wantErr == "" {
+				assert.NoError(t, err)
+				return
+			}
+			assert.EqualError(t, err, tt.wantErr)
+			assert.IsType(t, usageError{}, err, "неверный формат завершается с кодом exitUsage")
+		})
+	}
+}
+
+func TestWriteMessages(t *testing.T) {
+	timestamp := time.Date(2025, 5, 24, 12, 0, 0, 0, time.UTC)
+	messages := []rabbitmq.Message{
+		{ID: 1, ChatName: "general", Username: "alice", Body: "привет", Timestamp: timestamp},
+		{ID: 2, ChatName: "general", Username: "bob", Body: `цитата "в кавычках", с запятой`, Timestamp: timestamp.Add(time.Minute)},
+	}
+	local := timestamp.Local()
+
+	tests := []struct {
+		name     string
+		format   string
+		messages []rabbitmq.Message
+		want     string
+	}{
+		{
+			name:     "Текст",
+			format:   "text",
+			messages: messages[:1],
+			want:     render.DateSeparator(local) + "\n[general] [" + local.Format("15:04:05") + "] #1 alice: привет\n",
+		},
+		{
+			name:     "JSON",
+			format:   "json",
+			messages: messages[:1],
+			want:     "[\n  {\n    \"id\": 1,\n    \"username\": \"alice\",\n    \"body\": \"привет\",\n    \"timestamp\": \"2025-05-24T12:00:00Z\",\n    \"chat_name\": \"general\"\n  }\n]\n",
+		},
+		{
+			name:   "Пустой JSON — массив, а не null",
+			format: "json",
+			want:   "[]\n",
+		},
+		{
+			name:     "JSON Lines",
+			format:   "jsonl",
+			messages: messages,
+			want: `{"id":1,"username":"alice","body":"привет","timestamp":"2025-05-24T12:00:00Z","chat_name":"general"}` + "\n" +
+				`{"id":2,"username":"bob","body":"цитата \"в кавычках\", с запятой","timestamp":"2025-05-24T12:01:00Z","chat_name":"general"}` + "\n",
+		},
+		{
+			name:     "CSV",
+			format:   "csv",
+			messages: messages,
+			want: "id,chat,timestamp,username,body\n" +
+				"1,general,2025-05-24T12:00:00Z,alice,привет\n" +
+				`2,general,2025-05-24T12:01:00Z,bob,"цитата ""в кавычках"", с запятой"` + "\n",
+		},
+		{
+			name:   "Пустой CSV — только заголовок",
+			format: "csv",
+			want:   "id,chat,timestamp,username,body\n",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var out bytes.Buffer
+			renderer := render.New(render.Options{ShowChat: true})
+			require.NoError(t, writeMessages(&out, tt.format, tt.messages, renderer))
+			assert.Equal(t, tt.want, out.String())
+		})
+	}
+}
@@ -0,0 +1,147 @@
+package main
+
+import (
+	"errors"
+	"flag"
+	"fmt"
+	"os"
+	"os/exec"
+	"strings"
+
+	"team-bunny-chat/cli/config"
+)
+
+const configUsage = `действия:
+  path                          путь к файлу настроек
+  list                          список профилей (* — профиль по умолчанию)
+  show [-profile p]             итоговые настройки профиля с учетом BUNNY_*
+  set [-profile p] <ключ> <значение>
+  unset [-profile p] <ключ>
+  use <профиль>                 выбрать профиль по умолчанию
+  edit                          открыть файл в $EDITOR
+ключи: `
+
+func runConfig(args []string) error {
+	if len(args) == 0 {
+		return usageErrorf("не указано действие\n%s%s", configUsage, strings.Join(config.Keys, ", "))
+	}
+	path, err := config.Path()
+	if err != nil {
+		return err
+	}
+	cfg, err := config.Load(path)
+	if err != nil {
+		return err
+	}
+
+	action, args := args[0], args[1:]
+	switch action {
+	case "path":
+		fmt.Println(path)
+		return nil
+	case "list":
+		for _, name := range cfg.ProfileNames() {
+			marker := " "
+			if name == cfg.DefaultProfile {
+				marker = "*"
+			}
+			fmt.Printf("%s %s\n", marker, name)
+		}
+		return nil
+	case "show":
+		fs := flag.NewFlagSet("config show", flag.ContinueOnError)
+		profileName := fs.String("profile", "", "Профиль")
+		if err := parseFlags(fs, args); err != nil {
+			return err
+		}
+		name, profile, err := cfg.Select(*profileName)
+		if err != nil {
+			return usageError{msg: err.Error()}
+		}
+		profile.ApplyEnv()
+		profile = profile.WithDefaults()
+		if name != "" {
+			fmt.Printf("# профиль %s\n", name)
+		}
+		for _, key := range config.Keys {
+			value, _ := profile.Get(key)
+			fmt.Printf("%s = %s\n", key, value)
+		}
+		return nil
+	case "set", "unset":
+		fs := flag.NewFlagSet("config "+action, flag.ContinueOnError)
+		profileName := fs.String("profile", "", "Профиль (по умолчанию текущий)")
+		if err := parseFlags(fs, args); err != nil {
+			return err
+		}
+		rest := fs.Args()
+		if action == "set" && len(rest) < 2 {
+			return usageErrorf("использование: bunny config set [-profile p] <ключ> <значение>")
+		}
+		if action == "unset" && len(rest) != 1 {
+			return usageErrorf("использование: bunny config unset [-profile p] <ключ>")
+		}
+
+		name := editedProfile(cfg, *profileName)
+		profile := cfg.Profiles[name]
+		value := strings.Join(rest[1:], " ")
+		if err := profile.Set(rest[0], value); err != nil {
+			if errors.Is(err, config.ErrUnknownKey) {
+				return usageErrorf("%v, допустимые: %s", err, strings.Join(config.Keys, ", "))
+			}
+			return usageError{msg: err.Error()}
+		}
+		cfg.Profiles[name] = profile
+		if cfg.DefaultProfile == "" {
+			cfg.DefaultProfile = name
+		}
+		return cfg.Save(path)
+	case "use":
+		if len(args) != 1 {
+			return usageErrorf("использование: bunny config use <профиль>")
+		}
+		if _, ok := cfg.Profiles[args[0]]; !ok {
+			return usageErrorf("профиль %q не найден", args[0])
+		}
+		cfg.DefaultProfile = args[0]
+		return cfg.Save(path)
+	case "edit":
+		if _, err := os.Stat(path); errors.Is(err, os.ErrNotExist) {
+			if err := cfg.Save(path); err != nil {
+				return err
+			}
+		}
+		editor := os.Getenv("VISUAL")
+		if editor == "" {
+			editor = os.Getenv("EDITOR")
+		}
+		if editor == "" {
+			editor = "vi"
+		}
+		cmd := exec.Command(editor, path)
+		cmd.Stdin, cmd.Stdout, cmd.Stderr = os.Stdin, os.Stdout, os.Stderr
+		if err := cmd.Run(); err != nil {
+			return fmt.Errorf("ошибка запуска редактора: %w", err)
+		}
+		// Сразу сообщаем об ошибке в файле, а не при следующем запуске.
+		_, err := config.Load(path)
+		return err
+	default:
+		return usageErrorf("неизвестное действие %q\n%s%s", action, configUsage, strings.Join(config.Keys, ", "))
+	}
+}
+
+// editedProfile выбирает профиль для set и unset: указанный явно, из
+// $BUNNY_PROFILE, профиль по умолчанию или новый профиль "default".
+func editedProfile(cfg *config.Config, name string) string {
+	if name == "" {
+		name = os.Getenv("BUNNY_PROFILE")
+	}
+	if name == "" {
+		name = cfg.DefaultProfile
+	}
+	if name == "" {
+		name = "default"
+	}
+	return name
+}
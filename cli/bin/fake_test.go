@@ -0,0 +1,197 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	amqp "github.com/rabbitmq/amqp091-go"
+
+	"team-bunny-chat/bunnychat"
+	"team-bunny-chat/cli/client"
+)
+
+// fakeBroker — RabbitMQ в памяти с одной очередью: запоминает привязки
+// и публикации, а deliver доставляет сообщение в очередь клиента.
+type fakeBroker struct {
+	mu         sync.Mutex
+	bindings   map[string]bool
+	published  []amqp.Publishing
+	keys       []string
+	deliveries chan amqp.Delivery
+	closed     bool
+}
+
+// useFakeBroker подменяет подключение к RabbitMQ на время теста.
+func useFakeBroker(t *testing.T) *fakeBroker {
+	b := &fakeBroker{
+		bindings:   make(map[string]bool),
+		deliveries: make(chan amqp.Delivery, 16),
+	}
+	previous := rabbitmq.Dial
+	rabbitmq.Dial = func(string) (bunnychat.Connection, error) { return b, nil }
+	t.Cleanup(func() { rabbitmq.Dial = previous })
+	return b
+}
+
+func (b *fakeBroker) Channel() (bunnychat.Channel, error) { return b, nil }
+
+func (b *fakeBroker) NotifyClose(receiver chan *amqp.Error) chan *amqp.Error { return receiver }
+
+func (b *fakeBroker) ExchangeDeclare(string, string, bool, bool, bool, bool, amqp.Table) error {
+	return nil
+}
+
+func (b *fakeBroker) QueueDeclare(string, bool, bool, bool, bool, amqp.Table) (amqp.Queue, error) {
+	return amqp.Queue{Name: "fake-queue"}, nil
+}
+
+func (b *fakeBroker) QueueBind(_, key, _ string, _ bool, _ amqp.Table) error {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.bindings[key] = true
+	return nil
+}
+
+func (b *fakeBroker) QueueUnbind(_, key, _ string, _ amqp.Table) error {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	delete(b.bindings, key)
+	return nil
+}
+
+func (b *fakeBroker) Consume(string, string, bool, bool, bool, bool, amqp.Table) (<-chan amqp.Delivery, error) {
+	return b.deliveries, nil
+}
+
+func (b *fakeBroker) PublishWithContext(_ context.Context, _, key string, _, _ bool, msg amqp.Publishing) error {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.keys = append(b.keys, key)
+	b.published = append(b.published, msg)
+	return nil
+}
+
+func (b *fakeBroker) Close() error {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if !b.closed {
+		b.closed = true
+		close(b.deliveries)
+	}
+	return nil
+}
+
+func (b *fakeBroker) bound(chatName string) bool {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return b.bindings[bunnychat.MessageKey(chatName)]
+}
+
+// sent возвращает тексты сообщений, опубликованных в чат.
+func (b *fakeBroker) sent(chatName string) []string {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	var bodies []string
+	for i, key := range b.keys {
+		var msg bunnychat.Message
+		if key == bunnychat.MessageKey(chatName) && json.Unmarshal(b.published[i].Body, &msg) == nil {
+			bodies = append(bodies, msg.Body)
+		}
+	}
+	return bodies
+}
+
+func (b *fakeBroker) deliver(msg bunnychat.Message) {
+	body, _ := json.Marshal(msg)
+	b.deliveries <- amqp.Delivery{RoutingKey: bunnychat.MessageKey(msg.ChatName), Body: body}
+}
+
+// testMessages — история чатов тестового сервера: по три сообщения в
+// каждом, от bob.
+func testMessages(chatName string) []bunnychat.Message {
+	start := time.Date(2025, 5, 24, 12, 0, 0, 0, time.UTC)
+	var messages []bunnychat.Message
+	for i := int64(1); i <= 3; i++ {
+		messages = append(messages, bunnychat.Message{
+			ID:        i,
+			Username:  "bob",
+			Body:      fmt.Sprintf("%s %d", chatName, i),
+			Timestamp: start.Add(time.Duration(i) * time.Minute),
+		})
+	}
+	return messages
+}
+
+// newHistoryServer — сервер истории с чатами general, dev и ops. Отметки
+// о прочтении принимаются и ничего не меняют.
+func newHistoryServer(t *testing.T) *httptest.Server {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		query := r.URL.Query()
+		switch {
+		case r.URL.Path == "/v1/chats/history":
+			json.NewEncoder(w).Encode(bunnychat.HistoryResponse{
+				Chat:     query.Get("chat"),
+				Messages: testMessages(query.Get("chat")),
+			})
+		case r.URL.Path == "/v1/chats":
+			json.NewEncoder(w).Encode(bunnychat.ChatsResponse{Chats: []bunnychat.ChatInfo{
+				{Name: "general"},
+				{Name: "dev", Unread: 2},
+			}})
+		case r.Method == http.MethodPut && strings.HasSuffix(r.URL.Path, "/read"):
+			w.WriteHeader(http.StatusNoContent)
+		case strings.HasPrefix(r.URL.Path, "/v1/chats/"):
+			name := strings.TrimPrefix(r.URL.Path, "/v1/chats/")
+			json.NewEncoder(w).Encode(bunnychat.ChatInfo{Name: name, Topic: "тема " + name})
+		default:
+			http.NotFound(w, r)
+		}
+	}))
+	t.Cleanup(server.Close)
+	return server
+}
+
+// recordedOutput запоминает вывод сессии построчно; строки, относящиеся
+// к чату, начинаются с его названия в квадратных скобках.
+type recordedOutput struct {
+	mu    sync.Mutex
+	lines []string
+}
+
+func (o *recordedOutput) add(line string) {
+	o.mu.Lock()
+	defer o.mu.Unlock()
+	o.lines = append(o.lines, line)
+}
+
+func (o *recordedOutput) Info(format string, args ...interface{}) {
+	o.add(fmt.Sprintf(format, args...))
+}
+
+func (o *recordedOutput) Error(format string, args ...interface{}) {
+	o.add("ошибка: " + fmt.Sprintf(format, args...))
+}
+
+func (o *recordedOutput) ChatInfo(chatName, format string, args ...interface{}) {
+	o.add(fmt.Sprintf("[%s] %s", chatName, strings.TrimSpace(fmt.Sprintf(format, args...))))
+}
+
+func (o *recordedOutput) Message(msg rabbitmq.Message) {
+	o.add(fmt.Sprintf("[%s] %s: %s", msg.ChatName, msg.Username, msg.Body))
+}
+
+// take возвращает накопленные строки и очищает вывод.
+func (o *recordedOutput) take() []string {
+	o.mu.Lock()
+	defer o.mu.Unlock()
+	lines := o.lines
+	o.lines = nil
+	return lines
+}
@@ -8,119 +8,213 @@ import (
 	"os"
 	"os/signal"
 	"strings"
+	"sync"
 	"syscall"
+	"time"
 
+	"team-bunny-chat/cli/cache"
 	"team-bunny-chat/cli/client"
+	"team-bunny-chat/cli/render"
 )
 
+const typingTimeout = 5 * time.Second
+
 func main() {
-	username := flag.String("user", "", "Имя пользователя")
-	chatName := flag.String("chat", "", "Название чата")
-	rabbitmqHost := flag.String("rabbitmq", "localhost:5672", "Адрес RabbitMQ сервера")
-	serverHost := flag.String("server", "localhost:8080", "Адрес сервера чата")
-	flag.Parse()
+	os.Exit(run(os.Args[1:]))
+}
 
-	if *username == "" || *chatName == "" {
-		log.Fatal("Необходимо указать имя пользователя (-user) и название чата (-chat)")
+// runChat — интерактивный чат в терминале, обычный или полноэкранный.
+func runChat(args []string) error {
+	fs := flag.NewFlagSet("chat", flag.ContinueOnError)
+	conn := addConnectionFlags(fs, true)
+	chatName := fs.String("chat", "", "Название чата или несколько чатов через запятую")
+	fullscreen := fs.Bool("tui", false, "Полноэкранный режим")
+	limit := fs.Int("limit", 50, "Сколько последних сообщений каждого чата показать при входе")
+	noColor := fs.Bool("no-color", false, "Не выделять текст цветом")
+	useCache := fs.Bool("cache", false, "Хранить историю в зашифрованном локальном кэше")
+	if err := parseFlags(fs, args); err != nil {
+		return err
+	}
+	settings, err := conn.settings()
+	if err != nil {
+		return err
 	}
+	username, serverHost := settings.User, settings.Server
 
-	fmt.Println("Получение истории сообщений...")
-	history, err := rabbitmq.GetChatHistory(*chatName, *serverHost)
+	chatNames := parseChatNames(*chatName)
+	if len(chatNames) == 0 {
+		chatNames = settings.Chats
+	}
+	if username == "" || len(chatNames) == 0 {
+		return usageErrorf("необходимо указать имя пользователя (-user) и название чата (-chat)")
+	}
+	brokerURL, err := settings.BrokerURL()
 	if err != nil {
-		log.Printf("Ошибка при получении истории: %v", err)
-	} else {
-		if len(history.Messages) > 0 {
-			fmt.Println("\nИстория сообщений:")
-			for _, msg := range history.Messages {
-				fmt.Printf("[%s] %s: %s\n",
-					msg.Timestamp.Format("15:04:05"),
-					msg.Username,
-					msg.Body)
-			}
-			fmt.Println("\nКонец истории")
-		} else {
-			fmt.Println("История сообщений пуста")
+		return err
+	}
+	if !isFlagSet(fs, "tui") {
+		*fullscreen = settings.TUI
+	}
+	if *limit <= 0 {
+		return usageErrorf("-limit должен быть положительным")
+	}
+
+	api, err := newAPI(settings)
+	if err != nil {
+		return err
+	}
+	if !isFlagSet(fs, "cache") {
+		*useCache = settings.Cache
+	}
+	var localCache *cache.Cache
+	if *useCache {
+		if localCache, err = openCache(settings); err != nil {
+			return err
 		}
+		defer localCache.Close()
 	}
 
-	client, err := rabbitmq.NewClient(*username, *chatName, *rabbitmqHost)
+	if *fullscreen {
+		client, err := rabbitmq.NewClient(username, chatNames, brokerURL, api)
+		if err != nil {
+			return fmt.Errorf("ошибка создания клиента: %w", err)
+		}
+		defer client.Close()
+
+		ui := newTUI(username, serverHost, render.Options{
+			Color:      render.ColorEnabled(*noColor || settings.NoColor, os.Stdout),
+			Username:   username,
+			TimeFormat: settings.TimeFormat,
+		})
+		session := newChatSession(api, username, serverHost, ui)
+		session.historyLimit = *limit
+		session.cache = localCache
+		session.client = client
+		err = ui.run(session, chatNames)
+		session.out = plainOutput{printer: &messagePrinter{r: newRenderer(settings, *noColor)}}
+		for _, name := range client.Chats() {
+			session.markRead(name)
+		}
+		if err != nil {
+			return fmt.Errorf("ошибка полноэкранного режима: %w", err)
+		}
+		return nil
+	}
+
+	printer := &messagePrinter{r: newRenderer(settings, *noColor)}
+	session := newChatSession(api, username, serverHost, plainOutput{printer: printer})
+	session.historyLimit = *limit
+	session.cache = localCache
+
+	fmt.Println("Получение истории сообщений...")
+	for _, name := range chatNames {
+		session.showHistory(name)
+		session.showTopic(name)
+	}
+
+	client, err := rabbitmq.NewClient(username, chatNames, brokerURL, api)
 	if err != nil {
-		log.Fatalf("Ошибка создания клиента: %v", err)
+		return fmt.Errorf("ошибка создания клиента: %w", err)
 	}
 	defer client.Close()
+	session.client = client
 
 	sigChan := make(chan os.Signal, 1)
 	signal.Notify(sigChan, syscall.SIGINT, syscall.SIGTERM)
 
 	go func() {
 		for msg := range client.Messages() {
-			fmt.Printf("\n[%s] %s: %s\n> ",
-				msg.Timestamp.Format("15:04:05"),
-				msg.Username,
-				msg.Body)
+			session.remember(msg)
+			bell := ""
+			if isMention(msg, username) {
+				bell = "\a"
+			}
+			fmt.Printf("\n%s%s\n> ", bell, printer.format(msg))
+		}
+	}()
+
+	go func() {
+		for state := range client.States() {
+			if state.Connected {
+				fmt.Print("\r\033[K* Соединение восстановлено\n> ")
+			} else {
+				fmt.Printf("\r\033[K* Соединение потеряно (%v), переподключение…\n> ", state.Err)
+			}
+		}
+	}()
+
+	go func() {
+		typers := make(map[string]time.Time)
+		for event := range client.Typing() {
+			if event.ChatName != client.GetCurrentChat() {
+				continue
+			}
+			if time.Since(typers[event.Username]) > typingTimeout {
+				fmt.Printf("\r\033[K* %s печатает…\n> ", event.Username)
+			}
+			typers[event.Username] = time.Now()
 		}
 	}()
 
 	scanner := bufio.NewScanner(os.Stdin)
+	if len(chatNames) > 1 {
+		fmt.Printf("> Подписки: %s\n", strings.Join(chatNames, ", "))
+	}
 	fmt.Printf("> Вы находитесь в чате: %s\n> ", client.GetCurrentChat())
 
 	go func() {
 		for scanner.Scan() {
-			text := scanner.Text()
-			
-			if strings.HasPrefix(text, "/") {
-				parts := strings.Fields(text)
-				command := parts[0]
-				
-				switch command {
-				case "/quit":
-					sigChan <- syscall.SIGINT
-					return
-				case "/switch":
-					if len(parts) < 2 {
-						fmt.Println("Использование: /switch <название_чата>")
-						fmt.Print("> ")
-						continue
-					}
-					newChat := parts[1]
-					
-					if err := client.SwitchChat(newChat); err != nil {
-						log.Printf("Ошибка при переключении чата: %v", err)
-					} else {
-						fmt.Printf("Вы переключились в чат: %s\n", newChat)
-					}
-					
-					fmt.Printf("\nПолучение истории чата %s...\n", newChat)
-					history, err := rabbitmq.GetChatHistory(newChat, *serverHost)
-					if err != nil {
-						log.Printf("Ошибка при получении истории: %v", err)
-					} else {
-						if len(history.Messages) > 0 {
-							fmt.Println("\nИстория сообщений:")
-							for _, msg := range history.Messages {
-								fmt.Printf("[%s] %s: %s\n",
-									msg.Timestamp.Format("15:04:05"),
-									msg.Username,
-									msg.Body)
-							}
-							fmt.Println("\nКонец истории")
-						} else {
-							fmt.Println("История сообщений пуста")
-						}
-					}
-				default:
-					fmt.Printf("Неизвестная команда: %s\nДоступные команды:\n/switch <чат> - сменить чат\n/quit - выйти\n", command)
-				}
-			} else {
-				if err := client.SendMessage(text); err != nil {
-					log.Printf("Ошибка отправки сообщения: %v", err)
-				}
+			session.handleInput(scanner.Text())
+			select {
+			case <-session.quit:
+				return
+			default:
 			}
-
 			fmt.Print("> ")
 		}
 	}()
 
-	<-sigChan
+	select {
+	case <-sigChan:
+	case <-session.quit:
+	}
 	fmt.Println("\nЗавершение работы...")
+	for _, name := range client.Chats() {
+		session.markRead(name)
+	}
+	return nil
+}
+
+// plainOutput печатает результат команд прямо в терминал.
+type plainOutput struct {
+	printer *messagePrinter
+}
+
+func (plainOutput) Info(format string, args ...interface{}) {
+	fmt.Printf(format+"\n", args...)
+}
+
+func (plainOutput) Error(format string, args ...interface{}) {
+	log.Printf(format, args...)
+}
+
+func (p plainOutput) ChatInfo(_, format string, args ...interface{}) {
+	p.Info(format, args...)
+}
+
+func (p plainOutput) Message(msg rabbitmq.Message) {
+	fmt.Println(p.printer.format(msg))
+}
+
+// messagePrinter — общий оформитель для истории и новых сообщений, чтобы
+// разделители дат не повторялись. Сообщения приходят из разных горутин.
+type messagePrinter struct {
+	mu sync.Mutex
+	r  *render.Renderer
+}
+
+func (p *messagePrinter) format(msg rabbitmq.Message) string {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	return p.r.Message(msg)
 }
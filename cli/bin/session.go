@@ -0,0 +1,561 @@
+package main
+
+import (
+	"strconv"
+	"strings"
+	"sync"
+
+	"team-bunny-chat/bunnychat"
+	"team-bunny-chat/cli/cache"
+	"team-bunny-chat/cli/client"
+)
+
+// output — куда команды выводят результат: обычный терминал или
+// полноэкранный интерфейс.
+type output interface {
+	Info(format string, args ...interface{})
+	Error(format string, args ...interface{})
+	// ChatInfo — служебная строка, относящаяся к конкретному чату
+	// (заголовок истории, тема).
+	ChatInfo(chatName, format string, args ...interface{})
+	Message(msg rabbitmq.Message)
+}
+
+var commandNames = []string{
+	"/join", "/leave", "/focus", "/switch", "/list", "/who",
+	"/history", "/search", "/topic", "/pin", "/unpin", "/pins", "/help", "/quit",
+}
+
+// searchLimit — сколько найденных сообщений показывать.
+const searchLimit = 50
+
+// chatCommands — команды, аргумент которых — название чата.
+var chatCommands = []string{"/join", "/leave", "/focus", "/switch"}
+
+const helpText = `Доступные команды:
+/join <чат>[,<чат>] - подписаться на чаты
+/leave [чат] - отписаться от чата
+/focus <чат> - выбрать чат для отправки сообщений
+/switch <чат> - сменить чат
+/list - список чатов
+/who - кто сейчас в чате
+/history [n] - показать n более ранних сообщений
+/search <текст> - найти сообщения в чате
+/topic [текст] - показать или сменить тему
+/pin <id>, /unpin <id> - закрепить или открепить сообщение
+/pins - закрепленные сообщения
+/quit - выйти`
+
+// chatSession выполняет введенные пользователем строки: команды и
+// отправку сообщений. Общая для обычного и полноэкранного режимов.
+type chatSession struct {
+	client     *rabbitmq.Client
+	api        *bunnychat.API
+	username   string
+	serverHost string
+	out        output
+	// historyLimit — сколько сообщений показывать при входе в чат и
+	// по /history без аргумента.
+	historyLimit int
+	// cache — локальный кэш истории; nil, если он выключен.
+	cache *cache.Cache
+
+	mu sync.Mutex
+	// oldest — id самого раннего показанного сообщения каждого чата, от
+	// него /history листает назад.
+	oldest map[string]int64
+
+	quit     chan struct{}
+	quitOnce sync.Once
+}
+
+func newChatSession(api *bunnychat.API, username, serverHost string, out output) *chatSession {
+	return &chatSession{
+		api:        api,
+		username:   username,
+		serverHost: serverHost,
+		out:        out,
+		oldest:     make(map[string]int64),
+		quit:       make(chan struct{}),
+	}
+}
+
+func (s *chatSession) stop() {
+	s.quitOnce.Do(func() { close(s.quit) })
+}
+
+func (s *chatSession) handleInput(text string) {
+	if strings.TrimSpace(text) == "" {
+		return
+	}
+	command, ok := bunnychat.ParseCommand(text)
+	if !ok {
+		s.send(text)
+		return
+	}
+
+	args := command.Args
+	current := s.client.GetCurrentChat()
+
+	switch command.Name {
+	case "quit":
+		s.stop()
+	case "switch":
+		if len(args) < 1 {
+			s.out.Info("Использование: /switch <название_чата>")
+			return
+		}
+		newChat := args[0]
+
+		if err := s.client.SwitchChat(newChat); err != nil {
+			s.out.Error("Ошибка при переключении чата: %v", err)
+		} else {
+			s.out.Info("Вы переключились в чат: %s", newChat)
+			s.markRead(current)
+		}
+
+		s.out.ChatInfo(newChat, "\nПолучение истории чата %s...", newChat)
+		s.showHistory(newChat)
+		s.showTopic(newChat)
+	case "join":
+		if len(args) < 1 {
+			s.out.Info("Использование: /join <чат>[,<чат>...]")
+			return
+		}
+		for _, name := range parseChatNames(strings.Join(args, ",")) {
+			if err := s.client.Join(name); err != nil {
+				s.out.Error("Ошибка при подписке на чат %s: %v", name, err)
+				continue
+			}
+			s.out.Info("Вы подписались на чат: %s", name)
+			s.showHistory(name)
+			s.showTopic(name)
+		}
+	case "leave":
+		name := current
+		if len(args) > 0 {
+			name = args[0]
+		}
+		if err := s.client.Leave(name); err != nil {
+			s.out.Error("Ошибка при отписке от чата: %v", err)
+			return
+		}
+		s.markRead(name)
+		s.out.Info("Вы отписались от чата: %s\nСообщения отправляются в чат: %s", name, s.client.GetCurrentChat())
+	case "focus":
+		if len(args) < 1 {
+			s.out.Info("Сообщения отправляются в чат: %s", current)
+			return
+		}
+		if err := s.client.Focus(args[0]); err != nil {
+			s.out.Error("%v (подпишитесь командой /join)", err)
+			return
+		}
+		s.out.Info("Сообщения отправляются в чат: %s", args[0])
+	case "list":
+		chats, err := s.api.Chats()
+		if err != nil {
+			s.out.Error("Ошибка при получении списка чатов: %v", err)
+			return
+		}
+		if len(chats.Chats) == 0 {
+			s.out.Info("Чатов пока нет")
+			return
+		}
+		joined := s.client.Chats()
+		for _, chat := range chats.Chats {
+			marker := " "
+			if chat.Name == current {
+				marker = "*"
+			} else if containsChat(joined, chat.Name) {
+				marker = "+"
+			}
+			if chat.Unread > 0 && marker == " " {
+				s.out.Info("%s %s (%d)", marker, chat.Name, chat.Unread)
+			} else {
+				s.out.Info("%s %s", marker, chat.Name)
+			}
+		}
+	case "pin", "unpin":
+		if len(args) < 1 {
+			s.out.Info("Использование: /%s <id_сообщения>", command.Name)
+			return
+		}
+		messageID, err := bunnychat.ParseMessageID(args[0])
+		if err != nil {
+			s.out.Info("Некорректный id сообщения: %s", args[0])
+			return
+		}
+		if command.Name == "pin" {
+			err = s.api.Pin(current, messageID)
+		} else {
+			err = s.api.Unpin(current, messageID)
+		}
+		if err != nil {
+			s.out.Error("Ошибка при изменении закрепления: %v", err)
+		} else if command.Name == "pin" {
+			s.out.Info("Сообщение #%d закреплено", messageID)
+		} else {
+			s.out.Info("Сообщение #%d откреплено", messageID)
+		}
+	case "pins":
+		pins, err := s.api.Pins(current)
+		if err != nil {
+			s.out.Error("Ошибка при получении закрепленных сообщений: %v", err)
+		} else if len(pins.Pins) == 0 {
+			s.out.Info("Закрепленных сообщений нет")
+		} else {
+			s.out.Info("Закрепленные сообщения:")
+			for _, pin := range pins.Pins {
+				s.out.Message(pin.Message)
+			}
+		}
+	case "topic":
+		topic := command.Text
+		if topic == "" {
+			s.showTopic(current)
+			return
+		}
+		if err := s.api.SetTopic(current, topic); err != nil {
+			s.out.Error("Ошибка при смене темы: %v", err)
+		} else {
+			s.out.Info("Тема чата: %s", topic)
+		}
+	case "who":
+		members, err := s.api.Members(current, true)
+		if err != nil {
+			s.out.Error("Ошибка при получении участников: %v", err)
+		} else if len(members.Members) == 0 {
+			s.out.Info("Сейчас в чате никого нет")
+		} else {
+			names := make([]string, 0, len(members.Members))
+			for _, m := range members.Members {
+				names = append(names, m.Username)
+			}
+			s.out.Info("Сейчас в чате %s: %s", members.Chat, strings.Join(names, ", "))
+		}
+	case "history":
+		limit := s.historyLimit
+		if len(args) > 0 {
+			n, err := strconv.Atoi(args[0])
+			if err != nil || n <= 0 {
+				s.out.Info("Использование: /history [количество]")
+				return
+			}
+			limit = n
+		}
+		s.showOlderHistory(current, limit)
+	case "search":
+		if command.Text == "" {
+			s.out.Info("Использование: /search <текст>")
+			return
+		}
+		s.search(current, command.Text)
+	case "help":
+		s.out.Info(helpText)
+	default:
+		s.out.Info("Неизвестная команда: /%s\n%s", command.Name, helpText)
+	}
+}
+
+func (s *chatSession) send(text string) {
+	if err := s.client.SendMessage(text); err != nil {
+		s.out.Error("Ошибка отправки сообщения: %v", err)
+	} else if !s.client.Connected() {
+		s.out.Info("Нет связи: сообщение будет отправлено после переподключения")
+	}
+}
+
+func (s *chatSession) showHistory(chatName string) {
+	if s.cache != nil {
+		s.showCachedHistory(chatName)
+		return
+	}
+
+	history, err := rabbitmq.GetChatHistory(s.api, chatName, s.historyLimit)
+	if err != nil {
+		s.out.Error("%v", err)
+		return
+	}
+
+	if len(history.Messages) == 0 {
+		s.out.ChatInfo(chatName, "История сообщений пуста")
+		return
+	}
+
+	s.out.ChatInfo(chatName, "\nИстория сообщений:")
+	dividerShown := history.LastReadID == 0
+	for _, msg := range history.Messages {
+		if !dividerShown && msg.ID > history.LastReadID {
+			s.out.ChatInfo(chatName, "──── непрочитанные ────")
+			dividerShown = true
+		}
+		s.out.Message(msg)
+	}
+	s.out.ChatInfo(chatName, "\nКонец истории")
+	s.setOldest(chatName, history.Messages[0].ID)
+
+	lastID := history.Messages[len(history.Messages)-1].ID
+	if err := s.api.MarkRead(chatName, lastID); err != nil {
+		s.out.Error("Ошибка при отметке прочтения: %v", err)
+	}
+}
+
+// showOlderHistory показывает limit сообщений перед самым ранним из уже
+// показанных.
+func (s *chatSession) showOlderHistory(chatName string, limit int) {
+	s.mu.Lock()
+	beforeID, ok := s.oldest[chatName]
+	s.mu.Unlock()
+	if !ok {
+		s.showHistory(chatName)
+		return
+	}
+	if beforeID <= 1 {
+		s.out.ChatInfo(chatName, "Более ранних сообщений нет")
+		return
+	}
+
+	history, err := s.olderHistory(chatName, beforeID, limit)
+	if err != nil {
+		s.out.Error("%v", err)
+		return
+	}
+	if len(history.Messages) == 0 {
+		s.setOldest(chatName, 1)
+		s.out.ChatInfo(chatName, "Более ранних сообщений нет")
+		return
+	}
+
+	s.out.ChatInfo(chatName, "\nБолее ранние сообщения:")
+	for _, msg := range history.Messages {
+		s.out.Message(msg)
+	}
+	s.setOldest(chatName, history.Messages[0].ID)
+}
+
+// showCachedHistory сразу показывает сохраненную историю, затем догружает
+// с сервера то, чего нет в кэше. Без связи с сервером остается
+// сохраненная история.
+func (s *chatSession) showCachedHistory(chatName string) {
+	cached, err := s.cache.Recent(chatName, s.historyLimit)
+	if err != nil {
+		s.out.Error("%v", err)
+	}
+	if len(cached) > 0 {
+		s.out.ChatInfo(chatName, "\nСохраненная история:")
+		for _, msg := range cached {
+			s.out.Message(msg)
+		}
+		if id := oldestID(cached); id != 0 {
+			s.setOldest(chatName, id)
+		}
+	}
+
+	history, err := s.cache.Sync(s.api, chatName)
+	if err != nil {
+		if len(cached) > 0 {
+			s.out.Error("Нет связи с сервером, показана сохраненная история: %v", err)
+		} else {
+			s.out.Error("Ошибка при получении истории: %v", err)
+		}
+		return
+	}
+
+	fresh := unseen(history.Messages, cached)
+	if len(cached) == 0 && len(fresh) == 0 {
+		s.out.ChatInfo(chatName, "История сообщений пуста")
+		return
+	}
+	if skipped := len(fresh) - s.historyLimit; skipped > 0 {
+		s.out.ChatInfo(chatName, "Пропущено новых сообщений: %d, найти их можно через /search", skipped)
+		fresh = fresh[skipped:]
+	}
+	if len(fresh) > 0 {
+		if len(cached) > 0 {
+			s.out.ChatInfo(chatName, "\nНовые сообщения:")
+		} else {
+			s.out.ChatInfo(chatName, "\nИстория сообщений:")
+		}
+		dividerShown := history.LastReadID == 0
+		for _, msg := range fresh {
+			if !dividerShown && msg.ID > history.LastReadID {
+				s.out.ChatInfo(chatName, "──── непрочитанные ────")
+				dividerShown = true
+			}
+			s.out.Message(msg)
+		}
+		if len(cached) == 0 {
+			s.setOldest(chatName, fresh[0].ID)
+		}
+	}
+	s.out.ChatInfo(chatName, "\nКонец истории")
+
+	if lastID := newestID(append(cached, fresh...)); lastID != 0 {
+		if err := s.api.MarkRead(chatName, lastID); err != nil {
+			s.out.Error("Ошибка при отметке прочтения: %v", err)
+		}
+	}
+}
+
+// olderHistory берет более ранние сообщения из кэша, а если их там
+// меньше limit, — с сервера, сохраняя их в кэш.
+func (s *chatSession) olderHistory(chatName string, beforeID int64, limit int) (*rabbitmq.HistoryResponse, error) {
+	if s.cache == nil {
+		return rabbitmq.GetOlderHistory(s.api, chatName, beforeID, limit)
+	}
+
+	cached, err := s.cache.Before(chatName, beforeID, limit)
+	if err != nil {
+		return nil, err
+	}
+	if len(cached) == limit {
+		return &rabbitmq.HistoryResponse{Chat: chatName, Messages: cached}, nil
+	}
+	history, err := rabbitmq.GetOlderHistory(s.api, chatName, beforeID, limit)
+	if err != nil {
+		if len(cached) > 0 {
+			s.out.Error("Нет связи с сервером, показана сохраненная история: %v", err)
+			return &rabbitmq.HistoryResponse{Chat: chatName, Messages: cached}, nil
+		}
+		return nil, err
+	}
+	if err := s.cache.Store(history.Messages...); err != nil {
+		s.out.Error("%v", err)
+	}
+	return history, nil
+}
+
+// remember сохраняет пришедшее сообщение в кэш.
+func (s *chatSession) remember(msg rabbitmq.Message) {
+	if s.cache == nil {
+		return
+	}
+	if err := s.cache.Store(msg); err != nil {
+		s.out.Error("%v", err)
+	}
+}
+
+// search ищет в кэше, а без него — на сервере.
+func (s *chatSession) search(chatName, text string) {
+	var found []rabbitmq.Message
+	if s.cache != nil {
+		var err error
+		if found, err = s.cache.Search(chatName, text, searchLimit); err != nil {
+			s.out.Error("%v", err)
+			return
+		}
+	} else {
+		results, err := s.api.Search(bunnychat.SearchQuery{Text: text, Chats: []string{chatName}, Limit: searchLimit})
+		if err != nil {
+			s.out.Error("Ошибка поиска: %v", err)
+			return
+		}
+		for _, result := range results.Results {
+			result.Message.ChatName = result.Chat
+			found = append(found, result.Message)
+		}
+	}
+
+	if len(found) == 0 {
+		s.out.ChatInfo(chatName, "Ничего не найдено: %s", text)
+		return
+	}
+	s.out.ChatInfo(chatName, "\nНайдено сообщений: %d", len(found))
+	for _, msg := range found {
+		s.out.Message(msg)
+	}
+}
+
+func (s *chatSession) setOldest(chatName string, id int64) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.oldest[chatName] = id
+}
+
+func (s *chatSession) showTopic(chatName string) {
+	info, err := s.api.Chat(chatName)
+	if err != nil {
+		s.out.Error("Ошибка при получении информации о чате: %v", err)
+		return
+	}
+	if info.Topic != "" {
+		s.out.ChatInfo(chatName, "Тема чата: %s", info.Topic)
+	}
+}
+
+// markRead отмечает прочитанным всё, что пришло в чат, пока он был открыт.
+func (s *chatSession) markRead(chatName string) {
+	if err := s.api.MarkRead(chatName, 0); err != nil {
+		s.out.Error("Ошибка при отметке прочтения: %v", err)
+	}
+}
+
+// oldestID возвращает id самого раннего сообщения, пропуская сообщения без
+// id, которые сервер еще не сохранил.
+func oldestID(msgs []rabbitmq.Message) int64 {
+	for _, msg := range msgs {
+		if msg.ID != 0 {
+			return msg.ID
+		}
+	}
+	return 0
+}
+
+func newestID(msgs []rabbitmq.Message) int64 {
+	for i := len(msgs) - 1; i >= 0; i-- {
+		if msgs[i].ID != 0 {
+			return msgs[i].ID
+		}
+	}
+	return 0
+}
+
+// unseen отбрасывает из fresh уже показанные сообщения cached. Сообщения
+// из кэша без id сравниваются по автору, тексту и времени.
+func unseen(fresh, cached []rabbitmq.Message) []rabbitmq.Message {
+	shownID := newestID(cached)
+	var result []rabbitmq.Message
+	for _, msg := range fresh {
+		if msg.ID <= shownID || shownLive(msg, cached) {
+			continue
+		}
+		result = append(result, msg)
+	}
+	return result
+}
+
+func shownLive(msg rabbitmq.Message, cached []rabbitmq.Message) bool {
+	for _, c := range cached {
+		if c.ID == 0 && c.Username == msg.Username && c.Body == msg.Body && c.Timestamp.Equal(msg.Timestamp) {
+			return true
+		}
+	}
+	return false
+}
+
+// parseChatNames разбирает список чатов через запятую, пропуская пустые
+// и повторяющиеся.
+func parseChatNames(value string) []string {
+	var names []string
+	for _, name := range strings.Split(value, ",") {
+		name = strings.TrimSpace(name)
+		if name != "" && !containsChat(names, name) {
+			names = append(names, name)
+		}
+	}
+	return names
+}
+
+func containsChat(chats []string, chatName string) bool {
+	for _, name := range chats {
+		if name == chatName {
+			return true
+		}
+	}
+	return false
+}
+
+func isMention(msg rabbitmq.Message, username string) bool {
+	return msg.Username != username && bunnychat.MentionsUser(msg.Body, username)
+}
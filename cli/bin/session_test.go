@@ -0,0 +1,99 @@
+package main
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"team-bunny-chat/bunnychat"
+	"team-bunny-chat/cli/client"
+)
+
+// newTestSession — сессия alice, подписанная на chatNames, с тестовым
+// сервером истории и брокером в памяти.
+func newTestSession(t *testing.T, chatNames ...string) (*chatSession, *recordedOutput, *fakeBroker) {
+	broker := useFakeBroker(t)
+	server := newHistoryServer(t)
+	api := bunnychat.NewAPI(server.URL, "alice")
+	out := &recordedOutput{}
+
+	session := newChatSession(api, "alice", server.URL, out)
+	session.historyLimit = 10
+	client, err := rabbitmq.NewClient("alice", chatNames, "fake:5672", api)
+	require.NoError(t, err)
+	t.Cleanup(client.Close)
+	session.client = client
+	return session, out, broker
+}
+
+func TestSessionJoinSeveralChats(t *testing.T) {
+	session, out, broker := newTestSession(t, "general")
+
+	session.handleInput("/join dev, ops")
+	assert.Equal(t, []string{"general", "dev", "ops"}, session.client.Chats())
+	assert.Equal(t, "general", session.client.GetCurrentChat(), "подписка не меняет чат для отправки")
+	assert.True(t, broker.bound("dev"))
+	assert.True(t, broker.bound("ops"))
+
+	lines := out.take()
+	assert.Contains(t, lines, "Вы подписались на чат: dev")
+	assert.Contains(t, lines, "[dev] bob: dev 1", "история выводится в свой чат")
+	assert.Contains(t, lines, "[ops] bob: ops 3")
+	assert.Contains(t, lines, "[ops] Тема чата: тема ops")
+	assert.NotContains(t, lines, "[general] bob: dev 1")
+
+	session.handleInput("/join")
+	assert.Equal(t, []string{"Использование: /join <чат>[,<чат>...]"}, out.take())
+}
+
+func TestSessionFocusAndLeave(t *testing.T) {
+	session, out, broker := newTestSession(t, "general", "dev", "ops")
+
+	tests := []struct {
+		name    string
+		input   string
+		want    string
+		current string
+	}{
+		{name: "Сообщение в первый чат", input: "всем привет", current: "general"},
+		{name: "Текущий чат", input: "/focus", want: "Сообщения отправляются в чат: general", current: "general"},
+		{name: "Смена чата для отправки", input: "/focus ops", want: "Сообщения отправляются в чат: ops", current: "ops"},
+		{name: "Сообщение в выбранный чат", input: "только для ops", current: "ops"},
+		{name: "Чат без подписки", input: "/focus random", want: "ошибка: вы не подписаны на чат random (подпишитесь командой /join)", current: "ops"},
+		{name: "Выход из выбранного чата", input: "/leave ops", want: "Вы отписались от чата: ops\nСообщения отправляются в чат: general", current: "general"},
+		{name: "Выход из другого чата", input: "/leave dev", want: "Вы отписались от чата: dev\nСообщения отправляются в чат: general", current: "general"},
+		{name: "Последний чат покинуть нельзя", input: "/leave", want: "ошибка: Ошибка при отписке от чата: нельзя покинуть последний чат", current: "general"},
+		{name: "Выход из чата без подписки", input: "/leave ops", want: "ошибка: Ошибка при отписке от чата: вы не подписаны на чат ops", current: "general"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			session.handleInput(tt.input)
+			lines := out.take()
+			if tt.want != "" {
+				assert.Equal(t, []string{tt.want}, lines)
+			}
+			assert.Equal(t, tt.current, session.client.GetCurrentChat())
+		})
+	}
+
+	assert.Equal(t, []string{"всем привет"}, broker.sent("general"))
+	assert.Equal(t, []string{"только для ops"}, broker.sent("ops"))
+	assert.Empty(t, broker.sent("dev"))
+	assert.False(t, broker.bound("ops"))
+	assert.False(t, broker.bound("dev"))
+	assert.Equal(t, []string{"general"}, session.client.Chats())
+}
+
+func TestSessionList(t *testing.T) {
+	session, out, _ := newTestSession(t, "dev", "general")
+
+	session.handleInput("/list")
+	assert.Equal(t, []string{"+ general", "* dev"}, out.take(), "текущий чат отмечен *, остальные подписки +")
+
+	session.handleInput("/focus general")
+	out.take()
+	session.handleInput("/list")
+	assert.Equal(t, []string{"* general", "+ dev"}, out.take())
+}
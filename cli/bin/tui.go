@@ -0,0 +1,460 @@
+package main
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/gdamore/tcell/v2"
+	"github.com/rivo/tview"
+
+	"team-bunny-chat/cli/client"
+	"team-bunny-chat/cli/render"
+)
+
+const (
+	// chatsPollInterval — как часто обновлять список чатов сервера и
+	// участников активного чата.
+	chatsPollInterval = 15 * time.Second
+	sidebarWidth      = 24
+	// maxChatLines ограничивает буфер строк каждого чата.
+	maxChatLines = 2000
+)
+
+// tui — полноэкранный режим: список чатов слева, сообщения активного чата
+// справа, строка состояния и строка ввода внизу. Поля ниже app меняются
+// только в горутине tview (через update).
+type tui struct {
+	username   string
+	serverHost string
+	session    *chatSession
+
+	app      *tview.Application
+	sidebar  *tview.TextView
+	messages *tview.TextView
+	status   *tview.TextView
+	input    *tview.InputField
+
+	shown     string
+	buffers   map[string][]string
+	render    render.Options
+	renderers map[string]*render.Renderer
+	unread    map[string]int
+	remote    map[string]int
+	users     map[string]bool
+	typers    map[string]time.Time
+	connected bool
+	hint      string
+
+	history    []string
+	historyPos int
+}
+
+// newTUI создает интерфейс; opts задают оформление сообщений, перенос
+// строк делает сам tview.
+func newTUI(username, serverHost string, opts render.Options) *tui {
+	t := &tui{
+		username:   username,
+		serverHost: serverHost,
+		app:        tview.NewApplication(),
+		sidebar:    tview.NewTextView(),
+		messages:   tview.NewTextView(),
+		status:     tview.NewTextView(),
+		input:      tview.NewInputField(),
+		buffers:    make(map[string][]string),
+		render:     opts,
+		renderers:  make(map[string]*render.Renderer),
+		unread:     make(map[string]int),
+		remote:     make(map[string]int),
+		users:      make(map[string]bool),
+		typers:     make(map[string]time.Time),
+		connected:  true,
+	}
+
+	t.sidebar.SetDynamicColors(true).SetBorder(true).SetTitle(" Чаты ")
+	t.messages.SetDynamicColors(true).SetScrollable(true).SetWrap(true).SetBorder(true)
+	t.status.SetDynamicColors(true).SetBackgroundColor(tcell.ColorDarkBlue)
+	t.input.SetLabel("> ").SetFieldBackgroundColor(tcell.ColorDefault)
+
+	body := tview.NewFlex().
+		AddItem(t.sidebar, sidebarWidth, 0, false).
+		AddItem(t.messages, 0, 1, false)
+	root := tview.NewFlex().SetDirection(tview.FlexRow).
+		AddItem(body, 0, 1, false).
+		AddItem(t.status, 1, 0, false).
+		AddItem(t.input, 1, 0, true)
+	t.app.SetRoot(root, true).SetFocus(t.input)
+
+	return t
+}
+
+// run показывает интерфейс и блокируется до /quit или Ctrl+C.
+func (t *tui) run(s *chatSession, chatNames []string) error {
+	t.session = s
+	client := s.client
+
+	t.input.SetDoneFunc(func(key tcell.Key) {
+		if key != tcell.KeyEnter {
+			return
+		}
+		text := t.input.GetText()
+		if strings.TrimSpace(text) == "" {
+			return
+		}
+		t.history = append(t.history, text)
+		t.historyPos = len(t.history)
+		t.hint = ""
+		t.input.SetText("")
+		go s.handleInput(text)
+	})
+	t.input.SetChangedFunc(func(text string) {
+		if text != "" && !strings.HasPrefix(text, "/") {
+			go client.SendTyping()
+		}
+	})
+	t.input.SetInputCapture(t.handleInputKey)
+	t.app.SetInputCapture(t.handleGlobalKey)
+
+	go func() {
+		for msg := range client.Messages() {
+			msg := msg
+			s.remember(msg)
+			t.update(func() { t.receive(msg) })
+		}
+	}()
+	go func() {
+		for state := range client.States() {
+			state := state
+			t.update(func() {
+				t.connected = state.Connected
+				if state.Connected {
+					t.appendLine(t.active(), "[green]* Соединение восстановлено[-]")
+				} else {
+					t.appendLine(t.active(), "[red]"+tview.Escape(fmt.Sprintf("* Соединение потеряно (%v), переподключение…", state.Err))+"[-]")
+				}
+			})
+		}
+	}()
+	go func() {
+		for event := range client.Typing() {
+			name := event.Username
+			t.update(func() { t.typers[name] = time.Now() })
+			time.AfterFunc(typingTimeout, func() { t.update(func() {}) })
+		}
+	}()
+	go func() {
+		<-s.quit
+		t.app.Stop()
+	}()
+	go func() {
+		for _, name := range chatNames {
+			s.showHistory(name)
+			s.showTopic(name)
+		}
+		t.poll(s)
+	}()
+
+	t.refresh()
+	return t.app.Run()
+}
+
+// poll периодически обновляет список чатов сервера с непрочитанными и
+// участников активного чата для дополнения имен.
+func (t *tui) poll(s *chatSession) {
+	ticker := time.NewTicker(chatsPollInterval)
+	defer ticker.Stop()
+	for {
+		remote := make(map[string]int)
+		if chats, err := s.api.Chats(); err == nil {
+			for _, chat := range chats.Chats {
+				remote[chat.Name] = chat.Unread
+			}
+		}
+		var names []string
+		if members, err := s.api.Members(s.client.GetCurrentChat(), false); err == nil {
+			for _, m := range members.Members {
+				names = append(names, m.Username)
+			}
+		}
+		t.update(func() {
+			t.remote = remote
+			for _, name := range names {
+				t.users[name] = true
+			}
+		})
+
+		select {
+		case <-s.quit:
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+func (t *tui) Info(format string, args ...interface{}) {
+	text := fmt.Sprintf(format, args...)
+	t.update(func() { t.appendLine(t.active(), "[gray]"+tview.Escape(text)+"[-]") })
+}
+
+func (t *tui) Error(format string, args ...interface{}) {
+	text := fmt.Sprintf(format, args...)
+	t.update(func() { t.appendLine(t.active(), "[red]"+tview.Escape(text)+"[-]") })
+}
+
+func (t *tui) ChatInfo(chatName, format string, args ...interface{}) {
+	text := fmt.Sprintf(format, args...)
+	t.update(func() { t.appendLine(chatName, "[gray]"+tview.Escape(text)+"[-]") })
+}
+
+// Message выводит сообщение из истории или закреплений — без учета
+// в непрочитанных.
+func (t *tui) Message(msg rabbitmq.Message) {
+	t.update(func() {
+		t.users[msg.Username] = true
+		t.appendLine(msg.ChatName, t.formatLine(msg))
+	})
+}
+
+func (t *tui) receive(msg rabbitmq.Message) {
+	t.users[msg.Username] = true
+	delete(t.typers, msg.Username)
+	t.appendLine(msg.ChatName, t.formatLine(msg))
+	if msg.ChatName != t.active() {
+		t.unread[msg.ChatName]++
+	}
+}
+
+// formatLine оформляет сообщение и переводит ANSI-коды в теги tview. У
+// каждого чата свой оформитель: разделители дат идут в его буфере.
+func (t *tui) formatLine(msg rabbitmq.Message) string {
+	r, ok := t.renderers[msg.ChatName]
+	if !ok {
+		r = render.New(t.render)
+		t.renderers[msg.ChatName] = r
+	}
+	return tview.TranslateANSI(tview.Escape(r.Message(msg)))
+}
+
+// update выполняет f в горутине tview и перерисовывает боковую панель,
+// строку состояния и, если активный чат сменился, список сообщений.
+func (t *tui) update(f func()) {
+	t.app.QueueUpdateDraw(func() {
+		f()
+		t.refresh()
+	})
+}
+
+func (t *tui) active() string {
+	return t.session.client.GetCurrentChat()
+}
+
+func (t *tui) appendLine(chatName, line string) {
+	lines := append(t.buffers[chatName], line)
+	if len(lines) > maxChatLines {
+		lines = lines[len(lines)-maxChatLines:]
+	}
+	t.buffers[chatName] = lines
+	if chatName == t.shown {
+		fmt.Fprintln(t.messages, line)
+	}
+}
+
+func (t *tui) refresh() {
+	active := t.active()
+	if active != t.shown {
+		t.shown = active
+		t.unread[active] = 0
+		t.messages.SetTitle(" " + tview.Escape(active) + " ")
+		t.messages.SetText(strings.Join(t.buffers[active], "\n") + "\n")
+		t.messages.ScrollToEnd()
+	}
+	t.drawSidebar()
+	t.drawStatus()
+}
+
+func (t *tui) drawSidebar() {
+	var b strings.Builder
+	joined := t.session.client.Chats()
+	for _, name := range joined {
+		line := tview.Escape(name)
+		if count := t.unread[name]; count > 0 {
+			line = fmt.Sprintf("[yellow]%s (%d)[-]", line, count)
+		}
+		if name == t.shown {
+			line = "[::b]› " + line + "[::-]"
+		} else {
+			line = "  " + line
+		}
+		b.WriteString(line + "\n")
+	}
+
+	var others []string
+	for name := range t.remote {
+		if !containsChat(joined, name) {
+			others = append(others, name)
+		}
+	}
+	sort.Strings(others)
+	if len(others) > 0 {
+		b.WriteString("[gray]──────────[-]\n")
+	}
+	for _, name := range others {
+		line := "  " + tview.Escape(name)
+		if count := t.remote[name]; count > 0 {
+			line += fmt.Sprintf(" (%d)", count)
+		}
+		b.WriteString("[gray]" + line + "[-]\n")
+	}
+	t.sidebar.SetText(b.String())
+}
+
+func (t *tui) drawStatus() {
+	state := "[green]● в сети[-]"
+	if !t.connected {
+		state = "[red]○ нет связи[-]"
+	}
+	parts := []string{
+		tview.Escape(t.username + "@" + t.serverHost),
+		state,
+		tview.Escape(t.shown),
+	}
+
+	var typing []string
+	for name, at := range t.typers {
+		if time.Since(at) > typingTimeout {
+			delete(t.typers, name)
+		} else if name != t.username {
+			typing = append(typing, name)
+		}
+	}
+	if len(typing) > 0 {
+		sort.Strings(typing)
+		parts = append(parts, tview.Escape(strings.Join(typing, ", ")+" печатает…"))
+	}
+	if t.hint != "" {
+		parts = append(parts, "[gray]"+tview.Escape(t.hint)+"[-]")
+	}
+	t.status.SetText(" " + strings.Join(parts, " │ "))
+}
+
+// handleGlobalKey — клавиши, работающие независимо от фокуса: смена
+// активного чата и прокрутка сообщений.
+func (t *tui) handleGlobalKey(event *tcell.EventKey) *tcell.EventKey {
+	switch event.Key() {
+	case tcell.KeyCtrlN:
+		t.cycleChat(1)
+		return nil
+	case tcell.KeyCtrlP:
+		t.cycleChat(-1)
+		return nil
+	case tcell.KeyPgUp, tcell.KeyPgDn, tcell.KeyEnd:
+		t.messages.InputHandler()(event, func(tview.Primitive) {})
+		return nil
+	}
+	return event
+}
+
+func (t *tui) handleInputKey(event *tcell.EventKey) *tcell.EventKey {
+	switch event.Key() {
+	case tcell.KeyTab:
+		t.complete()
+		return nil
+	case tcell.KeyUp:
+		if t.historyPos > 0 {
+			t.historyPos--
+			t.input.SetText(t.history[t.historyPos])
+		}
+		return nil
+	case tcell.KeyDown:
+		if t.historyPos < len(t.history)-1 {
+			t.historyPos++
+			t.input.SetText(t.history[t.historyPos])
+		} else {
+			t.historyPos = len(t.history)
+			t.input.SetText("")
+		}
+		return nil
+	}
+	return event
+}
+
+func (t *tui) cycleChat(step int) {
+	joined := t.session.client.Chats()
+	if len(joined) < 2 {
+		return
+	}
+	next := 0
+	for i, name := range joined {
+		if name == t.shown {
+			next = (i + step + len(joined)) % len(joined)
+		}
+	}
+	if err := t.session.client.Focus(joined[next]); err == nil {
+		t.refresh()
+	}
+}
+
+func (t *tui) complete() {
+	chats := t.session.client.Chats()
+	for name := range t.remote {
+		if !containsChat(chats, name) {
+			chats = append(chats, name)
+		}
+	}
+	users := make([]string, 0, len(t.users))
+	for name := range t.users {
+		users = append(users, name)
+	}
+	sort.Strings(users)
+
+	text, candidates := completeInput(t.input.GetText(), chats, users)
+	t.input.SetText(text)
+	t.hint = strings.Join(candidates, " ")
+	t.drawStatus()
+}
+
+// completeInput дополняет последнее слово строки: команду в начале строки,
+// название чата после команд работы с чатами или имя после @. Если
+// вариантов несколько, дополняет до общего префикса и возвращает их.
+func completeInput(text string, chats, users []string) (string, []string) {
+	start := strings.LastIndex(text, " ") + 1
+	word := text[start:]
+	fields := strings.Fields(text)
+
+	var options []string
+	switch {
+	case start == 0 && strings.HasPrefix(word, "/"):
+		options = commandNames
+	case strings.HasPrefix(word, "@"):
+		for _, name := range users {
+			options = append(options, "@"+name)
+		}
+	case start > 0 && len(fields) > 0 && containsChat(chatCommands, fields[0]):
+		options = chats
+	default:
+		return text, nil
+	}
+
+	var matches []string
+	for _, option := range options {
+		if strings.HasPrefix(option, word) {
+			matches = append(matches, option)
+		}
+	}
+	switch len(matches) {
+	case 0:
+		return text, nil
+	case 1:
+		return text[:start] + matches[0] + " ", nil
+	}
+
+	prefix := matches[0]
+	for _, match := range matches[1:] {
+		for !strings.HasPrefix(match, prefix) {
+			runes := []rune(prefix)
+			prefix = string(runes[:len(runes)-1])
+		}
+	}
+	return text[:start] + prefix, matches
+}
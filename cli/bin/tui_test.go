@@ -0,0 +1,38 @@
+package main
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestCompleteInput(t *testing.T) {
+	chats := []string{"general", "geo", "dev"}
+	users := []string{"alice", "alex", "bob"}
+
+	tests := []struct {
+		name       string
+		text       string
+		want       string
+		candidates []string
+	}{
+		{name: "Пустая строка", text: "", want: ""},
+		{name: "Только пробелы", text: "  ", want: "  "},
+		{name: "Команда", text: "/jo", want: "/join "},
+		{name: "Несколько команд", text: "/p", want: "/pin", candidates: []string{"/pin", "/pins"}},
+		{name: "Чат после команды", text: "/join ge", want: "/join ge", candidates: []string{"general", "geo"}},
+		{name: "Единственный чат", text: "/focus d", want: "/focus dev "},
+		{name: "Чат не дополняется в тексте", text: "привет ge", want: "привет ge"},
+		{name: "Упоминание", text: "@al", want: "@al", candidates: []string{"@alice", "@alex"}},
+		{name: "Упоминание в тексте", text: "привет @b", want: "привет @bob "},
+		{name: "Нет вариантов", text: "@carol", want: "@carol"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			text, candidates := completeInput(tt.text, chats, users)
+			assert.Equal(t, tt.want, text)
+			assert.Equal(t, tt.candidates, candidates)
+		})
+	}
+}
@@ -0,0 +1,247 @@
+// Package bot — каркас для ботов поверх клиента CLI: обработчики команд
+// вида "!команда" и регулярных выражений, ограничение чатов, частоты
+// ответов и внешние обработчики-программы.
+package bot
+
+import (
+	"context"
+	"log"
+	"regexp"
+	"strings"
+	"sync"
+	"time"
+
+	"team-bunny-chat/cli/client"
+)
+
+// Client — то, что боту нужно от клиента; его реализует *rabbitmq.Client.
+type Client interface {
+	Username() string
+	Messages() <-chan rabbitmq.Message
+	States() <-chan rabbitmq.ConnectionState
+	SendTo(chatName, text string) error
+}
+
+// Request — сообщение, на которое сработал обработчик.
+type Request struct {
+	Message rabbitmq.Message
+	// Command и Args заполнены для обработчиков команд: для "!deploy api
+	// prod" это "deploy" и ["api", "prod"].
+	Command string
+	Args    []string
+	// Match — совпадение регулярного выражения и его группы.
+	Match []string
+}
+
+// Reply — ответ обработчика. Пустой Chat — ответ в чат исходного
+// сообщения.
+type Reply struct {
+	Chat string `json:"chat,omitempty"`
+	Body string `json:"body"`
+}
+
+type HandlerFunc func(ctx context.Context, req Request) ([]Reply, error)
+
+type Options struct {
+	// Prefix — начало команд, по умолчанию "!".
+	Prefix string
+	// RateLimit — сколько ответов бот отправляет в один чат за RateWindow;
+	// лишние отбрасываются. 0 — без ограничения.
+	RateLimit  int
+	RateWindow time.Duration
+	// MaxAge — сообщения старше этого (например, догруженные после долгого
+	// обрыва связи) бот пропускает. 0 — отвечать на все.
+	MaxAge time.Duration
+	// HandlerTimeout ограничивает время работы обработчика.
+	HandlerTimeout time.Duration
+	Logger         *log.Logger
+}
+
+type handler struct {
+	command string
+	pattern *regexp.Regexp
+	chats   []string
+	fn      HandlerFunc
+}
+
+type Bot struct {
+	client   Client
+	opts     Options
+	limiter  *limiter
+	handlers []handler
+	wg       sync.WaitGroup
+}
+
+func New(client Client, opts Options) *Bot {
+	if opts.Prefix == "" {
+		opts.Prefix = "!"
+	}
+	if opts.RateWindow == 0 {
+		opts.RateWindow = time.Minute
+	}
+	if opts.HandlerTimeout == 0 {
+		opts.HandlerTimeout = 30 * time.Second
+	}
+	if opts.Logger == nil {
+		opts.Logger = log.Default()
+	}
+	return &Bot{
+		client:  client,
+		opts:    opts,
+		limiter: newLimiter(opts.RateLimit, opts.RateWindow),
+	}
+}
+
+// Command регистрирует обработчик команды name (без префикса). Если chats
+// заданы, команда работает только в них.
+func (b *Bot) Command(name string, fn HandlerFunc, chats ...string) {
+	b.handlers = append(b.handlers, handler{command: name, chats: chats, fn: fn})
+}
+
+// Match регистрирует обработчик сообщений, в которых находится pattern.
+func (b *Bot) Match(pattern *regexp.Regexp, fn HandlerFunc, chats ...string) {
+	b.handlers = append(b.handlers, handler{pattern: pattern, chats: chats, fn: fn})
+}
+
+// Run обрабатывает сообщения, пока не отменят ctx или клиент не закроется,
+// и ждет завершения запущенных обработчиков. Переподключается сам клиент,
+// бот только пишет о смене состояния в журнал.
+func (b *Bot) Run(ctx context.Context) error {
+	defer b.wg.Wait()
+
+	messages, states := b.client.Messages(), b.client.States()
+	for {
+		select {
+		case <-ctx.Done():
+			return nil
+		case state, ok := <-states:
+			if !ok {
+				states = nil
+				continue
+			}
+			if state.Connected {
+				b.opts.Logger.Printf("Соединение восстановлено")
+			} else {
+				b.opts.Logger.Printf("Соединение потеряно (%v), переподключение…", state.Err)
+			}
+		case msg, ok := <-messages:
+			if !ok {
+				return nil
+			}
+			b.handle(ctx, msg)
+		}
+	}
+}
+
+// handle запускает все подходящие обработчики, каждый в своей горутине.
+func (b *Bot) handle(ctx context.Context, msg rabbitmq.Message) {
+	if msg.Username == b.client.Username() {
+		return
+	}
+	if b.opts.MaxAge > 0 && time.Since(msg.Timestamp) > b.opts.MaxAge {
+		return
+	}
+
+	for _, h := range b.handlers {
+		req, ok := b.match(h, msg)
+		if !ok {
+			continue
+		}
+		b.wg.Add(1)
+		go func(h handler) {
+			defer b.wg.Done()
+			b.run(ctx, h, req)
+		}(h)
+	}
+}
+
+func (b *Bot) match(h handler, msg rabbitmq.Message) (Request, bool) {
+	req := Request{Message: msg}
+	if len(h.chats) > 0 && !contains(h.chats, msg.ChatName) {
+		return req, false
+	}
+
+	if h.pattern != nil {
+		req.Match = h.pattern.FindStringSubmatch(msg.Body)
+		return req, req.Match != nil
+	}
+
+	fields := strings.Fields(msg.Body)
+	if len(fields) == 0 || fields[0] != b.opts.Prefix+h.command {
+		return req, false
+	}
+	req.Command, req.Args = h.command, fields[1:]
+	return req, true
+}
+
+func (b *Bot) run(ctx context.Context, h handler, req Request) {
+	ctx, cancel := context.WithTimeout(ctx, b.opts.HandlerTimeout)
+	defer cancel()
+
+	replies, err := h.fn(ctx, req)
+	if err != nil {
+		b.opts.Logger.Printf("Ошибка обработчика (чат %s, сообщение %q): %v", req.Message.ChatName, req.Message.Body, err)
+		return
+	}
+	for _, reply := range replies {
+		if strings.TrimSpace(reply.Body) == "" {
+			continue
+		}
+		chat := reply.Chat
+		if chat == "" {
+			chat = req.Message.ChatName
+		}
+		if !b.limiter.allow(chat, time.Now()) {
+			b.opts.Logger.Printf("Превышен лимит ответов в чат %s, ответ отброшен", chat)
+			continue
+		}
+		if err := b.client.SendTo(chat, reply.Body); err != nil {
+			b.opts.Logger.Printf("Ошибка отправки ответа в чат %s: %v", chat, err)
+		}
+	}
+}
+
+func contains(chats []string, chatName string) bool {
+	for _, name := range chats {
+		if name == chatName {
+			return true
+		}
+	}
+	return false
+}
+
+// limiter пропускает не больше limit ответов в чат за скользящее окно
+// window.
+type limiter struct {
+	limit  int
+	window time.Duration
+
+	mu   sync.Mutex
+	sent map[string][]time.Time
+}
+
+func newLimiter(limit int, window time.Duration) *limiter {
+	return &limiter{limit: limit, window: window, sent: make(map[string][]time.Time)}
+}
+
+func (l *limiter) allow(chat string, now time.Time) bool {
+	if l.limit <= 0 {
+		return true
+	}
+
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	recent := l.sent[chat][:0]
+	for _, t := range l.sent[chat] {
+		if now.Sub(t) < l.window {
+			recent = append(recent, t)
+		}
+	}
+	if len(recent) >= l.limit {
+		l.sent[chat] = recent
+		return false
+	}
+	l.sent[chat] = append(recent, now)
+	return true
+}
@@ -0,0 +1,238 @@
+package bot
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"team-bunny-chat/cli/client"
+)
+
+type fakeClient struct {
+	messages chan rabbitmq.Message
+	states   chan rabbitmq.ConnectionState
+
+	mu   sync.Mutex
+	sent []Reply
+}
+
+func newFakeClient() *fakeClient {
+	return &fakeClient{
+		messages: make(chan rabbitmq.Message),
+		states:   make(chan rabbitmq.ConnectionState),
+	}
+}
+
+func (f *fakeClient) Username() string                        { return "bot" }
+func (f *fakeClient) Messages() <-chan rabbitmq.Message       { return f.messages }
+func (f *fakeClient) States() <-chan rabbitmq.ConnectionState { return f.states }
+func (f *fakeClient) SendTo(chatName, text string) error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.sent = append(f.sent, Reply{Chat: chatName, Body: text})
+	return nil
+}
+
+// runBot прогоняет сообщения через бота и возвращает отправленные ответы.
+func runBot(t *testing.T, b *Bot, f *fakeClient, msgs ...rabbitmq.Message) []Reply {
+	done := make(chan error)
+	go func() { done <- b.Run(context.Background()) }()
+	for _, msg := range msgs {
+		f.messages <- msg
+	}
+	close(f.messages)
+	require.NoError(t, <-done)
+	return f.sent
+}
+
+func message(chat, username, body string) rabbitmq.Message {
+	return rabbitmq.Message{ChatName: chat, Username: username, Body: body, Timestamp: time.Now()}
+}
+
+func testOptions() Options {
+	return Options{Logger: log.New(io.Discard, "", 0)}
+}
+
+func TestBotHandlers(t *testing.T) {
+	tests := []struct {
+		name string
+		msg  rabbitmq.Message
+		want []Reply
+	}{
+		{
+			name: "Команда с аргументами",
+			msg:  message("general", "alice", "!ping раз два"),
+			want: []Reply{{Chat: "general", Body: "pong раз два"}},
+		},
+		{
+			name: "Команда должна быть отдельным словом",
+			msg:  message("general", "alice", "!pingpong"),
+		},
+		{
+			name: "Команда не в начале сообщения",
+			msg:  message("general", "alice", "скажи !ping"),
+		},
+		{
+			name: "Выражение в своем чате",
+			msg:  message("ops", "alice", "выкатили deploy api"),
+			want: []Reply{{Chat: "ops", Body: "api выкачен"}, {Chat: "general", Body: "в ops выкачен api"}},
+		},
+		{
+			name: "Выражение в чужом чате",
+			msg:  message("general", "alice", "deploy api"),
+		},
+		{
+			name: "Свои сообщения пропускаются",
+			msg:  message("general", "bot", "!ping"),
+		},
+		{
+			name: "Старые сообщения пропускаются",
+			msg: rabbitmq.Message{
+				ChatName: "general", Username: "alice", Body: "!ping",
+				Timestamp: time.Now().Add(-time.Hour),
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			f := newFakeClient()
+			opts := testOptions()
+			opts.MaxAge = time.Minute
+			b := New(f, opts)
+			b.Command("ping", func(_ context.Context, req Request) ([]Reply, error) {
+				return []Reply{{Body: strings.TrimSpace("pong " + strings.Join(req.Args, " "))}}, nil
+			})
+			b.Match(regexp.MustCompile(`deploy (\S+)`), func(_ context.Context, req Request) ([]Reply, error) {
+				return []Reply{
+					{Body: req.Match[1] + " выкачен"},
+					{Chat: "general", Body: "в ops выкачен " + req.Match[1]},
+				}, nil
+			}, "ops")
+
+			assert.Equal(t, tt.want, runBot(t, b, f, tt.msg))
+		})
+	}
+}
+
+func TestBotRateLimit(t *testing.T) {
+	f := newFakeClient()
+	opts := testOptions()
+	opts.RateLimit = 2
+	b := New(f, opts)
+	b.Command("ping", func(context.Context, Request) ([]Reply, error) {
+		return []Reply{{Body: "pong"}}, nil
+	})
+
+	sent := runBot(t, b, f,
+		message("general", "alice", "!ping"),
+		message("general", "alice", "!ping"),
+		message("general", "alice", "!ping"),
+		message("random", "alice", "!ping"),
+	)
+	perChat := map[string]int{}
+	for _, reply := range sent {
+		perChat[reply.Chat]++
+	}
+	assert.Equal(t, map[string]int{"general": 2, "random": 1}, perChat)
+}
+
+func TestLimiter(t *testing.T) {
+	l := newLimiter(2, time.Minute)
+	now := time.Now()
+
+	assert.True(t, l.allow("general", now))
+	assert.True(t, l.allow("general", now.Add(time.Second)))
+	assert.False(t, l.allow("general", now.Add(2*time.Second)))
+	assert.True(t, l.allow("random", now.Add(2*time.Second)), "у каждого чата свой лимит")
+	assert.True(t, l.allow("general", now.Add(time.Minute+time.Millisecond)), "окно сдвинулось")
+}
+
+// TestExecHelper — внешний обработчик для TestExec: тестовый бинарник
+// запускается сам с BOT_EXEC_HELPER=1.
+func TestExecHelper(t *testing.T) {
+	if os.Getenv("BOT_EXEC_HELPER") == "" {
+		return
+	}
+	var req ExecRequest
+	if err := json.NewDecoder(os.Stdin).Decode(&req); err != nil {
+		os.Exit(2)
+	}
+	switch req.Command {
+	case "fail":
+		fmt.Fprintln(os.Stderr, "сломалось")
+		os.Exit(3)
+	case "silent":
+		os.Exit(0)
+	}
+	json.NewEncoder(os.Stdout).Encode(ExecResponse{Replies: []Reply{
+		{Body: fmt.Sprintf("%s в %s: %s", req.Username, req.Chat, strings.Join(req.Args, " "))},
+	}})
+	os.Exit(0)
+}
+
+func TestExec(t *testing.T) {
+	t.Setenv("BOT_EXEC_HELPER", "1")
+	handler := Exec([]string{os.Args[0], "-test.run=^TestExecHelper$"})
+	req := func(command string, args ...string) Request {
+		return Request{Message: message("ops", "alice", "!"+command), Command: command, Args: args}
+	}
+
+	replies, err := handler(context.Background(), req("oncall", "сегодня"))
+	require.NoError(t, err)
+	assert.Equal(t, []Reply{{Body: "alice в ops: сегодня"}}, replies)
+
+	replies, err = handler(context.Background(), req("silent"))
+	require.NoError(t, err)
+	assert.Empty(t, replies)
+
+	_, err = handler(context.Background(), req("fail"))
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "сломалось")
+}
+
+func TestLoadSpecs(t *testing.T) {
+	dir := t.TempDir()
+	write := func(content string) string {
+		path := filepath.Join(dir, "bot.toml")
+		require.NoError(t, os.WriteFile(path, []byte(content), 0o600))
+		return path
+	}
+
+	specs, err := LoadSpecs(write(`
+[[handlers]]
+command = "oncall"
+chats = ["ops"]
+exec = ["./oncall.sh", "--short"]
+
+[[handlers]]
+pattern = 'deploy (\S+)'
+exec = ["notify"]
+`))
+	require.NoError(t, err)
+	require.Len(t, specs, 2)
+	assert.Equal(t, []string{filepath.Join(dir, "oncall.sh"), "--short"}, specs[0].Exec)
+	assert.Equal(t, []string{"ops"}, specs[0].Chats)
+	assert.Equal(t, []string{"notify"}, specs[1].Exec, "программа из PATH остается как есть")
+
+	_, err = LoadSpecs(write("[[handlers]]\ncommand = \"x\"\npattern = \"y\"\nexec = [\"z\"]\n"))
+	assert.Error(t, err)
+
+	_, err = LoadSpecs(write("[[handlers]]\ncommand = \"x\"\n"))
+	assert.Error(t, err)
+
+	b := New(newFakeClient(), testOptions())
+	assert.Error(t, b.Register([]Spec{{Pattern: "(", Exec: []string{"x"}}}))
+}
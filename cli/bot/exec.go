@@ -0,0 +1,140 @@
+package bot
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"regexp"
+	"strings"
+	"time"
+
+	"github.com/pelletier/go-toml/v2"
+)
+
+// Spec — внешний обработчик из файла описания бота: программа exec
+// запускается на каждое подходящее сообщение.
+type Spec struct {
+	// Command — команда без префикса; задается либо она, либо Pattern.
+	Command string   `toml:"command"`
+	Pattern string   `toml:"pattern"`
+	Chats   []string `toml:"chats"`
+	Exec    []string `toml:"exec"`
+}
+
+type specFile struct {
+	Handlers []Spec `toml:"handlers"`
+}
+
+// ExecRequest — то, что внешний обработчик получает на stdin.
+type ExecRequest struct {
+	Chat      string    `json:"chat"`
+	ID        int64     `json:"id,omitempty"`
+	Username  string    `json:"username"`
+	Body      string    `json:"body"`
+	Timestamp time.Time `json:"timestamp"`
+	Command   string    `json:"command,omitempty"`
+	Args      []string  `json:"args,omitempty"`
+	Match     []string  `json:"match,omitempty"`
+}
+
+// ExecResponse — то, что внешний обработчик пишет в stdout. Пустой вывод
+// означает, что отвечать не нужно.
+type ExecResponse struct {
+	Replies []Reply `json:"replies"`
+}
+
+// LoadSpecs читает описание обработчиков (TOML, таблицы [[handlers]]).
+// Относительные пути к программам считаются от каталога файла.
+func LoadSpecs(path string) ([]Spec, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("ошибка чтения обработчиков: %w", err)
+	}
+	var file specFile
+	if err := toml.Unmarshal(data, &file); err != nil {
+		return nil, fmt.Errorf("ошибка в файле обработчиков %s: %w", path, err)
+	}
+	if len(file.Handlers) == 0 {
+		return nil, fmt.Errorf("в файле %s нет обработчиков [[handlers]]", path)
+	}
+
+	dir := filepath.Dir(path)
+	for i, spec := range file.Handlers {
+		if (spec.Command == "") == (spec.Pattern == "") {
+			return nil, fmt.Errorf("обработчик %d: нужно указать command или pattern", i+1)
+		}
+		if len(spec.Exec) == 0 {
+			return nil, fmt.Errorf("обработчик %d: не указана программа exec", i+1)
+		}
+		if program := spec.Exec[0]; strings.Contains(program, "/") && !filepath.IsAbs(program) {
+			file.Handlers[i].Exec[0] = filepath.Join(dir, program)
+		}
+	}
+	return file.Handlers, nil
+}
+
+// Register добавляет внешние обработчики.
+func (b *Bot) Register(specs []Spec) error {
+	for _, spec := range specs {
+		fn := Exec(spec.Exec)
+		if spec.Command != "" {
+			b.Command(spec.Command, fn, spec.Chats...)
+			continue
+		}
+		pattern, err := regexp.Compile(spec.Pattern)
+		if err != nil {
+			return fmt.Errorf("некорректное выражение %q: %w", spec.Pattern, err)
+		}
+		b.Match(pattern, fn, spec.Chats...)
+	}
+	return nil
+}
+
+// Exec возвращает обработчик, который запускает программу argv: запрос
+// ExecRequest уходит ей на stdin, ответ ExecResponse читается из stdout.
+// Ненулевой код завершения — ошибка с текстом из stderr.
+func Exec(argv []string) HandlerFunc {
+	return func(ctx context.Context, req Request) ([]Reply, error) {
+		input, err := json.Marshal(ExecRequest{
+			Chat:      req.Message.ChatName,
+			ID:        req.Message.ID,
+			Username:  req.Message.Username,
+			Body:      req.Message.Body,
+			Timestamp: req.Message.Timestamp,
+			Command:   req.Command,
+			Args:      req.Args,
+			Match:     req.Match,
+		})
+		if err != nil {
+			return nil, err
+		}
+
+		var stdout, stderr bytes.Buffer
+		cmd := exec.CommandContext(ctx, argv[0], argv[1:]...)
+		cmd.Stdin = bytes.NewReader(input)
+		cmd.Stdout, cmd.Stderr = &stdout, &stderr
+		if err := cmd.Run(); err != nil {
+			if errors.Is(ctx.Err(), context.DeadlineExceeded) {
+				return nil, fmt.Errorf("%s: превышено время работы", argv[0])
+			}
+			if msg := strings.TrimSpace(stderr.String()); msg != "" {
+				return nil, fmt.Errorf("%s: %w: %s", argv[0], err, msg)
+			}
+			return nil, fmt.Errorf("%s: %w", argv[0], err)
+		}
+
+		if len(bytes.TrimSpace(stdout.Bytes())) == 0 {
+			return nil, nil
+		}
+		var resp ExecResponse
+		if err := json.Unmarshal(stdout.Bytes(), &resp); err != nil {
+			return nil, fmt.Errorf("%s: некорректный ответ: %w", argv[0], err)
+		}
+		return resp.Replies, nil
+	}
+}
@@ -0,0 +1,414 @@
+// Package cache хранит историю чатов на диске, чтобы показывать ее сразу
+// при входе в чат и читать без связи с сервером. Сообщения и названия
+// чатов зашифрованы ключом, полученным из пароля; в открытом виде в файле
+// остаются только время сообщений и их количество.
+package cache
+
+import (
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+
+	_ "github.com/mattn/go-sqlite3"
+	"golang.org/x/crypto/scrypt"
+
+	"team-bunny-chat/bunnychat"
+)
+
+var ErrWrongPassphrase = errors.New("неверный пароль кэша")
+
+// checkValue шифруется при создании кэша; по нему при открытии проверяется
+// пароль.
+const checkValue = "bunnychat-cache"
+
+// syncPageSize — сколько сообщений запрашивать у сервера за раз при
+// синхронизации, maxSyncPages ограничивает догрузку после долгого
+// отсутствия.
+var (
+	syncPageSize = 200
+	maxSyncPages = 10
+)
+
+// Source — откуда догружать историю; его реализует *bunnychat.API.
+type Source interface {
+	History(chatName string, limit int) (*bunnychat.HistoryResponse, error)
+	HistoryBefore(chatName string, beforeID int64, limit int) (*bunnychat.HistoryResponse, error)
+}
+
+type Cache struct {
+	db     *sql.DB
+	aead   cipher.AEAD
+	macKey []byte
+}
+
+var unsafeChars = regexp.MustCompile(`[^A-Za-z0-9._@-]+`)
+
+// DefaultPath возвращает путь к кэшу пользователя username на сервере
+// server: у каждой пары свой файл в $XDG_CACHE_HOME/bunnychat.
+func DefaultPath(server, username string) (string, error) {
+	dir, err := os.UserCacheDir()
+	if err != nil {
+		return "", fmt.Errorf("не удалось определить каталог кэша: %w", err)
+	}
+	name := unsafeChars.ReplaceAllString(username+"@"+server, "_")
+	return filepath.Join(dir, "bunnychat", name+".db"), nil
+}
+
+// Open открывает кэш, создавая его при первом запуске. Для существующего
+// кэша неверный пароль дает ErrWrongPassphrase.
+func Open(path, passphrase string) (*Cache, error) {
+	if passphrase == "" {
+		return nil, errors.New("пароль кэша не может быть пустым")
+	}
+	if err := os.MkdirAll(filepath.Dir(path), 0o700); err != nil {
+		return nil, fmt.Errorf("ошибка создания каталога кэша: %w", err)
+	}
+
+	db, err := sql.Open("sqlite3", path)
+	if err != nil {
+		return nil, fmt.Errorf("ошибка открытия кэша: %w", err)
+	}
+	db.SetMaxOpenConns(1)
+
+	c := &Cache{db: db}
+	if err := c.init(passphrase); err != nil {
+		db.Close()
+		return nil, err
+	}
+	if err := os.Chmod(path, 0o600); err != nil {
+		db.Close()
+		return nil, fmt.Errorf("ошибка настройки прав на кэш: %w", err)
+	}
+	return c, nil
+}
+
+func (c *Cache) init(passphrase string) error {
+	_, err := c.db.Exec(`
+	CREATE TABLE IF NOT EXISTS meta (
+		key TEXT PRIMARY KEY,
+		value BLOB NOT NULL
+	);
+	CREATE TABLE IF NOT EXISTS messages (
+		chat BLOB NOT NULL,
+		id INTEGER,
+		ts INTEGER NOT NULL,
+		data BLOB NOT NULL,
+		UNIQUE (chat, id)
+	);
+	CREATE INDEX IF NOT EXISTS idx_messages_chat_ts ON messages(chat, ts);
+	CREATE TABLE IF NOT EXISTS gaps (
+		chat BLOB NOT NULL,
+		from_id INTEGER NOT NULL,
+		to_id INTEGER NOT NULL
+	);
+	`)
+	if err != nil {
+		return fmt.Errorf("ошибка создания таблиц кэша: %w", err)
+	}
+
+	var salt, check []byte
+	err = c.db.QueryRow(`SELECT value FROM meta WHERE key = 'salt'`).Scan(&salt)
+	if errors.Is(err, sql.ErrNoRows) {
+		salt = make([]byte, 16)
+		if _, err := rand.Read(salt); err != nil {
+			return fmt.Errorf("ошибка генерации соли: %w", err)
+		}
+		if err := c.deriveKeys(passphrase, salt); err != nil {
+			return err
+		}
+		check, err = c.seal([]byte(checkValue), nil)
+		if err != nil {
+			return err
+		}
+		_, err = c.db.Exec(`INSERT INTO meta (key, value) VALUES ('salt', ?), ('check', ?)`, salt, check)
+		if err != nil {
+			return fmt.Errorf("ошибка записи кэша: %w", err)
+		}
+		return nil
+	}
+	if err != nil {
+		return fmt.Errorf("ошибка чтения кэша: %w", err)
+	}
+
+	if err := c.deriveKeys(passphrase, salt); err != nil {
+		return err
+	}
+	if err := c.db.QueryRow(`SELECT value FROM meta WHERE key = 'check'`).Scan(&check); err != nil {
+		return fmt.Errorf("ошибка чтения кэша: %w", err)
+	}
+	if plain, err := c.open(check, nil); err != nil || string(plain) != checkValue {
+		return ErrWrongPassphrase
+	}
+	return nil
+}
+
+// deriveKeys получает из пароля ключ AES-256-GCM для сообщений и ключ
+// HMAC для названий чатов.
+func (c *Cache) deriveKeys(passphrase string, salt []byte) error {
+	key, err := scrypt.Key([]byte(passphrase), salt, 1<<15, 8, 1, 64)
+	if err != nil {
+		return fmt.Errorf("ошибка получения ключа: %w", err)
+	}
+	block, err := aes.NewCipher(key[:32])
+	if err != nil {
+		return err
+	}
+	c.aead, err = cipher.NewGCM(block)
+	if err != nil {
+		return err
+	}
+	c.macKey = key[32:]
+	return nil
+}
+
+func (c *Cache) seal(plain, aad []byte) ([]byte, error) {
+	nonce := make([]byte, c.aead.NonceSize())
+	if _, err := rand.Read(nonce); err != nil {
+		return nil, fmt.Errorf("ошибка генерации nonce: %w", err)
+	}
+	return c.aead.Seal(nonce, nonce, plain, aad), nil
+}
+
+func (c *Cache) open(data, aad []byte) ([]byte, error) {
+	size := c.aead.NonceSize()
+	if len(data) < size {
+		return nil, errors.New("поврежденная запись кэша")
+	}
+	return c.aead.Open(nil, data[:size], data[size:], aad)
+}
+
+// chatKey — название чата в кэше: HMAC вместо открытого имени.
+func (c *Cache) chatKey(chatName string) []byte {
+	mac := hmac.New(sha256.New, c.macKey)
+	mac.Write([]byte(chatName))
+	return mac.Sum(nil)
+}
+
+func (c *Cache) Close() error {
+	return c.db.Close()
+}
+
+// Store сохраняет сообщения. Сообщения с id заменяют прежнюю версию;
+// сообщения без id (пришедшие через RabbitMQ) хранятся до синхронизации,
+// которая заменит их версиями с сервера.
+func (c *Cache) Store(msgs ...bunnychat.Message) error {
+	tx, err := c.db.Begin()
+	if err != nil {
+		return fmt.Errorf("ошибка записи кэша: %w", err)
+	}
+	defer tx.Rollback()
+
+	for _, msg := range msgs {
+		chat := c.chatKey(msg.ChatName)
+		plain, err := json.Marshal(msg)
+		if err != nil {
+			return fmt.Errorf("ошибка сериализации сообщения: %w", err)
+		}
+		data, err := c.seal(plain, chat)
+		if err != nil {
+			return err
+		}
+
+		var id interface{}
+		if msg.ID != 0 {
+			id = msg.ID
+		}
+		_, err = tx.Exec(`
+		INSERT INTO messages (chat, id, ts, data) VALUES (?, ?, ?, ?)
+		ON CONFLICT (chat, id) DO UPDATE SET ts = excluded.ts, data = excluded.data`,
+			chat, id, msg.Timestamp.UnixNano(), data)
+		if err != nil {
+			return fmt.Errorf("ошибка записи кэша: %w", err)
+		}
+	}
+
+	if err := tx.Commit(); err != nil {
+		return fmt.Errorf("ошибка записи кэша: %w", err)
+	}
+	return nil
+}
+
+// Recent возвращает последние limit сообщений чата по возрастанию времени.
+// Сообщения старше последнего пропуска в истории не возвращаются.
+func (c *Cache) Recent(chatName string, limit int) ([]bunnychat.Message, error) {
+	chat := c.chatKey(chatName)
+	gap, err := c.gapBelow(chat, math.MaxInt64)
+	if err != nil {
+		return nil, err
+	}
+	return c.query(chat, `
+	SELECT data FROM messages WHERE chat = ? AND (id IS NULL OR id > ?)
+	ORDER BY ts DESC, id DESC LIMIT ?`, chat, gap, limit)
+}
+
+// Before возвращает до limit сохраненных сообщений с id меньше beforeID.
+// Выборка останавливается на пропуске в истории: дальше сообщения нужно
+// запрашивать у сервера.
+func (c *Cache) Before(chatName string, beforeID int64, limit int) ([]bunnychat.Message, error) {
+	chat := c.chatKey(chatName)
+	gap, err := c.gapBelow(chat, beforeID)
+	if err != nil {
+		return nil, err
+	}
+	return c.query(chat, `
+	SELECT data FROM messages WHERE chat = ? AND id < ? AND id > ?
+	ORDER BY id DESC LIMIT ?`, chat, beforeID, gap, limit)
+}
+
+// gapBelow возвращает нижнюю границу ближайшего к id пропуска в истории
+// чата: сообщения не новее нее не продолжают сохраненную историю. Без
+// пропусков возвращает 0.
+func (c *Cache) gapBelow(chat []byte, id int64) (int64, error) {
+	var from int64
+	err := c.db.QueryRow(`SELECT COALESCE(MAX(from_id), 0) FROM gaps WHERE chat = ? AND from_id < ?`, chat, id).Scan(&from)
+	if err != nil {
+		return 0, fmt.Errorf("ошибка чтения кэша: %w", err)
+	}
+	return from, nil
+}
+
+// query расшифровывает выбранные в порядке убывания сообщения и
+// возвращает их по возрастанию.
+func (c *Cache) query(chat []byte, query string, args ...interface{}) ([]bunnychat.Message, error) {
+	rows, err := c.db.Query(query, args...)
+	if err != nil {
+		return nil, fmt.Errorf("ошибка чтения кэша: %w", err)
+	}
+	defer rows.Close()
+
+	messages := []bunnychat.Message{}
+	for rows.Next() {
+		msg, err := c.scan(rows, chat)
+		if err != nil {
+			return nil, err
+		}
+		messages = append(messages, msg)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("ошибка чтения кэша: %w", err)
+	}
+
+	for i, j := 0, len(messages)-1; i < j; i, j = i+1, j-1 {
+		messages[i], messages[j] = messages[j], messages[i]
+	}
+	return messages, nil
+}
+
+func (c *Cache) scan(rows *sql.Rows, chat []byte) (bunnychat.Message, error) {
+	var msg bunnychat.Message
+	var data []byte
+	if err := rows.Scan(&data); err != nil {
+		return msg, fmt.Errorf("ошибка чтения кэша: %w", err)
+	}
+	plain, err := c.open(data, chat)
+	if err != nil {
+		return msg, fmt.Errorf("ошибка расшифровки кэша: %w", err)
+	}
+	if err := json.Unmarshal(plain, &msg); err != nil {
+		return msg, fmt.Errorf("поврежденная запись кэша: %w", err)
+	}
+	return msg, nil
+}
+
+// Search ищет text в сообщениях чата без учета регистра и возвращает до
+// limit самых новых совпадений по возрастанию времени. Текст зашифрован,
+// поэтому сообщения перебираются по одному.
+func (c *Cache) Search(chatName, text string, limit int) ([]bunnychat.Message, error) {
+	chat := c.chatKey(chatName)
+	rows, err := c.db.Query(`SELECT data FROM messages WHERE chat = ? ORDER BY ts DESC, id DESC`, chat)
+	if err != nil {
+		return nil, fmt.Errorf("ошибка чтения кэша: %w", err)
+	}
+	defer rows.Close()
+
+	needle := strings.ToLower(text)
+	found := []bunnychat.Message{}
+	for len(found) < limit && rows.Next() {
+		msg, err := c.scan(rows, chat)
+		if err != nil {
+			return nil, err
+		}
+		if strings.Contains(strings.ToLower(msg.Body), needle) {
+			found = append([]bunnychat.Message{msg}, found...)
+		}
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("ошибка чтения кэша: %w", err)
+	}
+	return found, nil
+}
+
+// LastID возвращает id самого нового сохраненного сообщения чата или 0.
+func (c *Cache) LastID(chatName string) (int64, error) {
+	var id int64
+	err := c.db.QueryRow(`SELECT COALESCE(MAX(id), 0) FROM messages WHERE chat = ?`, c.chatKey(chatName)).Scan(&id)
+	if err != nil {
+		return 0, fmt.Errorf("ошибка чтения кэша: %w", err)
+	}
+	return id, nil
+}
+
+// Sync догружает с сервера сообщения новее сохраненных и возвращает их
+// вместе с отметкой прочтения. Пустой кэш получает одну страницу
+// последних сообщений. Сообщения без id, которые успел сохранить сервер,
+// заменяются серверными. Если за maxSyncPages страниц догрузить все не
+// удалось, недостающий отрезок запоминается как пропуск.
+func (c *Cache) Sync(src Source, chatName string) (*bunnychat.HistoryResponse, error) {
+	lastID, err := c.LastID(chatName)
+	if err != nil {
+		return nil, err
+	}
+
+	history, err := src.History(chatName, syncPageSize)
+	if err != nil {
+		return nil, err
+	}
+	fresh := newerThan(history.Messages, lastID)
+	page := history.Messages
+	for pages := 1; lastID > 0 && len(page) == syncPageSize && page[0].ID > lastID+1 && pages < maxSyncPages; pages++ {
+		older, err := src.HistoryBefore(chatName, page[0].ID, syncPageSize)
+		if err != nil {
+			return nil, err
+		}
+		page = older.Messages
+		fresh = append(newerThan(page, lastID), fresh...)
+	}
+
+	if err := c.Store(fresh...); err != nil {
+		return nil, err
+	}
+	if lastID > 0 && len(page) == syncPageSize && page[0].ID > lastID+1 {
+		_, err := c.db.Exec(`INSERT INTO gaps (chat, from_id, to_id) VALUES (?, ?, ?)`, c.chatKey(chatName), lastID, page[0].ID)
+		if err != nil {
+			return nil, fmt.Errorf("ошибка записи кэша: %w", err)
+		}
+	}
+	if n := len(history.Messages); n > 0 {
+		newest := history.Messages[n-1].Timestamp.UnixNano()
+		_, err := c.db.Exec(`DELETE FROM messages WHERE chat = ? AND id IS NULL AND ts <= ?`, c.chatKey(chatName), newest)
+		if err != nil {
+			return nil, fmt.Errorf("ошибка записи кэша: %w", err)
+		}
+	}
+	return &bunnychat.HistoryResponse{Chat: chatName, Messages: fresh, LastReadID: history.LastReadID}, nil
+}
+
+func newerThan(messages []bunnychat.Message, id int64) []bunnychat.Message {
+	for i, msg := range messages {
+		if msg.ID > id {
+			return messages[i:]
+		}
+	}
+	return nil
+}
@@ -0,0 +1,270 @@
+package cache
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"team-bunny-chat/bunnychat"
+)
+
+func openTestCache(t *testing.T) (*Cache, string) {
+	path := filepath.Join(t.TempDir(), "cache.db")
+	c, err := Open(path, "секрет")
+	require.NoError(t, err)
+	t.Cleanup(func() { c.Close() })
+	return c, path
+}
+
+func message(id int64, body string, minute int) bunnychat.Message {
+	return bunnychat.Message{
+		ID:        id,
+		Username:  "bob",
+		Body:      body,
+		Timestamp: time.Date(2026, 10, 19, 12, minute, 0, 0, time.UTC),
+		ChatName:  "general",
+	}
+}
+
+// fakeSource отдает сообщения с id от 1 до count, как сервер истории.
+type fakeSource struct {
+	count int64
+}
+
+func (f *fakeSource) page(before int64, limit int) *bunnychat.HistoryResponse {
+	history := &bunnychat.HistoryResponse{Chat: "general", LastReadID: 3}
+	start := before - int64(limit)
+	if start < 1 {
+		start = 1
+	}
+	for id := start; id < before; id++ {
+		history.Messages = append(history.Messages, message(id, "сообщение", int(id)))
+	}
+	return history
+}
+
+func (f *fakeSource) History(_ string, limit int) (*bunnychat.HistoryResponse, error) {
+	return f.page(f.count+1, limit), nil
+}
+
+func (f *fakeSource) HistoryBefore(_ string, beforeID int64, limit int) (*bunnychat.HistoryResponse, error) {
+	return f.page(beforeID, limit), nil
+}
+
+func TestOpen(t *testing.T) {
+	c, path := openTestCache(t)
+	require.NoError(t, c.Store(message(1, "совершенно секретно", 1)))
+	require.NoError(t, c.Close())
+
+	_, err := Open(path, "другой")
+	assert.ErrorIs(t, err, ErrWrongPassphrase)
+
+	_, err = Open(path, "")
+	assert.Error(t, err)
+
+	c, err = Open(path, "секрет")
+	require.NoError(t, err)
+	defer c.Close()
+	messages, err := c.Recent("general", 10)
+	require.NoError(t, err)
+	require.Len(t, messages, 1)
+	assert.Equal(t, "совершенно секретно", messages[0].Body)
+
+	info, err := os.Stat(path)
+	require.NoError(t, err)
+	assert.Equal(t, os.FileMode(0o600), info.Mode().Perm())
+}
+
+func TestEncryptedAtRest(t *testing.T) {
+	c, path := openTestCache(t)
+	require.NoError(t, c.Store(message(1, "совершенно секретно", 1)))
+	require.NoError(t, c.Close())
+
+	data, err := os.ReadFile(path)
+	require.NoError(t, err)
+	assert.NotContains(t, string(data), "совершенно секретно")
+	assert.NotContains(t, string(data), "general")
+	assert.NotContains(t, string(data), "bob")
+}
+
+func TestStoreAndRecent(t *testing.T) {
+	c, _ := openTestCache(t)
+
+	require.NoError(t, c.Store(message(2, "второе", 2), message(1, "первое", 1)))
+	require.NoError(t, c.Store(message(2, "второе, исправленное", 2)))
+	require.NoError(t, c.Store(message(0, "без id", 3)))
+	other := message(1, "другой чат", 1)
+	other.ChatName = "random"
+	require.NoError(t, c.Store(other))
+
+	messages, err := c.Recent("general", 10)
+	require.NoError(t, err)
+	bodies := []string{}
+	for _, msg := range messages {
+		bodies = append(bodies, msg.Body)
+	}
+	assert.Equal(t, []string{"первое", "второе, исправленное", "без id"}, bodies)
+
+	messages, err = c.Recent("general", 1)
+	require.NoError(t, err)
+	require.Len(t, messages, 1)
+	assert.Equal(t, "без id", messages[0].Body)
+
+	lastID, err := c.LastID("general")
+	require.NoError(t, err)
+	assert.Equal(t, int64(2), lastID)
+
+	older, err := c.Before("general", 2, 10)
+	require.NoError(t, err)
+	require.Len(t, older, 1)
+	assert.Equal(t, int64(1), older[0].ID)
+}
+
+func TestSearch(t *testing.T) {
+	c, _ := openTestCache(t)
+	require.NoError(t, c.Store(
+		message(1, "Деплой в пятницу", 1),
+		message(2, "обед", 2),
+		message(3, "деплой откатили", 3),
+	))
+
+	found, err := c.Search("general", "ДЕПЛОЙ", 10)
+	require.NoError(t, err)
+	require.Len(t, found, 2)
+	assert.Equal(t, int64(1), found[0].ID)
+	assert.Equal(t, int64(3), found[1].ID)
+
+	found, err = c.Search("general", "деплой", 1)
+	require.NoError(t, err)
+	require.Len(t, found, 1)
+	assert.Equal(t, int64(3), found[0].ID, "при ограничении остаются самые новые")
+
+	found, err = c.Search("random", "деплой", 10)
+	require.NoError(t, err)
+	assert.Empty(t, found)
+}
+
+func TestSync(t *testing.T) {
+	defer func(size, pages int) { syncPageSize, maxSyncPages = size, pages }(syncPageSize, maxSyncPages)
+	syncPageSize, maxSyncPages = 3, 10
+
+	tests := []struct {
+		name      string
+		cached    int64
+		count     int64
+		wantFirst int64
+		wantLen   int
+	}{
+		{
+			name:      "Пустой кэш получает одну страницу",
+			count:     10,
+			wantFirst: 8,
+			wantLen:   3,
+		},
+		{
+			name:      "Догружаются все новые сообщения",
+			cached:    2,
+			count:     10,
+			wantFirst: 3,
+			wantLen:   8,
+		},
+		{
+			name:    "Новых сообщений нет",
+			cached:  10,
+			count:   10,
+			wantLen: 0,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			c, _ := openTestCache(t)
+			for id := int64(1); id <= tt.cached; id++ {
+				require.NoError(t, c.Store(message(id, "сообщение", int(id))))
+			}
+
+			history, err := c.Sync(&fakeSource{count: tt.count}, "general")
+			require.NoError(t, err)
+			assert.Equal(t, int64(3), history.LastReadID)
+			require.Len(t, history.Messages, tt.wantLen)
+			if tt.wantLen > 0 {
+				assert.Equal(t, tt.wantFirst, history.Messages[0].ID)
+			}
+
+			lastID, err := c.LastID("general")
+			require.NoError(t, err)
+			assert.Equal(t, tt.count, lastID)
+		})
+	}
+}
+
+func TestSyncGap(t *testing.T) {
+	defer func(size, pages int) { syncPageSize, maxSyncPages = size, pages }(syncPageSize, maxSyncPages)
+	syncPageSize, maxSyncPages = 3, 2
+
+	c, _ := openTestCache(t)
+	for id := int64(1); id <= 4; id++ {
+		require.NoError(t, c.Store(message(id, "сообщение", int(id))))
+	}
+
+	// Новых сообщений 16, а за две страницы догружаются только 15–20.
+	history, err := c.Sync(&fakeSource{count: 20}, "general")
+	require.NoError(t, err)
+	require.Len(t, history.Messages, maxSyncPages*syncPageSize)
+	assert.Equal(t, int64(15), history.Messages[0].ID)
+
+	tests := []struct {
+		name     string
+		beforeID int64
+		want     []int64
+	}{
+		{name: "До пропуска", beforeID: 18, want: []int64{15, 16, 17}},
+		{name: "Выборка останавливается на пропуске", beforeID: 17, want: []int64{15, 16}},
+		{name: "От границы пропуска — только сервер", beforeID: 15},
+		{name: "Внутри пропуска", beforeID: 10},
+		{name: "Ниже пропуска история цельная", beforeID: 4, want: []int64{1, 2, 3}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			messages, err := c.Before("general", tt.beforeID, 3)
+			require.NoError(t, err)
+			var ids []int64
+			for _, msg := range messages {
+				ids = append(ids, msg.ID)
+			}
+			assert.Equal(t, tt.want, ids)
+		})
+	}
+
+	recent, err := c.Recent("general", 10)
+	require.NoError(t, err)
+	assert.Len(t, recent, 6, "последние сообщения не захватывают пропуск")
+	assert.Equal(t, int64(15), recent[0].ID)
+
+	// Сервер заполнил пропуск: сохраненные страницы снова читаются из кэша
+	// до его нижней границы.
+	require.NoError(t, c.Store((&fakeSource{}).page(15, 10).Messages...))
+	messages, err := c.Before("general", 15, 3)
+	require.NoError(t, err)
+	require.Len(t, messages, 3)
+	assert.Equal(t, int64(12), messages[0].ID)
+}
+
+func TestSyncReplacesLiveMessages(t *testing.T) {
+	c, _ := openTestCache(t)
+	require.NoError(t, c.Store(message(1, "сообщение", 1)))
+	require.NoError(t, c.Store(message(0, "сообщение", 2)))
+
+	_, err := c.Sync(&fakeSource{count: 2}, "general")
+	require.NoError(t, err)
+
+	messages, err := c.Recent("general", 10)
+	require.NoError(t, err)
+	require.Len(t, messages, 2)
+	assert.Equal(t, int64(2), messages[1].ID, "сообщение без id заменено серверным")
+}
@@ -1,190 +1,208 @@
 package rabbitmq
 
 import (
-	"context"
-	"encoding/json"
+	"errors"
 	"fmt"
-	"log"
-	"time"
+	"strings"
+	"sync"
 
-	amqp "github.com/rabbitmq/amqp091-go"
+	"team-bunny-chat/bunnychat"
 )
 
-type Message struct {
-	Username  string    `json:"username"`
-	Body      string    `json:"body"`
-	Timestamp time.Time `json:"timestamp"`
-}
+type Message = bunnychat.Message
 
-type Client struct {
-	conn         *amqp.Connection
-	ch           *amqp.Channel
-	username     string
-	chatName     string
-	messages     chan Message
-	closeConn    chan struct{}
-	queue        amqp.Queue
-	rabbitmqHost string
-}
-
-func NewClient(username, chatName, rabbitmqHost string) (*Client, error) {
-	conn, err := amqp.Dial(fmt.Sprintf("amqp://guest:guest@%s/", rabbitmqHost))
-	if err != nil {
-		return nil, fmt.Errorf("ошибка подключения к RabbitMQ: %v", err)
-	}
+type TypingEvent = bunnychat.TypingEvent
 
-	ch, err := conn.Channel()
-	if err != nil {
-		conn.Close()
-		return nil, fmt.Errorf("ошибка создания канала: %v", err)
-	}
+// ConnectionState — смена состояния связи с RabbitMQ. При обрыве клиент
+// переподключается сам, Err содержит причину обрыва.
+type ConnectionState struct {
+	Connected bool
+	Err       error
+}
 
-	client := &Client{
-		conn:         conn,
-		ch:           ch,
-		username:     username,
-		chatName:     chatName,
-		messages:     make(chan Message),
-		closeConn:    make(chan struct{}),
-		rabbitmqHost: rabbitmqHost,
-	}
+// Client — обертка над bunnychat.Client для CLI: подписка на несколько
+// чатов, активный чат для отправки и раздельные каналы сообщений и
+// событий набора текста.
+type Client struct {
+	client *bunnychat.Client
 
-	if err := client.setup(); err != nil {
-		client.Close()
-		return nil, err
-	}
+	mu       sync.Mutex
+	chatName string
 
-	return client, nil
+	messages chan Message
+	typing   chan TypingEvent
+	states   chan ConnectionState
 }
 
-func (c *Client) setup() error {
-	err := c.ch.ExchangeDeclare(
-		"bunny.chats",
-		"topic",
-		true,
-		false,
-		false,
-		false,
-		nil,
-	)
-	if err != nil {
-		return fmt.Errorf("ошибка объявления exchange: %v", err)
-	}
+// Dial открывает подключение к брокеру. Тесты подменяют его, чтобы
+// обойтись без RabbitMQ.
+var Dial = bunnychat.DialAMQP
 
-	q, err := c.ch.QueueDeclare(
-		"",
-		false,
-		true,
-		true,
-		false,
-		nil,
-	)
-	if err != nil {
-		return fmt.Errorf("ошибка создания очереди: %v", err)
+// NewClient подключается к RabbitMQ и подписывается на chatNames; первый
+// чат становится активным. rabbitmqHost — адрес "host:port" (вход как
+// guest) или полный URL amqp://. Через api после переподключения
+// догружаются пропущенные сообщения.
+func NewClient(username string, chatNames []string, rabbitmqHost string, api *bunnychat.API) (*Client, error) {
+	if len(chatNames) == 0 {
+		return nil, errors.New("не указан ни один чат")
 	}
 
-	c.queue = q
+	brokerURL := rabbitmqHost
+	if !strings.Contains(brokerURL, "://") {
+		brokerURL = fmt.Sprintf("amqp://guest:guest@%s/", rabbitmqHost)
+	}
 
-	err = c.ch.QueueBind(
-		q.Name,
-		c.chatName,
-		"bunny.chats",
-		false,
-		nil,
-	)
+	client, err := bunnychat.Connect(bunnychat.Config{
+		URL:      brokerURL,
+		Username: username,
+		API:      api,
+		Dial:     Dial,
+	})
 	if err != nil {
-		return fmt.Errorf("ошибка привязки очереди: %v", err)
+		return nil, err
 	}
 
-	msgs, err := c.ch.Consume(
-		q.Name,
-		"",
-		true,
-		false,
-		false,
-		false,
-		nil,
-	)
-	if err != nil {
-		return fmt.Errorf("ошибка подписки на сообщения: %v", err)
+	for _, chatName := range chatNames {
+		if err := client.Join(chatName); err != nil {
+			client.Close()
+			return nil, err
+		}
 	}
 
-	go c.handleMessages(msgs)
+	c := &Client{
+		client:   client,
+		chatName: chatNames[0],
+		messages: make(chan Message),
+		typing:   make(chan TypingEvent, 16),
+		states:   make(chan ConnectionState, 4),
+	}
+	go c.dispatch()
 
-	return nil
+	return c, nil
 }
 
-func (c *Client) handleMessages(msgs <-chan amqp.Delivery) {
-	for {
-		select {
-		case msg := <-msgs:
-			var message Message
-			if err := json.Unmarshal(msg.Body, &message); err != nil {
-				log.Printf("Ошибка разбора сообщения: %v", err)
+func (c *Client) dispatch() {
+	defer close(c.messages)
+	defer close(c.typing)
+	defer close(c.states)
+
+	for event := range c.client.Events() {
+		switch event.Type {
+		case bunnychat.EventDisconnected:
+			c.states <- ConnectionState{Connected: false, Err: event.Err}
+			continue
+		case bunnychat.EventReconnected:
+			c.states <- ConnectionState{Connected: true}
+			continue
+		}
+
+		switch event.Type {
+		case bunnychat.EventMessage:
+			c.messages <- event.Message
+		case bunnychat.EventTyping:
+			if event.Chat != c.GetCurrentChat() {
 				continue
 			}
-			c.messages <- message
-		case <-c.closeConn:
-			return
+			select {
+			case c.typing <- event.Typing:
+			default:
+			}
 		}
 	}
 }
 
+// SendMessage отправляет сообщение в активный чат. Без связи сообщение
+// откладывается до переподключения — это видно по Connected.
 func (c *Client) SendMessage(text string) error {
-	msg := Message{
-		Username:  c.username,
-		Body:      text,
-		Timestamp: time.Now(),
-	}
+	return c.client.Send(c.GetCurrentChat(), text)
+}
 
-	body, err := json.Marshal(msg)
-	if err != nil {
-		return fmt.Errorf("ошибка сериализации сообщения: %v", err)
+// SendTo отправляет сообщение в чат chatName, не меняя активный.
+func (c *Client) SendTo(chatName, text string) error {
+	return c.client.Send(chatName, text)
+}
+
+// SendTyping сообщает собеседникам, что пользователь набирает текст.
+// Частые вызовы отбрасываются, поэтому его можно дергать на каждое
+// нажатие клавиши.
+func (c *Client) SendTyping() error {
+	return c.client.SendTyping(c.GetCurrentChat())
+}
+
+// Join подписывает на чат, не меняя активный.
+func (c *Client) Join(chatName string) error {
+	return c.client.Join(chatName)
+}
+
+// Leave отписывает от чата. Если он был активным, активным становится
+// первый из оставшихся. Последний чат покинуть нельзя.
+func (c *Client) Leave(chatName string) error {
+	chats := c.client.Chats()
+	if !contains(chats, chatName) {
+		return fmt.Errorf("вы не подписаны на чат %s", chatName)
+	}
+	if len(chats) == 1 {
+		return errors.New("нельзя покинуть последний чат")
 	}
 
-	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
-	defer cancel()
+	if err := c.client.Leave(chatName); err != nil {
+		return err
+	}
 
-	err = c.ch.PublishWithContext(ctx,
-		"bunny.chats",
-		c.chatName,
-		false,
-		false,
-		amqp.Publishing{
-			ContentType: "application/json",
-			Body:        body,
-		})
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.chatName == chatName {
+		c.chatName = c.client.Chats()[0]
+	}
+	return nil
+}
 
-	if err != nil {
-		return fmt.Errorf("ошибка отправки сообщения: %v", err)
+// Focus делает чат активным: в него уходят сообщения и из него
+// показываются события набора текста.
+func (c *Client) Focus(chatName string) error {
+	if !contains(c.client.Chats(), chatName) {
+		return fmt.Errorf("вы не подписаны на чат %s", chatName)
 	}
 
+	c.mu.Lock()
+	c.chatName = chatName
+	c.mu.Unlock()
 	return nil
 }
 
+// Chats возвращает чаты, на которые подписан клиент, в порядке подписки.
+func (c *Client) Chats() []string {
+	return c.client.Chats()
+}
+
+func contains(chats []string, chatName string) bool {
+	for _, name := range chats {
+		if name == chatName {
+			return true
+		}
+	}
+	return false
+}
+
+// SwitchChat заменяет активный чат новым: подписывается на него и
+// отписывается от прежнего.
 func (c *Client) SwitchChat(newChatName string) error {
-	err := c.ch.QueueUnbind(
-		c.queue.Name,
-		c.chatName,
-		"bunny.chats",
-		nil,
-	)
-	if err != nil {
-		return fmt.Errorf("ошибка отвязки от старого чата: %v", err)
+	oldChatName := c.GetCurrentChat()
+	if newChatName == oldChatName {
+		return nil
 	}
 
-	err = c.ch.QueueBind(
-		c.queue.Name,
-		newChatName,
-		"bunny.chats",
-		false,
-		nil,
-	)
-	if err != nil {
+	if err := c.client.Join(newChatName); err != nil {
 		return fmt.Errorf("ошибка привязки к новому чату: %v", err)
 	}
 
+	c.mu.Lock()
 	c.chatName = newChatName
+	c.mu.Unlock()
+
+	if err := c.client.Leave(oldChatName); err != nil {
+		return fmt.Errorf("ошибка отвязки от старого чата: %v", err)
+	}
 
 	return nil
 }
@@ -193,16 +211,33 @@ func (c *Client) Messages() <-chan Message {
 	return c.messages
 }
 
+func (c *Client) Typing() <-chan TypingEvent {
+	return c.typing
+}
+
+func (c *Client) States() <-chan ConnectionState {
+	return c.states
+}
+
+func (c *Client) Connected() bool {
+	return c.client.Connected()
+}
+
+// Pending — сколько сообщений ждут отправки до восстановления связи.
+func (c *Client) Pending() int {
+	return c.client.Pending()
+}
+
+func (c *Client) Username() string {
+	return c.client.Username()
+}
+
 func (c *Client) GetCurrentChat() string {
+	c.mu.Lock()
+	defer c.mu.Unlock()
 	return c.chatName
 }
 
 func (c *Client) Close() {
-	close(c.closeConn)
-	if c.ch != nil {
-		c.ch.Close()
-	}
-	if c.conn != nil {
-		c.conn.Close()
-	}
-} 
\ No newline at end of file
+	c.client.Close()
+}
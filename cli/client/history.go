@@ -1,33 +1,49 @@
 package rabbitmq
 
 import (
-	"encoding/json"
 	"fmt"
-	"io"
-	"net/http"
+	"time"
+
+	"team-bunny-chat/bunnychat"
 )
 
-type HistoryResponse struct {
-	Chat     string    `json:"chat"`
-	Messages []Message `json:"messages"`
+type HistoryResponse = bunnychat.HistoryResponse
+
+// HTTPOptions — параметры подключения к серверу истории.
+type HTTPOptions struct {
+	// CAFile — сертификат центра сертификации (PEM) для https://-серверов
+	// с собственным центром.
+	CAFile  string
+	Timeout time.Duration
 }
 
-func GetChatHistory(chatName, serverHost string) (*HistoryResponse, error) {
-	resp, err := http.Get(fmt.Sprintf("http://%s/v1/chats/history?chat=%s", serverHost, chatName))
+// NewAPI создает клиент сервера истории. serverHost — "host:port" или
+// полный URL с http:// или https://.
+func NewAPI(serverHost, username string, opts HTTPOptions) (*bunnychat.API, error) {
+	httpClient, err := bunnychat.NewHTTPClient(opts.CAFile, opts.Timeout)
 	if err != nil {
-		return nil, fmt.Errorf("ошибка при получении истории: %v", err)
+		return nil, err
 	}
-	defer resp.Body.Close()
+	api := bunnychat.NewAPI(serverHost, username)
+	api.HTTP = httpClient
+	return api, nil
+}
 
-	body, err := io.ReadAll(resp.Body)
+// GetChatHistory возвращает последние limit сообщений чата; при limit == 0
+// сервер использует свое значение по умолчанию.
+func GetChatHistory(api *bunnychat.API, chatName string, limit int) (*HistoryResponse, error) {
+	history, err := api.History(chatName, limit)
 	if err != nil {
-		return nil, fmt.Errorf("ошибка при чтении ответа: %v", err)
+		return nil, fmt.Errorf("ошибка при получении истории: %w", err)
 	}
+	return history, nil
+}
 
-	var history HistoryResponse
-	if err := json.Unmarshal(body, &history); err != nil {
-		return nil, fmt.Errorf("ошибка при разборе истории: %v", err)
+// GetOlderHistory возвращает до limit сообщений, более ранних чем beforeID.
+func GetOlderHistory(api *bunnychat.API, chatName string, beforeID int64, limit int) (*HistoryResponse, error) {
+	history, err := api.HistoryBefore(chatName, beforeID, limit)
+	if err != nil {
+		return nil, fmt.Errorf("ошибка при получении истории: %w", err)
 	}
-
-	return &history, nil
-} 
\ No newline at end of file
+	return history, nil
+}
@@ -0,0 +1,340 @@
+// Package config читает и записывает файл настроек консольного клиента
+// с именованными профилями подключения (dev, staging, prod и т.п.).
+package config
+
+import (
+	"errors"
+	"fmt"
+	"net/url"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/pelletier/go-toml/v2"
+)
+
+const (
+	DefaultServer   = "localhost:8080"
+	DefaultRabbitMQ = "localhost:5672"
+)
+
+// Profile — параметры подключения и отображения. Пустые поля означают
+// значения по умолчанию.
+type Profile struct {
+	User     string `toml:"user,omitempty"`
+	Server   string `toml:"server,omitempty"`
+	RabbitMQ string `toml:"rabbitmq,omitempty"`
+	// Credentials — откуда взять логин и пароль RabbitMQ в виде
+	// "логин:пароль": "env:ПЕРЕМЕННАЯ" или "file:путь". Сами пароли в
+	// файле настроек не хранятся.
+	Credentials string `toml:"credentials,omitempty"`
+	// CAFile — сертификат центра сертификации (PEM) для сервера по https://.
+	CAFile string `toml:"ca_file,omitempty"`
+	// Timeout — таймаут HTTP-запросов, например "10s".
+	Timeout    string   `toml:"timeout,omitempty"`
+	Chats      []string `toml:"chats,omitempty"`
+	TUI        bool     `toml:"tui,omitempty"`
+	NoColor    bool     `toml:"no_color,omitempty"`
+	TimeFormat string   `toml:"time_format,omitempty"`
+	// Cache включает зашифрованный локальный кэш истории.
+	Cache bool `toml:"cache,omitempty"`
+	// CachePassphrase — откуда взять пароль кэша, как в Credentials; без
+	// него пароль спрашивается при запуске.
+	CachePassphrase string `toml:"cache_passphrase,omitempty"`
+}
+
+type Config struct {
+	DefaultProfile string             `toml:"default_profile,omitempty"`
+	Profiles       map[string]Profile `toml:"profiles,omitempty"`
+}
+
+// Keys — ключи профиля, которые можно менять через bunny config set.
+var Keys = []string{"user", "server", "rabbitmq", "credentials", "ca_file", "timeout", "chats", "tui", "no_color", "time_format", "cache", "cache_passphrase"}
+
+var ErrUnknownKey = errors.New("неизвестный ключ")
+
+// Path возвращает путь к файлу настроек: $BUNNY_CONFIG или
+// $XDG_CONFIG_HOME/bunnychat/config.toml (по умолчанию ~/.config).
+func Path() (string, error) {
+	if path := os.Getenv("BUNNY_CONFIG"); path != "" {
+		return path, nil
+	}
+	dir := os.Getenv("XDG_CONFIG_HOME")
+	if dir == "" {
+		home, err := os.UserHomeDir()
+		if err != nil {
+			return "", fmt.Errorf("не удалось определить домашний каталог: %w", err)
+		}
+		dir = filepath.Join(home, ".config")
+	}
+	return filepath.Join(dir, "bunnychat", "config.toml"), nil
+}
+
+// Load читает файл настроек. Отсутствующий файл — не ошибка: возвращается
+// пустая конфигурация.
+func Load(path string) (*Config, error) {
+	cfg := &Config{Profiles: make(map[string]Profile)}
+
+	data, err := os.ReadFile(path)
+	if errors.Is(err, os.ErrNotExist) {
+		return cfg, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("ошибка чтения настроек: %w", err)
+	}
+	if err := toml.Unmarshal(data, cfg); err != nil {
+		return nil, fmt.Errorf("ошибка в файле настроек %s: %w", path, err)
+	}
+	if cfg.Profiles == nil {
+		cfg.Profiles = make(map[string]Profile)
+	}
+	return cfg, nil
+}
+
+// Save записывает настройки, доступные только владельцу.
+func (c *Config) Save(path string) error {
+	data, err := toml.Marshal(c)
+	if err != nil {
+		return fmt.Errorf("ошибка сериализации настроек: %w", err)
+	}
+	if err := os.MkdirAll(filepath.Dir(path), 0o700); err != nil {
+		return fmt.Errorf("ошибка создания каталога настроек: %w", err)
+	}
+	if err := os.WriteFile(path, data, 0o600); err != nil {
+		return fmt.Errorf("ошибка записи настроек: %w", err)
+	}
+	return nil
+}
+
+// ProfileNames возвращает имена профилей по алфавиту.
+func (c *Config) ProfileNames() []string {
+	names := make([]string, 0, len(c.Profiles))
+	for name := range c.Profiles {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// Select возвращает профиль с именем name, а при пустом name — профиль из
+// $BUNNY_PROFILE или default_profile. Явно запрошенный, но отсутствующий
+// профиль — ошибка; без профиля возвращаются пустые настройки.
+func (c *Config) Select(name string) (string, Profile, error) {
+	if name == "" {
+		name = os.Getenv("BUNNY_PROFILE")
+	}
+	if name == "" {
+		name = c.DefaultProfile
+		if _, ok := c.Profiles[name]; !ok {
+			return "", Profile{}, nil
+		}
+	}
+	profile, ok := c.Profiles[name]
+	if !ok {
+		return "", Profile{}, fmt.Errorf("профиль %q не найден", name)
+	}
+	return name, profile, nil
+}
+
+// ApplyEnv переопределяет поля профиля переменными окружения
+// BUNNY_USER, BUNNY_SERVER, BUNNY_RABBITMQ, BUNNY_CREDENTIALS,
+// BUNNY_CA_FILE, BUNNY_TIMEOUT, BUNNY_CACHE_PASSPHRASE и BUNNY_CHATS (через
+// запятую).
+func (p *Profile) ApplyEnv() {
+	overrides := map[string]*string{
+		"BUNNY_USER":             &p.User,
+		"BUNNY_SERVER":           &p.Server,
+		"BUNNY_RABBITMQ":         &p.RabbitMQ,
+		"BUNNY_CREDENTIALS":      &p.Credentials,
+		"BUNNY_CA_FILE":          &p.CAFile,
+		"BUNNY_TIMEOUT":          &p.Timeout,
+		"BUNNY_CACHE_PASSPHRASE": &p.CachePassphrase,
+	}
+	for env, field := range overrides {
+		if value := os.Getenv(env); value != "" {
+			*field = value
+		}
+	}
+	if value := os.Getenv("BUNNY_CHATS"); value != "" {
+		p.Chats = splitList(value)
+	}
+}
+
+// WithDefaults заполняет пустые адреса значениями по умолчанию.
+func (p Profile) WithDefaults() Profile {
+	if p.Server == "" {
+		p.Server = DefaultServer
+	}
+	if p.RabbitMQ == "" {
+		p.RabbitMQ = DefaultRabbitMQ
+	}
+	return p
+}
+
+// HTTPTimeout возвращает таймаут HTTP-запросов; 0 — значение по умолчанию.
+func (p Profile) HTTPTimeout() (time.Duration, error) {
+	if p.Timeout == "" {
+		return 0, nil
+	}
+	timeout, err := time.ParseDuration(p.Timeout)
+	if err != nil {
+		return 0, fmt.Errorf("некорректный таймаут %q: %w", p.Timeout, err)
+	}
+	return timeout, nil
+}
+
+// BrokerURL возвращает URL RabbitMQ. RabbitMQ может быть адресом
+// "host:port" или полным URL; логин и пароль берутся из Credentials, если
+// их нет в самом адресе, иначе используется guest:guest.
+func (p Profile) BrokerURL() (string, error) {
+	raw := p.RabbitMQ
+	if raw == "" {
+		raw = DefaultRabbitMQ
+	}
+	if !strings.Contains(raw, "://") {
+		raw = "amqp://" + raw + "/"
+	}
+	u, err := url.Parse(raw)
+	if err != nil {
+		return "", fmt.Errorf("некорректный адрес RabbitMQ: %w", err)
+	}
+	if u.User != nil {
+		return u.String(), nil
+	}
+
+	user, password := "guest", "guest"
+	if p.Credentials != "" {
+		secret, err := resolveCredentials(p.Credentials)
+		if err != nil {
+			return "", err
+		}
+		var ok bool
+		user, password, ok = strings.Cut(secret, ":")
+		if !ok {
+			return "", errors.New("учетные данные RabbitMQ должны иметь вид логин:пароль")
+		}
+	}
+	u.User = url.UserPassword(user, password)
+	return u.String(), nil
+}
+
+// CachePassword возвращает пароль кэша из CachePassphrase или пустую
+// строку, если источник не задан.
+func (p Profile) CachePassword() (string, error) {
+	if p.CachePassphrase == "" {
+		return "", nil
+	}
+	return resolveCredentials(p.CachePassphrase)
+}
+
+func resolveCredentials(ref string) (string, error) {
+	kind, value, _ := strings.Cut(ref, ":")
+	switch kind {
+	case "env":
+		secret := os.Getenv(value)
+		if secret == "" {
+			return "", fmt.Errorf("переменная окружения %s не задана", value)
+		}
+		return secret, nil
+	case "file":
+		data, err := os.ReadFile(value)
+		if err != nil {
+			return "", fmt.Errorf("ошибка чтения учетных данных: %w", err)
+		}
+		return strings.TrimSpace(string(data)), nil
+	default:
+		return "", fmt.Errorf("неизвестный источник учетных данных %q (ожидается env:… или file:…)", ref)
+	}
+}
+
+// Get возвращает значение ключа в том виде, в каком его принимает Set.
+func (p Profile) Get(key string) (string, error) {
+	switch key {
+	case "user":
+		return p.User, nil
+	case "server":
+		return p.Server, nil
+	case "rabbitmq":
+		return p.RabbitMQ, nil
+	case "credentials":
+		return p.Credentials, nil
+	case "ca_file":
+		return p.CAFile, nil
+	case "timeout":
+		return p.Timeout, nil
+	case "chats":
+		return strings.Join(p.Chats, ","), nil
+	case "tui":
+		return strconv.FormatBool(p.TUI), nil
+	case "no_color":
+		return strconv.FormatBool(p.NoColor), nil
+	case "time_format":
+		return p.TimeFormat, nil
+	case "cache":
+		return strconv.FormatBool(p.Cache), nil
+	case "cache_passphrase":
+		return p.CachePassphrase, nil
+	}
+	return "", fmt.Errorf("%w %q", ErrUnknownKey, key)
+}
+
+// Set меняет значение ключа; пустое значение сбрасывает его.
+func (p *Profile) Set(key, value string) error {
+	switch key {
+	case "user":
+		p.User = value
+	case "server":
+		p.Server = value
+	case "rabbitmq":
+		p.RabbitMQ = value
+	case "credentials":
+		p.Credentials = value
+	case "ca_file":
+		p.CAFile = value
+	case "timeout":
+		if value != "" {
+			if _, err := time.ParseDuration(value); err != nil {
+				return fmt.Errorf("timeout: ожидается длительность, например 10s")
+			}
+		}
+		p.Timeout = value
+	case "chats":
+		p.Chats = splitList(value)
+	case "tui", "no_color", "cache":
+		enabled := false
+		if value != "" {
+			var err error
+			if enabled, err = strconv.ParseBool(value); err != nil {
+				return fmt.Errorf("%s: ожидается true или false", key)
+			}
+		}
+		switch key {
+		case "tui":
+			p.TUI = enabled
+		case "no_color":
+			p.NoColor = enabled
+		default:
+			p.Cache = enabled
+		}
+	case "time_format":
+		p.TimeFormat = value
+	case "cache_passphrase":
+		p.CachePassphrase = value
+	default:
+		return fmt.Errorf("%w %q", ErrUnknownKey, key)
+	}
+	return nil
+}
+
+func splitList(value string) []string {
+	var items []string
+	for _, item := range strings.Split(value, ",") {
+		if item = strings.TrimSpace(item); item != "" {
+			items = append(items, item)
+		}
+	}
+	return items
+}
@@ -2,4 +2,28 @@ module team-bunny-chat/cli
 
 go 1.23.6
 
-require github.com/rabbitmq/amqp091-go v1.10.0
+require (
+	github.com/gdamore/tcell/v2 v2.8.1
+	github.com/mattn/go-runewidth v0.0.16
+	github.com/mattn/go-sqlite3 v1.14.22
+	github.com/pelletier/go-toml/v2 v2.2.2
+	github.com/rabbitmq/amqp091-go v1.10.0
+	github.com/rivo/tview v0.42.0
+	github.com/stretchr/testify v1.9.0
+	golang.org/x/crypto v0.32.0
+	golang.org/x/term v0.28.0
+	team-bunny-chat/bunnychat v0.0.0
+)
+
+require (
+	github.com/davecgh/go-spew v1.1.1 // indirect
+	github.com/gdamore/encoding v1.0.1 // indirect
+	github.com/lucasb-eyer/go-colorful v1.2.0 // indirect
+	github.com/pmezard/go-difflib v1.0.0 // indirect
+	github.com/rivo/uniseg v0.4.7 // indirect
+	golang.org/x/sys v0.29.0 // indirect
+	golang.org/x/text v0.21.0 // indirect
+	gopkg.in/yaml.v3 v3.0.1 // indirect
+)
+
+replace team-bunny-chat/bunnychat => ../bunnychat
@@ -0,0 +1,251 @@
+// Package render оформляет сообщения чата для вывода в терминал: цвет
+// автора, разделители дат, простой Markdown и перенос строк по ширине.
+package render
+
+import (
+	"fmt"
+	"hash/fnv"
+	"os"
+	"regexp"
+	"strings"
+	"time"
+
+	"github.com/mattn/go-runewidth"
+	"golang.org/x/term"
+
+	"team-bunny-chat/bunnychat"
+)
+
+const (
+	bold      = "\033[1m"
+	boldOff   = "\033[22m"
+	dim       = "\033[2m"
+	dimOff    = "\033[22m"
+	italic    = "\033[3m"
+	italicOff = "\033[23m"
+	underline = "\033[4m"
+	underOff  = "\033[24m"
+	code      = "\033[36m"
+	colorOff  = "\033[39m"
+	// mention — черный текст на желтом фоне.
+	mention    = "\033[30;43m"
+	mentionOff = "\033[39;49m"
+)
+
+// userColors — цвета авторов; красный не используется, он у ошибок.
+var userColors = []string{
+	"\033[32m", "\033[33m", "\033[34m", "\033[35m", "\033[36m",
+	"\033[92m", "\033[93m", "\033[94m", "\033[95m", "\033[96m",
+}
+
+var months = []string{
+	"января", "февраля", "марта", "апреля", "мая", "июня",
+	"июля", "августа", "сентября", "октября", "ноября", "декабря",
+}
+
+type Options struct {
+	// Color включает ANSI-оформление; без него текст выводится как есть.
+	Color bool
+	// Width — ширина терминала для переноса строк; 0 — без переноса.
+	Width int
+	// Username — текущий пользователь: его упоминания выделяются, а его
+	// имя в сообщениях пишется жирным.
+	Username   string
+	TimeFormat string
+	// ShowChat добавляет название чата перед сообщением.
+	ShowChat bool
+}
+
+// Renderer помнит день последнего сообщения, чтобы вывести разделитель
+// при смене даты. Не безопасен для одновременного использования.
+type Renderer struct {
+	opts    Options
+	lastDay string
+}
+
+func New(opts Options) *Renderer {
+	if opts.TimeFormat == "" {
+		opts.TimeFormat = "15:04:05"
+	}
+	return &Renderer{opts: opts}
+}
+
+// Message возвращает оформленное сообщение; если день сменился, перед ним
+// идет строка с датой. Результат может состоять из нескольких строк и не
+// заканчивается переводом строки.
+func (r *Renderer) Message(msg bunnychat.Message) string {
+	var b strings.Builder
+
+	local := msg.Timestamp.Local()
+	if day := local.Format("2006-01-02"); day != r.lastDay {
+		r.lastDay = day
+		b.WriteString(r.style(dim, DateSeparator(local), dimOff))
+		b.WriteString("\n")
+	}
+
+	var prefix strings.Builder
+	if r.opts.ShowChat {
+		prefix.WriteString(r.style(dim, "["+msg.ChatName+"]", dimOff) + " ")
+	}
+	prefix.WriteString(r.style(dim, "["+local.Format(r.opts.TimeFormat)+"]", dimOff) + " ")
+	if msg.ID != 0 {
+		prefix.WriteString(r.style(dim, fmt.Sprintf("#%d", msg.ID), dimOff) + " ")
+	}
+	author := msg.Username
+	if r.opts.Color {
+		author = UserColor(msg.Username) + author + colorOff
+		if msg.Username == r.opts.Username {
+			author = bold + author + boldOff
+		}
+	}
+	prefix.WriteString(author + ": ")
+
+	body := Markdown(msg.Body, r.opts.Color)
+	if r.opts.Color && r.opts.Username != "" {
+		body = highlightMentions(body, r.opts.Username)
+	}
+
+	line := prefix.String() + body
+	indent := visibleWidth(prefix.String())
+	if indent > r.opts.Width/3 {
+		indent = 2
+	}
+	b.WriteString(Wrap(line, r.opts.Width, indent))
+	return b.String()
+}
+
+func (r *Renderer) style(on, text, off string) string {
+	if !r.opts.Color {
+		return text
+	}
+	return on + text + off
+}
+
+// DateSeparator — строка-разделитель вида "──── 19 октября 2026 ────".
+func DateSeparator(t time.Time) string {
+	return fmt.Sprintf("──── %d %s %d ────", t.Day(), months[t.Month()-1], t.Year())
+}
+
+// UserColor возвращает цвет автора. Цвет зависит только от имени, поэтому
+// у одного пользователя он одинаковый во всех чатах и запусках.
+func UserColor(username string) string {
+	h := fnv.New32a()
+	h.Write([]byte(username))
+	return userColors[h.Sum32()%uint32(len(userColors))]
+}
+
+var (
+	codeSpan   = regexp.MustCompile("`[^`]+`")
+	link       = regexp.MustCompile(`\[([^\]]+)\]\((https?://[^)\s]+)\)`)
+	bareURL    = regexp.MustCompile(`(^|\s)(https?://\S+)`)
+	boldText   = regexp.MustCompile(`\*\*([^*]+)\*\*`)
+	italicText = regexp.MustCompile(`(^|[\s(])[*_]([^*_\s](?:[^*_]*[^*_\s])?)[*_]($|[\s.,!?;:)])`)
+	ansiCode   = regexp.MustCompile("\033\\[[0-9;]*m")
+)
+
+// Markdown оформляет **жирный**, *курсив* (или _курсив_), `код` и ссылки.
+// Без цвета разметка остается как есть, только ссылки [текст](url)
+// превращаются в "текст (url)".
+func Markdown(text string, color bool) string {
+	if !color {
+		return link.ReplaceAllString(text, "$1 ($2)")
+	}
+
+	var b strings.Builder
+	last := 0
+	for _, span := range codeSpan.FindAllStringIndex(text, -1) {
+		b.WriteString(inline(text[last:span[0]]))
+		b.WriteString(code + text[span[0]+1:span[1]-1] + colorOff)
+		last = span[1]
+	}
+	b.WriteString(inline(text[last:]))
+	return b.String()
+}
+
+func inline(text string) string {
+	text = bareURL.ReplaceAllString(text, "$1"+underline+"$2"+underOff)
+	text = link.ReplaceAllString(text, underline+"$1"+underOff+" "+dim+"($2)"+dimOff)
+	text = boldText.ReplaceAllString(text, bold+"$1"+boldOff)
+	return italicText.ReplaceAllString(text, "$1"+italic+"$2"+italicOff+"$3")
+}
+
+// highlightMentions выделяет упоминания пользователя, @here и @channel по
+// тем же правилам, что и сервер. ANSI-коды заменяются пробелами той же
+// длины, чтобы не мешать поиску и не сдвигать границы.
+func highlightMentions(text, username string) string {
+	plain := ansiCode.ReplaceAllStringFunc(text, func(code string) string {
+		return strings.Repeat(" ", len(code))
+	})
+
+	var b strings.Builder
+	last := 0
+	for _, index := range bunnychat.MentionIndexes(plain) {
+		switch text[index[0]+1 : index[1]] {
+		case username, "here", "channel":
+			b.WriteString(text[last:index[0]])
+			b.WriteString(mention + text[index[0]:index[1]] + mentionOff)
+			last = index[1]
+		}
+	}
+	b.WriteString(text[last:])
+	return b.String()
+}
+
+// Wrap переносит text по словам так, чтобы видимая ширина строк не
+// превышала width; продолжения и следующие абзацы сдвигаются на indent
+// пробелов. ANSI-коды не учитываются в ширине. Слова длиннее строки не
+// разрываются.
+func Wrap(text string, width, indent int) string {
+	if width <= 0 {
+		return text
+	}
+
+	pad := strings.Repeat(" ", indent)
+	var out []string
+	for i, paragraph := range strings.Split(text, "\n") {
+		line, lineWidth, empty := "", 0, true
+		if i > 0 {
+			line, lineWidth = pad, indent
+		}
+		for _, word := range strings.Split(paragraph, " ") {
+			w := visibleWidth(word)
+			switch {
+			case empty:
+				line += word
+				lineWidth += w
+				empty = false
+			case lineWidth+1+w > width:
+				out = append(out, line)
+				line, lineWidth = pad+word, indent+w
+			default:
+				line += " " + word
+				lineWidth += 1 + w
+			}
+		}
+		out = append(out, line)
+	}
+	return strings.Join(out, "\n")
+}
+
+func visibleWidth(s string) int {
+	return runewidth.StringWidth(ansiCode.ReplaceAllString(s, ""))
+}
+
+// ColorEnabled решает, выводить ли цвет: не выводим при флаге -no-color,
+// заданной переменной NO_COLOR (https://no-color.org) и когда вывод идет
+// не в терминал.
+func ColorEnabled(noColor bool, f *os.File) bool {
+	if noColor || os.Getenv("NO_COLOR") != "" {
+		return false
+	}
+	return term.IsTerminal(int(f.Fd()))
+}
+
+// TerminalWidth возвращает ширину терминала или 0, если f не терминал.
+func TerminalWidth(f *os.File) int {
+	width, _, err := term.GetSize(int(f.Fd()))
+	if err != nil {
+		return 0
+	}
+	return width
+}
@@ -0,0 +1,169 @@
+package render
+
+import (
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+
+	"team-bunny-chat/bunnychat"
+)
+
+func TestMarkdown(t *testing.T) {
+	tests := []struct {
+		name  string
+		text  string
+		color bool
+		want  string
+	}{
+		{
+			name:  "Жирный и курсив",
+			text:  "**важно** и *тихо*",
+			color: true,
+			want:  bold + "важно" + boldOff + " и " + italic + "тихо" + italicOff,
+		},
+		{
+			name:  "Курсив через подчеркивание",
+			text:  "это _курсив_.",
+			color: true,
+			want:  "это " + italic + "курсив" + italicOff + ".",
+		},
+		{
+			name:  "Подчеркивания внутри слов не трогаем",
+			text:  "snake_case_name",
+			color: true,
+			want:  "snake_case_name",
+		},
+		{
+			name:  "Разметка внутри кода не работает",
+			text:  "запусти `go test **./...**`",
+			color: true,
+			want:  "запусти " + code + "go test **./...**" + colorOff,
+		},
+		{
+			name:  "Ссылка",
+			text:  "[доки](https://example.com/docs)",
+			color: true,
+			want:  underline + "доки" + underOff + " " + dim + "(https://example.com/docs)" + dimOff,
+		},
+		{
+			name:  "Адрес в тексте",
+			text:  "см. https://example.com/a_b",
+			color: true,
+			want:  "см. " + underline + "https://example.com/a_b" + underOff,
+		},
+		{
+			name:  "Без цвета разметка остается",
+			text:  "**важно**, `код` и [доки](https://example.com)",
+			color: false,
+			want:  "**важно**, `код` и доки (https://example.com)",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			assert.Equal(t, tt.want, Markdown(tt.text, tt.color))
+		})
+	}
+}
+
+func TestWrap(t *testing.T) {
+	tests := []struct {
+		name   string
+		text   string
+		width  int
+		indent int
+		want   string
+	}{
+		{
+			name:  "Без ширины",
+			text:  "один два три",
+			width: 0,
+			want:  "один два три",
+		},
+		{
+			name:   "Перенос с отступом",
+			text:   "один два три четыре",
+			width:  9,
+			indent: 2,
+			want:   "один два\n  три\n  четыре",
+		},
+		{
+			name:  "ANSI-коды не занимают места",
+			text:  bold + "один" + boldOff + " два",
+			width: 8,
+			want:  bold + "один" + boldOff + " два",
+		},
+		{
+			name:   "Длинное слово не разрывается",
+			text:   "адрес https://example.com/very/long",
+			width:  10,
+			indent: 1,
+			want:   "адрес\n https://example.com/very/long",
+		},
+		{
+			name:   "Следующий абзац с отступом",
+			text:   "первый\nвторой",
+			width:  20,
+			indent: 2,
+			want:   "первый\n  второй",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			assert.Equal(t, tt.want, Wrap(tt.text, tt.width, tt.indent))
+		})
+	}
+}
+
+func TestUserColor(t *testing.T) {
+	assert.Equal(t, UserColor("alice"), UserColor("alice"))
+
+	colors := map[string]bool{}
+	for _, name := range []string{"alice", "bob", "carol", "dave", "eve", "frank"} {
+		colors[UserColor(name)] = true
+	}
+	assert.Greater(t, len(colors), 1, "разные пользователи должны получать разные цвета")
+}
+
+func TestRendererMessage(t *testing.T) {
+	day := time.Date(2026, 10, 19, 15, 4, 5, 0, time.Local)
+	msg := bunnychat.Message{ID: 42, Username: "bob", Body: "привет, @alice", Timestamp: day, ChatName: "general"}
+
+	r := New(Options{ShowChat: true})
+	assert.Equal(t, "──── 19 октября 2026 ────\n[general] [15:04:05] #42 bob: привет, @alice", r.Message(msg))
+
+	msg.Timestamp = day.Add(time.Minute)
+	assert.Equal(t, "[general] [15:05:05] #42 bob: привет, @alice", r.Message(msg), "разделитель только при смене дня")
+
+	msg.Timestamp = day.Add(24 * time.Hour)
+	assert.True(t, strings.HasPrefix(r.Message(msg), "──── 20 октября 2026 ────\n"))
+
+	colored := New(Options{Color: true, Username: "alice"}).Message(msg)
+	assert.Contains(t, colored, mention+"@alice"+mentionOff)
+	assert.Contains(t, colored, UserColor("bob")+"bob"+colorOff)
+}
+
+func TestHighlightMentions(t *testing.T) {
+	tests := []struct {
+		name string
+		text string
+		want string
+	}{
+		{name: "Упоминание", text: "привет, @bob!", want: "привет, " + mention + "@bob" + mentionOff + "!"},
+		{name: "Точка после имени", text: "спроси @bob.", want: "спроси " + mention + "@bob" + mentionOff + "."},
+		{name: "Другой пользователь с тем же началом", text: "привет, @bobby", want: "привет, @bobby"},
+		{name: "Адрес почты", text: "пиши на x@bob.com", want: "пиши на x@bob.com"},
+		{name: "Адрес почты с именем пользователя", text: "bob@bob.com", want: "bob@bob.com"},
+		{name: "Всем в чате", text: "@here и @channel", want: mention + "@here" + mentionOff + " и " + mention + "@channel" + mentionOff},
+		{name: "Внутри разметки", text: bold + "@bob" + boldOff, want: bold + mention + "@bob" + mentionOff + boldOff},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			assert.Equal(t, tt.want, highlightMentions(tt.text, "bob"))
+		})
+	}
+}
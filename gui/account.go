@@ -0,0 +1,621 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"image/color"
+	"log"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"fyne.io/fyne/v2"
+	"fyne.io/fyne/v2/canvas"
+	"fyne.io/fyne/v2/container"
+	"fyne.io/fyne/v2/dialog"
+	"fyne.io/fyne/v2/storage"
+	"fyne.io/fyne/v2/theme"
+	"fyne.io/fyne/v2/widget"
+
+	"team-bunny-chat/bunnychat"
+)
+
+var (
+	errSignedOut      = errors.New("вход не выполнен")
+	errSessionExpired = errors.New("сеанс истек, войдите снова")
+)
+
+// Account — вход на сервер истории. После выхода аккаунт остается в
+// списке без токенов, чтобы войти снова, не вводя адрес и имя. Server —
+// базовый URL вместе со схемой, как в bunnychat.API.
+type Account struct {
+	Server       string         `json:"server"`
+	User         bunnychat.User `json:"user"`
+	AccessToken  string         `json:"access_token,omitempty"`
+	RefreshToken string         `json:"refresh_token,omitempty"`
+}
+
+func (a Account) key() string {
+	return a.User.Username + "@" + a.Server
+}
+
+func (a Account) signedIn() bool {
+	return a.RefreshToken != ""
+}
+
+func (a Account) title() string {
+	return fmt.Sprintf("%s — %s", a.User.Name(), serverAddress(a.Server))
+}
+
+// accountBook — файл аккаунтов. Current — ключ аккаунта, в котором
+// приложение открывается при запуске.
+type accountBook struct {
+	Current  string    `json:"current,omitempty"`
+	Accounts []Account `json:"accounts,omitempty"`
+}
+
+// put добавляет аккаунт или заменяет сохраненный с тем же ключом.
+func (b *accountBook) put(account Account) {
+	for i := range b.Accounts {
+		if b.Accounts[i].key() == account.key() {
+			b.Accounts[i] = account
+			return
+		}
+	}
+	b.Accounts = append(b.Accounts, account)
+}
+
+// startAccount выбирает аккаунт для запуска: последний открытый, а если
+// адрес сервера задан в окружении, — первый аккаунт на этом сервере.
+func (b accountBook) startAccount(server string) (Account, bool) {
+	if server != "" {
+		server = serverBaseURL(server)
+	}
+	for _, account := range b.Accounts {
+		if account.key() == b.Current && (server == "" || account.Server == server) {
+			return account, true
+		}
+	}
+	if server == "" {
+		return Account{}, false
+	}
+	for _, account := range b.Accounts {
+		if account.Server == server {
+			return account, true
+		}
+	}
+	return Account{}, false
+}
+
+// accountsPath возвращает путь к файлу аккаунтов: $BUNNY_GUI_ACCOUNTS или
+// каталог настроек пользователя/bunnychat/gui-accounts.json. В файле
+// токены, поэтому он, как и пароль RabbitMQ, не в настройках приложения.
+func accountsPath() (string, error) {
+	if path := os.Getenv("BUNNY_GUI_ACCOUNTS"); path != "" {
+		return path, nil
+	}
+	dir, err := os.UserConfigDir()
+	if err != nil {
+		return "", fmt.Errorf("не удалось определить каталог настроек: %w", err)
+	}
+	return filepath.Join(dir, "bunnychat", "gui-accounts.json"), nil
+}
+
+// loadAccountBook читает файл аккаунтов. Отсутствующий файл — не ошибка.
+func loadAccountBook(path string) (accountBook, error) {
+	var book accountBook
+	data, err := os.ReadFile(path)
+	if errors.Is(err, os.ErrNotExist) {
+		return book, nil
+	}
+	if err != nil {
+		return book, fmt.Errorf("ошибка чтения аккаунтов: %w", err)
+	}
+	if err := json.Unmarshal(data, &book); err != nil {
+		return book, fmt.Errorf("ошибка в файле аккаунтов %s: %w", path, err)
+	}
+	return book, nil
+}
+
+func saveAccountBook(path string, book accountBook) error {
+	data, err := json.MarshalIndent(book, "", "  ")
+	if err != nil {
+		return fmt.Errorf("ошибка сериализации аккаунтов: %w", err)
+	}
+	return writePrivateFile(path, data)
+}
+
+// restoreAccount читает сохраненные аккаунты и, если в аккаунте для
+// запуска выполнен вход, открывает приложение от его имени.
+func (c *ChatApp) restoreAccount(path string) {
+	c.accountsPath = path
+	if path == "" {
+		return
+	}
+	book, err := loadAccountBook(path)
+	if err != nil {
+		log.Printf("%v", err)
+	}
+	c.accounts = book
+	if account, ok := book.startAccount(os.Getenv("CHAT_SERVER")); ok && account.signedIn() {
+		c.applyAccount(account)
+	}
+}
+
+// applyAccount делает account текущим и запоминает его в списке. Отметка
+// упоминаний прежнего пользователя сбрасывается вместе со сменой имени,
+// чтобы опрос упоминаний не спросил нового пользователя с чужой отметкой.
+func (c *ChatApp) applyAccount(account Account) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if account.User.Username != c.username || account.Server != c.serverURL {
+		c.lastMentionID, c.mentionsLoaded = 0, false
+		c.mentionEpoch++
+	}
+	c.account = &account
+	c.username, c.serverURL = account.User.Username, account.Server
+	c.accounts.Current = account.key()
+	c.accounts.put(account)
+}
+
+func (c *ChatApp) currentAccount() *Account {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+	return c.account
+}
+
+func (c *ChatApp) savedAccounts() []Account {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+	return append([]Account(nil), c.accounts.Accounts...)
+}
+
+// saveAccounts записывает список аккаунтов. Запись идет под mu, чтобы
+// обновление токена и выход не записали файл одновременно.
+func (c *ChatApp) saveAccounts() {
+	if c.accountsPath == "" {
+		return
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if err := saveAccountBook(c.accountsPath, c.accounts); err != nil {
+		log.Printf("%v", err)
+	}
+}
+
+// login входит на сервер (или регистрируется на нем) и открывает чат.
+// Ошибка показывается в форме входа.
+func (c *ChatApp) login(server, username, password string, register bool) {
+	server = strings.TrimSpace(server)
+	username = strings.TrimSpace(username)
+	if server == "" || username == "" || password == "" {
+		c.showLoginMessage("Укажите сервер, имя пользователя и пароль")
+		return
+	}
+
+	c.showLoginMessage("Вход…")
+	c.background(func() {
+		api := bunnychat.NewAPI(server, username)
+		login := api.Login
+		if register {
+			login = api.Register
+		}
+		session, err := login(username, password)
+		if err != nil {
+			c.showLoginMessage(loginErrorText(err, register))
+			return
+		}
+		c.openAccount(Account{
+			Server:       api.BaseURL,
+			User:         session.User,
+			AccessToken:  session.AccessToken,
+			RefreshToken: session.RefreshToken,
+		})
+	})
+}
+
+func loginErrorText(err error, register bool) string {
+	var apiErr *bunnychat.APIError
+	if errors.As(err, &apiErr) {
+		switch apiErr.StatusCode {
+		case http.StatusUnauthorized:
+			return "Неверное имя пользователя или пароль"
+		case http.StatusConflict:
+			return "Это имя уже занято"
+		case http.StatusBadRequest:
+			if register {
+				return "Имя — буквы, цифры, «_», «.» и «-», пароль — от 8 символов"
+			}
+		case http.StatusNotFound:
+			return "Сервер не поддерживает вход, обновите сервер истории"
+		}
+	}
+	return fmt.Sprintf("Не удалось войти: %v", err)
+}
+
+// openAccount переключает приложение на account: переподключается от
+// его имени и загружает историю. Неотправленные сообщения прежнего
+// аккаунта отбрасываются, а если сменился пользователь, — и его данные,
+// см. resetUser.
+func (c *ChatApp) openAccount(account Account) {
+	c.mu.Lock()
+	running := c.stopConn != nil
+	c.outbox = nil
+	previous := c.username
+	changed := account.User.Username != c.username || account.Server != c.serverURL
+	c.mu.Unlock()
+	if running {
+		c.disconnect()
+	}
+
+	c.applyAccount(account)
+	if changed {
+		c.resetUser(previous)
+	}
+	c.saveAccounts()
+	if err := c.saveSettings(); err != nil {
+		log.Printf("%v", err)
+	}
+	c.do(func() {
+		c.loginForm = nil
+		c.showAccount()
+		c.window.SetContent(c.chatView)
+	})
+	c.connect()
+	c.fetchHistory()
+}
+
+// resetUser забывает данные пользователя previous: его личные переписки,
+// черновики и счетчики непрочитанных; отметку упоминаний сбрасывает
+// applyAccount. Вызывается до подключения, чтобы новый пользователь не
+// подписался на чужие личные переписки.
+func (c *ChatApp) resetUser(previous string) {
+	var channels []string
+	for _, channelName := range c.state.Channels() {
+		if _, ok := bunnychat.DirectPeer(channelName, previous); !ok {
+			channels = append(channels, channelName)
+		}
+	}
+	current := c.state.Channel()
+	if !containsString(channels, current) {
+		current = defaultChat
+		if len(channels) > 0 {
+			current = channels[0]
+		}
+	}
+	c.state.Reset(current, channels)
+	c.highlighted.Store(0)
+	c.editing.Store(nil)
+	c.saveChannels()
+	c.do(func() {
+		c.editBar.Hide()
+		c.messageInput.SetText("")
+		c.followLatest()
+		c.updateTypingLabel()
+		c.messageList.Refresh()
+		c.memberList.Refresh()
+		c.showChatInfo()
+		c.refreshChannelList()
+	})
+}
+
+// switchAccount открывает сохраненный аккаунт, а если из него вышли, —
+// форму входа с его сервером и именем.
+func (c *ChatApp) switchAccount(account Account) {
+	if !account.signedIn() {
+		c.showLogin(account.Server, account.User.Username, "")
+		return
+	}
+	c.openAccount(account)
+}
+
+// signOut завершает сеанс на сервере и показывает форму входа.
+func (c *ChatApp) signOut() {
+	account := c.currentAccount()
+	if account == nil {
+		return
+	}
+	api := c.api()
+	c.background(func() {
+		if err := api.Logout(); err != nil {
+			log.Printf("Ошибка при выходе: %v", err)
+		}
+	})
+	c.closeAccount(account, "Вы вышли из аккаунта")
+}
+
+// closeAccount забывает токены account, если он еще текущий, отключается
+// и показывает форму входа.
+func (c *ChatApp) closeAccount(account *Account, message string) {
+	c.mu.Lock()
+	if c.account != account {
+		c.mu.Unlock()
+		return
+	}
+	c.account = nil
+	closed := *account
+	closed.AccessToken, closed.RefreshToken = "", ""
+	c.accounts.put(closed)
+	c.mu.Unlock()
+
+	c.saveAccounts()
+	c.disconnect()
+	c.showLogin(closed.Server, closed.User.Username, message)
+}
+
+// reauth — bunnychat.API.Reauth: обменивает токен обновления на новую
+// пару, когда сервер отверг токен доступа. Запросы обновляют токен по
+// одному: токен обновления одноразовый, и второй обмен того же токена
+// завершил бы сеанс.
+func (c *ChatApp) reauth(expired string) (string, error) {
+	c.authMu.Lock()
+	defer c.authMu.Unlock()
+
+	account := c.currentAccount()
+	if account == nil {
+		return "", errSignedOut
+	}
+	if account.AccessToken != expired {
+		// Токен уже обновил другой запрос.
+		return account.AccessToken, nil
+	}
+
+	session, err := bunnychat.NewAPI(account.Server, account.User.Username).Refresh(account.RefreshToken)
+	var apiErr *bunnychat.APIError
+	if errors.As(err, &apiErr) && apiErr.StatusCode == http.StatusUnauthorized {
+		// reauth вызывают и горутины клиента RabbitMQ, а closeAccount его
+		// закрывает и ждет их.
+		c.background(func() { c.closeAccount(account, "Сеанс истек, войдите снова") })
+		return "", errSessionExpired
+	}
+	if err != nil {
+		return "", err
+	}
+
+	refreshed := *account
+	refreshed.User = session.User
+	refreshed.AccessToken, refreshed.RefreshToken = session.AccessToken, session.RefreshToken
+	c.mu.Lock()
+	if c.account == account {
+		c.account = &refreshed
+	}
+	c.accounts.put(refreshed)
+	c.mu.Unlock()
+	c.saveAccounts()
+	return session.AccessToken, nil
+}
+
+// accountLabel — подпись с именем пользователя над списком сообщений.
+func accountLabel(user bunnychat.User) string {
+	if user.DisplayName != "" && user.DisplayName != user.Username {
+		return fmt.Sprintf("Пользователь: %s (%s)", user.DisplayName, user.Username)
+	}
+	return fmt.Sprintf("Пользователь: %s", user.Username)
+}
+
+func (c *ChatApp) showAccount() {
+	if account := c.currentAccount(); account != nil {
+		c.usernameLabel.SetText(accountLabel(account.User))
+	}
+}
+
+// loginView — форма входа; показывается вместо чата, пока вход не
+// выполнен.
+type loginView struct {
+	server   *widget.Entry
+	username *widget.Entry
+	password *widget.Entry
+	message  *widget.Label
+}
+
+// showLogin показывает форму входа с заполненными сервером и именем.
+func (c *ChatApp) showLogin(server, username, message string) {
+	c.do(func() {
+		view, content := c.newLoginView(server, username)
+		view.message.SetText(message)
+		c.loginForm = view
+		c.window.SetContent(content)
+	})
+}
+
+func (c *ChatApp) showLoginMessage(message string) {
+	c.do(func() {
+		if c.loginForm != nil {
+			c.loginForm.message.SetText(message)
+		}
+	})
+}
+
+func (c *ChatApp) newLoginView(server, username string) (*loginView, fyne.CanvasObject) {
+	if server == "" {
+		server = c.currentServerURL()
+	}
+	view := &loginView{
+		server:   widget.NewEntry(),
+		username: widget.NewEntry(),
+		password: widget.NewPasswordEntry(),
+		message:  widget.NewLabel(""),
+	}
+	view.server.SetText(serverAddress(server))
+	view.username.SetText(username)
+	view.message.Wrapping = fyne.TextWrapWord
+	submit := func(register bool) {
+		c.login(view.server.Text, view.username.Text, view.password.Text, register)
+	}
+	view.password.OnSubmitted = func(string) { submit(false) }
+
+	loginButton := widget.NewButton("Войти", func() { submit(false) })
+	loginButton.Importance = widget.HighImportance
+	buttons := container.NewGridWithColumns(2,
+		loginButton,
+		widget.NewButton("Зарегистрироваться", func() { submit(true) }),
+	)
+
+	// Прозрачный прямоугольник задает форме ширину: по центру окна
+	// она иначе сжимается до самых узких полей.
+	width := canvas.NewRectangle(color.Transparent)
+	width.SetMinSize(fyne.NewSize(380, 0))
+	box := container.NewVBox(
+		width,
+		widget.NewLabelWithStyle(appTitle, fyne.TextAlignCenter, fyne.TextStyle{Bold: true}),
+		widget.NewForm(
+			widget.NewFormItem("Сервер истории", view.server),
+			widget.NewFormItem("Имя пользователя", view.username),
+			widget.NewFormItem("Пароль", view.password),
+		),
+		buttons,
+		view.message,
+	)
+
+	current := c.currentAccount()
+	accounts := c.savedAccounts()
+	if len(accounts) > 0 {
+		box.Add(widget.NewLabelWithStyle("Сохраненные аккаунты", fyne.TextAlignLeading, fyne.TextStyle{Bold: true}))
+		for _, account := range accounts {
+			account := account
+			if current != nil && account.key() == current.key() {
+				continue
+			}
+			box.Add(widget.NewButtonWithIcon(account.title(), theme.AccountIcon(), func() {
+				if account.signedIn() {
+					c.openAccount(account)
+					return
+				}
+				c.do(func() {
+					view.server.SetText(serverAddress(account.Server))
+					view.username.SetText(account.User.Username)
+					view.password.SetText("")
+					c.window.Canvas().Focus(view.password)
+				})
+			}))
+		}
+	}
+	if current != nil {
+		box.Add(widget.NewButton("Отмена", func() {
+			c.do(func() {
+				c.loginForm = nil
+				c.window.SetContent(c.chatView)
+			})
+		}))
+	}
+
+	return view, container.NewCenter(box)
+}
+
+func (c *ChatApp) currentServerURL() string {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+	return c.serverURL
+}
+
+// showAccountMenu — меню кнопки аккаунта: профиль, переключение между
+// сохраненными аккаунтами и выход.
+func (c *ChatApp) showAccountMenu(anchor fyne.CanvasObject) {
+	current := c.currentAccount()
+	profile := fyne.NewMenuItem("Профиль…", c.showProfileDialog)
+	profile.Disabled = current == nil
+
+	items := []*fyne.MenuItem{profile, fyne.NewMenuItemSeparator()}
+	for _, account := range c.savedAccounts() {
+		account := account
+		item := fyne.NewMenuItem(account.title(), func() { c.switchAccount(account) })
+		item.Checked = current != nil && account.key() == current.key()
+		items = append(items, item)
+	}
+	items = append(items,
+		fyne.NewMenuItem("Добавить аккаунт…", func() { c.showLogin("", "", "") }),
+		fyne.NewMenuItemSeparator(),
+		fyne.NewMenuItem("Выйти", c.signOut),
+	)
+
+	pos := c.app.Driver().AbsolutePositionForObject(anchor).Add(fyne.NewPos(0, anchor.Size().Height))
+	widget.ShowPopUpMenuAtPosition(fyne.NewMenu("", items...), c.window.Canvas(), pos)
+}
+
+func (c *ChatApp) showProfileDialog() {
+	account := c.currentAccount()
+	if account == nil {
+		return
+	}
+	user := account.User
+
+	nameEntry := widget.NewEntry()
+	nameEntry.SetPlaceHolder(user.Username)
+	nameEntry.SetText(user.DisplayName)
+	statusEntry := widget.NewEntry()
+	statusEntry.SetPlaceHolder("Например: в отпуске до понедельника")
+	statusEntry.SetText(user.Status)
+	avatarEntry := widget.NewEntry()
+	avatarEntry.SetPlaceHolder("Адрес изображения")
+	avatarEntry.SetText(user.AvatarURL)
+	uploadButton := widget.NewButtonWithIcon("", theme.FileImageIcon(), func() {
+		c.showAvatarDialog(avatarEntry)
+	})
+
+	form := widget.NewForm(
+		widget.NewFormItem("Имя пользователя", widget.NewLabel(user.Username)),
+		widget.NewFormItem("Отображаемое имя", nameEntry),
+		widget.NewFormItem("Статус", statusEntry),
+		widget.NewFormItem("Аватар", container.NewBorder(nil, nil, nil, uploadButton, avatarEntry)),
+	)
+	dialog.ShowCustomConfirm("Профиль", "Сохранить", "Отмена", form, func(ok bool) {
+		if !ok {
+			return
+		}
+		profile := bunnychat.ProfileUpdate{
+			DisplayName: strings.TrimSpace(nameEntry.Text),
+			AvatarURL:   strings.TrimSpace(avatarEntry.Text),
+			Status:      strings.TrimSpace(statusEntry.Text),
+		}
+		c.background(func() { c.updateProfile(profile) })
+	}, c.window)
+}
+
+// showAvatarDialog загружает выбранное изображение на сервер и подставляет
+// его адрес в поле аватара.
+func (c *ChatApp) showAvatarDialog(avatarEntry *widget.Entry) {
+	open := dialog.NewFileOpen(func(reader fyne.URIReadCloser, err error) {
+		if err != nil {
+			c.setStatus(fmt.Sprintf("Ошибка при выборе файла: %v", err))
+			return
+		}
+		if reader == nil {
+			return
+		}
+		c.background(func() {
+			defer reader.Close()
+			link, err := c.api().Upload(reader.URI().Name(), reader)
+			c.reportServer(err)
+			if err != nil {
+				c.setStatus(fmt.Sprintf("Ошибка при загрузке изображения: %v", err))
+				return
+			}
+			c.do(func() { avatarEntry.SetText(link) })
+		})
+	}, c.window)
+	open.SetFilter(storage.NewExtensionFileFilter(imageExtensions))
+	open.Show()
+}
+
+func (c *ChatApp) updateProfile(profile bunnychat.ProfileUpdate) {
+	user, err := c.api().UpdateProfile(profile)
+	c.reportServer(err)
+	if err != nil {
+		c.setStatus(fmt.Sprintf("Ошибка при сохранении профиля: %v", err))
+		return
+	}
+
+	c.mu.Lock()
+	if c.account != nil && c.account.User.Username == user.Username {
+		updated := *c.account
+		updated.User = *user
+		c.account = &updated
+		c.accounts.put(updated)
+	}
+	c.mu.Unlock()
+	c.saveAccounts()
+	c.do(c.showAccount)
+	c.setStatus("Профиль сохранен")
+}
@@ -0,0 +1,369 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"team-bunny-chat/bunnychat"
+)
+
+// authServer — сервер истории со входом: у alice пароль «пароль123», у
+// bob — «пароль456». Запросы к остальному API проходят только с текущим
+// токеном доступа; expire делает его недействительным, как по истечении
+// срока. У каждого пользователя своя личная переписка с непрочитанными.
+type authServer struct {
+	*httptest.Server
+
+	mu            sync.Mutex
+	user          string
+	access        string
+	refresh       string
+	refreshes     int
+	rejectRefresh bool
+	logouts       []string
+	// mentionQueries — запросы упоминаний в виде «пользователь:after».
+	mentionQueries []string
+}
+
+var (
+	testPasswords    = map[string]string{"alice": "пароль123", "bob": "пароль456"}
+	testDisplayNames = map[string]string{"alice": "Алиса", "bob": "Боб"}
+	testDirectChats  = map[string]string{"alice": "dm:alice:carol", "bob": "dm:bob:dave"}
+)
+
+func newAuthServer(t *testing.T) *authServer {
+	s := &authServer{}
+	s.Server = httptest.NewServer(http.HandlerFunc(s.serve))
+	t.Cleanup(s.Close)
+	return s
+}
+
+func (s *authServer) host() string {
+	return strings.TrimPrefix(s.URL, "http://")
+}
+
+func (s *authServer) expire() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.access = ""
+}
+
+func (s *authServer) issue(username string) bunnychat.Session {
+	s.user = username
+	s.access = fmt.Sprintf("a%d", s.refreshes+1)
+	s.refresh = fmt.Sprintf("r%d", s.refreshes+1)
+	return bunnychat.Session{
+		User:         bunnychat.User{Username: username, DisplayName: testDisplayNames[username]},
+		AccessToken:  s.access,
+		RefreshToken: s.refresh,
+	}
+}
+
+func (s *authServer) serve(w http.ResponseWriter, r *http.Request) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	var body map[string]string
+	json.NewDecoder(r.Body).Decode(&body)
+	switch r.URL.Path {
+	case "/v1/auth/login":
+		if password, ok := testPasswords[body["username"]]; !ok || body["password"] != password {
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+		json.NewEncoder(w).Encode(s.issue(body["username"]))
+		return
+	case "/v1/auth/refresh":
+		if s.rejectRefresh || body["refresh_token"] != s.refresh {
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+		s.refreshes++
+		json.NewEncoder(w).Encode(s.issue(s.user))
+		return
+	}
+
+	token := strings.TrimPrefix(r.Header.Get("Authorization"), "Bearer ")
+	if s.access == "" || token != s.access {
+		w.WriteHeader(http.StatusUnauthorized)
+		return
+	}
+	switch r.URL.Path {
+	case "/v1/auth/logout":
+		s.logouts = append(s.logouts, token)
+		w.WriteHeader(http.StatusNoContent)
+	case "/v1/profile":
+		json.NewEncoder(w).Encode(bunnychat.User{Username: s.user, DisplayName: body["display_name"], Status: body["status"]})
+	case "/v1/chats":
+		json.NewEncoder(w).Encode(ChatsResponse{Chats: []ChatInfo{{Name: testDirectChats[s.user], Unread: 2}}})
+	case "/v1/mentions":
+		s.mentionQueries = append(s.mentionQueries, s.user+":"+r.URL.Query().Get("after"))
+		var mentions []Mention
+		if s.user == "alice" {
+			mentions = []Mention{{ID: 40, Chat: defaultChat, Author: "bob", Body: "@alice"}}
+		}
+		json.NewEncoder(w).Encode(MentionsResponse{User: s.user, Mentions: mentions})
+	case "/v1/chats/history":
+		json.NewEncoder(w).Encode(HistoryResponse{
+			Chat:     r.URL.Query().Get("chat"),
+			Messages: []Message{{ID: 1, Username: "bob", Body: "привет, alice", Timestamp: time.Now()}},
+		})
+	default:
+		w.Write([]byte("{}"))
+	}
+}
+
+// newAccountChatApp — приложение с файлом аккаунтов и без RabbitMQ.
+func newAccountChatApp(t *testing.T) *ChatApp {
+	chatApp := newTestChatApp(t, "http://localhost:0")
+	chatApp.accountsPath = filepath.Join(t.TempDir(), "accounts.json")
+	chatApp.dial = func(string) (bunnychat.Connection, error) {
+		return nil, errors.New("RabbitMQ недоступен")
+	}
+	t.Cleanup(chatApp.disconnect)
+	return chatApp
+}
+
+func TestAccountBook(t *testing.T) {
+	alice := Account{Server: "http://chat.example.com:8080", User: bunnychat.User{Username: "alice"}}
+	bob := Account{Server: "https://dev.example.com", User: bunnychat.User{Username: "bob"}}
+	book := accountBook{Current: bob.key(), Accounts: []Account{alice, bob}}
+
+	tests := []struct {
+		name   string
+		server string
+		want   string
+		wantOK bool
+	}{
+		{name: "Последний открытый", want: "bob", wantOK: true},
+		{name: "Аккаунт на сервере из окружения", server: "chat.example.com:8080", want: "alice", wantOK: true},
+		{name: "Сервер из окружения по HTTPS", server: "https://dev.example.com/", want: "bob", wantOK: true},
+		{name: "Та же машина без HTTPS — другой сервер", server: "dev.example.com"},
+		{name: "Нет аккаунта на сервере", server: "other:8080"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			account, ok := book.startAccount(tt.server)
+			assert.Equal(t, tt.wantOK, ok)
+			assert.Equal(t, tt.want, account.User.Username)
+		})
+	}
+
+	bob.User.DisplayName = "Боб"
+	book.put(bob)
+	assert.Len(t, book.Accounts, 2, "аккаунт с тем же ключом заменяется")
+	assert.Equal(t, "Боб — https://dev.example.com", book.Accounts[1].title())
+}
+
+func TestServerBaseURL(t *testing.T) {
+	tests := []struct {
+		name    string
+		server  string
+		want    string
+		address string
+	}{
+		{name: "Без схемы", server: "chat.example.com:8080", want: "http://chat.example.com:8080", address: "chat.example.com:8080"},
+		{name: "HTTP", server: " http://chat.example.com:8080/ ", want: "http://chat.example.com:8080", address: "chat.example.com:8080"},
+		{name: "HTTPS сохраняется", server: "https://chat.example.com", want: "https://chat.example.com", address: "https://chat.example.com"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			baseURL := serverBaseURL(tt.server)
+			assert.Equal(t, tt.want, baseURL)
+			assert.Equal(t, tt.address, serverAddress(baseURL))
+			assert.Equal(t, baseURL, serverBaseURL(serverAddress(baseURL)), "адрес из поля ввода дает тот же URL")
+		})
+	}
+}
+
+func TestLogin(t *testing.T) {
+	if testing.Short() {
+		t.Skip("Skipping test in short mode")
+	}
+
+	server := newAuthServer(t)
+	chatApp := newAccountChatApp(t)
+
+	chatApp.showLogin("", "", "")
+	chatApp.flush()
+	require.NotNil(t, chatApp.loginForm)
+	assert.NotEqual(t, chatApp.chatView, chatApp.window.Content(), "вместо чата — форма входа")
+
+	chatApp.login(server.host(), "alice", "", false)
+	chatApp.flush()
+	assert.Equal(t, "Укажите сервер, имя пользователя и пароль", chatApp.loginForm.message.Text)
+
+	chatApp.login(server.host(), "alice", "неверный", false)
+	chatApp.flush()
+	assert.Equal(t, "Неверное имя пользователя или пароль", chatApp.loginForm.message.Text)
+	assert.Nil(t, chatApp.currentAccount())
+
+	chatApp.login(" http://"+server.host()+" ", "alice", "пароль123", false)
+	chatApp.flush()
+	assert.Nil(t, chatApp.loginForm)
+	assert.Equal(t, chatApp.chatView, chatApp.window.Content())
+	assert.Equal(t, "alice", chatApp.currentUsername())
+	assert.Equal(t, server.URL, chatApp.currentServerURL())
+	assert.Equal(t, "Пользователь: Алиса (alice)", chatApp.usernameLabel.Text)
+	msg, _, ok := chatApp.state.Message(0)
+	require.True(t, ok)
+	assert.Equal(t, "привет, alice", msg.Body, "история загружена с токеном")
+
+	info, err := os.Stat(chatApp.accountsPath)
+	require.NoError(t, err)
+	assert.Equal(t, os.FileMode(0o600), info.Mode().Perm(), "токены доступны только владельцу")
+
+	restarted := newTestChatApp(t, "http://localhost:0")
+	restarted.restoreAccount(chatApp.accountsPath)
+	require.NotNil(t, restarted.currentAccount(), "после перезапуска вход не нужен")
+	assert.Equal(t, "alice", restarted.currentUsername())
+	assert.Equal(t, "r1", restarted.currentAccount().RefreshToken)
+	assert.Equal(t, server.URL, restarted.currentAccount().Server, "сохранен полный адрес со схемой")
+	assert.Equal(t, server.URL, restarted.currentServerURL())
+}
+
+func TestReauth(t *testing.T) {
+	if testing.Short() {
+		t.Skip("Skipping test in short mode")
+	}
+
+	server := newAuthServer(t)
+	chatApp := newAccountChatApp(t)
+	chatApp.login(server.host(), "alice", "пароль123", false)
+	chatApp.flush()
+	require.NotNil(t, chatApp.currentAccount())
+
+	server.expire()
+	var wg sync.WaitGroup
+	errs := make([]error, 3)
+	for i := range errs {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			_, errs[i] = chatApp.api().History(defaultChat, 10)
+		}(i)
+	}
+	wg.Wait()
+	for _, err := range errs {
+		assert.NoError(t, err)
+	}
+	server.mu.Lock()
+	assert.Equal(t, 1, server.refreshes, "токен обновляется один раз на все запросы")
+	server.mu.Unlock()
+	assert.Equal(t, "r2", chatApp.currentAccount().RefreshToken)
+
+	book, err := loadAccountBook(chatApp.accountsPath)
+	require.NoError(t, err)
+	assert.Equal(t, "r2", book.Accounts[0].RefreshToken, "новый токен сохранен")
+
+	server.mu.Lock()
+	server.rejectRefresh = true
+	server.mu.Unlock()
+	server.expire()
+	chatApp.fetchHistory()
+	chatApp.flush()
+
+	assert.Nil(t, chatApp.currentAccount())
+	require.NotNil(t, chatApp.loginForm)
+	assert.Equal(t, "Сеанс истек, войдите снова", chatApp.loginForm.message.Text)
+	assert.Equal(t, "alice", chatApp.loginForm.username.Text)
+	book, err = loadAccountBook(chatApp.accountsPath)
+	require.NoError(t, err)
+	assert.False(t, book.Accounts[0].signedIn(), "токены забыты, аккаунт остался в списке")
+}
+
+func TestSwitchAccountAndSignOut(t *testing.T) {
+	if testing.Short() {
+		t.Skip("Skipping test in short mode")
+	}
+
+	server := newAuthServer(t)
+	chatApp := newAccountChatApp(t)
+	chatApp.login(server.host(), "alice", "пароль123", false)
+	chatApp.flush()
+
+	bob := Account{Server: "https://dev.example.com", User: bunnychat.User{Username: "bob"}}
+	chatApp.mu.Lock()
+	chatApp.accounts.put(bob)
+	chatApp.mu.Unlock()
+
+	chatApp.switchAccount(bob)
+	chatApp.flush()
+	require.NotNil(t, chatApp.loginForm, "из аккаунта bob вышли — нужен пароль")
+	assert.Equal(t, "https://dev.example.com", chatApp.loginForm.server.Text, "схема не теряется")
+	assert.Equal(t, "bob", chatApp.loginForm.username.Text)
+	assert.Equal(t, "alice", chatApp.currentUsername(), "пока вход не выполнен, аккаунт прежний")
+
+	chatApp.updateProfile(bunnychat.ProfileUpdate{DisplayName: "Алиса Л.", Status: "в отпуске"})
+	chatApp.flush()
+	assert.Equal(t, "Пользователь: Алиса Л. (alice)", chatApp.usernameLabel.Text)
+	assert.Equal(t, "в отпуске", chatApp.currentAccount().User.Status)
+
+	chatApp.signOut()
+	chatApp.flush()
+	assert.Nil(t, chatApp.currentAccount())
+	require.NotNil(t, chatApp.loginForm)
+	assert.Equal(t, "Вы вышли из аккаунта", chatApp.loginForm.message.Text)
+	server.mu.Lock()
+	assert.Equal(t, []string{"a1"}, server.logouts, "сеанс завершен на сервере")
+	server.mu.Unlock()
+}
+
+func TestSwitchAccountResetsUserState(t *testing.T) {
+	if testing.Short() {
+		t.Skip("Skipping test in short mode")
+	}
+
+	server := newAuthServer(t)
+	chatApp := newAccountChatApp(t)
+	chatApp.login(server.host(), "alice", "пароль123", false)
+	chatApp.flush()
+	chatApp.fetchUnread()
+	chatApp.fetchMentions()
+	chatApp.state.SetDraft(defaultChat, "черновик alice")
+	chatApp.switchChannel("dm:alice:carol")
+	chatApp.flush()
+	require.Equal(t, []string{defaultChat, "dm:alice:carol"}, chatApp.state.Channels())
+	chatApp.mu.RLock()
+	require.Equal(t, int64(40), chatApp.lastMentionID)
+	chatApp.mu.RUnlock()
+
+	chatApp.login(server.host(), "bob", "пароль456", false)
+	chatApp.flush()
+	assert.Equal(t, "bob", chatApp.currentUsername())
+	assert.Equal(t, defaultChat, chatApp.state.Channel(), "личная переписка alice закрыта")
+	assert.Equal(t, []string{defaultChat}, chatApp.state.Channels())
+	assert.Equal(t, []string{defaultChat}, chatApp.app.Preferences().StringList(prefChannels))
+	assert.Empty(t, chatApp.state.Draft(defaultChat))
+	assert.Empty(t, chatApp.messageInput.Text)
+	assert.Zero(t, chatApp.state.TotalUnread())
+
+	// Опрос упоминаний нового подключения начинается с начала, а не с
+	// отметки alice.
+	require.Eventually(t, func() bool {
+		server.mu.Lock()
+		defer server.mu.Unlock()
+		return containsString(server.mentionQueries, "bob:0")
+	}, 5*time.Second, 10*time.Millisecond)
+	chatApp.mu.RLock()
+	assert.Zero(t, chatApp.lastMentionID, "отметка alice не перешла к bob")
+	chatApp.mu.RUnlock()
+
+	chatApp.fetchUnread()
+	chatApp.flush()
+	assert.Equal(t, []string{defaultChat, "dm:bob:dave"}, chatApp.state.Channels())
+}
@@ -0,0 +1,404 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"path/filepath"
+	"strings"
+	"unicode"
+
+	"fyne.io/fyne/v2"
+	"fyne.io/fyne/v2/dialog"
+	"fyne.io/fyne/v2/driver/desktop"
+	"fyne.io/fyne/v2/storage"
+	"fyne.io/fyne/v2/widget"
+
+	"team-bunny-chat/bunnychat"
+)
+
+const composerHelp = `Enter — отправить, Shift+Enter — новая строка.
+Стрелка вверх в пустом поле — изменить свое последнее сообщение.
+
+Команды:
+/join <канал>[,<канал>...] — войти в каналы
+/leave [канал] — покинуть канал (по умолчанию текущий)
+/switch <канал> — перейти в канал
+/topic [текст] — сменить тему канала
+/pin <id>, /unpin <id> — закрепить или открепить сообщение
+/pins — закрепленные сообщения
+/search [текст] — поиск по истории
+/who — кто сейчас в канале
+/help — эта справка`
+
+// imageExtensions — какие файлы можно загрузить на сервер.
+var imageExtensions = []string{".png", ".jpg", ".jpeg", ".gif", ".webp"}
+
+// composerEntry — поле ввода сообщения. Enter отправляет, Shift+Enter
+// переносит строку; стрелка вверх в пустом поле открывает на изменение
+// последнее свое сообщение, Escape отменяет изменение. Вставка пути к
+// изображению загружает его. Обработчики вызываются из событий
+// интерфейса.
+type composerEntry struct {
+	widget.Entry
+
+	shift bool
+
+	onSend     func(text string)
+	onEditLast func() bool
+	onCancel   func() bool
+	onPaste    func(text string) bool
+}
+
+func newComposerEntry() *composerEntry {
+	e := &composerEntry{}
+	e.MultiLine = true
+	e.Wrapping = fyne.TextWrapWord
+	e.ExtendBaseWidget(e)
+	return e
+}
+
+func (e *composerEntry) KeyDown(key *fyne.KeyEvent) {
+	if key.Name == desktop.KeyShiftLeft || key.Name == desktop.KeyShiftRight {
+		e.shift = true
+	}
+	e.Entry.KeyDown(key)
+}
+
+func (e *composerEntry) KeyUp(key *fyne.KeyEvent) {
+	if key.Name == desktop.KeyShiftLeft || key.Name == desktop.KeyShiftRight {
+		e.shift = false
+	}
+	e.Entry.KeyUp(key)
+}
+
+// TypedKey перехватывает Enter: без Shift текст отправляется, а с Shift
+// Entry сама вставляет перенос — OnSubmitted у поля не задан.
+func (e *composerEntry) TypedKey(key *fyne.KeyEvent) {
+	switch key.Name {
+	case fyne.KeyReturn, fyne.KeyEnter:
+		if !e.shift && e.onSend != nil {
+			e.onSend(e.Text)
+			return
+		}
+	case fyne.KeyUp:
+		if e.Text == "" && e.onEditLast != nil && e.onEditLast() {
+			return
+		}
+	case fyne.KeyEscape:
+		if e.onCancel != nil && e.onCancel() {
+			return
+		}
+	}
+	e.Entry.TypedKey(key)
+}
+
+func (e *composerEntry) TypedShortcut(shortcut fyne.Shortcut) {
+	if paste, ok := shortcut.(*fyne.ShortcutPaste); ok && e.onPaste != nil && paste.Clipboard != nil {
+		if e.onPaste(paste.Clipboard.Content()) {
+			return
+		}
+	}
+	e.Entry.TypedShortcut(shortcut)
+}
+
+// submit — Enter в поле ввода и кнопка «Отправить»: сохраняет изменение
+// сообщения, выполняет команду или отправляет сообщение.
+func (c *ChatApp) submit(text string) {
+	if c.editing.Load() != nil {
+		c.saveEdit(text)
+		return
+	}
+	if strings.TrimSpace(text) == "" {
+		return
+	}
+	if command, ok := bunnychat.ParseCommand(text); ok {
+		c.setInput("")
+		c.runCommand(command)
+		return
+	}
+	c.sendMessage(text)
+}
+
+// runCommand выполняет команду, введенную в поле сообщения, — те же
+// команды, что в CLI, кроме относящихся только к терминалу.
+func (c *ChatApp) runCommand(command bunnychat.Command) {
+	current := c.state.Channel()
+	switch command.Name {
+	case "join", "switch":
+		names := strings.FieldsFunc(command.Text, func(r rune) bool { return r == ',' || unicode.IsSpace(r) })
+		if len(names) == 0 {
+			c.setStatus(fmt.Sprintf("Использование: /%s <канал>", command.Name))
+			return
+		}
+		for _, name := range names {
+			c.joinChannel(name)
+		}
+	case "leave":
+		name := current
+		if len(command.Args) > 0 {
+			name = command.Args[0]
+		}
+		c.leaveChannel(name)
+	case "topic":
+		if command.Text == "" {
+			c.showTopicDialog()
+			return
+		}
+		c.background(func() {
+			if err := c.api().SetTopic(current, command.Text); err != nil {
+				c.setStatus(fmt.Sprintf("Ошибка при смене темы: %v", err))
+				return
+			}
+			c.fetchChatInfo()
+		})
+	case "pin", "unpin":
+		if len(command.Args) == 0 {
+			c.setStatus(fmt.Sprintf("Использование: /%s <id_сообщения>", command.Name))
+			return
+		}
+		messageID, err := bunnychat.ParseMessageID(command.Args[0])
+		if err != nil {
+			c.setStatus(err.Error())
+			return
+		}
+		if command.Name == "pin" {
+			c.background(func() { c.pinMessage(Message{ID: messageID, ChatName: current}) })
+		} else {
+			c.background(func() { c.unpinMessage(messageID) })
+		}
+	case "pins":
+		c.showPinsDialog()
+	case "search":
+		c.showSearch()
+		if command.Text != "" {
+			c.search.query.SetText(command.Text)
+			c.runSearch()
+		}
+	case "who":
+		var online []string
+		for i := 0; i < c.state.MembersLen(); i++ {
+			if member, ok := c.state.Member(i); ok && member.Online {
+				online = append(online, member.Username)
+			}
+		}
+		if len(online) == 0 {
+			c.setStatus("Сейчас в канале никого нет")
+		} else {
+			c.setStatus(fmt.Sprintf("Сейчас в канале: %s", strings.Join(online, ", ")))
+		}
+	case "help":
+		dialog.ShowInformation("Поле ввода", composerHelp, c.window)
+	default:
+		c.setStatus(fmt.Sprintf("Неизвестная команда: /%s, список — /help", command.Name))
+	}
+}
+
+// editLast открывает на изменение последнее свое сообщение в канале.
+func (c *ChatApp) editLast() bool {
+	msg, ok := c.state.LastFrom(c.currentUsername())
+	if !ok {
+		return false
+	}
+	c.editing.Store(&msg)
+	c.do(func() {
+		c.messageInput.SetText(msg.Body)
+		c.editBar.Show()
+	})
+	return true
+}
+
+// cancelEdit возвращает в поле ввода черновик канала.
+func (c *ChatApp) cancelEdit() bool {
+	if c.editing.Swap(nil) == nil {
+		return false
+	}
+	draft := c.state.Draft(c.state.Channel())
+	c.do(func() {
+		c.messageInput.SetText(draft)
+		c.editBar.Hide()
+	})
+	return true
+}
+
+func (c *ChatApp) saveEdit(text string) {
+	msg := c.editing.Load()
+	if msg == nil || !c.cancelEdit() {
+		return
+	}
+	if strings.TrimSpace(text) == "" || text == msg.Body {
+		return
+	}
+	c.background(func() { c.editMessage(*msg, text) })
+}
+
+// editMessage сохраняет новый текст на сервере и сообщает о нем
+// подписчикам канала. У сообщения, полученного из RabbitMQ, еще нет ID —
+// его находим в истории.
+func (c *ChatApp) editMessage(msg Message, body string) {
+	api := c.api()
+	if msg.ID == 0 {
+		history, err := api.History(msg.ChatName, historyPage)
+		if err != nil {
+			c.setStatus(fmt.Sprintf("Ошибка при изменении сообщения: %v", err))
+			return
+		}
+		for _, stored := range history.Messages {
+			if stored.Username == msg.Username && stored.Timestamp.Equal(msg.Timestamp) {
+				msg.ID = stored.ID
+			}
+		}
+		if msg.ID == 0 {
+			c.setStatus("Сообщение еще не сохранено на сервере, попробуйте позже")
+			return
+		}
+	}
+
+	edited, err := api.EditMessage(msg.ChatName, msg.ID, body)
+	if err != nil {
+		c.setStatus(fmt.Sprintf("Ошибка при изменении сообщения: %v", err))
+		return
+	}
+
+	edit := bunnychat.EditEvent{
+		ID:        msg.ID,
+		Username:  msg.Username,
+		ChatName:  msg.ChatName,
+		Body:      edited.Body,
+		Timestamp: msg.Timestamp,
+	}
+	c.applyEdit(edit)
+	if client := c.currentClient(); client != nil {
+		if err := client.SendEdit(edit); err != nil {
+			log.Printf("%v", err)
+		}
+	}
+	c.setStatus("Сообщение изменено")
+}
+
+// applyEdit показывает новый текст сообщения, если оно загружено.
+func (c *ChatApp) applyEdit(edit bunnychat.EditEvent) {
+	if c.state.Edit(edit) {
+		c.do(func() {
+			c.messageList.Refresh()
+			c.showChatInfo()
+		})
+	}
+}
+
+// setInput заменяет текст поля ввода. Очередь изменений перестраивает
+// окно целиком, поэтому и поле ввода меняется только через нее.
+func (c *ChatApp) setInput(text string) {
+	c.do(func() { c.messageInput.SetText(text) })
+}
+
+// saveDraft запоминает текст поля ввода как черновик текущего канала.
+// Текст изменяемого сообщения черновиком не считается; совпадение с
+// черновиком значит, что его только что вернули в поле.
+func (c *ChatApp) saveDraft(text string) bool {
+	channelName := c.state.Channel()
+	if c.editing.Load() != nil || text == c.state.Draft(channelName) {
+		return false
+	}
+	c.state.SetDraft(channelName, text)
+	return true
+}
+
+func isImageFile(name string) bool {
+	ext := strings.ToLower(filepath.Ext(name))
+	for _, image := range imageExtensions {
+		if ext == image {
+			return true
+		}
+	}
+	return false
+}
+
+// pastedImagePath распознает во вставленном тексте путь к изображению
+// или его file:// URI — так вставляется скопированный в файловом
+// менеджере файл: буфер обмена Fyne 2.4 хранит только текст.
+func pastedImagePath(text string) (string, bool) {
+	text = strings.TrimSpace(text)
+	if text == "" || strings.Contains(text, "\n") {
+		return "", false
+	}
+	if strings.HasPrefix(text, "file://") {
+		uri, err := storage.ParseURI(text)
+		if err != nil {
+			return "", false
+		}
+		text = uri.Path()
+	}
+	if !filepath.IsAbs(text) || !isImageFile(text) {
+		return "", false
+	}
+	if info, err := os.Stat(text); err != nil || !info.Mode().IsRegular() {
+		return "", false
+	}
+	return text, true
+}
+
+func (c *ChatApp) pasteImage(text string) bool {
+	path, ok := pastedImagePath(text)
+	if ok {
+		c.uploadPath(path)
+	}
+	return ok
+}
+
+// uploadDropped загружает файлы, перетащенные в окно.
+func (c *ChatApp) uploadDropped(_ fyne.Position, uris []fyne.URI) {
+	for _, uri := range uris {
+		if uri.Scheme() != "file" {
+			continue
+		}
+		c.uploadPath(uri.Path())
+	}
+}
+
+func (c *ChatApp) uploadPath(path string) {
+	if !isImageFile(path) {
+		c.setStatus("Загрузить можно только изображение: PNG, JPEG, GIF или WebP")
+		return
+	}
+	file, err := os.Open(path)
+	if err != nil {
+		c.setStatus(fmt.Sprintf("Ошибка при загрузке изображения: %v", err))
+		return
+	}
+	c.upload(c.state.Channel(), filepath.Base(path), file)
+}
+
+func (c *ChatApp) showAttachDialog() {
+	open := dialog.NewFileOpen(func(reader fyne.URIReadCloser, err error) {
+		if err != nil {
+			c.setStatus(fmt.Sprintf("Ошибка при выборе файла: %v", err))
+			return
+		}
+		if reader == nil {
+			return
+		}
+		c.upload(c.state.Channel(), reader.URI().Name(), reader)
+	}, c.window)
+	open.SetFilter(storage.NewExtensionFileFilter(imageExtensions))
+	open.Show()
+}
+
+// upload загружает изображение на сервер и отправляет в канал сообщение
+// со ссылкой на него.
+func (c *ChatApp) upload(channelName, name string, r io.ReadCloser) {
+	c.setStatus(fmt.Sprintf("Загрузка %s...", name))
+	c.background(func() {
+		defer r.Close()
+		link, err := c.api().Upload(name, r)
+		c.reportServer(err)
+		if err != nil {
+			c.setStatus(fmt.Sprintf("Ошибка при загрузке изображения: %v", err))
+			return
+		}
+		alt := strings.NewReplacer("[", "", "]", "").Replace(name)
+		c.send(Message{ChatName: channelName, Body: fmt.Sprintf("![%s](%s)", alt, link)})
+		c.setStatus(fmt.Sprintf("Изображение %s отправлено", name))
+	})
+}
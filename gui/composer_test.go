@@ -0,0 +1,317 @@
+package main
+
+import (
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"fyne.io/fyne/v2"
+	"fyne.io/fyne/v2/driver/desktop"
+	"fyne.io/fyne/v2/storage"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"team-bunny-chat/bunnychat"
+)
+
+// outboxBodies — тексты сообщений, ждущих подключения к RabbitMQ.
+func outboxBodies(c *ChatApp) []string {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	var bodies []string
+	for _, msg := range c.outbox {
+		bodies = append(bodies, msg.ChatName+": "+msg.Body)
+	}
+	return bodies
+}
+
+// pressKey и typeText — действия пользователя в поле ввода. Они идут
+// через очередь изменений: поле ввода меняется только из нее.
+func pressKey(c *ChatApp, name fyne.KeyName, shift bool) {
+	e := c.messageInput
+	c.do(func() {
+		if shift {
+			e.KeyDown(&fyne.KeyEvent{Name: desktop.KeyShiftLeft})
+		}
+		e.TypedKey(&fyne.KeyEvent{Name: name})
+		if shift {
+			e.KeyUp(&fyne.KeyEvent{Name: desktop.KeyShiftLeft})
+		}
+	})
+	c.flush()
+}
+
+func typeText(c *ChatApp, text string) {
+	c.do(func() { c.messageInput.SetText(text) })
+	c.flush()
+}
+
+func TestComposerEnter(t *testing.T) {
+	if testing.Short() {
+		t.Skip("Skipping test in short mode")
+	}
+
+	chatApp := newTestChatApp(t, "http://localhost:0")
+	input := chatApp.messageInput
+
+	typeText(chatApp, "первая")
+	chatApp.do(func() { input.CursorColumn = len([]rune("первая")) })
+	pressKey(chatApp, fyne.KeyReturn, true)
+	chatApp.do(func() { input.TypedRune('в') })
+	chatApp.flush()
+	assert.Equal(t, "первая\nв", input.Text, "Shift+Enter переносит строку")
+	assert.Empty(t, outboxBodies(chatApp))
+
+	pressKey(chatApp, fyne.KeyReturn, false)
+	assert.Equal(t, []string{defaultChat + ": первая\nв"}, outboxBodies(chatApp), "Enter отправляет")
+	assert.Empty(t, input.Text)
+
+	typeText(chatApp, "   ")
+	pressKey(chatApp, fyne.KeyEnter, false)
+	assert.Len(t, outboxBodies(chatApp), 1, "пустое сообщение не отправляется")
+}
+
+func TestDrafts(t *testing.T) {
+	if testing.Short() {
+		t.Skip("Skipping test in short mode")
+	}
+
+	server := newHistoryServer(nil, "")
+	defer server.Close()
+
+	chatApp := newTestChatApp(t, server.URL)
+	chatApp.state.AddChannel("random")
+
+	typeText(chatApp, "недописанное")
+	chatApp.switchChannel("random")
+	chatApp.flush()
+	assert.Empty(t, chatApp.messageInput.Text, "у нового канала черновика нет")
+
+	typeText(chatApp, "в random")
+	chatApp.switchChannel(defaultChat)
+	chatApp.flush()
+	assert.Equal(t, "недописанное", chatApp.messageInput.Text)
+
+	chatApp.switchChannel("random")
+	chatApp.flush()
+	assert.Equal(t, "в random", chatApp.messageInput.Text)
+
+	pressKey(chatApp, fyne.KeyReturn, false)
+	assert.Empty(t, chatApp.state.Draft("random"), "отправленное — уже не черновик")
+}
+
+func TestSlashCommands(t *testing.T) {
+	if testing.Short() {
+		t.Skip("Skipping test in short mode")
+	}
+
+	var mu sync.Mutex
+	var topic string
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method == http.MethodPut && strings.HasSuffix(r.URL.Path, "/topic") {
+			var body struct {
+				Topic string `json:"topic"`
+			}
+			json.NewDecoder(r.Body).Decode(&body)
+			mu.Lock()
+			topic = body.Topic
+			mu.Unlock()
+		}
+		w.Write([]byte("{}"))
+	}))
+	defer server.Close()
+
+	chatApp := newTestChatApp(t, server.URL)
+	input := chatApp.messageInput
+
+	tests := []struct {
+		name       string
+		line       string
+		wantStatus string
+	}{
+		{name: "Вход в каналы", line: "/join random, dev"},
+		{name: "Выход из канала", line: "/leave random", wantStatus: "Статус: Вы покинули канал: random"},
+		{name: "Тема канала", line: "/topic Релиз в пятницу"},
+		{name: "Неверный id", line: "/pin abc", wantStatus: "Статус: некорректный id сообщения: abc"},
+		{name: "Неизвестная команда", line: "/quit", wantStatus: "Статус: Неизвестная команда: /quit, список — /help"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			typeText(chatApp, tt.line)
+			pressKey(chatApp, fyne.KeyReturn, false)
+			chatApp.flush()
+			assert.Empty(t, input.Text)
+			if tt.wantStatus != "" {
+				assert.Equal(t, tt.wantStatus, chatApp.statusLabel.Text)
+			}
+		})
+	}
+
+	assert.Equal(t, []string{defaultChat, "dev"}, chatApp.state.Channels())
+	assert.Equal(t, "dev", chatApp.state.Channel())
+	mu.Lock()
+	assert.Equal(t, "Релиз в пятницу", topic)
+	mu.Unlock()
+	assert.Empty(t, outboxBodies(chatApp), "команды не отправляются сообщениями")
+}
+
+func TestEditLast(t *testing.T) {
+	if testing.Short() {
+		t.Skip("Skipping test in short mode")
+	}
+
+	sent := time.Date(2026, 10, 19, 12, 0, 0, 0, time.UTC)
+	var mu sync.Mutex
+	var editPath, editBody string
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch {
+		case r.URL.Path == "/v1/chats/history":
+			json.NewEncoder(w).Encode(HistoryResponse{Chat: defaultChat, Messages: []Message{
+				{ID: 7, Username: "testuser", Body: "превет", Timestamp: sent},
+			}})
+		case r.Method == http.MethodPut && strings.Contains(r.URL.Path, "/messages/"):
+			var body struct {
+				Body string `json:"body"`
+			}
+			json.NewDecoder(r.Body).Decode(&body)
+			mu.Lock()
+			editPath, editBody = r.URL.Path, body.Body
+			mu.Unlock()
+			json.NewEncoder(w).Encode(bunnychat.EditResponse{Chat: defaultChat, Message: Message{ID: 7, Body: body.Body}})
+		default:
+			w.Write([]byte("{}"))
+		}
+	}))
+	defer server.Close()
+
+	chatApp := newTestChatApp(t, server.URL)
+	input := chatApp.messageInput
+
+	pressKey(chatApp, fyne.KeyUp, false)
+	assert.Nil(t, chatApp.editing.Load(), "своих сообщений нет — стрелка работает как обычно")
+
+	chatApp.addMessage(Message{Username: "testuser", Body: "превет", ChatName: defaultChat, Timestamp: sent})
+	chatApp.addMessage(Message{Username: "bob", Body: "что?", ChatName: defaultChat, Timestamp: sent.Add(time.Second)})
+	chatApp.flush()
+
+	pressKey(chatApp, fyne.KeyUp, false)
+	chatApp.flush()
+	assert.Equal(t, "превет", input.Text)
+	assert.True(t, chatApp.editBar.Visible())
+
+	pressKey(chatApp, fyne.KeyEscape, false)
+	chatApp.flush()
+	assert.Empty(t, input.Text)
+	assert.False(t, chatApp.editBar.Visible())
+
+	pressKey(chatApp, fyne.KeyUp, false)
+	typeText(chatApp, "привет")
+	pressKey(chatApp, fyne.KeyReturn, false)
+	chatApp.flush()
+
+	mu.Lock()
+	assert.Equal(t, "/v1/chats/general/messages/7", editPath, "id живого сообщения найден в истории")
+	assert.Equal(t, "привет", editBody)
+	mu.Unlock()
+	msg, _, _ := chatApp.state.Message(0)
+	assert.Equal(t, "привет", msg.Body)
+	assert.Equal(t, int64(7), msg.ID)
+	assert.Empty(t, outboxBodies(chatApp), "изменение не отправляется новым сообщением")
+	assert.Equal(t, "Статус: Сообщение изменено", chatApp.statusLabel.Text)
+
+	chatApp.applyEdit(bunnychat.EditEvent{ID: 7, Username: "testuser", ChatName: defaultChat, Body: "привет всем"})
+	chatApp.flush()
+	msg, _, _ = chatApp.state.Message(0)
+	assert.Equal(t, "привет всем", msg.Body, "изменение из RabbitMQ")
+}
+
+func TestPastedImagePath(t *testing.T) {
+	dir := t.TempDir()
+	image := filepath.Join(dir, "снимок.PNG")
+	require.NoError(t, os.WriteFile(image, []byte("png"), 0o644))
+	text := filepath.Join(dir, "заметка.txt")
+	require.NoError(t, os.WriteFile(text, []byte("txt"), 0o644))
+
+	tests := []struct {
+		name   string
+		text   string
+		want   string
+		wantOK bool
+	}{
+		{name: "Путь к изображению", text: image + "\n", want: image, wantOK: true},
+		{name: "URI файла", text: storage.NewFileURI(image).String(), want: image, wantOK: true},
+		{name: "Не изображение", text: text},
+		{name: "Нет файла", text: filepath.Join(dir, "нет.png")},
+		{name: "Относительный путь", text: "снимок.png"},
+		{name: "Обычный текст", text: "смотри снимок.png"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, ok := pastedImagePath(tt.text)
+			assert.Equal(t, tt.wantOK, ok)
+			assert.Equal(t, tt.want, got)
+		})
+	}
+}
+
+func TestPasteUpload(t *testing.T) {
+	if testing.Short() {
+		t.Skip("Skipping test in short mode")
+	}
+
+	var mu sync.Mutex
+	var uploaded string
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/v1/uploads" {
+			w.Write([]byte("{}"))
+			return
+		}
+		file, _, err := r.FormFile("file")
+		if err == nil {
+			data, _ := io.ReadAll(file)
+			mu.Lock()
+			uploaded = string(data)
+			mu.Unlock()
+		}
+		w.WriteHeader(http.StatusCreated)
+		json.NewEncoder(w).Encode(bunnychat.UploadResponse{Name: "ab.png", URL: "/v1/uploads/ab.png"})
+	}))
+	defer server.Close()
+
+	image := filepath.Join(t.TempDir(), "снимок.png")
+	require.NoError(t, os.WriteFile(image, []byte("картинка"), 0o644))
+
+	chatApp := newTestChatApp(t, server.URL)
+	clipboard := chatApp.window.Clipboard()
+
+	paste := func(content string) {
+		clipboard.SetContent(content)
+		chatApp.do(func() { chatApp.messageInput.TypedShortcut(&fyne.ShortcutPaste{Clipboard: clipboard}) })
+		chatApp.flush()
+	}
+
+	paste("просто текст")
+	assert.Equal(t, "просто текст", chatApp.messageInput.Text, "текст вставляется как обычно")
+
+	typeText(chatApp, "")
+	paste(image)
+
+	assert.Empty(t, chatApp.messageInput.Text, "путь к изображению не вставляется")
+	mu.Lock()
+	assert.Equal(t, "картинка", uploaded)
+	mu.Unlock()
+	assert.Equal(t, []string{defaultChat + ": ![снимок.png](" + server.URL + "/v1/uploads/ab.png)"}, outboxBodies(chatApp))
+
+	chatApp.uploadDropped(fyne.NewPos(0, 0), []fyne.URI{storage.NewFileURI(filepath.Join(t.TempDir(), "заметка.txt"))})
+	chatApp.flush()
+	assert.Equal(t, "Статус: Загрузить можно только изображение: PNG, JPEG, GIF или WebP", chatApp.statusLabel.Text)
+}
@@ -0,0 +1,346 @@
+package main
+
+import (
+	"fmt"
+	"log"
+	"time"
+
+	"fyne.io/fyne/v2"
+	"fyne.io/fyne/v2/canvas"
+	"fyne.io/fyne/v2/container"
+	"fyne.io/fyne/v2/theme"
+	"fyne.io/fyne/v2/widget"
+
+	"team-bunny-chat/bunnychat"
+)
+
+type linkState int
+
+const (
+	linkOffline linkState = iota
+	linkConnecting
+	linkOnline
+	linkReconnecting
+)
+
+// linkStatus — то, что показывает индикатор подключения. Состояние
+// RabbitMQ и сервера истории ведется отдельно: сообщения могут ходить и
+// без сервера истории, и наоборот.
+type linkStatus struct {
+	broker linkState
+	// serverDown выставляется после неудачного запроса к серверу истории и
+	// сбрасывается после удачного.
+	serverDown bool
+	lastErr    string
+	lastErrAt  time.Time
+	// pending — сообщения, которые еще не ушли в RabbitMQ.
+	pending int
+}
+
+func (s *linkStatus) fail(err error, at time.Time) {
+	s.lastErr, s.lastErrAt = err.Error(), at
+}
+
+func (s linkStatus) text() string {
+	var text string
+	switch s.broker {
+	case linkOffline:
+		text = "Отключено"
+	case linkConnecting:
+		text = "Подключение…"
+	case linkReconnecting:
+		text = "Нет связи с RabbitMQ, переподключение…"
+	case linkOnline:
+		text = "В сети"
+	}
+	if s.serverDown {
+		text += ", сервер истории недоступен"
+	}
+	if s.pending > 0 {
+		text += fmt.Sprintf(" · не отправлено: %d", s.pending)
+	}
+	return text
+}
+
+// errorText — последняя ошибка подключения для подписи под индикатором.
+func (s linkStatus) errorText() string {
+	if s.lastErr == "" || (s.broker == linkOnline && !s.serverDown) {
+		return ""
+	}
+	return fmt.Sprintf("Последняя ошибка (%s): %s", s.lastErrAt.Format("15:04:05"), s.lastErr)
+}
+
+func (s linkStatus) color() fyne.ThemeColorName {
+	switch {
+	case s.broker == linkOnline && !s.serverDown:
+		return theme.ColorNameSuccess
+	case s.broker == linkOffline:
+		return theme.ColorNameError
+	default:
+		return theme.ColorNameWarning
+	}
+}
+
+// newLinkIndicator строит индикатор подключения: цветной кружок, состояние,
+// последнюю ошибку и кнопку «Переподключить».
+func (c *ChatApp) newLinkIndicator() fyne.CanvasObject {
+	c.linkDot = canvas.NewCircle(theme.ErrorColor())
+	c.linkLabel = widget.NewLabel(c.link.text())
+	c.linkErrorLabel = widget.NewLabelWithStyle("", fyne.TextAlignLeading, fyne.TextStyle{Italic: true})
+	c.linkErrorLabel.Wrapping = fyne.TextTruncate
+	c.linkErrorLabel.Hide()
+	reconnectButton := widget.NewButtonWithIcon("Переподключить", theme.ViewRefreshIcon(), c.reconnectNow)
+
+	size := theme.IconInlineSize() / 2
+	dot := container.NewCenter(container.NewGridWrap(fyne.NewSize(size, size), c.linkDot))
+	return container.NewBorder(nil, nil,
+		container.NewHBox(dot, c.linkLabel),
+		reconnectButton,
+		c.linkErrorLabel,
+	)
+}
+
+// updateLink меняет состояние подключения и перерисовывает индикатор.
+// Можно вызывать из любой горутины.
+func (c *ChatApp) updateLink(update func(*linkStatus)) {
+	c.mu.Lock()
+	update(&c.link)
+	c.mu.Unlock()
+	c.do(c.showLink)
+}
+
+// showLink читает состояние в момент перерисовки, поэтому порядок, в
+// котором горутины поставили перерисовки в очередь, не важен.
+func (c *ChatApp) showLink() {
+	c.mu.RLock()
+	status, client := c.link, c.client
+	status.pending = len(c.outbox)
+	c.mu.RUnlock()
+	if client != nil {
+		status.pending += client.Pending()
+	}
+
+	settings := c.app.Settings()
+	c.linkDot.FillColor = settings.Theme().Color(status.color(), settings.ThemeVariant())
+	c.linkDot.Refresh()
+	c.linkLabel.SetText(status.text())
+	if text := status.errorText(); text != "" {
+		c.linkErrorLabel.SetText(text)
+		c.linkErrorLabel.Show()
+	} else {
+		c.linkErrorLabel.Hide()
+	}
+}
+
+// reportServer отмечает результат запроса к серверу истории.
+func (c *ChatApp) reportServer(err error) {
+	c.mu.RLock()
+	changed := c.link.serverDown != (err != nil)
+	c.mu.RUnlock()
+	if !changed && err == nil {
+		return
+	}
+	c.updateLink(func(s *linkStatus) {
+		s.serverDown = err != nil
+		if err != nil {
+			s.fail(err, time.Now())
+		}
+	})
+}
+
+func (c *ChatApp) currentClient() *bunnychat.Client {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+	return c.client
+}
+
+// connect запускает подключение к RabbitMQ и опрос сервера истории.
+// Остановить их можно через disconnect.
+func (c *ChatApp) connect() {
+	stop, retry := make(chan struct{}), make(chan struct{}, 1)
+	c.mu.Lock()
+	c.stopConn, c.retry = stop, retry
+	c.mu.Unlock()
+	c.updateLink(func(s *linkStatus) { s.broker = linkConnecting })
+
+	go c.supervise(stop, retry)
+	go c.refresh(stop)
+}
+
+// supervise устанавливает первое подключение к RabbitMQ, повторяя попытки
+// с растущей паузой, пока не получится или не вызовут disconnect. Дальше
+// связь восстанавливает сам bunnychat.Client, а supervise разбирает его
+// события до закрытия клиента.
+func (c *ChatApp) supervise(stop chan struct{}, retry chan struct{}) {
+	backoff := bunnychat.DefaultMinBackoff
+	for attempt := 0; ; attempt++ {
+		client, err := c.dialBroker()
+		if err == nil {
+			if !c.attach(client, stop) {
+				client.Close()
+				return
+			}
+			if attempt > 0 {
+				// Пока не было связи, в каналы могли написать.
+				c.fetchHistory()
+			}
+			c.consume(client.Events())
+			return
+		}
+
+		log.Printf("Ошибка подключения к RabbitMQ: %v", err)
+		c.updateLink(func(s *linkStatus) {
+			s.broker = linkReconnecting
+			s.fail(err, time.Now())
+		})
+
+		timer := time.NewTimer(backoff)
+		select {
+		case <-timer.C:
+			backoff = min(backoff*2, bunnychat.DefaultMaxBackoff)
+		case <-retry:
+			timer.Stop()
+			backoff = bunnychat.DefaultMinBackoff
+		case <-stop:
+			timer.Stop()
+			return
+		}
+	}
+}
+
+// dialBroker подключается к RabbitMQ и подписывается на все каналы из
+// списка, чтобы видеть новые сообщения не только в текущем.
+func (c *ChatApp) dialBroker() (*bunnychat.Client, error) {
+	c.mu.RLock()
+	config := bunnychat.Config{URL: c.rabbitMQURL, Username: c.username, Dial: c.dial}
+	c.mu.RUnlock()
+	config.API = c.api()
+
+	client, err := bunnychat.Connect(config)
+	if err != nil {
+		return nil, err
+	}
+	for _, channelName := range c.state.Channels() {
+		if err := client.Join(channelName); err != nil {
+			client.Close()
+			return nil, err
+		}
+	}
+	return client, nil
+}
+
+// attach делает клиента текущим и отправляет сообщения, набранные до
+// подключения. Если подключение успели остановить, возвращает false.
+func (c *ChatApp) attach(client *bunnychat.Client, stop chan struct{}) bool {
+	c.mu.Lock()
+	select {
+	case <-stop:
+		c.mu.Unlock()
+		return false
+	default:
+	}
+	c.client = client
+	outbox := c.outbox
+	c.outbox = nil
+	c.mu.Unlock()
+
+	for _, msg := range outbox {
+		if err := client.Send(msg.ChatName, msg.Body); err != nil {
+			c.setStatus(err.Error())
+		}
+	}
+	c.updateLink(func(s *linkStatus) { s.broker = linkOnline })
+	c.setStatus("Подключено")
+	return true
+}
+
+// consume разбирает события RabbitMQ. Сообщения и события набора текста
+// помечены чатом: сообщения из других каналов идут в счетчики боковой
+// панели, события набора из них отбрасывает state.
+func (c *ChatApp) consume(events <-chan bunnychat.Event) {
+	for event := range events {
+		switch event.Type {
+		case bunnychat.EventMessage:
+			msg := event.Message
+			if msg.ChatName == "" {
+				msg.ChatName = event.Chat
+			}
+			c.notifyMessage(msg)
+			c.addMessage(msg)
+		case bunnychat.EventTyping:
+			typing := event.Typing
+			if typing.ChatName == "" {
+				typing.ChatName = event.Chat
+			}
+			c.handleTyping(typing)
+		case bunnychat.EventEdited:
+			edit := event.Edit
+			if edit.ChatName == "" {
+				edit.ChatName = event.Chat
+			}
+			c.applyEdit(edit)
+		case bunnychat.EventDisconnected:
+			c.updateLink(func(s *linkStatus) {
+				s.broker = linkReconnecting
+				if event.Err != nil {
+					s.fail(event.Err, time.Now())
+				}
+			})
+		case bunnychat.EventReconnected:
+			// Пропущенные сообщения клиент уже догрузил из истории, а
+			// счетчики и участников подтягиваем сами.
+			c.updateLink(func(s *linkStatus) { s.broker = linkOnline })
+			c.background(c.fetchUnread)
+			c.background(c.fetchMembers)
+		}
+	}
+}
+
+// reconnectNow — кнопка «Переподключить»: не дожидаясь паузы, повторяет
+// подключение к RabbitMQ и проверяет сервер истории.
+func (c *ChatApp) reconnectNow() {
+	c.mu.RLock()
+	client, retry := c.client, c.retry
+	c.mu.RUnlock()
+
+	switch {
+	case retry == nil:
+		c.connect()
+	case client == nil:
+		select {
+		case retry <- struct{}{}:
+		default:
+		}
+	case !client.Connected():
+		client.RetryNow()
+	}
+	c.background(c.fetchUnread)
+}
+
+// reconnect переподключается с новыми параметрами, если соединение было.
+func (c *ChatApp) reconnect() {
+	c.mu.RLock()
+	running := c.stopConn != nil
+	c.mu.RUnlock()
+	if running {
+		c.disconnect()
+		c.connect()
+	}
+}
+
+func (c *ChatApp) disconnect() {
+	c.mu.Lock()
+	if c.stopConn != nil {
+		close(c.stopConn)
+	}
+	client := c.client
+	c.stopConn, c.retry, c.client = nil, nil, nil
+	c.mu.Unlock()
+
+	if client != nil {
+		client.Close()
+	}
+
+	c.updateLink(func(s *linkStatus) { s.broker = linkOffline })
+	c.setStatus("Отключено")
+}
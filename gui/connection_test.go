@@ -0,0 +1,105 @@
+package main
+
+import (
+	"errors"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"fyne.io/fyne/v2"
+	"fyne.io/fyne/v2/theme"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"team-bunny-chat/bunnychat"
+)
+
+func TestLinkStatus(t *testing.T) {
+	failedAt := time.Date(2024, 3, 1, 12, 30, 5, 0, time.UTC)
+
+	tests := []struct {
+		name      string
+		status    linkStatus
+		wantText  string
+		wantError string
+		wantColor fyne.ThemeColorName
+	}{
+		{
+			name:      "Отключено",
+			status:    linkStatus{broker: linkOffline},
+			wantText:  "Отключено",
+			wantColor: theme.ColorNameError,
+		},
+		{
+			name:      "Подключение",
+			status:    linkStatus{broker: linkConnecting},
+			wantText:  "Подключение…",
+			wantColor: theme.ColorNameWarning,
+		},
+		{
+			name:      "В сети",
+			status:    linkStatus{broker: linkOnline, lastErr: "старая ошибка", lastErrAt: failedAt},
+			wantText:  "В сети",
+			wantColor: theme.ColorNameSuccess,
+		},
+		{
+			name:      "Сервер истории недоступен",
+			status:    linkStatus{broker: linkOnline, serverDown: true, lastErr: "connection refused", lastErrAt: failedAt},
+			wantText:  "В сети, сервер истории недоступен",
+			wantError: "Последняя ошибка (12:30:05): connection refused",
+			wantColor: theme.ColorNameWarning,
+		},
+		{
+			name:      "Переподключение с неотправленными сообщениями",
+			status:    linkStatus{broker: linkReconnecting, pending: 2, lastErr: "EOF", lastErrAt: failedAt},
+			wantText:  "Нет связи с RabbitMQ, переподключение… · не отправлено: 2",
+			wantError: "Последняя ошибка (12:30:05): EOF",
+			wantColor: theme.ColorNameWarning,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			assert.Equal(t, tt.wantText, tt.status.text())
+			assert.Equal(t, tt.wantError, tt.status.errorText())
+			assert.Equal(t, tt.wantColor, tt.status.color())
+		})
+	}
+}
+
+func TestSupervisorRetries(t *testing.T) {
+	if testing.Short() {
+		t.Skip("Skipping test in short mode")
+	}
+
+	server := newHistoryServer(nil, "")
+	defer server.Close()
+
+	chatApp := newTestChatApp(t, server.URL)
+	var attempts atomic.Int32
+	chatApp.dial = func(string) (bunnychat.Connection, error) {
+		attempts.Add(1)
+		return nil, errors.New("connection refused")
+	}
+	chatApp.connect()
+	defer chatApp.disconnect()
+
+	require.Eventually(t, func() bool { return attempts.Load() == 1 }, time.Second, 10*time.Millisecond)
+	chatApp.sendMessage("привет")
+	chatApp.flush()
+	assert.Len(t, chatApp.outbox, 1, "сообщение ждет подключения")
+	assert.Contains(t, chatApp.linkLabel.Text, "переподключение")
+	assert.Contains(t, chatApp.linkLabel.Text, "не отправлено: 1")
+	assert.Contains(t, chatApp.linkErrorLabel.Text, "connection refused")
+	assert.True(t, chatApp.linkErrorLabel.Visible())
+
+	chatApp.reconnectNow()
+	assert.Eventually(t, func() bool { return attempts.Load() == 2 }, bunnychat.DefaultMinBackoff/2, 10*time.Millisecond,
+		"«Переподключить» не ждет паузы")
+
+	chatApp.disconnect()
+	chatApp.flush()
+	assert.Equal(t, "Отключено · не отправлено: 1", chatApp.linkLabel.Text)
+	time.Sleep(2 * bunnychat.DefaultMinBackoff)
+	assert.Equal(t, int32(2), attempts.Load(), "после disconnect попытки прекращаются")
+}
@@ -0,0 +1,211 @@
+package main
+
+import (
+	"fmt"
+
+	"fyne.io/fyne/v2"
+	"fyne.io/fyne/v2/widget"
+)
+
+const (
+	// historyPage — сколько сообщений загружается за раз.
+	historyPage = 50
+	// loadThreshold — за сколько строк до начала списка догружается
+	// следующая страница.
+	loadThreshold = 3
+)
+
+// maxMessages — сколько сообщений канала держим в памяти; дальние от
+// видимых вытесняются и при прокрутке загружаются снова.
+var maxMessages = 500
+
+// trackRow запоминает, какое сообщение показывает строка списка, и
+// ставит в очередь проверку прокрутки. В Fyne 2.4 список не сообщает о
+// прокрутке, но при ней показывает новые строки — то есть вызывает
+// UpdateItem. Вызывается и из горутины очереди, поэтому не ждет места в
+// ней: если очередь полна, проверку поставит следующая строка.
+func (c *ChatApp) trackRow(obj fyne.CanvasObject, id widget.ListItemID) {
+	c.rowsMu.Lock()
+	c.rows[obj] = id
+	c.rowsMu.Unlock()
+
+	if c.scrollCheck.CompareAndSwap(false, true) {
+		select {
+		case c.updates <- c.checkScroll:
+		default:
+			c.scrollCheck.Store(false)
+		}
+	}
+}
+
+// visibleMessages возвращает номера первого и последнего видимых
+// сообщений. Строки переиспользуются, и видимы те из них, что сейчас
+// есть в окне.
+func (c *ChatApp) visibleMessages() (first, last int, ok bool) {
+	driver := c.app.Driver()
+
+	c.rowsMu.Lock()
+	defer c.rowsMu.Unlock()
+	first, last = -1, -1
+	for row, id := range c.rows {
+		if driver.AbsolutePositionForObject(row) == (fyne.Position{}) {
+			continue
+		}
+		if first < 0 || id < first {
+			first = id
+		}
+		if id > last {
+			last = id
+		}
+	}
+	if last >= c.state.Len() {
+		last = c.state.Len() - 1
+	}
+	return first, last, first >= 0 && first <= last
+}
+
+// checkScroll следит, прокручен ли список до конца, и догружает
+// страницы истории, когда пользователь добрался до края загруженного.
+func (c *ChatApp) checkScroll() {
+	c.scrollCheck.Store(false)
+	first, last, ok := c.visibleMessages()
+	if !ok {
+		return
+	}
+
+	// Сообщения попадают в state раньше, чем список перерисован, поэтому
+	// «не в конце» еще не значит, что пользователь прокрутил вверх: об
+	// этом говорит только то, что последняя видимая строка стала выше.
+	scrolledUp := last < c.lastVisible
+	c.lastVisible = last
+	switch {
+	case last >= c.state.Len()-1 && c.state.HasNewer():
+		c.following.Store(false)
+		c.loadNewer()
+	case last >= c.state.Len()-1:
+		c.following.Store(true)
+		c.unseen = 0
+		c.jumpButton.Hide()
+	case scrolledUp:
+		c.following.Store(false)
+	}
+	if first < loadThreshold {
+		c.loadOlder()
+	}
+}
+
+// loadOlder догружает страницу сообщений раньше самого старого из
+// загруженных. Строка, бывшая первой видимой, остается на месте.
+// Запрос идет в отдельной горутине, а не через background: его
+// запускает прокрутка, а не действие, завершения которого ждет flush.
+func (c *ChatApp) loadOlder() {
+	channelName, generation := c.state.Current()
+	oldest, ok := c.state.BeginLoad(generation, true)
+	if !ok {
+		return
+	}
+
+	go func() {
+		history, err := c.api().HistoryBefore(channelName, oldest.ID, historyPage)
+		c.reportServer(err)
+		if err != nil {
+			c.state.EndLoad(generation)
+			c.setStatus(fmt.Sprintf("Ошибка при получении истории: %v", err))
+			return
+		}
+		added, ok := c.state.Prepend(generation, history.Messages, len(history.Messages) == historyPage)
+		if !ok || added == 0 {
+			return
+		}
+
+		c.do(func() {
+			first, _, _ := c.visibleMessages()
+			c.messageList.Refresh()
+			c.scrollToRow(max(first, 0) + added)
+			c.trimMessages()
+		})
+	}()
+}
+
+// loadNewer загружает сообщения, вытесненные из памяти снизу, когда
+// пользователь снова долистал до них.
+func (c *ChatApp) loadNewer() {
+	channelName, generation := c.state.Current()
+	newest, ok := c.state.BeginLoad(generation, false)
+	if !ok {
+		return
+	}
+
+	go func() {
+		history, err := c.api().HistoryAfter(channelName, newest.ID, historyPage)
+		c.reportServer(err)
+		if err != nil {
+			c.state.EndLoad(generation)
+			c.setStatus(fmt.Sprintf("Ошибка при получении истории: %v", err))
+			return
+		}
+		hasNewer := len(history.Messages) == historyPage
+		if _, ok := c.state.AppendNewer(generation, history.Messages, hasNewer); !ok {
+			return
+		}
+
+		c.do(func() {
+			c.messageList.Refresh()
+			c.trimMessages()
+		})
+	}()
+}
+
+// trimMessages вытесняет из памяти сообщения, далекие от видимых, не
+// сдвигая видимые строки.
+func (c *ChatApp) trimMessages() {
+	first, last, ok := c.visibleMessages()
+	if !ok {
+		return
+	}
+	top, bottom := c.state.Trim(maxMessages, first, last)
+	if top == 0 && bottom == 0 {
+		return
+	}
+
+	c.messageList.Refresh()
+	if c.following.Load() {
+		c.messageList.ScrollToBottom()
+	} else {
+		c.scrollToRow(first - top)
+	}
+}
+
+// scrollToRow прокручивает список так, чтобы строка id оказалась вверху:
+// ScrollTo выравнивает по верху строку, которая выше видимой области.
+func (c *ChatApp) scrollToRow(id widget.ListItemID) {
+	c.messageList.ScrollToBottom()
+	c.messageList.ScrollTo(id)
+}
+
+// noteUnseen учитывает сообщение, пришедшее, пока список прокручен вверх.
+func (c *ChatApp) noteUnseen() {
+	c.unseen++
+	c.jumpButton.SetText(fmt.Sprintf("К последним (новых: %d)", c.unseen))
+	c.jumpButton.Show()
+}
+
+// followLatest снова прокручивает список за новыми сообщениями — после
+// загрузки истории, смены канала или нажатия «К последним».
+func (c *ChatApp) followLatest() {
+	c.following.Store(true)
+	c.unseen = 0
+	c.lastVisible = 0
+	c.jumpButton.Hide()
+}
+
+// jumpToLatest — кнопка «К последним». Если конец истории вытеснен из
+// памяти, он загружается заново.
+func (c *ChatApp) jumpToLatest() {
+	c.followLatest()
+	if c.state.HasNewer() {
+		c.fetchHistory()
+		return
+	}
+	c.messageList.ScrollToBottom()
+}
@@ -0,0 +1,165 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"testing"
+	"time"
+
+	"fyne.io/fyne/v2"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// newPagedHistoryServer отдает историю из total сообщений страницами,
+// как настоящий сервер: последние limit, limit до before или первые
+// limit после after.
+func newPagedHistoryServer(total int) *httptest.Server {
+	return httptest.NewServer(pagedHistory(total))
+}
+
+func pagedHistory(total int) http.HandlerFunc {
+	start := time.Date(2026, 10, 19, 12, 0, 0, 0, time.UTC)
+	return func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/v1/chats/history" {
+			w.Write([]byte("{}"))
+			return
+		}
+		query := r.URL.Query()
+		limit, _ := strconv.Atoi(query.Get("limit"))
+		end := int64(total) + 1
+		if before := query.Get("before"); before != "" {
+			end, _ = strconv.ParseInt(before, 10, 64)
+		}
+		begin := max(end-int64(limit), 1)
+		if after := query.Get("after"); after != "" {
+			begin, _ = strconv.ParseInt(after, 10, 64)
+			begin++
+			end = min(begin+int64(limit), int64(total)+1)
+		}
+		var messages []Message
+		for id := begin; id < end; id++ {
+			messages = append(messages, Message{
+				ID:        id,
+				Username:  "bob",
+				Body:      fmt.Sprintf("сообщение %d", id),
+				Timestamp: start.Add(time.Duration(id) * time.Minute),
+			})
+		}
+		json.NewEncoder(w).Encode(HistoryResponse{Chat: query.Get("chat"), Messages: messages})
+	}
+}
+
+// visibleIDs возвращает ID первого и последнего видимых сообщений.
+func visibleIDs(t *testing.T, chatApp *ChatApp) (int64, int64) {
+	var first, last int
+	var ok bool
+	done := make(chan struct{})
+	chatApp.do(func() {
+		first, last, ok = chatApp.visibleMessages()
+		close(done)
+	})
+	<-done
+	require.True(t, ok, "список отрисован")
+	messages := chatApp.state.Messages()
+	return messages[first].ID, messages[last].ID
+}
+
+func TestInfiniteScroll(t *testing.T) {
+	if testing.Short() {
+		t.Skip("Skipping test in short mode")
+	}
+
+	server := newPagedHistoryServer(120)
+	defer server.Close()
+
+	chatApp := newTestChatApp(t, server.URL)
+	chatApp.window.Resize(fyne.NewSize(800, 600))
+	chatApp.fetchHistory()
+	chatApp.flush()
+
+	require.Equal(t, historyPage, chatApp.state.Len())
+	_, last := visibleIDs(t, chatApp)
+	assert.Equal(t, int64(120), last, "после загрузки виден конец истории")
+
+	chatApp.do(chatApp.messageList.ScrollToTop)
+	require.Eventually(t, func() bool {
+		chatApp.flush()
+		return chatApp.state.Len() == 2*historyPage
+	}, 5*time.Second, 10*time.Millisecond, "у начала списка догружается страница")
+	chatApp.flush()
+	first, _ := visibleIDs(t, chatApp)
+	assert.Equal(t, int64(71), first, "бывшая первой строка остается на месте")
+
+	chatApp.addMessage(Message{ID: 121, Username: "alice", Body: "новое", ChatName: defaultChat, Timestamp: time.Now()})
+	chatApp.flush()
+	first, _ = visibleIDs(t, chatApp)
+	assert.Equal(t, int64(71), first, "список, прокрученный вверх, не двигается")
+	assert.True(t, chatApp.jumpButton.Visible())
+	assert.Equal(t, "К последним (новых: 1)", chatApp.jumpButton.Text)
+
+	chatApp.do(chatApp.jumpToLatest)
+	chatApp.flush()
+	_, last = visibleIDs(t, chatApp)
+	assert.Equal(t, int64(121), last)
+	assert.False(t, chatApp.jumpButton.Visible())
+}
+
+func TestMessageCap(t *testing.T) {
+	if testing.Short() {
+		t.Skip("Skipping test in short mode")
+	}
+	defer func(previous int) { maxMessages = previous }(maxMessages)
+	maxMessages = 60
+
+	server := newPagedHistoryServer(historyPage)
+	defer server.Close()
+
+	chatApp := newTestChatApp(t, server.URL)
+	chatApp.window.Resize(fyne.NewSize(800, 600))
+	chatApp.fetchHistory()
+	chatApp.flush()
+
+	for id := int64(historyPage + 1); id <= historyPage+20; id++ {
+		chatApp.addMessage(Message{ID: id, Username: "alice", Body: "новое", ChatName: defaultChat, Timestamp: time.Now()})
+	}
+	chatApp.flush()
+
+	assert.Equal(t, maxMessages, chatApp.state.Len(), "старые сообщения вытесняются")
+	assert.True(t, chatApp.state.HasOlder(), "вытесненные можно загрузить снова")
+	_, last := visibleIDs(t, chatApp)
+	assert.Equal(t, int64(historyPage+20), last)
+}
+
+func TestLoadNewer(t *testing.T) {
+	if testing.Short() {
+		t.Skip("Skipping test in short mode")
+	}
+
+	server := newPagedHistoryServer(120)
+	defer server.Close()
+
+	chatApp := newTestChatApp(t, server.URL)
+	history, err := chatApp.api().HistoryBefore(defaultChat, 51, historyPage)
+	require.NoError(t, err)
+	_, generation := chatApp.state.Current()
+	require.True(t, chatApp.state.SetPage(generation, history.Messages, false, true))
+
+	chatApp.loadNewer()
+	require.Eventually(t, func() bool { return chatApp.state.Len() == 100 }, time.Second, 5*time.Millisecond,
+		"страница сразу после загруженных, без разрыва")
+	chatApp.flush()
+	assert.True(t, chatApp.state.HasNewer())
+
+	chatApp.loadNewer()
+	require.Eventually(t, func() bool { return chatApp.state.Len() == 120 }, time.Second, 5*time.Millisecond)
+	chatApp.flush()
+	assert.False(t, chatApp.state.HasNewer(), "неполная страница — конец истории")
+	messages := chatApp.state.Messages()
+	for i, msg := range messages {
+		require.Equal(t, int64(i+1), msg.ID)
+	}
+}
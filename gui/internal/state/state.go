@@ -0,0 +1,748 @@
+// Package state хранит данные окна чата: сообщения, участников, тему и
+// счетчики текущего канала. Их меняют горутина RabbitMQ, запросы к серверу
+// и обработчики интерфейса, поэтому все доступы идут под мьютексом, а
+// ответы, пришедшие после смены канала, отбрасываются.
+package state
+
+import (
+	"sort"
+	"sync"
+	"time"
+
+	"team-bunny-chat/bunnychat"
+)
+
+type (
+	Message = bunnychat.Message
+	Member  = bunnychat.Member
+	Pin     = bunnychat.Pin
+)
+
+// NotifyLevel — о каких сообщениях канала показывать системные
+// уведомления. NotifyDefault — уровень не выбран, его определяет
+// приложение.
+type NotifyLevel string
+
+const (
+	NotifyDefault  NotifyLevel = ""
+	NotifyAll      NotifyLevel = "all"
+	NotifyMentions NotifyLevel = "mentions"
+	NotifyNone     NotifyLevel = "none"
+)
+
+type State struct {
+	mu sync.RWMutex
+
+	channel string
+	// generation растет при каждой смене канала: по ней отличаем ответ на
+	// запрос истории текущего канала от ответа на запрос прежнего.
+	generation  uint64
+	messages    []Message
+	unreadIndex int
+	// hasOlder — на сервере есть сообщения раньше загруженных, hasNewer —
+	// позже: их вытеснили из памяти, пока пользователь читал старые.
+	// loading выставлен, пока догружается страница истории.
+	hasOlder bool
+	hasNewer bool
+	loading  bool
+	members  []Member
+	topic    string
+	pins     []Pin
+	typing   map[string]time.Time
+
+	channels []string
+	unread   map[string]int
+	mentions map[string]int
+	muted    map[string]bool
+	levels   map[string]NotifyLevel
+	// drafts — неотправленный текст поля ввода каждого канала.
+	drafts map[string]string
+}
+
+func New(channel string) *State {
+	return &State{
+		channel:     channel,
+		unreadIndex: -1,
+		typing:      make(map[string]time.Time),
+		channels:    []string{channel},
+		unread:      make(map[string]int),
+		mentions:    make(map[string]int),
+		muted:       make(map[string]bool),
+		levels:      make(map[string]NotifyLevel),
+		drafts:      make(map[string]string),
+	}
+}
+
+// Current возвращает текущий канал и его поколение.
+func (s *State) Current() (string, uint64) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	return s.channel, s.generation
+}
+
+func (s *State) Channel() string {
+	channel, _ := s.Current()
+	return channel
+}
+
+// Switch делает канал текущим, очищает данные прежнего и возвращает новое
+// поколение.
+func (s *State) Switch(channel string) uint64 {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.enter(channel)
+	delete(s.unread, channel)
+	delete(s.mentions, channel)
+	if !contains(s.channels, channel) {
+		s.channels = append(s.channels, channel)
+	}
+	return s.generation
+}
+
+// Reset готовит состояние для другого пользователя: в списке остаются
+// только channels, текущим становится channel, а черновики и счетчики
+// прежнего пользователя забываются. Возвращает новое поколение.
+func (s *State) Reset(channel string, channels []string) uint64 {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.enter(channel)
+	s.channels = []string{channel}
+	for _, name := range channels {
+		if name != "" && !contains(s.channels, name) {
+			s.channels = append(s.channels, name)
+		}
+	}
+	for name := range s.muted {
+		if !contains(s.channels, name) {
+			delete(s.muted, name)
+		}
+	}
+	for name := range s.levels {
+		if !contains(s.channels, name) {
+			delete(s.levels, name)
+		}
+	}
+	s.unread = make(map[string]int)
+	s.mentions = make(map[string]int)
+	s.drafts = make(map[string]string)
+	return s.generation
+}
+
+// enter делает канал текущим и очищает данные прежнего; вызывается под mu.
+func (s *State) enter(channel string) {
+	s.channel = channel
+	s.generation++
+	s.messages = nil
+	s.unreadIndex = -1
+	s.hasOlder, s.hasNewer, s.loading = false, false, false
+	s.members = nil
+	s.topic = ""
+	s.pins = nil
+	s.typing = make(map[string]time.Time)
+}
+
+// SetHistory заменяет сообщения последней страницей истории, запрошенной
+// в поколении generation; устаревший ответ отбрасывается, и тогда
+// возвращается false. Сообщения, пришедшие через RabbitMQ позже последнего
+// из истории, сохраняются. hasOlder — есть ли на сервере более ранние.
+func (s *State) SetHistory(generation uint64, history []Message, lastReadID int64, hasOlder bool) bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if generation != s.generation {
+		return false
+	}
+	s.hasOlder, s.hasNewer, s.loading = hasOlder, false, false
+
+	messages := make([]Message, 0, len(history)+len(s.messages))
+	messages = append(messages, history...)
+	var newest time.Time
+	if len(history) > 0 {
+		newest = history[len(history)-1].Timestamp
+	}
+	for _, msg := range s.messages {
+		if msg.Timestamp.After(newest) {
+			messages = append(messages, msg)
+		}
+	}
+
+	s.messages = messages
+	s.unreadIndex = -1
+	if lastReadID > 0 {
+		for i, msg := range history {
+			if msg.ID > lastReadID {
+				s.unreadIndex = i
+				break
+			}
+		}
+	}
+	return true
+}
+
+// Add добавляет сообщение, если оно из текущего канала. Если конец
+// истории вытеснен из памяти, сообщение не добавляется — оно придет со
+// следующей страницей, — но true все равно возвращается.
+func (s *State) Add(msg Message) bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if msg.ChatName != s.channel {
+		return false
+	}
+	if !s.hasNewer {
+		s.messages = append(s.messages, msg)
+	}
+	delete(s.typing, msg.Username)
+	return true
+}
+
+// SetPage заменяет сообщения страницей из середины истории, например
+// вокруг найденного сообщения. hasOlder и hasNewer — есть ли на сервере
+// сообщения раньше и позже страницы.
+func (s *State) SetPage(generation uint64, page []Message, hasOlder, hasNewer bool) bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if generation != s.generation {
+		return false
+	}
+	s.messages = append([]Message(nil), page...)
+	s.unreadIndex = -1
+	s.hasOlder, s.hasNewer, s.loading = hasOlder, hasNewer, false
+	return true
+}
+
+// Index возвращает номер загруженного сообщения с данным ID или -1.
+func (s *State) Index(id int64) int {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	for i, msg := range s.messages {
+		if msg.ID == id {
+			return i
+		}
+	}
+	return -1
+}
+
+// BeginLoad отмечает, что в поколении generation догружается страница
+// истории: более ранняя, если older, иначе вытесненная более поздняя.
+// Возвращает крайнее загруженное сообщение с этой стороны. false — если
+// страница уже догружается, поколение устарело или догружать нечего.
+func (s *State) BeginLoad(generation uint64, older bool) (Message, bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if generation != s.generation || s.loading || len(s.messages) == 0 {
+		return Message{}, false
+	}
+	edge := s.messages[len(s.messages)-1]
+	if older {
+		edge = s.messages[0]
+	}
+	if (older && (!s.hasOlder || edge.ID == 0)) || (!older && !s.hasNewer) {
+		return Message{}, false
+	}
+	s.loading = true
+	return edge, true
+}
+
+// EndLoad снимает отметку BeginLoad, если страница не пришла.
+func (s *State) EndLoad(generation uint64) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if generation == s.generation {
+		s.loading = false
+	}
+}
+
+// Prepend добавляет в начало страницу более ранних сообщений и возвращает
+// число добавленных; hasOlder — остались ли на сервере еще более ранние.
+func (s *State) Prepend(generation uint64, page []Message, hasOlder bool) (int, bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if generation != s.generation {
+		return 0, false
+	}
+	s.loading = false
+	s.hasOlder = hasOlder
+	if len(s.messages) > 0 {
+		oldest := s.messages[0].ID
+		n := 0
+		for n < len(page) && page[n].ID < oldest {
+			n++
+		}
+		page = page[:n]
+	}
+
+	s.messages = append(append(make([]Message, 0, len(page)+len(s.messages)), page...), s.messages...)
+	if s.unreadIndex >= 0 {
+		s.unreadIndex += len(page)
+	}
+	return len(page), true
+}
+
+// AppendNewer добавляет в конец страницу вытесненных ранее сообщений,
+// следующих за последним загруженным, и возвращает число добавленных.
+// hasNewer — остались ли на сервере сообщения еще новее.
+func (s *State) AppendNewer(generation uint64, page []Message, hasNewer bool) (int, bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if generation != s.generation {
+		return 0, false
+	}
+	s.loading = false
+	s.hasNewer = hasNewer
+	var newest int64
+	if len(s.messages) > 0 {
+		newest = s.messages[len(s.messages)-1].ID
+	}
+	n := len(s.messages)
+	for _, msg := range page {
+		if msg.ID > newest {
+			s.messages = append(s.messages, msg)
+		}
+	}
+	return len(s.messages) - n, true
+}
+
+func (s *State) HasOlder() bool {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	return s.hasOlder
+}
+
+func (s *State) HasNewer() bool {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	return s.hasNewer
+}
+
+// Trim оставляет не больше max сообщений, вытесняя самые далекие от
+// видимых first..last; видимые не вытесняются. Возвращает, сколько
+// сообщений убрано сверху и снизу.
+func (s *State) Trim(max, first, last int) (top, bottom int) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	excess := len(s.messages) - max
+	if excess <= 0 || first < 0 || last >= len(s.messages) || first > last {
+		return 0, 0
+	}
+	above, below := first, len(s.messages)-1-last
+	if above >= below {
+		top = min(excess, above)
+		bottom = min(excess-top, below)
+	} else {
+		bottom = min(excess, below)
+		top = min(excess-bottom, above)
+	}
+
+	s.messages = append([]Message(nil), s.messages[top:len(s.messages)-bottom]...)
+	if top > 0 {
+		s.hasOlder = true
+		s.unreadIndex -= top
+	}
+	if bottom > 0 {
+		s.hasNewer = true
+	}
+	if s.unreadIndex < 0 || s.unreadIndex >= len(s.messages) {
+		s.unreadIndex = -1
+	}
+	return top, bottom
+}
+
+func (s *State) Len() int {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	return len(s.messages)
+}
+
+// Message возвращает i-е сообщение и признак того, что с него начинаются
+// непрочитанные.
+func (s *State) Message(i int) (Message, bool, bool) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	if i < 0 || i >= len(s.messages) {
+		return Message{}, false, false
+	}
+	return s.messages[i], i == s.unreadIndex, true
+}
+
+// Edit заменяет текст сообщения текущего канала, в том числе в
+// закрепленных. Сообщение ищется по ID, а пришедшее из RabbitMQ без ID —
+// по автору и времени отправки; заодно оно получает ID. false — если
+// сообщения нет среди загруженных.
+func (s *State) Edit(edit bunnychat.EditEvent) bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if edit.ChatName != s.channel {
+		return false
+	}
+	found := false
+	for i := len(s.messages) - 1; i >= 0; i-- {
+		msg := &s.messages[i]
+		sameID := msg.ID != 0 && msg.ID == edit.ID
+		sameSend := (msg.ID == 0 || edit.ID == 0) && msg.Username == edit.Username && msg.Timestamp.Equal(edit.Timestamp)
+		if sameID || sameSend {
+			msg.Body = edit.Body
+			if msg.ID == 0 {
+				msg.ID = edit.ID
+			}
+			found = true
+			break
+		}
+	}
+	for i := range s.pins {
+		if edit.ID != 0 && s.pins[i].Message.ID == edit.ID {
+			s.pins[i].Message.Body = edit.Body
+		}
+	}
+	return found
+}
+
+// LastFrom возвращает последнее загруженное сообщение пользователя в
+// текущем канале.
+func (s *State) LastFrom(username string) (Message, bool) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	for i := len(s.messages) - 1; i >= 0; i-- {
+		if s.messages[i].Username == username {
+			return s.messages[i], true
+		}
+	}
+	return Message{}, false
+}
+
+// SetDraft запоминает неотправленный текст канала; пустой текст удаляет
+// черновик.
+func (s *State) SetDraft(channel, text string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if text == "" {
+		delete(s.drafts, channel)
+	} else {
+		s.drafts[channel] = text
+	}
+}
+
+func (s *State) Draft(channel string) string {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	return s.drafts[channel]
+}
+
+// Messages возвращает копию сообщений текущего канала.
+func (s *State) Messages() []Message {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	return append([]Message(nil), s.messages...)
+}
+
+// SetMembers сохраняет участников канала, если он все еще текущий.
+func (s *State) SetMembers(channel string, members []Member) bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if channel != s.channel {
+		return false
+	}
+	s.members = members
+	return true
+}
+
+func (s *State) MembersLen() int {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	return len(s.members)
+}
+
+func (s *State) Member(i int) (Member, bool) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	if i < 0 || i >= len(s.members) {
+		return Member{}, false
+	}
+	return s.members[i], true
+}
+
+// SetInfo сохраняет тему и закрепленные сообщения, если канал все еще
+// текущий.
+func (s *State) SetInfo(channel, topic string, pins []Pin) bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if channel != s.channel {
+		return false
+	}
+	s.topic = topic
+	s.pins = pins
+	return true
+}
+
+func (s *State) Topic() string {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	return s.topic
+}
+
+func (s *State) Pins() []Pin {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	return append([]Pin(nil), s.pins...)
+}
+
+// Typing отмечает, что username набирает текст в канале chat до until.
+// События из других каналов отбрасываются.
+func (s *State) Typing(chat, username string, until time.Time) bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if chat != s.channel {
+		return false
+	}
+	s.typing[username] = until
+	return true
+}
+
+// Typers возвращает тех, кто набирает текст в момент now, по алфавиту, и
+// забывает истекшие отметки.
+func (s *State) Typers(now time.Time) []string {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	usernames := make([]string, 0, len(s.typing))
+	for username, until := range s.typing {
+		if now.After(until) {
+			delete(s.typing, username)
+			continue
+		}
+		usernames = append(usernames, username)
+	}
+	sort.Strings(usernames)
+	return usernames
+}
+
+// AddChannel добавляет канал в список; false — если он там уже есть.
+func (s *State) AddChannel(channel string) bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if contains(s.channels, channel) {
+		return false
+	}
+	s.channels = append(s.channels, channel)
+	return true
+}
+
+func (s *State) Channels() []string {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	return append([]string(nil), s.channels...)
+}
+
+// Restore задает сохраненный список каналов и выключенные из них.
+// Текущий канал остается в списке, даже если его там не было.
+func (s *State) Restore(channels, muted []string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.channels = s.channels[:0]
+	for _, channel := range channels {
+		if channel != "" && !contains(s.channels, channel) {
+			s.channels = append(s.channels, channel)
+		}
+	}
+	if !contains(s.channels, s.channel) {
+		s.channels = append([]string{s.channel}, s.channels...)
+	}
+	s.muted = make(map[string]bool, len(muted))
+	for _, channel := range muted {
+		if contains(s.channels, channel) {
+			s.muted[channel] = true
+		}
+	}
+}
+
+// Remove убирает канал из списка. Текущий канал убрать нельзя: сначала
+// нужно переключиться на другой.
+func (s *State) Remove(channel string) bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if channel == s.channel {
+		return false
+	}
+	for i, name := range s.channels {
+		if name == channel {
+			s.channels = append(s.channels[:i], s.channels[i+1:]...)
+			delete(s.unread, channel)
+			delete(s.mentions, channel)
+			delete(s.muted, channel)
+			delete(s.levels, channel)
+			delete(s.drafts, channel)
+			return true
+		}
+	}
+	return false
+}
+
+// Move сдвигает канал в списке на delta позиций; false — если двигать
+// некуда.
+func (s *State) Move(channel string, delta int) bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	for i, name := range s.channels {
+		if name != channel {
+			continue
+		}
+		j := i + delta
+		if j < 0 || j >= len(s.channels) || j == i {
+			return false
+		}
+		step := 1
+		if j < i {
+			step = -1
+		}
+		for ; i != j; i += step {
+			s.channels[i], s.channels[i+step] = s.channels[i+step], s.channels[i]
+		}
+		return true
+	}
+	return false
+}
+
+func (s *State) SetMuted(channel string, muted bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if muted {
+		s.muted[channel] = true
+	} else {
+		delete(s.muted, channel)
+	}
+}
+
+func (s *State) Muted(channel string) bool {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	return s.muted[channel]
+}
+
+// MutedChannels возвращает выключенные каналы в порядке списка.
+func (s *State) MutedChannels() []string {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	var muted []string
+	for _, channel := range s.channels {
+		if s.muted[channel] {
+			muted = append(muted, channel)
+		}
+	}
+	return muted
+}
+
+func (s *State) SetNotifyLevel(channel string, level NotifyLevel) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if level == NotifyDefault {
+		delete(s.levels, channel)
+	} else {
+		s.levels[channel] = level
+	}
+}
+
+func (s *State) NotifyLevel(channel string) NotifyLevel {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	return s.levels[channel]
+}
+
+// NotifyLevels возвращает выбранные уровни уведомлений каналов из списка.
+func (s *State) NotifyLevels() map[string]NotifyLevel {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	levels := make(map[string]NotifyLevel, len(s.levels))
+	for _, channel := range s.channels {
+		if level, ok := s.levels[channel]; ok {
+			levels[channel] = level
+		}
+	}
+	return levels
+}
+
+// RestoreNotifyLevels задает сохраненные уровни уведомлений. Уровни
+// каналов, которых нет в списке, отбрасываются.
+func (s *State) RestoreNotifyLevels(levels map[string]NotifyLevel) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.levels = make(map[string]NotifyLevel, len(levels))
+	for channel, level := range levels {
+		if contains(s.channels, channel) && level != NotifyDefault {
+			s.levels[channel] = level
+		}
+	}
+}
+
+// Incoming учитывает сообщение, пришедшее в другой канал из списка:
+// увеличивает счетчик непрочитанных и, если в нем упомянут пользователь,
+// счетчик упоминаний. Для текущего и неизвестных каналов возвращает false.
+func (s *State) Incoming(channel string, mention bool) bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if channel == s.channel || !contains(s.channels, channel) {
+		return false
+	}
+	s.unread[channel]++
+	if mention {
+		s.mentions[channel]++
+	}
+	return true
+}
+
+func (s *State) Mentions(channel string) int {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	return s.mentions[channel]
+}
+
+// SetUnread заменяет счетчики непрочитанных; у текущего канала счетчик
+// не ведется.
+func (s *State) SetUnread(unread map[string]int) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.unread = unread
+	delete(s.unread, s.channel)
+}
+
+func (s *State) Unread(channel string) int {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	return s.unread[channel]
+}
+
+// TotalUnread — сколько всего непрочитанных в каналах из списка: у
+// выключенных каналов учитываются только упоминания, как и в боковой
+// панели.
+func (s *State) TotalUnread() int {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	total := 0
+	for _, channel := range s.channels {
+		if s.muted[channel] {
+			total += s.mentions[channel]
+		} else {
+			total += s.unread[channel]
+		}
+	}
+	return total
+}
+
+func contains(items []string, item string) bool {
+	for _, i := range items {
+		if i == item {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,411 @@
+package state
+
+import (
+	"fmt"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"team-bunny-chat/bunnychat"
+)
+
+var start = time.Date(2026, 10, 19, 12, 0, 0, 0, time.UTC)
+
+func message(chat string, id int64, minute int) Message {
+	return Message{
+		ID:        id,
+		ChatName:  chat,
+		Username:  "bob",
+		Body:      fmt.Sprintf("сообщение %d", id),
+		Timestamp: start.Add(time.Duration(minute) * time.Minute),
+	}
+}
+
+func TestSetHistory(t *testing.T) {
+	s := New("general")
+	_, generation := s.Current()
+
+	require.True(t, s.Add(message("general", 0, 5)), "живое сообщение до ответа истории")
+	assert.False(t, s.Add(message("random", 0, 5)), "чужой канал")
+
+	ok := s.SetHistory(generation, []Message{
+		message("general", 1, 1),
+		message("general", 2, 2),
+		message("general", 3, 3),
+	}, 1, false)
+	require.True(t, ok)
+
+	messages := s.Messages()
+	require.Len(t, messages, 4)
+	assert.Equal(t, int64(0), messages[3].ID, "живое сообщение новее истории сохраняется")
+
+	_, unreadStart, ok := s.Message(1)
+	require.True(t, ok)
+	assert.True(t, unreadStart)
+	_, _, ok = s.Message(4)
+	assert.False(t, ok)
+}
+
+func TestStaleResponses(t *testing.T) {
+	s := New("general")
+	_, old := s.Current()
+
+	s.Switch("random")
+	assert.False(t, s.SetHistory(old, []Message{message("general", 1, 1)}, 0, false))
+	assert.False(t, s.SetMembers("general", []Member{{Username: "bob"}}))
+	assert.False(t, s.SetInfo("general", "тема", nil))
+	assert.False(t, s.Typing("general", "bob", start))
+	assert.Zero(t, s.Len())
+	assert.Zero(t, s.MembersLen())
+	assert.Empty(t, s.Topic())
+
+	channel, current := s.Current()
+	assert.Equal(t, "random", channel)
+	assert.True(t, s.SetHistory(current, []Message{message("random", 1, 1)}, 0, false))
+	assert.Equal(t, 1, s.Len())
+}
+
+func TestSwitchClearsChannel(t *testing.T) {
+	s := New("general")
+	s.Add(message("general", 1, 1))
+	s.SetMembers("general", []Member{{Username: "bob"}})
+	s.SetInfo("general", "тема", []Pin{{PinnedBy: "bob"}})
+	s.Typing("general", "bob", start.Add(time.Hour))
+	s.SetUnread(map[string]int{"general": 2, "random": 3})
+
+	assert.Zero(t, s.Unread("general"), "у текущего канала нет счетчика")
+	assert.Equal(t, 3, s.Unread("random"))
+
+	s.Switch("random")
+	assert.Zero(t, s.Len())
+	assert.Zero(t, s.MembersLen())
+	assert.Empty(t, s.Topic())
+	assert.Empty(t, s.Pins())
+	assert.Empty(t, s.Typers(start))
+	assert.Zero(t, s.Unread("random"))
+	assert.Equal(t, []string{"general", "random"}, s.Channels())
+}
+
+func TestReset(t *testing.T) {
+	s := New("dm:alice:bob")
+	s.Restore([]string{"general", "dev", "dm:alice:carol"}, []string{"dev", "dm:alice:carol"})
+	s.SetNotifyLevel("general", NotifyAll)
+	s.SetNotifyLevel("dm:alice:carol", NotifyNone)
+	s.Add(message("dm:alice:bob", 1, 1))
+	s.SetUnread(map[string]int{"general": 2, "dm:alice:carol": 1})
+	s.Incoming("dev", true)
+	s.SetDraft("general", "черновик alice")
+	_, before := s.Current()
+
+	generation := s.Reset("general", []string{"general", "dev"})
+	assert.Greater(t, generation, before, "ответы на запросы прежнего пользователя устарели")
+	assert.Equal(t, "general", s.Channel())
+	assert.Equal(t, []string{"general", "dev"}, s.Channels())
+	assert.Zero(t, s.Len())
+	assert.Zero(t, s.TotalUnread())
+	assert.Zero(t, s.Mentions("dev"))
+	assert.Empty(t, s.Draft("general"))
+	assert.Equal(t, []string{"dev"}, s.MutedChannels(), "настройки оставшихся каналов сохраняются")
+	assert.Equal(t, map[string]NotifyLevel{"general": NotifyAll}, s.NotifyLevels())
+
+	s.Reset("random", nil)
+	assert.Equal(t, []string{"random"}, s.Channels(), "текущий канал всегда в списке")
+}
+
+func TestTypers(t *testing.T) {
+	s := New("general")
+	s.Typing("general", "carol", start.Add(time.Second))
+	s.Typing("general", "alice", start.Add(time.Minute))
+
+	assert.Equal(t, []string{"alice", "carol"}, s.Typers(start))
+	assert.Equal(t, []string{"alice"}, s.Typers(start.Add(2*time.Second)))
+
+	s.Add(Message{ChatName: "general", Username: "alice", Timestamp: start})
+	assert.Empty(t, s.Typers(start), "сообщение снимает отметку о наборе")
+}
+
+// TestSwitchUnderLoad переключает каналы, пока другие горутины добавляют
+// сообщения и присылают ответы истории; запускать с -race.
+func TestSwitchUnderLoad(t *testing.T) {
+	channels := []string{"general", "random", "dev"}
+	s := New(channels[0])
+
+	stop := make(chan struct{})
+	var wg sync.WaitGroup
+	for w := 0; w < 4; w++ {
+		wg.Add(1)
+		go func(w int) {
+			defer wg.Done()
+			for i := 0; ; i++ {
+				select {
+				case <-stop:
+					return
+				default:
+				}
+				chat := channels[(w+i)%len(channels)]
+				s.Add(message(chat, 0, i))
+				channel, generation := s.Current()
+				s.SetHistory(generation, []Message{message(channel, int64(i), i)}, 0, false)
+				s.SetMembers(chat, []Member{{Username: "bob"}})
+				s.Typing(chat, "bob", start)
+				for j := 0; j < s.Len(); j++ {
+					s.Message(j)
+				}
+			}
+		}(w)
+	}
+
+	for i := 0; i < 500; i++ {
+		s.Switch(channels[i%len(channels)])
+		s.Typers(start)
+		s.Channels()
+	}
+	close(stop)
+	wg.Wait()
+
+	channel := s.Channel()
+	for _, msg := range s.Messages() {
+		assert.Equal(t, channel, msg.ChatName, "сообщение из чужого канала")
+	}
+}
+
+func TestChannelList(t *testing.T) {
+	s := New("general")
+	s.Restore([]string{"random", "dev", "random", "", "ops"}, []string{"dev", "unknown"})
+
+	assert.Equal(t, []string{"general", "random", "dev", "ops"}, s.Channels(), "текущий канал остается в списке")
+	assert.Equal(t, []string{"dev"}, s.MutedChannels())
+
+	assert.True(t, s.Move("ops", -2))
+	assert.Equal(t, []string{"general", "ops", "random", "dev"}, s.Channels())
+	assert.True(t, s.Move("general", 1))
+	assert.Equal(t, []string{"ops", "general", "random", "dev"}, s.Channels())
+	assert.False(t, s.Move("dev", 1), "последний канал ниже не сдвинуть")
+	assert.False(t, s.Move("unknown", -1))
+
+	assert.False(t, s.Remove("general"), "текущий канал не убрать")
+	assert.True(t, s.Remove("dev"))
+	assert.Empty(t, s.MutedChannels())
+	assert.Equal(t, []string{"ops", "general", "random"}, s.Channels())
+}
+
+func TestIncoming(t *testing.T) {
+	s := New("general")
+	s.AddChannel("random")
+
+	assert.False(t, s.Incoming("general", true), "текущий канал")
+	assert.False(t, s.Incoming("dev", false), "канала нет в списке")
+	assert.True(t, s.Incoming("random", false))
+	assert.True(t, s.Incoming("random", true))
+	assert.Equal(t, 2, s.Unread("random"))
+	assert.Equal(t, 1, s.Mentions("random"))
+
+	s.Switch("random")
+	assert.Zero(t, s.Unread("random"))
+	assert.Zero(t, s.Mentions("random"))
+}
+
+func TestNotifyLevels(t *testing.T) {
+	s := New("general")
+	s.Restore([]string{"random", "dev"}, nil)
+	s.RestoreNotifyLevels(map[string]NotifyLevel{"random": NotifyAll, "dev": NotifyDefault, "unknown": NotifyNone})
+
+	assert.Equal(t, map[string]NotifyLevel{"random": NotifyAll}, s.NotifyLevels(), "только каналы из списка")
+	assert.Equal(t, NotifyDefault, s.NotifyLevel("general"))
+
+	s.SetNotifyLevel("dev", NotifyNone)
+	s.SetNotifyLevel("random", NotifyDefault)
+	assert.Equal(t, map[string]NotifyLevel{"dev": NotifyNone}, s.NotifyLevels())
+
+	assert.True(t, s.Remove("dev"))
+	assert.Empty(t, s.NotifyLevels())
+}
+
+func TestTotalUnread(t *testing.T) {
+	s := New("general")
+	s.Restore([]string{"random", "dev"}, []string{"dev"})
+	s.SetUnread(map[string]int{"general": 3, "random": 2, "dev": 5, "unknown": 7})
+	s.Incoming("dev", true)
+
+	assert.Equal(t, 3, s.TotalUnread(), "текущий и чужие каналы не считаются, у выключенного — только упоминания")
+}
+
+func page(chat string, from, to int64) []Message {
+	var messages []Message
+	for id := from; id <= to; id++ {
+		messages = append(messages, message(chat, id, int(id)))
+	}
+	return messages
+}
+
+func TestPaging(t *testing.T) {
+	s := New("general")
+	_, generation := s.Current()
+
+	require.True(t, s.SetHistory(generation, page("general", 11, 20), 15, true))
+	_, ok := s.BeginLoad(generation, false)
+	assert.False(t, ok, "новее загруженных сообщений нет")
+
+	oldest, ok := s.BeginLoad(generation, true)
+	require.True(t, ok)
+	assert.Equal(t, int64(11), oldest.ID)
+	_, ok = s.BeginLoad(generation, true)
+	assert.False(t, ok, "страница уже догружается")
+
+	added, ok := s.Prepend(generation, page("general", 5, 11), false)
+	require.True(t, ok)
+	assert.Equal(t, 6, added, "повтор самого старого сообщения отбрасывается")
+	assert.Equal(t, 16, s.Len())
+	assert.False(t, s.HasOlder())
+	_, unreadStart, _ := s.Message(11)
+	assert.True(t, unreadStart, "разделитель непрочитанных сдвигается вместе с сообщениями")
+
+	_, ok = s.BeginLoad(generation, true)
+	assert.False(t, ok, "более ранних сообщений нет")
+
+	s.Switch("random")
+	_, ok = s.Prepend(generation, page("general", 1, 4), false)
+	assert.False(t, ok, "ответ для прежнего канала отбрасывается")
+}
+
+func TestTrim(t *testing.T) {
+	s := New("general")
+	_, generation := s.Current()
+	require.True(t, s.SetHistory(generation, page("general", 1, 10), 0, false))
+
+	top, bottom := s.Trim(6, 7, 9)
+	assert.Equal(t, 4, top, "вытесняются сообщения, далекие от видимых")
+	assert.Zero(t, bottom)
+	assert.True(t, s.HasOlder())
+	first, _, _ := s.Message(0)
+	assert.Equal(t, int64(5), first.ID)
+
+	top, bottom = s.Trim(3, 0, 1)
+	assert.Zero(t, top)
+	assert.Equal(t, 3, bottom)
+	assert.True(t, s.HasNewer())
+
+	require.True(t, s.Add(message("general", 11, 11)))
+	assert.Equal(t, 3, s.Len(), "пока конец истории вытеснен, живые сообщения не добавляются")
+
+	newest, ok := s.BeginLoad(generation, false)
+	require.True(t, ok)
+	assert.Equal(t, int64(7), newest.ID)
+	added, ok := s.AppendNewer(generation, page("general", 8, 9), true)
+	require.True(t, ok)
+	assert.Equal(t, 2, added)
+	assert.True(t, s.HasNewer(), "полная страница — на сервере есть еще")
+
+	_, ok = s.BeginLoad(generation, false)
+	require.True(t, ok)
+	added, ok = s.AppendNewer(generation, page("general", 10, 11), false)
+	require.True(t, ok)
+	assert.Equal(t, 2, added)
+	assert.False(t, s.HasNewer())
+	assert.Equal(t, 7, s.Len())
+
+	top, bottom = s.Trim(2, 0, 6)
+	assert.Zero(t, top+bottom, "видимые сообщения не вытесняются")
+}
+
+func TestSetPage(t *testing.T) {
+	s := New("general")
+	_, generation := s.Current()
+	require.True(t, s.SetHistory(generation, page("general", 91, 100), 95, true))
+
+	require.True(t, s.SetPage(generation, page("general", 40, 60), true, true))
+	assert.Equal(t, 21, s.Len())
+	assert.Equal(t, 10, s.Index(50))
+	assert.Equal(t, -1, s.Index(95))
+	_, unreadStart, _ := s.Message(0)
+	assert.False(t, unreadStart)
+
+	require.True(t, s.Add(message("general", 101, 101)))
+	assert.Equal(t, 21, s.Len(), "живые сообщения придут вместе с концом истории")
+
+	s.Switch("random")
+	assert.False(t, s.SetPage(generation, page("general", 1, 5), false, true))
+}
+
+func TestEdit(t *testing.T) {
+	s := New("general")
+	_, generation := s.Current()
+	require.True(t, s.SetHistory(generation, []Message{message("general", 1, 1), message("general", 2, 2)}, 0, false))
+	require.True(t, s.SetInfo("general", "", []Pin{{Message: message("general", 1, 1)}}))
+	live := message("general", 0, 3)
+	live.Username = "alice"
+	require.True(t, s.Add(live))
+
+	tests := []struct {
+		name  string
+		edit  bunnychat.EditEvent
+		want  bool
+		index int
+	}{
+		{
+			name:  "По ID",
+			edit:  bunnychat.EditEvent{ID: 1, Username: "bob", ChatName: "general", Body: "исправлено"},
+			want:  true,
+			index: 0,
+		},
+		{
+			name:  "Живое сообщение по автору и времени",
+			edit:  bunnychat.EditEvent{ID: 3, Username: "alice", ChatName: "general", Body: "исправлено", Timestamp: live.Timestamp},
+			want:  true,
+			index: 2,
+		},
+		{
+			name: "Нет среди загруженных",
+			edit: bunnychat.EditEvent{ID: 40, Username: "bob", ChatName: "general", Body: "исправлено"},
+		},
+		{
+			name: "Другой канал",
+			edit: bunnychat.EditEvent{ID: 2, Username: "bob", ChatName: "random", Body: "исправлено"},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			assert.Equal(t, tt.want, s.Edit(tt.edit))
+			if tt.want {
+				msg, _, _ := s.Message(tt.index)
+				assert.Equal(t, "исправлено", msg.Body)
+				assert.Equal(t, tt.edit.ID, msg.ID)
+			}
+		})
+	}
+
+	assert.Equal(t, "исправлено", s.Pins()[0].Message.Body, "закрепленное тоже изменено")
+	msg, _, _ := s.Message(1)
+	assert.Equal(t, "сообщение 2", msg.Body)
+}
+
+func TestLastFromAndDrafts(t *testing.T) {
+	s := New("general")
+	_, ok := s.LastFrom("bob")
+	assert.False(t, ok)
+
+	s.Add(message("general", 1, 1))
+	s.Add(message("general", 2, 2))
+	own := message("general", 3, 3)
+	own.Username = "alice"
+	s.Add(own)
+
+	last, ok := s.LastFrom("bob")
+	require.True(t, ok)
+	assert.Equal(t, int64(2), last.ID)
+
+	s.AddChannel("random")
+	s.SetDraft("general", "недописанное")
+	s.SetDraft("random", "тоже")
+	s.Switch("random")
+	assert.Equal(t, "недописанное", s.Draft("general"), "черновик переживает смену канала")
+
+	s.SetDraft("random", "")
+	assert.Empty(t, s.Draft("random"))
+	s.Remove("general")
+	assert.Empty(t, s.Draft("general"))
+}
@@ -1,15 +1,15 @@
 package main
 
 import (
-	"context"
-	"encoding/json"
 	"flag"
 	"fmt"
-	"io"
 	"log"
-	"net/http"
+	"net/url"
 	"os"
+	"sort"
 	"strings"
+	"sync"
+	"sync/atomic"
 	"time"
 
 	"fyne.io/fyne/v2"
@@ -17,29 +17,57 @@ import (
 	"fyne.io/fyne/v2/canvas"
 	"fyne.io/fyne/v2/container"
 	"fyne.io/fyne/v2/dialog"
+	"fyne.io/fyne/v2/driver/desktop"
 	"fyne.io/fyne/v2/theme"
 	"fyne.io/fyne/v2/widget"
-	amqp "github.com/rabbitmq/amqp091-go"
+
+	"team-bunny-chat/bunnychat"
+
+	"github.com/team-bunny-chat/gui/internal/state"
 )
 
 const (
+	appID           = "com.github.team-bunny-chat.gui"
 	appTitle        = "Team Bunny Chat"
 	defaultServer   = "localhost:8080"
 	defaultRabbitMQ = "localhost:5672"
 	defaultChat     = "general"
-	exchangeName    = "bunny.chats"
+
+	refreshInterval = 15 * time.Second
+	typingTimeout   = 5 * time.Second
+
+	mentionPollInterval = 5 * time.Second
 )
 
-type Message struct {
-	Username  string    `json:"username"`
-	Body      string    `json:"body"`
-	Timestamp time.Time `json:"timestamp"`
-	ChatName  string    `json:"chat_name,omitempty"`
-}
+type (
+	Message          = bunnychat.Message
+	HistoryResponse  = bunnychat.HistoryResponse
+	ChatInfo         = bunnychat.ChatInfo
+	ChatsResponse    = bunnychat.ChatsResponse
+	Pin              = bunnychat.Pin
+	PinsResponse     = bunnychat.PinsResponse
+	Mention          = bunnychat.Mention
+	MentionsResponse = bunnychat.MentionsResponse
+	TypingEvent      = bunnychat.TypingEvent
+	Member           = bunnychat.Member
+	MembersResponse  = bunnychat.MembersResponse
+	SearchQuery      = bunnychat.SearchQuery
+	SearchResult     = bunnychat.SearchResult
+	SearchResponse   = bunnychat.SearchResponse
+)
 
-type HistoryResponse struct {
-	Chat     string    `json:"chat"`
-	Messages []Message `json:"messages"`
+func typingText(usernames []string) string {
+	sort.Strings(usernames)
+	switch len(usernames) {
+	case 0:
+		return ""
+	case 1:
+		return fmt.Sprintf("%s печатает…", usernames[0])
+	case 2:
+		return fmt.Sprintf("%s и %s печатают…", usernames[0], usernames[1])
+	default:
+		return "Несколько человек печатают…"
+	}
 }
 
 type ChatApp struct {
@@ -47,109 +75,279 @@ type ChatApp struct {
 	window fyne.Window
 
 	messageList   *widget.List
-	messageInput  *widget.Entry
+	memberList    *widget.List
+	messageInput  *composerEntry
 	sendButton    *widget.Button
-	channelSelect *widget.Select
+	channelList   *widget.List
 	usernameLabel *widget.Label
 	statusLabel   *widget.Label
-
-	messages       []Message
-	username       string
-	currentChannel string
-	serverURL      string
-	rabbitMQURL    string
-
-	conn    *amqp.Connection
-	channel *amqp.Channel
-	queue   amqp.Queue
-}
-
-func getServerURL() string {
-	if server := os.Getenv("CHAT_SERVER"); server != "" {
-		return fmt.Sprintf("http://%s", server)
-	}
-	return fmt.Sprintf("http://%s", defaultServer)
-}
-
-func getRabbitMQURL() string {
-	if rabbitMQ := os.Getenv("CHAT_RABBITMQ"); rabbitMQ != "" {
-		return fmt.Sprintf("amqp://guest:guest@%s/", rabbitMQ)
-	}
-	return fmt.Sprintf("amqp://guest:guest@%s/", defaultRabbitMQ)
+	typingLabel   *widget.Label
+	topicLabel    *widget.Label
+	pinsButton    *widget.Button
+	jumpButton    *widget.Button
+	editBar       *fyne.Container
+	// chatView — содержимое окна с чатом; loginForm — форма входа, пока
+	// она показана вместо чата.
+	chatView  fyne.CanvasObject
+	loginForm *loginView
+
+	// state — данные текущего канала; его меняют и фоновые горутины, и
+	// интерфейс.
+	state *state.State
+	// updates — очередь изменений виджетов, см. do; quit останавливает ее.
+	updates chan func()
+	quit    chan struct{}
+	// pending — запросы к серверу, запущенные через background.
+	pending sync.WaitGroup
+	// selecting выставлен, пока выделение канала меняет программа, а не
+	// пользователь: такое выделение не должно переключать канал.
+	selecting atomic.Bool
+
+	// rows — какое сообщение показывает каждая строка списка, см.
+	// visibleMessages. following выставлен, пока список прокручен до
+	// конца: тогда новые сообщения прокручивают его дальше, а иначе
+	// считаются в unseen. lastVisible — последняя видимая строка при
+	// прошлой проверке прокрутки; scrollCheck — проверка уже в очереди.
+	rowsMu      sync.Mutex
+	rows        map[fyne.CanvasObject]widget.ListItemID
+	following   atomic.Bool
+	unseen      int
+	lastVisible int
+	scrollCheck atomic.Bool
+	// highlighted — ID сообщения, выделенного после перехода из поиска.
+	highlighted atomic.Int64
+
+	search *searchPanel
+	// editing — свое сообщение, открытое на изменение в поле ввода; nil —
+	// в поле новое сообщение.
+	editing atomic.Pointer[Message]
+
+	// mu защищает параметры подключения: их меняет диалог настроек, а
+	// читают фоновые запросы к серверу.
+	mu          sync.RWMutex
+	username    string
+	serverURL   string
+	rabbitMQURL string
+	// account — аккаунт, в который выполнен вход, nil — вход не выполнен;
+	// accounts — все сохраненные аккаунты. Оба защищены mu. authMu не дает
+	// обновлять токен нескольким запросам сразу, см. reauth.
+	account  *Account
+	accounts accountBook
+	authMu   sync.Mutex
+	// accountsPath — файл аккаунтов с токенами; пустой путь — аккаунты
+	// не сохраняются.
+	accountsPath string
+
+	// credentialsPath — файл с паролем RabbitMQ; пустой путь — пароль не
+	// сохраняется. theme — themeDark или themeLight.
+	credentialsPath string
+	theme           string
+	// setTheme применяет тему; по умолчанию — Settings().SetTheme.
+	setTheme func(fyne.Theme)
+
+	// client — текущее подключение к RabbitMQ, nil до первого удачного
+	// подключения; защищен mu, как и остальное состояние подключения.
+	client *bunnychat.Client
+	// stopConn останавливает подключение и опрос сервера, retry будит
+	// supervise до истечения паузы. Оба nil, пока подключения нет.
+	stopConn chan struct{}
+	retry    chan struct{}
+	// outbox — сообщения, набранные до первого подключения к RabbitMQ;
+	// дальше неотправленные сообщения копит сам клиент.
+	outbox []Message
+	link   linkStatus
+	// dial подключается к RabbitMQ; nil — bunnychat.DialAMQP.
+	dial func(url string) (bunnychat.Connection, error)
+
+	linkDot        *canvas.Circle
+	linkLabel      *widget.Label
+	linkErrorLabel *widget.Label
+
+	// lastMentionID — последнее известное упоминание, mentionsLoaded —
+	// первый опрос упоминаний выполнен. mentionEpoch растет при смене
+	// пользователя, чтобы отбросить ответ на запрос, начатый до нее. Все
+	// три защищены mu: опрос прежнего подключения может еще идти.
+	lastMentionID  int64
+	mentionsLoaded bool
+	mentionEpoch   uint64
+
+	// dnd — расписание «Не беспокоить»; nil — defaultQuietHours.
+	// foreground выставлен, пока окно приложения активно.
+	dnd        atomic.Pointer[quietHours]
+	foreground atomic.Bool
+	// tray — системный трей, nil, если платформа его не поддерживает.
+	tray       desktop.App
+	trayMenu   *fyne.Menu
+	trayUnread *fyne.MenuItem
+	trayDND    *fyne.MenuItem
 }
 
 func NewChatApp() *ChatApp {
-	a := app.New()
-	a.Settings().SetTheme(theme.DarkTheme())
-
-	w := a.NewWindow(appTitle)
-	w.Resize(fyne.NewSize(800, 600))
+	a := app.NewWithID(appID)
 
 	chatApp := &ChatApp{
-		app:            a,
-		window:         w,
-		messages:       make([]Message, 0),
-		username:       os.Getenv("USER"),
-		currentChannel: defaultChat,
-		serverURL:      getServerURL(),
-		rabbitMQURL:    getRabbitMQURL(),
+		app:    a,
+		window: a.NewWindow(appTitle),
+		state:  state.New(defaultChat),
 	}
 
+	credsPath, err := credentialsPath()
+	if err != nil {
+		log.Printf("%v", err)
+	}
+	chatApp.loadSettings(credsPath)
+	accountsFile, err := accountsPath()
+	if err != nil {
+		log.Printf("%v", err)
+	}
+	chatApp.restoreAccount(accountsFile)
+	chatApp.loadChannels()
 	chatApp.initUI()
+	chatApp.setupTray()
+	chatApp.restoreWindow()
 
 	return chatApp
 }
 
 func (c *ChatApp) initUI() {
+	// Очередь создается заранее: список вызывает UpdateItem, а тот
+	// ставит в очередь проверку прокрутки, уже при первой отрисовке.
+	c.updates = make(chan func(), 256)
+	c.quit = make(chan struct{})
+	c.rows = make(map[fyne.CanvasObject]widget.ListItemID)
+	c.following.Store(true)
+
 	c.messageList = widget.NewList(
 		func() int {
-			return len(c.messages)
+			return c.state.Len()
 		},
 		func() fyne.CanvasObject {
-			return container.NewVBox(
-				widget.NewLabelWithStyle("", fyne.TextAlignLeading, fyne.TextStyle{Bold: true}),
-				widget.NewLabel(""),
+			highlight := canvas.NewRectangle(theme.SelectionColor())
+			highlight.Hide()
+			return container.NewStack(highlight, container.NewVBox(
+				widget.NewLabelWithStyle("──── Непрочитанные ────", fyne.TextAlignCenter, fyne.TextStyle{Italic: true}),
+				container.NewBorder(nil, nil, nil,
+					container.NewHBox(
+						&widget.Button{Icon: theme.ContentCopyIcon(), Importance: widget.LowImportance},
+						&widget.Button{Text: "Закрепить", Importance: widget.LowImportance},
+					),
+					widget.NewLabelWithStyle("", fyne.TextAlignLeading, fyne.TextStyle{Bold: true}),
+				),
+				widget.NewRichText(),
 				canvas.NewLine(theme.ForegroundColor()),
-			)
+			))
 		},
 		func(id widget.ListItemID, obj fyne.CanvasObject) {
-			if id >= len(c.messages) {
+			message, unreadStart, ok := c.state.Message(id)
+			if !ok {
 				return
 			}
+			row := obj.(*fyne.Container)
+			highlight := row.Objects[0].(*canvas.Rectangle)
+			if message.ID != 0 && message.ID == c.highlighted.Load() {
+				highlight.FillColor = theme.SelectionColor()
+				highlight.Show()
+			} else {
+				highlight.Hide()
+			}
+			vbox := row.Objects[1].(*fyne.Container)
+
+			divider := vbox.Objects[0].(*widget.Label)
+			if unreadStart {
+				divider.Show()
+			} else {
+				divider.Hide()
+			}
 			
-			message := c.messages[id]
-			vbox := obj.(*fyne.Container)
-			
-			header := vbox.Objects[0].(*widget.Label)
+			headerRow := vbox.Objects[1].(*fyne.Container)
+			header := headerRow.Objects[0].(*widget.Label)
+			actions := headerRow.Objects[1].(*fyne.Container)
+			copyButton := actions.Objects[0].(*widget.Button)
+			copyButton.OnTapped = func() {
+				c.copyMessage(message)
+			}
+			pinButton := actions.Objects[1].(*widget.Button)
+			pinButton.OnTapped = func() {
+				c.pinMessage(message)
+			}
+			if message.ID == 0 {
+				pinButton.Disable()
+			} else {
+				pinButton.Enable()
+			}
+
 			header.SetText(fmt.Sprintf("[%s] %s", 
 				message.Timestamp.Format("15:04:05"),
 				message.Username))
 			
-			body := vbox.Objects[1].(*widget.Label)
-			body.SetText(message.Body)
+			body := vbox.Objects[2].(*widget.RichText)
+			body.Segments = messageSegments(message.Body, c.currentUsername(), c.openURL)
+			body.Refresh()
 			
-			line := vbox.Objects[2].(*canvas.Line)
+			line := vbox.Objects[3].(*canvas.Line)
 			line.StrokeColor = theme.DisabledColor()
 			line.StrokeWidth = 1
+
+			// Строки разной высоты: в сообщении может быть несколько абзацев
+			// или блок кода.
+			c.messageList.SetItemHeight(id, row.MinSize().Height)
+			c.trackRow(obj, id)
 		},
 	)
 
-	c.messageInput = widget.NewMultiLineEntry()
-	c.messageInput.SetPlaceHolder("Введите сообщение...")
-	c.messageInput.OnSubmitted = func(text string) {
-		c.sendMessage(text)
+	c.memberList = widget.NewList(
+		func() int {
+			return c.state.MembersLen()
+		},
+		func() fyne.CanvasObject {
+			return widget.NewLabel("")
+		},
+		func(id widget.ListItemID, obj fyne.CanvasObject) {
+			member, ok := c.state.Member(id)
+			if !ok {
+				return
+			}
+			label := obj.(*widget.Label)
+			if member.Online {
+				label.SetText("● " + member.Username)
+			} else {
+				label.SetText("○ " + member.Username)
+			}
+		},
+	)
+	c.memberList.OnSelected = func(id widget.ListItemID) {
+		c.memberList.Unselect(id)
+		if member, ok := c.state.Member(id); ok {
+			c.openDirectChat(member.Username)
+		}
+	}
+
+	c.messageInput = newComposerEntry()
+	c.messageInput.SetPlaceHolder("Введите сообщение... (Enter — отправить, Shift+Enter — новая строка, /help — команды)")
+	c.messageInput.onSend = c.submit
+	c.messageInput.onEditLast = c.editLast
+	c.messageInput.onCancel = c.cancelEdit
+	c.messageInput.onPaste = c.pasteImage
+	c.messageInput.OnChanged = func(text string) {
+		if c.saveDraft(text) && text != "" {
+			c.sendTyping()
+		}
 	}
 
 	c.sendButton = widget.NewButtonWithIcon("Отправить", theme.MailSendIcon(), func() {
-		c.sendMessage(c.messageInput.Text)
+		c.submit(c.messageInput.Text)
 	})
-
-	c.channelSelect = widget.NewSelect([]string{defaultChat}, func(selected string) {
-		if selected != c.currentChannel {
-			c.switchChannel(selected)
-		}
+	attachButton := widget.NewButtonWithIcon("", theme.FileImageIcon(), func() {
+		c.showAttachDialog()
 	})
-	c.channelSelect.SetSelected(defaultChat)
+	c.editBar = container.NewBorder(nil, nil, nil,
+		widget.NewButtonWithIcon("", theme.CancelIcon(), func() { c.cancelEdit() }),
+		widget.NewLabelWithStyle("Изменение сообщения: Enter — сохранить, Esc — отменить",
+			fyne.TextAlignLeading, fyne.TextStyle{Italic: true}),
+	)
+	c.editBar.Hide()
+
+	c.channelList = c.newChannelList()
 
 	c.usernameLabel = widget.NewLabelWithStyle(
 		fmt.Sprintf("Пользователь: %s", c.username),
@@ -159,337 +357,578 @@ func (c *ChatApp) initUI() {
 
 	c.statusLabel = widget.NewLabel("Статус: Отключен")
 
+	c.typingLabel = widget.NewLabelWithStyle("", fyne.TextAlignLeading, fyne.TextStyle{Italic: true})
+
+	c.topicLabel = widget.NewLabel("Тема не задана")
+	c.topicLabel.Wrapping = fyne.TextTruncate
+	editTopicButton := widget.NewButtonWithIcon("", theme.DocumentCreateIcon(), func() {
+		c.showTopicDialog()
+	})
+	c.pinsButton = widget.NewButton("Закреплено: 0", func() {
+		c.showPinsDialog()
+	})
+
 	addChannelButton := widget.NewButtonWithIcon("", theme.ContentAddIcon(), func() {
-		entry := widget.NewEntry()
-		entry.SetPlaceHolder("Введите название канала")
-		
-		dialog.ShowCustomConfirm("Новый канал", "Добавить", "Отмена", entry, func(ok bool) {
-			if ok && entry.Text != "" {
-				channelName := strings.TrimSpace(entry.Text)
-				options := append(c.channelSelect.Options, channelName)
-				c.channelSelect.SetOptions(options)
-				c.channelSelect.SetSelected(channelName)
-			}
-		}, c.window)
+		c.showAddChannelDialog()
 	})
 
 	settingsButton := widget.NewButtonWithIcon("", theme.SettingsIcon(), func() {
 		c.showSettingsDialog()
 	})
 
+	var accountButton *widget.Button
+	accountButton = widget.NewButtonWithIcon("", theme.AccountIcon(), func() {
+		c.showAccountMenu(accountButton)
+	})
+
+	searchButton := widget.NewButtonWithIcon("", theme.SearchIcon(), func() {
+		c.showSearch()
+	})
+	c.window.Canvas().AddShortcut(&desktop.CustomShortcut{KeyName: fyne.KeyF, Modifier: fyne.KeyModifierShortcutDefault},
+		func(fyne.Shortcut) { c.showSearch() })
+
 	topBar := container.NewBorder(
-		nil, nil, 
-		container.NewHBox(
-			widget.NewLabel("Канал:"),
-			c.channelSelect,
-			addChannelButton,
-		),
+		nil, nil, nil,
 		container.NewHBox(
 			c.usernameLabel,
+			accountButton,
+			searchButton,
 			settingsButton,
 		),
 	)
 
 	bottomBar := container.NewBorder(
-		nil, nil, nil, 
+		c.editBar, nil, nil,
 		container.NewHBox(
+			attachButton,
 			c.sendButton,
 		),
 		c.messageInput,
 	)
 
+	membersPanel := container.NewBorder(
+		widget.NewLabelWithStyle("Участники", fyne.TextAlignLeading, fyne.TextStyle{Bold: true}),
+		nil, nil, nil,
+		c.memberList,
+	)
+
+	topicBar := container.NewBorder(
+		nil, nil, nil,
+		container.NewHBox(editTopicButton, c.pinsButton),
+		c.topicLabel,
+	)
+
+	c.jumpButton = widget.NewButtonWithIcon("К последним", theme.MoveDownIcon(), func() {
+		c.do(c.jumpToLatest)
+	})
+	c.jumpButton.Hide()
+
+	messagesPanel := container.NewBorder(
+		topicBar,
+		container.NewBorder(nil, nil, nil, c.jumpButton, c.typingLabel),
+		nil, nil,
+		container.NewPadded(c.messageList),
+	)
+
+	channelsPanel := container.NewBorder(
+		container.NewBorder(nil, nil, nil, addChannelButton,
+			widget.NewLabelWithStyle("Каналы", fyne.TextAlignLeading, fyne.TextStyle{Bold: true}),
+		),
+		nil, nil, nil,
+		c.channelList,
+	)
+
+	chatSplit := container.NewHSplit(messagesPanel, membersPanel)
+	chatSplit.Offset = 0.78
+
+	split := container.NewHSplit(channelsPanel, chatSplit)
+	split.Offset = 0.2
+
 	content := container.NewBorder(
 		topBar,
 		container.NewBorder(
 			nil, bottomBar, nil, nil,
 			container.NewVBox(
+				c.newLinkIndicator(),
 				c.statusLabel,
 			),
 		),
 		nil, nil,
-		container.NewPadded(c.messageList),
+		split,
 	)
 
+	c.chatView = content
 	c.window.SetContent(content)
+	c.showAccount()
+	c.window.SetOnDropped(c.uploadDropped)
+	c.app.Lifecycle().SetOnEnteredForeground(func() { c.foreground.Store(true) })
+	c.app.Lifecycle().SetOnExitedForeground(func() { c.foreground.Store(false) })
+	c.refreshChannelList()
+	c.showLink()
+
+	go c.runUpdates()
 }
 
-func (c *ChatApp) showSettingsDialog() {
-	usernameEntry := widget.NewEntry()
-	usernameEntry.SetText(c.username)
-	
-	serverEntry := widget.NewEntry()
-	serverEntry.SetText(strings.TrimPrefix(c.serverURL, "http://"))
-	
-	rabbitMQEntry := widget.NewEntry()
-	rabbitMQEntry.SetText(strings.Split(strings.TrimPrefix(c.rabbitMQURL, "amqp://guest:guest@"), "/")[0])
-	
-	form := widget.NewForm(
-		widget.NewFormItem("Имя пользователя", usernameEntry),
-		widget.NewFormItem("Сервер истории", serverEntry),
-		widget.NewFormItem("Сервер RabbitMQ", rabbitMQEntry),
-	)
-	
-	dialog.ShowCustomConfirm("Настройки", "Сохранить", "Отмена", form, func(ok bool) {
-		if ok {
-			newUsername := usernameEntry.Text
-			newServer := serverEntry.Text
-			newRabbitMQ := rabbitMQEntry.Text
-			
-			reconnectNeeded := false
-			
-			if newUsername != c.username {
-				c.username = newUsername
-				c.usernameLabel.SetText(fmt.Sprintf("Пользователь: %s", c.username))
-			}
-			
-			if newServer != strings.TrimPrefix(c.serverURL, "http://") {
-				c.serverURL = fmt.Sprintf("http://%s", newServer)
-				reconnectNeeded = true
-			}
-			
-			if newRabbitMQ != strings.Split(strings.TrimPrefix(c.rabbitMQURL, "amqp://guest:guest@"), "/")[0] {
-				c.rabbitMQURL = fmt.Sprintf("amqp://guest:guest@%s/", newRabbitMQ)
-				reconnectNeeded = true
-			}
-			
-			if reconnectNeeded && c.conn != nil {
-				c.disconnect()
-				c.connect()
-			}
+// do ставит изменение виджетов в очередь. В Fyne 2.4 нет способа выполнить
+// код в главном потоке, поэтому списки и подписи, которые обновляются из
+// фоновых горутин (RabbitMQ, запросы к серверу, таймеры), меняет только
+// одна горутина, применяя изменения по порядку. Обработчики событий
+// интерфейса тоже обновляют эти виджеты через очередь.
+func (c *ChatApp) do(f func()) {
+	select {
+	case c.updates <- f:
+	case <-c.quit:
+	}
+}
+
+func (c *ChatApp) runUpdates() {
+	for {
+		select {
+		case f := <-c.updates:
+			f()
+		case <-c.quit:
+			return
 		}
-	}, c.window)
+	}
+}
+
+// background выполняет запрос к серверу в отдельной горутине.
+func (c *ChatApp) background(f func()) {
+	c.pending.Add(1)
+	go func() {
+		defer c.pending.Done()
+		f()
+	}()
+}
+
+// flush ждет завершения запросов, запущенных через background, и
+// применения всех поставленных в очередь изменений. Очередь сначала
+// разбирается, потому что изменения из нее тоже запускают запросы.
+func (c *ChatApp) flush() {
+	c.drain()
+	c.pending.Wait()
+	c.drain()
+}
+
+func (c *ChatApp) drain() {
+	done := make(chan struct{})
+	c.do(func() { close(done) })
+	select {
+	case <-done:
+	case <-c.quit:
+	}
+}
+
+// stop дожидается фоновой работы и останавливает очередь изменений.
+func (c *ChatApp) stop() {
+	c.flush()
+	close(c.quit)
 }
 
 func (c *ChatApp) Run() {
-	c.connect()
-	c.fetchHistory()
+	if c.currentAccount() == nil {
+		c.showLogin("", "", "")
+	} else {
+		c.connect()
+		c.fetchHistory()
+	}
 	c.window.ShowAndRun()
 	c.disconnect()
+	c.stop()
 }
 
-func (c *ChatApp) connect() {
-	var err error
-	
-	c.conn, err = amqp.Dial(c.rabbitMQURL)
-	if err != nil {
-		c.setStatus(fmt.Sprintf("Ошибка подключения к RabbitMQ: %v", err))
+// refresh периодически подтягивает с сервера то, что не приходит через
+// RabbitMQ: участников, непрочитанные, тему и упоминания.
+func (c *ChatApp) refresh(stop chan struct{}) {
+	ticker := time.NewTicker(refreshInterval)
+	defer ticker.Stop()
+
+	mentionTicker := time.NewTicker(mentionPollInterval)
+	defer mentionTicker.Stop()
+
+	c.fetchMembers()
+	c.fetchMentions()
+	for {
+		select {
+		case <-mentionTicker.C:
+			c.fetchMentions()
+		case <-ticker.C:
+			c.fetchMembers()
+			c.fetchUnread()
+			c.fetchChatInfo()
+		case <-stop:
+			return
+		}
+	}
+}
+
+func (c *ChatApp) api() *bunnychat.API {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+	api := bunnychat.NewAPI(c.serverURL, c.username)
+	if c.account != nil {
+		api.Token = c.account.AccessToken
+		api.Reauth = c.reauth
+	}
+	return api
+}
+
+func (c *ChatApp) sendTyping() {
+	client := c.currentClient()
+	if client == nil || !client.Connected() {
+		return
+	}
+	if err := client.SendTyping(c.state.Channel()); err != nil {
+		log.Printf("%v", err)
+	}
+}
+
+func (c *ChatApp) handleTyping(event TypingEvent) {
+	if !c.state.Typing(event.ChatName, event.Username, time.Now().Add(typingTimeout)) {
 		return
 	}
-	
-	c.channel, err = c.conn.Channel()
+	c.do(c.updateTypingLabel)
+
+	time.AfterFunc(typingTimeout, func() { c.do(c.updateTypingLabel) })
+}
+
+func (c *ChatApp) updateTypingLabel() {
+	c.typingLabel.SetText(typingText(c.state.Typers(time.Now())))
+}
+
+func (c *ChatApp) fetchMembers() {
+	channelName := c.state.Channel()
+	members, err := c.api().Members(channelName, false)
+	c.reportServer(err)
 	if err != nil {
-		c.setStatus(fmt.Sprintf("Ошибка создания канала: %v", err))
+		log.Printf("Ошибка при получении участников: %v", err)
 		return
 	}
-	
-	err = c.channel.ExchangeDeclare(
-		exchangeName,
-		"topic",
-		true,
-		false,
-		false,
-		false,
-		nil,
-	)
+
+	if c.state.SetMembers(channelName, members.Members) {
+		c.do(c.memberList.Refresh)
+	}
+}
+
+// fetchMentions опрашивает сервер о новых упоминаниях во всех чатах.
+// Первый запрос только запоминает последнее упоминание, чтобы при запуске
+// не показывать уведомления о старых.
+func (c *ChatApp) fetchMentions() {
+	c.mu.RLock()
+	after, epoch := c.lastMentionID, c.mentionEpoch
+	c.mu.RUnlock()
+
+	mentions, err := c.api().Mentions(after)
+	c.reportServer(err)
 	if err != nil {
-		c.setStatus(fmt.Sprintf("Ошибка объявления exchange: %v", err))
+		log.Printf("Ошибка при получении упоминаний: %v", err)
 		return
 	}
-	
-	c.queue, err = c.channel.QueueDeclare(
-		"",
-		false,
-		true,
-		true,
-		false,
-		nil,
-	)
+
+	// Новые упоминания отбираются под mu: одновременный опрос прежнего
+	// подключения не должен ни сдвинуть отметку назад, ни уведомить дважды.
+	var fresh []Mention
+	c.mu.Lock()
+	if epoch != c.mentionEpoch {
+		c.mu.Unlock()
+		return
+	}
+	loaded := c.mentionsLoaded
+	for i := len(mentions.Mentions) - 1; i >= 0; i-- {
+		mention := mentions.Mentions[i]
+		if mention.ID <= c.lastMentionID {
+			continue
+		}
+		c.lastMentionID = mention.ID
+		fresh = append(fresh, mention)
+	}
+	c.mentionsLoaded = true
+	c.mu.Unlock()
+
+	if !loaded {
+		return
+	}
+	for _, mention := range fresh {
+		if c.notifyMention(mention) {
+			c.notify(fmt.Sprintf("%s упомянул(а) вас в #%s", mention.Author, mention.Chat), mention.Body)
+		}
+	}
+}
+
+func (c *ChatApp) fetchUnread() {
+	chats, err := c.api().Chats()
+	c.reportServer(err)
 	if err != nil {
-		c.setStatus(fmt.Sprintf("Ошибка создания очереди: %v", err))
+		log.Printf("Ошибка при получении списка чатов: %v", err)
 		return
 	}
-	
-	err = c.channel.QueueBind(
-		c.queue.Name,
-		c.currentChannel,
-		exchangeName,
-		false,
-		nil,
-	)
+
+	c.openDirectChats(chats.Chats)
+	unread := make(map[string]int, len(chats.Chats))
+	for _, chat := range chats.Chats {
+		unread[chat.Name] = chat.Unread
+	}
+	c.state.SetUnread(unread)
+	c.do(c.showUnread)
+}
+
+func (c *ChatApp) markRead(channelName string, messageID int64) {
+	if err := c.api().MarkRead(channelName, messageID); err != nil {
+		log.Printf("Ошибка при отметке прочтения: %v", err)
+	}
+}
+
+func (c *ChatApp) fetchChatInfo() {
+	channelName := c.state.Channel()
+
+	api := c.api()
+
+	info, err := api.Chat(channelName)
 	if err != nil {
-		c.setStatus(fmt.Sprintf("Ошибка привязки очереди: %v", err))
+		log.Printf("Ошибка при получении информации о канале: %v", err)
 		return
 	}
-	
-	msgs, err := c.channel.Consume(
-		c.queue.Name,
-		"",
-		true,
-		false,
-		false,
-		false,
-		nil,
-	)
+
+	pins, err := api.Pins(channelName)
 	if err != nil {
-		c.setStatus(fmt.Sprintf("Ошибка подписки на сообщения: %v", err))
+		log.Printf("Ошибка при получении закрепленных сообщений: %v", err)
 		return
 	}
-	
-	go func() {
-		for msg := range msgs {
-			var message Message
-			if err := json.Unmarshal(msg.Body, &message); err != nil {
-				log.Printf("Ошибка разбора сообщения: %v", err)
-				continue
-			}
-			
-			c.window.Canvas().Refresh(c.messageList)
-			c.addMessage(message)
+
+	if c.state.SetInfo(channelName, info.Topic, pins.Pins) {
+		c.do(c.showChatInfo)
+	}
+}
+
+func (c *ChatApp) showChatInfo() {
+	if topic := c.state.Topic(); topic == "" {
+		c.topicLabel.SetText("Тема не задана")
+	} else {
+		c.topicLabel.SetText("Тема: " + topic)
+	}
+	c.pinsButton.SetText(fmt.Sprintf("Закреплено: %d", len(c.state.Pins())))
+}
+
+func (c *ChatApp) showTopicDialog() {
+	entry := widget.NewEntry()
+	entry.SetText(c.state.Topic())
+	entry.SetPlaceHolder("Тема канала")
+
+	dialog.ShowCustomConfirm("Тема канала", "Сохранить", "Отмена", entry, func(ok bool) {
+		if !ok {
+			return
 		}
-	}()
-	
-	c.setStatus("Подключено")
+
+		if err := c.api().SetTopic(c.state.Channel(), strings.TrimSpace(entry.Text)); err != nil {
+			c.setStatus(fmt.Sprintf("Ошибка при смене темы: %v", err))
+			return
+		}
+		c.background(c.fetchChatInfo)
+	}, c.window)
+}
+
+func (c *ChatApp) showPinsDialog() {
+	pins := c.state.Pins()
+	if len(pins) == 0 {
+		dialog.ShowInformation("Закрепленные сообщения", "В этом канале нет закрепленных сообщений", c.window)
+		return
+	}
+
+	var d dialog.Dialog
+	items := container.NewVBox()
+	for _, pin := range pins {
+		pin := pin
+		text := widget.NewLabel(fmt.Sprintf("[%s] %s: %s",
+			pin.Message.Timestamp.Format("02.01 15:04"),
+			pin.Message.Username,
+			pin.Message.Body))
+		text.Wrapping = fyne.TextWrapWord
+		unpin := widget.NewButtonWithIcon("", theme.DeleteIcon(), func() {
+			c.unpinMessage(pin.Message.ID)
+			d.Hide()
+		})
+		items.Add(container.NewBorder(nil, nil, nil, unpin, text))
+	}
+
+	scroll := container.NewVScroll(items)
+	scroll.SetMinSize(fyne.NewSize(500, 300))
+	d = dialog.NewCustom("Закрепленные сообщения", "Закрыть", scroll, c.window)
+	d.Show()
+}
+
+func (c *ChatApp) copyMessage(msg Message) {
+	c.window.Clipboard().SetContent(msg.Body)
+	c.setStatus("Сообщение скопировано")
 }
 
-func (c *ChatApp) disconnect() {
-	if c.channel != nil {
-		c.channel.Close()
+func (c *ChatApp) openURL(u *url.URL) {
+	if err := c.app.OpenURL(u); err != nil {
+		c.setStatus(fmt.Sprintf("Не удалось открыть ссылку: %v", err))
 	}
-	
-	if c.conn != nil {
-		c.conn.Close()
+}
+
+func (c *ChatApp) currentUsername() string {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+	return c.username
+}
+
+func (c *ChatApp) pinMessage(msg Message) {
+	if msg.ID == 0 {
+		return
+	}
+
+	if err := c.api().Pin(msg.ChatName, msg.ID); err != nil {
+		c.setStatus(fmt.Sprintf("Ошибка при закреплении сообщения: %v", err))
+		return
+	}
+	c.setStatus("Сообщение закреплено")
+	c.background(c.fetchChatInfo)
+}
+
+func (c *ChatApp) unpinMessage(messageID int64) {
+	if err := c.api().Unpin(c.state.Channel(), messageID); err != nil {
+		c.setStatus(fmt.Sprintf("Ошибка при откреплении сообщения: %v", err))
+		return
 	}
-	
-	c.setStatus("Отключено")
+	c.background(c.fetchChatInfo)
 }
 
+// fetchHistory загружает историю текущего канала. Если канал успели
+// сменить, пока шел запрос, ответ отбрасывается.
 func (c *ChatApp) fetchHistory() {
-	go func() {
+	channelName, generation := c.state.Current()
+	c.background(func() {
 		c.setStatus("Получение истории сообщений...")
-		
-		url := fmt.Sprintf("%s/v1/chats/history?chat=%s", c.serverURL, c.currentChannel)
-		
-		resp, err := http.Get(url)
+
+		history, err := c.api().History(channelName, historyPage)
+		c.reportServer(err)
 		if err != nil {
 			c.setStatus(fmt.Sprintf("Ошибка при получении истории: %v", err))
 			return
 		}
-		defer resp.Body.Close()
-		
-		body, err := io.ReadAll(resp.Body)
-		if err != nil {
-			c.setStatus(fmt.Sprintf("Ошибка при чтении ответа: %v", err))
-			return
-		}
-		
-		var history HistoryResponse
-		if err := json.Unmarshal(body, &history); err != nil {
-			c.setStatus(fmt.Sprintf("Ошибка при разборе истории: %v", err))
+		if !c.state.SetHistory(generation, history.Messages, history.LastReadID, len(history.Messages) == historyPage) {
 			return
 		}
-		
-		c.messages = make([]Message, 0, len(history.Messages))
-		
-		for _, msg := range history.Messages {
-			c.addMessage(msg)
+		c.highlighted.Store(0)
+
+		if n := len(history.Messages); n > 0 {
+			c.markRead(channelName, history.Messages[n-1].ID)
 		}
-		
+		c.fetchChatInfo()
+
+		c.do(func() {
+			c.followLatest()
+			c.messageList.Refresh()
+			c.messageList.ScrollToBottom()
+		})
 		c.setStatus(fmt.Sprintf("Получено %d сообщений из истории", len(history.Messages)))
-		c.window.Canvas().Refresh(c.messageList)
-	}()
+	})
 }
 
 func (c *ChatApp) switchChannel(channelName string) {
-	if c.channel != nil {
-		err := c.channel.QueueUnbind(
-			c.queue.Name,
-			c.currentChannel,
-			exchangeName,
-			nil,
-		)
-		if err != nil {
-			c.setStatus(fmt.Sprintf("Ошибка отвязки очереди: %v", err))
-			return
-		}
-		
-		err = c.channel.QueueBind(
-			c.queue.Name,
-			channelName,
-			exchangeName,
-			false,
-			nil,
-		)
-		if err != nil {
-			c.setStatus(fmt.Sprintf("Ошибка привязки очереди: %v", err))
-			return
-		}
+	if !c.enterChannel(channelName) {
+		return
 	}
-	
-	c.currentChannel = channelName
-	
-	c.messages = make([]Message, 0)
-	c.messageList.Refresh()
-	
 	c.fetchHistory()
-	
+
 	c.setStatus(fmt.Sprintf("Переключено на канал: %s", channelName))
 }
 
+// enterChannel делает канал текущим, не загружая историю: ее загружает
+// вызывающий — последнюю страницу или страницу вокруг нужного сообщения.
+func (c *ChatApp) enterChannel(channelName string) bool {
+	previous := c.state.Channel()
+	if client := c.currentClient(); client != nil {
+		if err := client.Join(channelName); err != nil {
+			c.setStatus(err.Error())
+			return false
+		}
+	}
+
+	c.background(func() { c.markRead(previous, 0) })
+
+	c.highlighted.Store(0)
+	c.editing.Store(nil)
+	c.state.Switch(channelName)
+	c.app.Preferences().SetString(prefLastChannel, channelName)
+	c.do(func() {
+		c.editBar.Hide()
+		c.messageInput.SetText(c.state.Draft(channelName))
+		c.followLatest()
+		c.updateTypingLabel()
+		c.messageList.Refresh()
+		c.memberList.Refresh()
+		c.showChatInfo()
+		c.refreshChannelList()
+	})
+
+	c.background(c.fetchMembers)
+	return true
+}
+
 func (c *ChatApp) sendMessage(text string) {
 	if text == "" {
 		return
 	}
-	
-	c.messageInput.SetText("")
-	
-	if c.channel == nil {
-		c.setStatus("Нет подключения к серверу")
-		return
-	}
-	
-	msg := Message{
-		Username:  c.username,
-		Body:      text,
-		Timestamp: time.Now(),
-		ChatName:  c.currentChannel,
-	}
-	
-	body, err := json.Marshal(msg)
-	if err != nil {
-		c.setStatus(fmt.Sprintf("Ошибка сериализации сообщения: %v", err))
-		return
+
+	c.setInput("")
+	c.send(Message{ChatName: c.state.Channel(), Body: text})
+}
+
+// send отправляет сообщение через RabbitMQ, а без подключения откладывает
+// его.
+func (c *ChatApp) send(msg Message) {
+	c.mu.Lock()
+	client := c.client
+	if client == nil {
+		c.outbox = append(c.outbox, msg)
 	}
-	
-	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
-	defer cancel()
-	
-	err = c.channel.PublishWithContext(ctx,
-		exchangeName,
-		c.currentChannel,
-		false,
-		false,
-		amqp.Publishing{
-			ContentType: "application/json",
-			Body:        body,
-		})
-	
-	if err != nil {
-		c.setStatus(fmt.Sprintf("Ошибка отправки сообщения: %v", err))
+	c.mu.Unlock()
+
+	switch {
+	case client == nil:
+		c.setStatus("Нет подключения: сообщение будет отправлено после подключения")
+	case !client.Connected():
+		if err := client.Send(msg.ChatName, msg.Body); err != nil {
+			c.setStatus(err.Error())
+		} else {
+			c.setStatus("Нет подключения: сообщение будет отправлено после переподключения")
+		}
+	default:
+		if err := client.Send(msg.ChatName, msg.Body); err != nil {
+			c.setStatus(err.Error())
+		}
 		return
 	}
+	c.do(c.showLink)
 }
 
+// addMessage показывает сообщение, если оно из текущего канала, а иначе
+// учитывает его в счетчиках боковой панели. Если список прокручен вверх,
+// он остается на месте, а сообщение учитывается на кнопке «К последним».
 func (c *ChatApp) addMessage(msg Message) {
-	c.messages = append(c.messages, msg)
-	c.window.Canvas().Refresh(c.messageList)
-	c.messageList.Refresh()
-	c.messageList.ScrollToBottom()
+	if !c.state.Add(msg) {
+		c.countIncoming(msg)
+		return
+	}
+
+	c.do(func() {
+		c.updateTypingLabel()
+		c.messageList.Refresh()
+		if !c.following.Load() {
+			c.noteUnseen()
+			return
+		}
+		c.messageList.ScrollToBottom()
+		c.trimMessages()
+	})
 }
 
+// setStatus можно вызывать из любой горутины.
 func (c *ChatApp) setStatus(status string) {
 	statusText := fmt.Sprintf("Статус: %s", status)
-	c.statusLabel.SetText(statusText)
-	c.window.Canvas().Refresh(c.statusLabel)
+	c.do(func() { c.statusLabel.SetText(statusText) })
 }
 
 func main() {
@@ -5,11 +5,17 @@ import (
 	"fmt"
 	"net/http"
 	"net/http/httptest"
+	"net/url"
 	"testing"
 	"time"
 
+	"fyne.io/fyne/v2"
 	"fyne.io/fyne/v2/test"
+	"fyne.io/fyne/v2/theme"
+	"fyne.io/fyne/v2/widget"
 	"github.com/stretchr/testify/assert"
+
+	"github.com/team-bunny-chat/gui/internal/state"
 )
 
 func TestMessage(t *testing.T) {
@@ -50,11 +56,12 @@ func TestNewChatApp(t *testing.T) {
 	}
 	
 	chatApp := NewChatApp()
+	defer chatApp.stop()
 	
 	assert.NotNil(t, chatApp)
 	assert.NotNil(t, chatApp.app)
 	assert.NotNil(t, chatApp.window)
-	assert.Equal(t, defaultChat, chatApp.currentChannel)
+	assert.Equal(t, defaultChat, chatApp.state.Channel())
 	assert.Equal(t, fmt.Sprintf("http://%s", defaultServer), chatApp.serverURL)
 	assert.Equal(t, fmt.Sprintf("amqp://guest:guest@%s/", defaultRabbitMQ), chatApp.rabbitMQURL)
 }
@@ -68,28 +75,27 @@ func TestInitUI(t *testing.T) {
 	w := app.NewWindow(appTitle)
 	
 	chatApp := &ChatApp{
-		app:            app,
-		window:         w,
-		messages:       make([]Message, 0),
-		username:       "testuser",
-		currentChannel: defaultChat,
-		serverURL:      fmt.Sprintf("http://%s", defaultServer),
-		rabbitMQURL:    fmt.Sprintf("amqp://guest:guest@%s/", defaultRabbitMQ),
+		app:         app,
+		window:      w,
+		state:       state.New(defaultChat),
+		username:    "testuser",
+		serverURL:   fmt.Sprintf("http://%s", defaultServer),
+		rabbitMQURL: fmt.Sprintf("amqp://guest:guest@%s/", defaultRabbitMQ),
 	}
 	
 	chatApp.initUI()
+	defer chatApp.stop()
 	
 	assert.NotNil(t, chatApp.messageList)
 	assert.NotNil(t, chatApp.messageInput)
 	assert.NotNil(t, chatApp.sendButton)
-	assert.NotNil(t, chatApp.channelSelect)
+	assert.NotNil(t, chatApp.channelList)
 	assert.NotNil(t, chatApp.usernameLabel)
 	assert.NotNil(t, chatApp.statusLabel)
 	
 	assert.Equal(t, "Пользователь: testuser", chatApp.usernameLabel.Text)
 	
-	assert.Equal(t, []string{defaultChat}, chatApp.channelSelect.Options)
-	assert.Equal(t, defaultChat, chatApp.channelSelect.Selected)
+	assert.Equal(t, 1, chatApp.channelList.Length())
 }
 
 func TestAddMessage(t *testing.T) {
@@ -101,16 +107,16 @@ func TestAddMessage(t *testing.T) {
 	w := app.NewWindow(appTitle)
 	
 	chatApp := &ChatApp{
-		app:            app,
-		window:         w,
-		messages:       make([]Message, 0),
-		username:       "testuser",
-		currentChannel: defaultChat,
-		serverURL:      fmt.Sprintf("http://%s", defaultServer),
-		rabbitMQURL:    fmt.Sprintf("amqp://guest:guest@%s/", defaultRabbitMQ),
+		app:         app,
+		window:      w,
+		state:       state.New(defaultChat),
+		username:    "testuser",
+		serverURL:   fmt.Sprintf("http://%s", defaultServer),
+		rabbitMQURL: fmt.Sprintf("amqp://guest:guest@%s/", defaultRabbitMQ),
 	}
 	
 	chatApp.initUI()
+	defer chatApp.stop()
 	
 	msg := Message{
 		Username:  "testuser",
@@ -120,13 +126,14 @@ func TestAddMessage(t *testing.T) {
 	}
 	
 	chatApp.addMessage(msg)
-	
-	time.Sleep(100 * time.Millisecond)
-	
-	assert.Equal(t, 1, len(chatApp.messages))
-	assert.Equal(t, msg.Username, chatApp.messages[0].Username)
-	assert.Equal(t, msg.Body, chatApp.messages[0].Body)
-	assert.Equal(t, msg.ChatName, chatApp.messages[0].ChatName)
+	chatApp.addMessage(Message{Username: "bob", Body: "чужой канал", ChatName: "random"})
+	chatApp.flush()
+	
+	messages := chatApp.state.Messages()
+	assert.Equal(t, 1, len(messages))
+	assert.Equal(t, msg.Username, messages[0].Username)
+	assert.Equal(t, msg.Body, messages[0].Body)
+	assert.Equal(t, msg.ChatName, messages[0].ChatName)
 }
 
 func TestSetStatus(t *testing.T) {
@@ -138,20 +145,19 @@ func TestSetStatus(t *testing.T) {
 	w := app.NewWindow(appTitle)
 	
 	chatApp := &ChatApp{
-		app:            app,
-		window:         w,
-		messages:       make([]Message, 0),
-		username:       "testuser",
-		currentChannel: defaultChat,
-		serverURL:      fmt.Sprintf("http://%s", defaultServer),
-		rabbitMQURL:    fmt.Sprintf("amqp://guest:guest@%s/", defaultRabbitMQ),
+		app:         app,
+		window:      w,
+		state:       state.New(defaultChat),
+		username:    "testuser",
+		serverURL:   fmt.Sprintf("http://%s", defaultServer),
+		rabbitMQURL: fmt.Sprintf("amqp://guest:guest@%s/", defaultRabbitMQ),
 	}
 	
 	chatApp.initUI()
+	defer chatApp.stop()
 	
 	chatApp.setStatus("Test status")
-	
-	time.Sleep(100 * time.Millisecond)
+	chatApp.flush()
 	
 	assert.Equal(t, "Статус: Test status", chatApp.statusLabel.Text)
 }
@@ -165,16 +171,16 @@ func TestFetchHistory(t *testing.T) {
 	w := app.NewWindow(appTitle)
 	
 	chatApp := &ChatApp{
-		app:            app,
-		window:         w,
-		messages:       make([]Message, 0),
-		username:       "testuser",
-		currentChannel: defaultChat,
-		serverURL:      fmt.Sprintf("http://%s", defaultServer),
-		rabbitMQURL:    fmt.Sprintf("amqp://guest:guest@%s/", defaultRabbitMQ),
+		app:         app,
+		window:      w,
+		state:       state.New(defaultChat),
+		username:    "testuser",
+		serverURL:   fmt.Sprintf("http://%s", defaultServer),
+		rabbitMQURL: fmt.Sprintf("amqp://guest:guest@%s/", defaultRabbitMQ),
 	}
 	
 	chatApp.initUI()
+	defer chatApp.stop()
 	
 	historyMessages := []Message{
 		{
@@ -203,12 +209,449 @@ func TestFetchHistory(t *testing.T) {
 	chatApp.serverURL = server.URL
 	
 	chatApp.fetchHistory()
-	
-	time.Sleep(100 * time.Millisecond)
-	
-	assert.Equal(t, 2, len(chatApp.messages))
-	assert.Equal(t, historyMessages[0].Username, chatApp.messages[0].Username)
-	assert.Equal(t, historyMessages[0].Body, chatApp.messages[0].Body)
-	assert.Equal(t, historyMessages[1].Username, chatApp.messages[1].Username)
-	assert.Equal(t, historyMessages[1].Body, chatApp.messages[1].Body)
-}
\ No newline at end of file
+	chatApp.flush()
+	
+	messages := chatApp.state.Messages()
+	assert.Equal(t, 2, len(messages))
+	assert.Equal(t, historyMessages[0].Username, messages[0].Username)
+	assert.Equal(t, historyMessages[0].Body, messages[0].Body)
+	assert.Equal(t, historyMessages[1].Username, messages[1].Username)
+	assert.Equal(t, historyMessages[1].Body, messages[1].Body)
+}
+func TestTypingText(t *testing.T) {
+	tests := []struct {
+		name      string
+		usernames []string
+		want      string
+	}{
+		{
+			name:      "Никто не печатает",
+			usernames: []string{},
+			want:      "",
+		},
+		{
+			name:      "Один пользователь",
+			usernames: []string{"alice"},
+			want:      "alice печатает…",
+		},
+		{
+			name:      "Два пользователя",
+			usernames: []string{"bob", "alice"},
+			want:      "alice и bob печатают…",
+		},
+		{
+			name:      "Много пользователей",
+			usernames: []string{"alice", "bob", "carol"},
+			want:      "Несколько человек печатают…",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			assert.Equal(t, tt.want, typingText(tt.usernames))
+		})
+	}
+}
+
+func TestChannelBadge(t *testing.T) {
+	tests := []struct {
+		name     string
+		unread   int
+		mentions int
+		muted    bool
+		want     string
+	}{
+		{
+			name: "Без непрочитанных",
+			want: "",
+		},
+		{
+			name:   "С непрочитанными",
+			unread: 3,
+			want:   "3",
+		},
+		{
+			name:     "Упоминания важнее непрочитанных",
+			unread:   5,
+			mentions: 2,
+			want:     "@2",
+		},
+		{
+			name:   "Канал без звука",
+			unread: 3,
+			muted:  true,
+			want:   "",
+		},
+		{
+			name:     "Упоминание в канале без звука",
+			unread:   3,
+			mentions: 1,
+			muted:    true,
+			want:     "@1",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			assert.Equal(t, tt.want, channelBadge(tt.unread, tt.mentions, tt.muted))
+		})
+	}
+}
+
+func TestFetchMentions(t *testing.T) {
+	if testing.Short() {
+		t.Skip("Skipping test in short mode")
+	}
+
+	app := test.NewApp()
+	w := app.NewWindow(appTitle)
+
+	mentions := []Mention{
+		{ID: 1, Chat: "random", Author: "bob", Body: "@testuser старое"},
+	}
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		json.NewEncoder(w).Encode(MentionsResponse{User: "testuser", Mentions: mentions})
+	}))
+	defer server.Close()
+
+	chatApp := &ChatApp{
+		app:         app,
+		window:      w,
+		state:       state.New(defaultChat),
+		username:    "testuser",
+		serverURL:   server.URL,
+		rabbitMQURL: fmt.Sprintf("amqp://guest:guest@%s/", defaultRabbitMQ),
+	}
+
+	chatApp.initUI()
+	defer chatApp.stop()
+
+	test.AssertNotificationSent(t, nil, func() {
+		chatApp.fetchMentions()
+	})
+	assert.Equal(t, int64(1), chatApp.lastMentionID)
+
+	mentions = []Mention{
+		{ID: 2, Chat: "random", Author: "bob", Body: "@testuser новое"},
+	}
+
+	test.AssertNotificationSent(t, fyne.NewNotification("bob упомянул(а) вас в #random", "@testuser новое"), func() {
+		chatApp.fetchMentions()
+	})
+	assert.Equal(t, int64(2), chatApp.lastMentionID)
+}
+
+func TestFetchChatInfo(t *testing.T) {
+	if testing.Short() {
+		t.Skip("Skipping test in short mode")
+	}
+
+	app := test.NewApp()
+	w := app.NewWindow(appTitle)
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("/v1/chats/"+defaultChat, func(w http.ResponseWriter, r *http.Request) {
+		json.NewEncoder(w).Encode(ChatInfo{Name: defaultChat, Topic: "Релиз в пятницу"})
+	})
+	mux.HandleFunc("/v1/chats/"+defaultChat+"/pins", func(w http.ResponseWriter, r *http.Request) {
+		json.NewEncoder(w).Encode(PinsResponse{
+			Chat: defaultChat,
+			Pins: []Pin{{Message: Message{ID: 1, Username: "bob", Body: "ссылка"}, PinnedBy: "alice"}},
+		})
+	})
+	server := httptest.NewServer(mux)
+	defer server.Close()
+
+	chatApp := &ChatApp{
+		app:         app,
+		window:      w,
+		state:       state.New(defaultChat),
+		username:    "testuser",
+		serverURL:   server.URL,
+		rabbitMQURL: fmt.Sprintf("amqp://guest:guest@%s/", defaultRabbitMQ),
+	}
+
+	chatApp.initUI()
+	defer chatApp.stop()
+	chatApp.fetchChatInfo()
+	chatApp.flush()
+
+	assert.Equal(t, "Тема: Релиз в пятницу", chatApp.topicLabel.Text)
+	assert.Equal(t, "Закреплено: 1", chatApp.pinsButton.Text)
+	assert.Len(t, chatApp.state.Pins(), 1)
+}
+
+// newHistoryServer отвечает на запрос истории одним сообщением из
+// запрошенного чата, на остальные запросы — пустым объектом.
+func newHistoryServer(block <-chan struct{}, blockedChat string) *httptest.Server {
+	return httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/v1/chats/history" {
+			w.Write([]byte("{}"))
+			return
+		}
+		chat := r.URL.Query().Get("chat")
+		if chat == blockedChat {
+			<-block
+		}
+		json.NewEncoder(w).Encode(HistoryResponse{
+			Chat:     chat,
+			Messages: []Message{{ID: 1, Username: "bob", Body: "из " + chat, Timestamp: time.Now()}},
+		})
+	}))
+}
+
+func newTestChatApp(t *testing.T, serverURL string) *ChatApp {
+	app := test.NewApp()
+	chatApp := &ChatApp{
+		app:         app,
+		window:      app.NewWindow(appTitle),
+		state:       state.New(defaultChat),
+		username:    "testuser",
+		serverURL:   serverURL,
+		rabbitMQURL: fmt.Sprintf("amqp://guest:guest@%s/", defaultRabbitMQ),
+	}
+	chatApp.setTheme = func(th fyne.Theme) {
+		pauseUpdates(chatApp, func() { test.ApplyTheme(t, th) })
+	}
+	chatApp.initUI()
+	t.Cleanup(chatApp.stop)
+	return chatApp
+}
+
+// pauseUpdates выполняет f, пока очередь изменений стоит. Тестовое
+// приложение применяет тему, перерисовывая окна в своей горутине, и
+// изменения из очереди не должны идти одновременно с этим.
+func pauseUpdates(c *ChatApp, f func()) {
+	paused, resume := make(chan struct{}), make(chan struct{})
+	defer close(resume)
+	c.do(func() {
+		close(paused)
+		<-resume
+	})
+	select {
+	case <-paused:
+	case <-c.quit:
+	}
+	f()
+}
+
+func TestSwitchChannelDiscardsStaleHistory(t *testing.T) {
+	if testing.Short() {
+		t.Skip("Skipping test in short mode")
+	}
+
+	release := make(chan struct{})
+	server := newHistoryServer(release, defaultChat)
+	defer server.Close()
+
+	chatApp := newTestChatApp(t, server.URL)
+	chatApp.fetchHistory()
+	chatApp.switchChannel("random")
+
+	assert.Eventually(t, func() bool { return chatApp.state.Len() == 1 }, time.Second, 10*time.Millisecond)
+
+	close(release)
+	chatApp.flush()
+
+	messages := chatApp.state.Messages()
+	assert.Len(t, messages, 1)
+	assert.Equal(t, "из random", messages[0].Body, "ответ для прежнего канала отброшен")
+}
+
+// TestSwitchChannelUnderLoad переключает каналы, пока приходят сообщения
+// и события набора текста из всех каналов; запускать с -race.
+func TestSwitchChannelUnderLoad(t *testing.T) {
+	if testing.Short() {
+		t.Skip("Skipping test in short mode")
+	}
+
+	server := newHistoryServer(nil, "")
+	defer server.Close()
+
+	chatApp := newTestChatApp(t, server.URL)
+	channels := []string{defaultChat, "random", "dev"}
+
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		for i := 0; i < 300; i++ {
+			chat := channels[i%len(channels)]
+			chatApp.addMessage(Message{Username: "bob", Body: "живое", Timestamp: time.Now(), ChatName: chat})
+			chatApp.handleTyping(TypingEvent{Username: "bob", ChatName: chat})
+		}
+	}()
+
+	for i := 1; i <= 30; i++ {
+		chatApp.switchChannel(channels[i%len(channels)])
+	}
+	<-done
+	chatApp.flush()
+
+	current := chatApp.state.Channel()
+	for _, msg := range chatApp.state.Messages() {
+		assert.Equal(t, current, msg.ChatName, "сообщение из чужого канала")
+	}
+}
+
+func TestChannelSidebar(t *testing.T) {
+	if testing.Short() {
+		t.Skip("Skipping test in short mode")
+	}
+
+	server := newHistoryServer(nil, "")
+	defer server.Close()
+
+	chatApp := newTestChatApp(t, server.URL)
+	chatApp.joinChannel("random")
+	chatApp.joinChannel("dev")
+	assert.Equal(t, "dev", chatApp.state.Channel())
+
+	chatApp.addMessage(Message{Username: "bob", Body: "привет", ChatName: "random"})
+	chatApp.addMessage(Message{Username: "bob", Body: "@testuser глянь", ChatName: "random"})
+	chatApp.addMessage(Message{Username: "bob", Body: "не в списке", ChatName: "ops"})
+	chatApp.flush()
+	assert.Equal(t, 2, chatApp.state.Unread("random"))
+	assert.Equal(t, 1, chatApp.state.Mentions("random"))
+	assert.Zero(t, chatApp.state.Unread("ops"))
+
+	chatApp.moveChannel("dev", -2)
+	chatApp.toggleMute("random")
+	chatApp.leaveChannel(defaultChat)
+	assert.Equal(t, []string{"dev", "random"}, chatApp.state.Channels())
+
+	chatApp.leaveChannel("dev")
+	assert.Equal(t, "random", chatApp.state.Channel(), "покинув текущий канал, переходим в соседний")
+	chatApp.leaveChannel("random")
+	assert.Equal(t, []string{"random"}, chatApp.state.Channels(), "последний канал не покинуть")
+
+	chatApp.joinChannel("dev")
+	chatApp.moveChannel("dev", -1)
+
+	restored := &ChatApp{app: chatApp.app, state: state.New(defaultChat)}
+	restored.loadChannels()
+	assert.Equal(t, []string{"dev", "random"}, restored.state.Channels())
+	assert.Equal(t, "dev", restored.state.Channel())
+	assert.Equal(t, []string{"random"}, restored.state.MutedChannels())
+}
+
+// describeSegments кратко описывает сегменты RichText для сравнения в
+// тестах.
+func describeSegments(segments []widget.RichTextSegment) []string {
+	var out []string
+	for _, segment := range segments {
+		switch s := segment.(type) {
+		case *widget.TextSegment:
+			switch {
+			case s.Style.TextStyle.Monospace:
+				out = append(out, "код: "+s.Text)
+			case s.Style.ColorName == theme.ColorNamePrimary && s.Style.TextStyle.Bold:
+				out = append(out, "меня: "+s.Text)
+			case s.Style.ColorName == theme.ColorNamePrimary:
+				out = append(out, "упоминание: "+s.Text)
+			case s.Text != "":
+				out = append(out, "текст: "+s.Text)
+			}
+		case *widget.HyperlinkSegment:
+			out = append(out, "ссылка: "+s.URL.String())
+		case *widget.ListSegment:
+			out = append(out, describeSegments(s.Items)...)
+		case *widget.ParagraphSegment:
+			out = append(out, describeSegments(s.Texts)...)
+		}
+	}
+	return out
+}
+
+func TestMessageSegments(t *testing.T) {
+	tests := []struct {
+		name string
+		body string
+		want []string
+	}{
+		{
+			name: "Простой текст",
+			body: "привет",
+			want: []string{"текст: привет"},
+		},
+		{
+			name: "Блок кода",
+			body: "смотри:\n```\nfunc main() {\n\tfmt.Println(\"hi\")\n}\n```",
+			want: []string{"текст: смотри:", "код: func main() {\n\tfmt.Println(\"hi\")\n}"},
+		},
+		{
+			name: "Ссылка в Markdown",
+			body: "см. [документацию](https://example.com/docs)",
+			want: []string{"текст: см. ", "ссылка: https://example.com/docs"},
+		},
+		{
+			name: "Адрес в тексте",
+			body: "см. https://example.com/a?b=1.",
+			want: []string{"текст: см. ", "ссылка: https://example.com/a?b=1", "текст: ."},
+		},
+		{
+			name: "Упоминания",
+			body: "@testuser и @bob, гляньте",
+			want: []string{"меня: @testuser", "текст:  и ", "упоминание: @bob", "текст: , гляньте"},
+		},
+		{
+			name: "Упоминание в коде не выделяется",
+			body: "`@testuser`",
+			want: []string{"код: @testuser"},
+		},
+		{
+			name: "Переносы строк сохраняются",
+			body: "первая\nвторая",
+			want: []string{"текст: первая", "текст: вторая"},
+		},
+		{
+			name: "Изображение — ссылкой",
+			body: "![снимок.png](http://chat.example.com/v1/uploads/ab.png)",
+			want: []string{"ссылка: http://chat.example.com/v1/uploads/ab.png"},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := messageSegments(tt.body, "testuser", func(*url.URL) {})
+			assert.Equal(t, tt.want, describeSegments(got))
+		})
+	}
+}
+
+func TestMessageSegmentsOpenURL(t *testing.T) {
+	var opened []string
+	open := func(u *url.URL) { opened = append(opened, u.String()) }
+
+	for _, segment := range messageSegments("[сайт](https://a.example) и https://b.example", "testuser", open) {
+		if link, ok := segment.(*widget.HyperlinkSegment); ok {
+			link.OnTapped()
+		}
+	}
+	assert.Equal(t, []string{"https://a.example", "https://b.example"}, opened)
+}
+
+func TestMessageRow(t *testing.T) {
+	if testing.Short() {
+		t.Skip("Skipping test in short mode")
+	}
+
+	chatApp := newTestChatApp(t, fmt.Sprintf("http://%s", defaultServer))
+	chatApp.addMessage(Message{ID: 1, Username: "bob", Body: "одна строка", ChatName: defaultChat})
+	chatApp.addMessage(Message{ID: 2, Username: "bob", Body: "```\nfirst\nsecond\nthird\n```", ChatName: defaultChat})
+	chatApp.flush()
+
+	short := chatApp.messageList.CreateItem()
+	chatApp.messageList.UpdateItem(0, short)
+	row := chatApp.messageList.CreateItem()
+	chatApp.messageList.UpdateItem(1, row)
+	assert.Greater(t, row.MinSize().Height, short.MinSize().Height, "строка с блоком кода выше")
+
+	vbox := row.(*fyne.Container).Objects[1].(*fyne.Container)
+	body := vbox.Objects[2].(*widget.RichText)
+	assert.Equal(t, []string{"код: first\nsecond\nthird"}, describeSegments(body.Segments))
+
+	actions := vbox.Objects[1].(*fyne.Container).Objects[1].(*fyne.Container)
+	test.Tap(actions.Objects[0].(*widget.Button))
+	assert.Equal(t, "```\nfirst\nsecond\nthird\n```", chatApp.window.Clipboard().Content(), "копируется исходный текст")
+}
@@ -0,0 +1,150 @@
+package main
+
+import (
+	"net/url"
+	"regexp"
+	"sort"
+	"strings"
+
+	"fyne.io/fyne/v2/theme"
+	"fyne.io/fyne/v2/widget"
+
+	"team-bunny-chat/bunnychat"
+)
+
+var (
+	urlPattern   = regexp.MustCompile(`https?://[^\s<>"]+`)
+	imagePattern = regexp.MustCompile(`!\[([^\]]*)\]\(([^)\s]+)\)`)
+)
+
+// messageSegments разбирает текст сообщения как Markdown. Блоки кода
+// выводятся моноширинным шрифтом, ссылки и адреса в тексте открываются
+// через open, упоминания выделены цветом, а упоминания username — еще и
+// жирным.
+func messageSegments(body, username string, open func(*url.URL)) []widget.RichTextSegment {
+	segments := widget.NewRichTextFromMarkdown(keepLineBreaks(imageLinks(body))).Segments
+	return decorateSegments(segments, username, open)
+}
+
+// keepLineBreaks превращает переносы строк вне блоков кода в границы
+// абзацев: в Markdown одиночный перенос склеивает строки, а в чате его
+// ждут увидеть.
+func keepLineBreaks(body string) string {
+	lines := strings.Split(body, "\n")
+	out := make([]string, 0, len(lines))
+	fenced := false
+	for i, line := range lines {
+		trimmed := strings.TrimSpace(line)
+		if strings.HasPrefix(trimmed, "```") || strings.HasPrefix(trimmed, "~~~") {
+			fenced = !fenced
+		}
+		out = append(out, line)
+		if !fenced && trimmed != "" && i+1 < len(lines) && strings.TrimSpace(lines[i+1]) != "" {
+			out = append(out, "")
+		}
+	}
+	return strings.Join(out, "\n")
+}
+
+// imageLinks заменяет картинки вне блоков кода ссылками на них: RichText
+// загружает картинку прямо при разборе текста, в потоке интерфейса, и
+// выводит ее в исходном размере.
+func imageLinks(body string) string {
+	lines := strings.Split(body, "\n")
+	fenced := false
+	for i, line := range lines {
+		trimmed := strings.TrimSpace(line)
+		if strings.HasPrefix(trimmed, "```") || strings.HasPrefix(trimmed, "~~~") {
+			fenced = !fenced
+		}
+		if !fenced {
+			lines[i] = imagePattern.ReplaceAllString(line, "[Изображение: $1]($2)")
+		}
+	}
+	return strings.Join(lines, "\n")
+}
+
+func decorateSegments(segments []widget.RichTextSegment, username string, open func(*url.URL)) []widget.RichTextSegment {
+	var out []widget.RichTextSegment
+	for _, segment := range segments {
+		switch s := segment.(type) {
+		case *widget.TextSegment:
+			if s.Style == widget.RichTextStyleCodeBlock || s.Style == widget.RichTextStyleCodeInline {
+				out = append(out, s)
+				continue
+			}
+			out = append(out, splitText(s, username, open)...)
+		case *widget.HyperlinkSegment:
+			out = append(out, link(s, open))
+		case *widget.ListSegment:
+			s.Items = decorateSegments(s.Items, username, open)
+			out = append(out, s)
+		case *widget.ParagraphSegment:
+			s.Texts = decorateSegments(s.Texts, username, open)
+			out = append(out, s)
+		default:
+			out = append(out, s)
+		}
+	}
+	return out
+}
+
+func link(s *widget.HyperlinkSegment, open func(*url.URL)) *widget.HyperlinkSegment {
+	if target := s.URL; target != nil {
+		s.OnTapped = func() { open(target) }
+	}
+	return s
+}
+
+// splitText выделяет в тексте адреса и упоминания. Если segment завершал
+// абзац, абзац завершает и последний кусок.
+func splitText(segment *widget.TextSegment, username string, open func(*url.URL)) []widget.RichTextSegment {
+	type span struct {
+		start, end int
+		url        bool
+	}
+	text := segment.Text
+	var spans []span
+	for _, index := range urlPattern.FindAllStringIndex(text, -1) {
+		end := index[0] + len(strings.TrimRight(text[index[0]:index[1]], ".,;:!?)"))
+		spans = append(spans, span{index[0], end, true})
+	}
+	for _, index := range bunnychat.MentionIndexes(text) {
+		spans = append(spans, span{index[0], index[1], false})
+	}
+	if len(spans) == 0 {
+		return []widget.RichTextSegment{segment}
+	}
+	sort.Slice(spans, func(i, j int) bool { return spans[i].start < spans[j].start })
+
+	inline := segment.Style
+	inline.Inline = true
+	var out []widget.RichTextSegment
+	pos := 0
+	for _, sp := range spans {
+		if sp.start < pos {
+			continue // упоминание внутри адреса
+		}
+		if sp.start > pos {
+			out = append(out, &widget.TextSegment{Style: inline, Text: text[pos:sp.start]})
+		}
+		part := text[sp.start:sp.end]
+		if sp.url {
+			if target, err := url.Parse(part); err == nil {
+				out = append(out, link(&widget.HyperlinkSegment{Text: part, URL: target}, open))
+			} else {
+				out = append(out, &widget.TextSegment{Style: inline, Text: part})
+			}
+		} else {
+			style := inline
+			style.ColorName = theme.ColorNamePrimary
+			style.TextStyle.Bold = bunnychat.MentionsUser(part, username)
+			out = append(out, &widget.TextSegment{Style: style, Text: part})
+		}
+		pos = sp.end
+	}
+	if pos < len(text) || !segment.Style.Inline {
+		out = append(out, &widget.TextSegment{Style: segment.Style, Text: text[pos:]})
+	}
+	return out
+}
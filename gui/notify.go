@@ -0,0 +1,249 @@
+package main
+
+import (
+	"fmt"
+	"strings"
+	"time"
+
+	"fyne.io/fyne/v2"
+	"fyne.io/fyne/v2/driver/desktop"
+
+	"team-bunny-chat/bunnychat"
+
+	"github.com/team-bunny-chat/gui/internal/state"
+)
+
+const clockFormat = "15:04"
+
+var notifyLevelNames = map[state.NotifyLevel]string{
+	state.NotifyAll:      "все сообщения",
+	state.NotifyMentions: "только упоминания",
+	state.NotifyNone:     "нет",
+}
+
+// quietHours — расписание «Не беспокоить» по местному времени, в минутах
+// от начала суток. Если from позже to, тихие часы идут через полночь;
+// если они равны — весь день.
+type quietHours struct {
+	enabled  bool
+	from, to int
+}
+
+var defaultQuietHours = quietHours{from: 22 * 60, to: 8 * 60}
+
+func (q quietHours) active(now time.Time) bool {
+	if !q.enabled {
+		return false
+	}
+	minute := now.Hour()*60 + now.Minute()
+	switch {
+	case q.from == q.to:
+		return true
+	case q.from < q.to:
+		return minute >= q.from && minute < q.to
+	default:
+		return minute >= q.from || minute < q.to
+	}
+}
+
+// parseClock разбирает время ЧЧ:ММ в минуты от начала суток.
+func parseClock(text string) (int, error) {
+	t, err := time.Parse(clockFormat, strings.TrimSpace(text))
+	if err != nil {
+		return 0, fmt.Errorf("неверное время %q, ожидается ЧЧ:ММ", text)
+	}
+	return t.Hour()*60 + t.Minute(), nil
+}
+
+func formatClock(minute int) string {
+	return fmt.Sprintf("%02d:%02d", minute/60, minute%60)
+}
+
+func (c *ChatApp) quietHours() quietHours {
+	if q := c.dnd.Load(); q != nil {
+		return *q
+	}
+	return defaultQuietHours
+}
+
+func (c *ChatApp) setQuietHours(q quietHours) {
+	c.dnd.Store(&q)
+	prefs := c.app.Preferences()
+	prefs.SetBool(prefDND, q.enabled)
+	prefs.SetString(prefDNDFrom, formatClock(q.from))
+	prefs.SetString(prefDNDTo, formatClock(q.to))
+	c.do(c.updateTray)
+}
+
+// applyQuietHours задает расписание «Не беспокоить» из полей диалога
+// настроек.
+func (c *ChatApp) applyQuietHours(enabled bool, from, to string) error {
+	q := quietHours{enabled: enabled}
+	var err error
+	if q.from, err = parseClock(from); err != nil {
+		return err
+	}
+	if q.to, err = parseClock(to); err != nil {
+		return err
+	}
+	c.setQuietHours(q)
+	return nil
+}
+
+func (c *ChatApp) toggleDND() {
+	q := c.quietHours()
+	q.enabled = !q.enabled
+	c.setQuietHours(q)
+}
+
+// notifyLevel — уровень уведомлений канала: выбранный пользователем, а
+// если он не выбран — все сообщения для личной переписки и упоминания
+// для остальных каналов.
+func (c *ChatApp) notifyLevel(channelName string) state.NotifyLevel {
+	if level := c.state.NotifyLevel(channelName); level != state.NotifyDefault {
+		return level
+	}
+	if _, ok := bunnychat.DirectPeer(channelName, c.currentUsername()); ok {
+		return state.NotifyAll
+	}
+	return state.NotifyMentions
+}
+
+func (c *ChatApp) setNotifyLevel(channelName string, level state.NotifyLevel) {
+	c.state.SetNotifyLevel(channelName, level)
+	c.saveChannels()
+}
+
+// channelTitle — как канал называется в интерфейсе: личная переписка —
+// по имени собеседника.
+func (c *ChatApp) channelTitle(channelName string) string {
+	if peer, ok := bunnychat.DirectPeer(channelName, c.currentUsername()); ok {
+		return "@ " + peer
+	}
+	return "# " + channelName
+}
+
+// notify показывает системное уведомление, если сейчас не тихие часы.
+func (c *ChatApp) notify(title, body string) {
+	if c.quietHours().active(time.Now()) {
+		return
+	}
+	c.app.SendNotification(fyne.NewNotification(title, body))
+}
+
+// notifyMessage уведомляет о сообщении из RabbitMQ, если канал присылает
+// уведомления обо всех сообщениях. Об упоминаниях уведомляет
+// fetchMentions: сервер находит их и в каналах, на которые мы не
+// подписаны. Сообщения текущего канала при активном окне и так видны.
+func (c *ChatApp) notifyMessage(msg Message) {
+	username := c.currentUsername()
+	if msg.Username == username || c.notifyLevel(msg.ChatName) != state.NotifyAll {
+		return
+	}
+	if c.foreground.Load() && msg.ChatName == c.state.Channel() {
+		return
+	}
+	title := fmt.Sprintf("%s в #%s", msg.Username, msg.ChatName)
+	if peer, ok := bunnychat.DirectPeer(msg.ChatName, username); ok {
+		title = fmt.Sprintf("Личное сообщение от %s", peer)
+	}
+	c.notify(title, msg.Body)
+}
+
+// notifyMention решает, уведомлять ли об упоминании: каналы с уровнем
+// «все сообщения» из списка уже уведомили через notifyMessage.
+func (c *ChatApp) notifyMention(mention Mention) bool {
+	switch c.notifyLevel(mention.Chat) {
+	case state.NotifyMentions:
+		return true
+	case state.NotifyAll:
+		return !containsString(c.state.Channels(), mention.Chat)
+	default:
+		return false
+	}
+}
+
+// openDirectChats добавляет в список личные переписки, в которых есть
+// непрочитанные, — о новых сообщениях в них RabbitMQ не сообщает, пока
+// мы не подписаны.
+func (c *ChatApp) openDirectChats(chats []ChatInfo) {
+	username := c.currentUsername()
+	added := false
+	for _, chat := range chats {
+		peer, ok := bunnychat.DirectPeer(chat.Name, username)
+		if !ok || chat.Unread == 0 || !c.state.AddChannel(chat.Name) {
+			continue
+		}
+		added = true
+		if client := c.currentClient(); client != nil {
+			if err := client.Join(chat.Name); err != nil {
+				c.setStatus(err.Error())
+			}
+		}
+		if c.notifyLevel(chat.Name) != state.NotifyNone {
+			c.notify(fmt.Sprintf("Личное сообщение от %s", peer), fmt.Sprintf("Непрочитанных: %d", chat.Unread))
+		}
+	}
+	if added {
+		c.saveChannels()
+		c.do(c.refreshChannelList)
+	}
+}
+
+// openDirectChat открывает личную переписку с участником канала.
+func (c *ChatApp) openDirectChat(peer string) {
+	username := c.currentUsername()
+	if peer == username {
+		return
+	}
+	c.joinChannel(bunnychat.DirectChat(username, peer))
+}
+
+// setupTray добавляет меню в системный трей, если платформа его
+// поддерживает.
+func (c *ChatApp) setupTray() {
+	desk, ok := c.app.(desktop.App)
+	if !ok {
+		return
+	}
+	c.tray = desk
+	c.trayUnread = fyne.NewMenuItem("", nil)
+	c.trayUnread.Disabled = true
+	c.trayDND = fyne.NewMenuItem("Не беспокоить", c.toggleDND)
+	c.trayMenu = fyne.NewMenu(appTitle,
+		c.trayUnread,
+		fyne.NewMenuItem("Открыть", func() {
+			c.window.Show()
+			c.window.RequestFocus()
+		}),
+		c.trayDND,
+	)
+	c.updateTray()
+}
+
+// updateTray показывает в меню трея число непрочитанных и режим «Не
+// беспокоить». Вызывается из очереди изменений. Menu.Refresh обновляет
+// только главное меню окна, поэтому меню трея задается заново — и только
+// если оно изменилось.
+func (c *ChatApp) updateTray() {
+	if c.tray == nil {
+		return
+	}
+	label := "Непрочитанных нет"
+	if unread := c.state.TotalUnread(); unread > 0 {
+		label = fmt.Sprintf("Непрочитанных: %d", unread)
+	}
+	dnd := c.quietHours().enabled
+	if label == c.trayUnread.Label && dnd == c.trayDND.Checked {
+		return
+	}
+	c.trayUnread.Label = label
+	c.trayDND.Checked = dnd
+	c.tray.SetSystemTrayMenu(c.trayMenu)
+}
+
+// showUnread обновляет счетчики в боковой панели и в трее.
+func (c *ChatApp) showUnread() {
+	c.channelList.Refresh()
+	c.updateTray()
+}
@@ -0,0 +1,238 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"fyne.io/fyne/v2"
+	"fyne.io/fyne/v2/test"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/team-bunny-chat/gui/internal/state"
+)
+
+func TestQuietHours(t *testing.T) {
+	at := func(hour, minute int) time.Time {
+		return time.Date(2026, 10, 19, hour, minute, 0, 0, time.Local)
+	}
+
+	tests := []struct {
+		name  string
+		hours quietHours
+		now   time.Time
+		want  bool
+	}{
+		{name: "Выключено", hours: quietHours{from: 0, to: 0}, now: at(12, 0)},
+		{name: "Днем внутри", hours: quietHours{enabled: true, from: 13 * 60, to: 14 * 60}, now: at(13, 30), want: true},
+		{name: "Днем, конец не входит", hours: quietHours{enabled: true, from: 13 * 60, to: 14 * 60}, now: at(14, 0)},
+		{name: "Через полночь, вечер", hours: quietHours{enabled: true, from: 22 * 60, to: 8 * 60}, now: at(23, 15), want: true},
+		{name: "Через полночь, утро", hours: quietHours{enabled: true, from: 22 * 60, to: 8 * 60}, now: at(7, 59), want: true},
+		{name: "Через полночь, день", hours: quietHours{enabled: true, from: 22 * 60, to: 8 * 60}, now: at(12, 0)},
+		{name: "Весь день", hours: quietHours{enabled: true, from: 9 * 60, to: 9 * 60}, now: at(3, 0), want: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			assert.Equal(t, tt.want, tt.hours.active(tt.now))
+		})
+	}
+}
+
+func TestParseClock(t *testing.T) {
+	minute, err := parseClock(" 07:45 ")
+	require.NoError(t, err)
+	assert.Equal(t, 7*60+45, minute)
+	assert.Equal(t, "07:45", formatClock(minute))
+
+	_, err = parseClock("25:00")
+	assert.Error(t, err)
+	_, err = parseClock("утром")
+	assert.Error(t, err)
+}
+
+func TestNotifyMessage(t *testing.T) {
+	chatApp := newTestChatApp(t, "http://localhost:0")
+	chatApp.state.AddChannel("random")
+	chatApp.state.AddChannel("dev")
+	chatApp.state.SetNotifyLevel("random", state.NotifyAll)
+	chatApp.state.SetNotifyLevel("dev", state.NotifyNone)
+	direct := "dm:bob:testuser"
+
+	tests := []struct {
+		name       string
+		msg        Message
+		foreground bool
+		dnd        bool
+		want       *fyne.Notification
+	}{
+		{
+			name: "Канал с уведомлениями об упоминаниях",
+			msg:  Message{Username: "bob", Body: "привет", ChatName: defaultChat},
+		},
+		{
+			name: "Канал с уведомлениями обо всех сообщениях",
+			msg:  Message{Username: "bob", Body: "привет", ChatName: "random"},
+			want: fyne.NewNotification("bob в #random", "привет"),
+		},
+		{
+			name: "Канал без уведомлений",
+			msg:  Message{Username: "bob", Body: "@testuser привет", ChatName: "dev"},
+		},
+		{
+			name: "Личное сообщение",
+			msg:  Message{Username: "bob", Body: "есть минута?", ChatName: direct},
+			want: fyne.NewNotification("Личное сообщение от bob", "есть минута?"),
+		},
+		{
+			name: "Свое сообщение",
+			msg:  Message{Username: "testuser", Body: "привет", ChatName: direct},
+		},
+		{
+			name:       "Текущий канал в активном окне",
+			msg:        Message{Username: "bob", Body: "привет", ChatName: defaultChat},
+			foreground: true,
+		},
+		{
+			name: "Не беспокоить",
+			msg:  Message{Username: "bob", Body: "есть минута?", ChatName: direct},
+			dnd:  true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			chatApp.state.SetNotifyLevel(defaultChat, state.NotifyDefault)
+			if tt.foreground {
+				chatApp.state.SetNotifyLevel(defaultChat, state.NotifyAll)
+			}
+			chatApp.foreground.Store(tt.foreground)
+			chatApp.dnd.Store(&quietHours{enabled: tt.dnd})
+
+			test.AssertNotificationSent(t, tt.want, func() {
+				chatApp.notifyMessage(tt.msg)
+			})
+		})
+	}
+}
+
+func TestNotifyMention(t *testing.T) {
+	chatApp := newTestChatApp(t, "http://localhost:0")
+	chatApp.state.AddChannel("random")
+	chatApp.state.SetNotifyLevel("random", state.NotifyAll)
+	chatApp.state.AddChannel("dev")
+	chatApp.state.SetNotifyLevel("dev", state.NotifyNone)
+
+	assert.True(t, chatApp.notifyMention(Mention{Chat: defaultChat}), "по умолчанию — об упоминаниях")
+	assert.True(t, chatApp.notifyMention(Mention{Chat: "ops"}), "канал не в списке")
+	assert.False(t, chatApp.notifyMention(Mention{Chat: "random"}), "уже уведомили как о сообщении")
+	assert.False(t, chatApp.notifyMention(Mention{Chat: "dev"}))
+	assert.True(t, chatApp.notifyMention(Mention{Chat: "dm:bob:testuser"}), "переписка не в списке")
+}
+
+func TestDirectChats(t *testing.T) {
+	if testing.Short() {
+		t.Skip("Skipping test in short mode")
+	}
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/v1/chats" {
+			w.Write([]byte("{}"))
+			return
+		}
+		json.NewEncoder(w).Encode(ChatsResponse{Chats: []ChatInfo{
+			{Name: defaultChat, Unread: 1},
+			{Name: "dm:bob:testuser", Unread: 2},
+			{Name: "dm:alice:testuser"},
+			{Name: "dm:alice:bob", Unread: 5},
+		}})
+	}))
+	defer server.Close()
+
+	chatApp := newTestChatApp(t, server.URL)
+	test.AssertNotificationSent(t, fyne.NewNotification("Личное сообщение от bob", "Непрочитанных: 2"), func() {
+		chatApp.fetchUnread()
+	})
+	chatApp.flush()
+
+	assert.Equal(t, []string{defaultChat, "dm:bob:testuser"}, chatApp.state.Channels(),
+		"добавлена только своя переписка с непрочитанными")
+	assert.Equal(t, "@ bob", chatApp.channelTitle("dm:bob:testuser"))
+	assert.Equal(t, 2, chatApp.state.Unread("dm:bob:testuser"))
+
+	test.AssertNotificationSent(t, nil, func() {
+		chatApp.fetchUnread()
+	})
+}
+
+func TestOpenDirectChat(t *testing.T) {
+	if testing.Short() {
+		t.Skip("Skipping test in short mode")
+	}
+
+	server := newHistoryServer(nil, "")
+	defer server.Close()
+
+	chatApp := newTestChatApp(t, server.URL)
+	chatApp.openDirectChat("testuser")
+	chatApp.openDirectChat("bob")
+	chatApp.flush()
+
+	assert.Equal(t, "dm:bob:testuser", chatApp.state.Channel())
+	assert.Equal(t, []string{defaultChat, "dm:bob:testuser"}, chatApp.state.Channels(), "с собой переписку не открыть")
+}
+
+// trayApp — тестовое приложение с системным треем.
+type trayApp struct {
+	fyne.App
+	menu *fyne.Menu
+	sets int
+}
+
+func (a *trayApp) SetSystemTrayMenu(menu *fyne.Menu) {
+	a.menu = menu
+	a.sets++
+}
+
+func (a *trayApp) SetSystemTrayIcon(fyne.Resource) {}
+
+func TestTray(t *testing.T) {
+	if testing.Short() {
+		t.Skip("Skipping test in short mode")
+	}
+
+	app := &trayApp{App: test.NewApp()}
+	chatApp := &ChatApp{
+		app:      app,
+		window:   app.NewWindow(appTitle),
+		state:    state.New(defaultChat),
+		username: "testuser",
+	}
+	chatApp.initUI()
+	chatApp.setupTray()
+	t.Cleanup(chatApp.stop)
+
+	require.NotNil(t, app.menu)
+	assert.Equal(t, "Непрочитанных нет", app.menu.Items[0].Label)
+	assert.False(t, app.menu.Items[2].Checked)
+
+	chatApp.state.AddChannel("random")
+	chatApp.addMessage(Message{Username: "bob", Body: "привет", ChatName: "random"})
+	chatApp.addMessage(Message{Username: "bob", Body: "еще", ChatName: "random"})
+	chatApp.flush()
+	assert.Equal(t, "Непрочитанных: 2", app.menu.Items[0].Label)
+
+	sets := app.sets
+	chatApp.do(chatApp.updateTray)
+	chatApp.flush()
+	assert.Equal(t, sets, app.sets, "неизмененное меню не задается заново")
+
+	app.menu.Items[2].Action()
+	chatApp.flush()
+	assert.True(t, app.menu.Items[2].Checked, "«Не беспокоить» включено")
+	assert.True(t, chatApp.quietHours().enabled)
+	assert.True(t, app.Preferences().Bool(prefDND))
+}
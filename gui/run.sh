@@ -9,4 +9,4 @@ echo "Установка зависимостей..."
 go mod tidy
 
 echo "Запуск Team Bunny Chat GUI..."
-go run main.go
+go run .
@@ -0,0 +1,282 @@
+package main
+
+import (
+	"fmt"
+	"strings"
+	"sync"
+	"time"
+	"unicode/utf8"
+
+	"fyne.io/fyne/v2"
+	"fyne.io/fyne/v2/container"
+	"fyne.io/fyne/v2/dialog"
+	"fyne.io/fyne/v2/theme"
+	"fyne.io/fyne/v2/widget"
+)
+
+const (
+	searchDateFormat = "02.01.2006"
+	searchLimit      = 100
+	// snippetContext — сколько символов вокруг совпадения показывается в
+	// результатах поиска.
+	snippetContext = 40
+
+	scopeAll     = "Все каналы"
+	scopeCurrent = "Текущий канал"
+)
+
+// searchPanel — окно поиска по истории. Создается при первом открытии и
+// сохраняет запрос и результаты до следующего поиска.
+type searchPanel struct {
+	mu       sync.Mutex
+	results  []SearchResult
+	searched string
+
+	query  *widget.Entry
+	author *widget.Entry
+	from   *widget.Entry
+	to     *widget.Entry
+	scope  *widget.RadioGroup
+	list   *widget.List
+	status *widget.Label
+	dialog dialog.Dialog
+}
+
+// result возвращает найденное сообщение и текст запроса, по которому
+// оно найдено.
+func (p *searchPanel) result(id widget.ListItemID) (SearchResult, string, bool) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if id < 0 || id >= len(p.results) {
+		return SearchResult{}, "", false
+	}
+	return p.results[id], p.searched, true
+}
+
+func (c *ChatApp) newSearchPanel() *searchPanel {
+	p := &searchPanel{
+		query:  widget.NewEntry(),
+		author: widget.NewEntry(),
+		from:   widget.NewEntry(),
+		to:     widget.NewEntry(),
+		scope:  widget.NewRadioGroup([]string{scopeAll, scopeCurrent}, nil),
+		status: widget.NewLabel(""),
+	}
+	p.query.SetPlaceHolder("Текст сообщения")
+	p.query.OnSubmitted = func(string) { c.runSearch() }
+	p.author.SetPlaceHolder("Любой")
+	p.from.SetPlaceHolder("с ДД.ММ.ГГГГ")
+	p.to.SetPlaceHolder("по ДД.ММ.ГГГГ")
+	p.scope.Horizontal = true
+	p.scope.SetSelected(scopeAll)
+
+	p.list = widget.NewList(
+		func() int {
+			p.mu.Lock()
+			defer p.mu.Unlock()
+			return len(p.results)
+		},
+		func() fyne.CanvasObject {
+			snippet := widget.NewRichText()
+			snippet.Wrapping = fyne.TextWrapWord
+			return container.NewVBox(
+				widget.NewLabelWithStyle("", fyne.TextAlignLeading, fyne.TextStyle{Bold: true}),
+				snippet,
+			)
+		},
+		func(id widget.ListItemID, obj fyne.CanvasObject) {
+			result, searched, ok := p.result(id)
+			if !ok {
+				return
+			}
+			vbox := obj.(*fyne.Container)
+			vbox.Objects[0].(*widget.Label).SetText(fmt.Sprintf("#%s · %s · %s",
+				result.Chat, result.Message.Username, result.Message.Timestamp.Local().Format("02.01.2006 15:04")))
+
+			before, match, after := searchSnippet(result.Message.Body, searched)
+			inline := widget.RichTextStyleInline
+			bold := widget.RichTextStyleStrong
+			snippet := vbox.Objects[1].(*widget.RichText)
+			snippet.Segments = []widget.RichTextSegment{
+				&widget.TextSegment{Style: inline, Text: before},
+				&widget.TextSegment{Style: bold, Text: match},
+				&widget.TextSegment{Style: widget.RichTextStyleParagraph, Text: after},
+			}
+			snippet.Refresh()
+			p.list.SetItemHeight(id, vbox.MinSize().Height)
+		},
+	)
+	p.list.OnSelected = func(id widget.ListItemID) {
+		p.list.Unselect(id)
+		if result, _, ok := p.result(id); ok {
+			p.dialog.Hide()
+			c.jumpToMessage(result.Message)
+		}
+	}
+
+	form := widget.NewForm(
+		widget.NewFormItem("Найти", p.query),
+		widget.NewFormItem("Где", p.scope),
+		widget.NewFormItem("Автор", p.author),
+		widget.NewFormItem("Период", container.NewGridWithColumns(2, p.from, p.to)),
+	)
+	searchButton := widget.NewButtonWithIcon("Найти", theme.SearchIcon(), c.runSearch)
+
+	content := container.NewBorder(
+		container.NewVBox(form, container.NewBorder(nil, nil, nil, searchButton, p.status)),
+		nil, nil, nil,
+		p.list,
+	)
+	p.dialog = dialog.NewCustom("Поиск", "Закрыть", content, c.window)
+	p.dialog.Resize(fyne.NewSize(700, 550))
+	return p
+}
+
+// showSearch открывает окно поиска (Ctrl+F).
+func (c *ChatApp) showSearch() {
+	if c.search == nil {
+		c.search = c.newSearchPanel()
+	}
+	c.search.dialog.Show()
+	c.window.Canvas().Focus(c.search.query)
+}
+
+// runSearch ищет сообщения на сервере по заполненным полям окна поиска.
+func (c *ChatApp) runSearch() {
+	p := c.search
+	text := strings.TrimSpace(p.query.Text)
+	if text == "" {
+		p.status.SetText("Введите текст для поиска")
+		return
+	}
+	from, err := parseDate(p.from.Text, false)
+	if err != nil {
+		p.status.SetText(err.Error())
+		return
+	}
+	to, err := parseDate(p.to.Text, true)
+	if err != nil {
+		p.status.SetText(err.Error())
+		return
+	}
+
+	query := SearchQuery{
+		Text:   text,
+		Chats:  c.state.Channels(),
+		Author: strings.TrimSpace(p.author.Text),
+		From:   from,
+		To:     to,
+		Limit:  searchLimit,
+	}
+	if p.scope.Selected == scopeCurrent {
+		query.Chats = []string{c.state.Channel()}
+	}
+
+	p.status.SetText("Поиск...")
+	c.background(func() {
+		response, err := c.api().Search(query)
+		c.reportServer(err)
+		if err != nil {
+			c.do(func() { p.status.SetText(fmt.Sprintf("Ошибка при поиске: %v", err)) })
+			return
+		}
+
+		p.mu.Lock()
+		p.results = response.Results
+		p.searched = text
+		p.mu.Unlock()
+		c.do(func() {
+			if len(response.Results) == 0 {
+				p.status.SetText("Ничего не найдено")
+			} else {
+				p.status.SetText(fmt.Sprintf("Найдено: %d", len(response.Results)))
+			}
+			p.list.Refresh()
+			p.list.ScrollToTop()
+		})
+	})
+}
+
+// jumpToMessage открывает канал сообщения и показывает его, выделив.
+func (c *ChatApp) jumpToMessage(msg Message) {
+	if msg.ChatName != c.state.Channel() && !c.enterChannel(msg.ChatName) {
+		return
+	}
+	c.fetchAround(msg)
+}
+
+// fetchAround загружает страницу истории вокруг msg. Сообщения позже
+// страницы догружаются при прокрутке вниз, как вытесненные из памяти.
+func (c *ChatApp) fetchAround(msg Message) {
+	channelName, generation := c.state.Current()
+	c.background(func() {
+		history, err := c.api().HistoryBefore(channelName, msg.ID+historyPage/2, historyPage)
+		c.reportServer(err)
+		if err != nil {
+			c.setStatus(fmt.Sprintf("Ошибка при получении истории: %v", err))
+			return
+		}
+		if !c.state.SetPage(generation, history.Messages, len(history.Messages) == historyPage, true) {
+			return
+		}
+		c.highlighted.Store(msg.ID)
+		c.fetchChatInfo()
+
+		c.do(func() {
+			c.following.Store(false)
+			c.jumpButton.SetText("К последним")
+			c.jumpButton.Show()
+			c.messageList.Refresh()
+			if index := c.state.Index(msg.ID); index >= 0 {
+				c.scrollToRow(max(index-2, 0))
+			}
+		})
+		c.setStatus(fmt.Sprintf("Сообщение от %s в канале %s", msg.Username, channelName))
+	})
+}
+
+// parseDate разбирает дату в формате ДД.ММ.ГГГГ. Пустая строка — без
+// ограничения. Дата конца периода включается целиком.
+func parseDate(text string, end bool) (time.Time, error) {
+	text = strings.TrimSpace(text)
+	if text == "" {
+		return time.Time{}, nil
+	}
+	date, err := time.ParseInLocation(searchDateFormat, text, time.Local)
+	if err != nil {
+		return time.Time{}, fmt.Errorf("неверная дата %q, ожидается ДД.ММ.ГГГГ", text)
+	}
+	if end {
+		date = date.AddDate(0, 0, 1)
+	}
+	return date, nil
+}
+
+// searchSnippet вырезает из текста сообщения совпадение с query и до
+// snippetContext символов вокруг него. Переносы строк заменяются
+// пробелами. Если совпадения нет (сервер мог найти другую форму слова),
+// возвращается начало текста.
+func searchSnippet(body, query string) (before, match, after string) {
+	text := []rune(strings.Join(strings.Fields(body), " "))
+	lower := strings.ToLower(string(text))
+	query = strings.ToLower(strings.TrimSpace(query))
+	start, end := 0, 0
+	if index := strings.Index(lower, query); index >= 0 && query != "" {
+		start = utf8.RuneCountInString(lower[:index])
+		end = start + utf8.RuneCountInString(query)
+	}
+
+	from := max(start-snippetContext, 0)
+	to := min(end+snippetContext, len(text))
+	if end == 0 {
+		to = min(2*snippetContext, len(text))
+	}
+	before, match, after = string(text[from:start]), string(text[start:end]), string(text[end:to])
+	if from > 0 {
+		before = "…" + before
+	}
+	if to < len(text) {
+		after += "…"
+	}
+	return before, match, after
+}
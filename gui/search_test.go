@@ -0,0 +1,179 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+	"time"
+
+	"fyne.io/fyne/v2"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestParseDate(t *testing.T) {
+	tests := []struct {
+		name    string
+		text    string
+		end     bool
+		want    time.Time
+		wantErr bool
+	}{
+		{
+			name: "Пустая дата",
+			text: "  ",
+		},
+		{
+			name: "Начало периода",
+			text: "05.03.2024",
+			want: time.Date(2024, 3, 5, 0, 0, 0, 0, time.Local),
+		},
+		{
+			name: "Конец периода включается целиком",
+			text: "05.03.2024",
+			end:  true,
+			want: time.Date(2024, 3, 6, 0, 0, 0, 0, time.Local),
+		},
+		{
+			name:    "Неверный формат",
+			text:    "2024-03-05",
+			wantErr: true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := parseDate(tt.text, tt.end)
+			if tt.wantErr {
+				assert.Error(t, err)
+				return
+			}
+			require.NoError(t, err)
+			assert.True(t, tt.want.Equal(got), "получено %v", got)
+		})
+	}
+}
+
+func TestSearchSnippet(t *testing.T) {
+	long := strings.Repeat("а", 50)
+
+	tests := []struct {
+		name       string
+		body       string
+		query      string
+		wantBefore string
+		wantMatch  string
+		wantAfter  string
+	}{
+		{
+			name:       "Совпадение без учета регистра",
+			body:       "Релиз Сегодня вечером",
+			query:      "сегодня",
+			wantBefore: "Релиз ",
+			wantMatch:  "Сегодня",
+			wantAfter:  " вечером",
+		},
+		{
+			name:       "Переносы строк заменяются пробелами",
+			body:       "первая\nвторая строка",
+			query:      "вторая",
+			wantBefore: "первая ",
+			wantMatch:  "вторая",
+			wantAfter:  " строка",
+		},
+		{
+			name:       "Длинный текст обрезается",
+			body:       long + " деплой " + long,
+			query:      "деплой",
+			wantBefore: "…" + strings.Repeat("а", snippetContext-1) + " ",
+			wantMatch:  "деплой",
+			wantAfter:  " " + strings.Repeat("а", snippetContext-1) + "…",
+		},
+		{
+			name:      "Совпадения нет",
+			body:      "деплои прошли",
+			query:     "деплой",
+			wantAfter: "деплои прошли",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			before, match, after := searchSnippet(tt.body, tt.query)
+			assert.Equal(t, tt.wantBefore, before)
+			assert.Equal(t, tt.wantMatch, match)
+			assert.Equal(t, tt.wantAfter, after)
+		})
+	}
+}
+
+func TestSearchJump(t *testing.T) {
+	if testing.Short() {
+		t.Skip("Skipping test in short mode")
+	}
+
+	searches := make(chan url.Values, 1)
+	mux := http.NewServeMux()
+	mux.HandleFunc("/v1/search", func(w http.ResponseWriter, r *http.Request) {
+		searches <- r.URL.Query()
+		json.NewEncoder(w).Encode(SearchResponse{
+			Query: r.URL.Query().Get("q"),
+			Results: []SearchResult{{
+				Chat:    "random",
+				Message: Message{ID: 30, Username: "bob", Body: "сообщение 30", Timestamp: time.Now()},
+			}},
+		})
+	})
+	mux.Handle("/", pagedHistory(120))
+	server := httptest.NewServer(mux)
+	defer server.Close()
+
+	chatApp := newTestChatApp(t, server.URL)
+	chatApp.window.Resize(fyne.NewSize(800, 600))
+	chatApp.state.AddChannel("random")
+	chatApp.fetchHistory()
+	chatApp.flush()
+
+	chatApp.showSearch()
+	chatApp.search.query.SetText("сообщение 30")
+	chatApp.search.author.SetText("bob")
+	chatApp.search.from.SetText("01.10.2026")
+	chatApp.search.to.SetText("19.10.2026")
+	chatApp.runSearch()
+	chatApp.flush()
+
+	query := <-searches
+	assert.Equal(t, []string{defaultChat, "random"}, query["chat"], "поиск по всем каналам")
+	assert.Equal(t, "bob", query.Get("author"))
+	assert.NotEmpty(t, query.Get("from"))
+	assert.NotEmpty(t, query.Get("to"))
+	assert.Equal(t, "Найдено: 1", chatApp.search.status.Text)
+
+	chatApp.search.list.Select(0)
+	chatApp.flush()
+
+	assert.Equal(t, "random", chatApp.state.Channel())
+	assert.Equal(t, int64(30), chatApp.highlighted.Load())
+	index := chatApp.state.Index(30)
+	require.GreaterOrEqual(t, index, 0, "страница вокруг сообщения загружена")
+	assert.True(t, chatApp.state.HasNewer())
+	assert.True(t, chatApp.jumpButton.Visible())
+
+	first, last := visibleIDs(t, chatApp)
+	assert.LessOrEqual(t, first, int64(30))
+	assert.GreaterOrEqual(t, last, int64(30), "найденное сообщение видно")
+
+	highlighted := 0
+	chatApp.rowsMu.Lock()
+	for row, id := range chatApp.rows {
+		if row.(*fyne.Container).Objects[0].Visible() {
+			highlighted++
+			assert.Equal(t, index, id, "выделено найденное сообщение")
+		}
+	}
+	chatApp.rowsMu.Unlock()
+	assert.Equal(t, 1, highlighted)
+}
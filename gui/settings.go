@@ -0,0 +1,494 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"fyne.io/fyne/v2"
+	"fyne.io/fyne/v2/container"
+	"fyne.io/fyne/v2/dialog"
+	"fyne.io/fyne/v2/theme"
+	"fyne.io/fyne/v2/widget"
+
+	"team-bunny-chat/bunnychat"
+
+	"github.com/team-bunny-chat/gui/internal/state"
+)
+
+// Ключи настроек приложения (fyne.Preferences). Пароли сюда не попадают:
+// они хранятся в отдельном файле, см. Credentials.
+const (
+	prefUsername     = "username"
+	prefServer       = "server"
+	prefRabbitMQ     = "rabbitmq"
+	prefTheme        = "theme"
+	prefChannels     = "channels"
+	prefMuted        = "muted_channels"
+	prefNotifyLevels = "notify_levels"
+	prefDND          = "dnd_enabled"
+	prefDNDFrom      = "dnd_from"
+	prefDNDTo        = "dnd_to"
+	prefLastChannel  = "last_channel"
+	prefWindowWidth  = "window_width"
+	prefWindowHeight = "window_height"
+)
+
+const (
+	themeDark  = "dark"
+	themeLight = "light"
+)
+
+var themeNames = map[string]string{
+	themeDark:  "Темная",
+	themeLight: "Светлая",
+}
+
+// Credentials — логин и пароль RabbitMQ. Пустой логин означает guest.
+type Credentials struct {
+	User     string `json:"rabbitmq_user,omitempty"`
+	Password string `json:"rabbitmq_password,omitempty"`
+}
+
+// credentialsPath возвращает путь к файлу с паролями: $BUNNY_GUI_CREDENTIALS
+// или каталог настроек пользователя/bunnychat/gui-credentials.json.
+func credentialsPath() (string, error) {
+	if path := os.Getenv("BUNNY_GUI_CREDENTIALS"); path != "" {
+		return path, nil
+	}
+	dir, err := os.UserConfigDir()
+	if err != nil {
+		return "", fmt.Errorf("не удалось определить каталог настроек: %w", err)
+	}
+	return filepath.Join(dir, "bunnychat", "gui-credentials.json"), nil
+}
+
+// loadCredentials читает файл с паролями. Отсутствующий файл — не ошибка.
+func loadCredentials(path string) (Credentials, error) {
+	var creds Credentials
+	data, err := os.ReadFile(path)
+	if errors.Is(err, os.ErrNotExist) {
+		return creds, nil
+	}
+	if err != nil {
+		return creds, fmt.Errorf("ошибка чтения учетных данных: %w", err)
+	}
+	if err := json.Unmarshal(data, &creds); err != nil {
+		return creds, fmt.Errorf("ошибка в файле учетных данных %s: %w", path, err)
+	}
+	return creds, nil
+}
+
+// saveCredentials записывает пароли в файл, доступный только владельцу.
+func saveCredentials(path string, creds Credentials) error {
+	data, err := json.MarshalIndent(creds, "", "  ")
+	if err != nil {
+		return fmt.Errorf("ошибка сериализации учетных данных: %w", err)
+	}
+	return writePrivateFile(path, data)
+}
+
+// writePrivateFile записывает файл, доступный только владельцу.
+func writePrivateFile(path string, data []byte) error {
+	if err := os.MkdirAll(filepath.Dir(path), 0o700); err != nil {
+		return fmt.Errorf("ошибка создания каталога настроек: %w", err)
+	}
+	if err := os.WriteFile(path, data, 0o600); err != nil {
+		return fmt.Errorf("ошибка записи учетных данных: %w", err)
+	}
+	// WriteFile не меняет права уже существующего файла.
+	if err := os.Chmod(path, 0o600); err != nil {
+		return fmt.Errorf("ошибка записи учетных данных: %w", err)
+	}
+	return nil
+}
+
+func brokerURL(host string, creds Credentials) string {
+	user, password := creds.User, creds.Password
+	if user == "" {
+		user, password = "guest", "guest"
+	}
+	u := url.URL{Scheme: "amqp", User: url.UserPassword(user, password), Host: host, Path: "/"}
+	return u.String()
+}
+
+// brokerParts разбирает URL RabbitMQ на адрес и учетные данные.
+func brokerParts(rabbitMQURL string) (string, Credentials) {
+	u, err := url.Parse(rabbitMQURL)
+	if err != nil {
+		return "", Credentials{}
+	}
+	var creds Credentials
+	if u.User != nil && u.User.Username() != "guest" {
+		creds.User = u.User.Username()
+		creds.Password, _ = u.User.Password()
+	}
+	return u.Host, creds
+}
+
+// sharedSettings — файл для новых участников команды: адреса серверов,
+// каналы и тема. Имя пользователя и пароли в него не выгружаются.
+type sharedSettings struct {
+	Server   string   `json:"server,omitempty"`
+	RabbitMQ string   `json:"rabbitmq,omitempty"`
+	Channels []string `json:"channels,omitempty"`
+	Theme    string   `json:"theme,omitempty"`
+}
+
+// loadSettings заполняет параметры подключения и тему из настроек
+// приложения. Адреса из переменных окружения (и флагов) важнее
+// сохраненных.
+func (c *ChatApp) loadSettings(credsPath string) {
+	prefs := c.app.Preferences()
+	c.credentialsPath = credsPath
+
+	c.username = prefs.String(prefUsername)
+
+	server := os.Getenv("CHAT_SERVER")
+	if server == "" {
+		server = prefs.StringWithFallback(prefServer, defaultServer)
+	}
+	c.serverURL = serverBaseURL(server)
+
+	rabbitMQ := os.Getenv("CHAT_RABBITMQ")
+	if rabbitMQ == "" {
+		rabbitMQ = prefs.StringWithFallback(prefRabbitMQ, defaultRabbitMQ)
+	}
+	var creds Credentials
+	if credsPath != "" {
+		var err error
+		if creds, err = loadCredentials(credsPath); err != nil {
+			log.Printf("%v", err)
+		}
+	}
+	c.rabbitMQURL = brokerURL(rabbitMQ, creds)
+
+	c.theme = prefs.StringWithFallback(prefTheme, themeDark)
+	c.applyTheme()
+
+	dnd := defaultQuietHours
+	dnd.enabled = prefs.Bool(prefDND)
+	if from, err := parseClock(prefs.String(prefDNDFrom)); err == nil {
+		dnd.from = from
+	}
+	if to, err := parseClock(prefs.String(prefDNDTo)); err == nil {
+		dnd.to = to
+	}
+	c.dnd.Store(&dnd)
+}
+
+// restoreWindow возвращает окну прежний размер и запоминает новый при
+// закрытии. Вызывается после initUI: размер, заданный до содержимого
+// окна, может не сохраниться.
+func (c *ChatApp) restoreWindow() {
+	prefs := c.app.Preferences()
+	c.window.Resize(fyne.NewSize(
+		float32(prefs.FloatWithFallback(prefWindowWidth, 800)),
+		float32(prefs.FloatWithFallback(prefWindowHeight, 600)),
+	))
+	c.window.SetCloseIntercept(func() {
+		c.saveWindowSize()
+		c.window.Close()
+	})
+}
+
+// saveSettings сохраняет параметры подключения и тему; пароли уходят в
+// отдельный файл.
+func (c *ChatApp) saveSettings() error {
+	c.mu.RLock()
+	username, server := c.username, serverAddress(c.serverURL)
+	rabbitMQ, creds := brokerParts(c.rabbitMQURL)
+	c.mu.RUnlock()
+
+	prefs := c.app.Preferences()
+	prefs.SetString(prefUsername, username)
+	prefs.SetString(prefServer, server)
+	prefs.SetString(prefRabbitMQ, rabbitMQ)
+	prefs.SetString(prefTheme, c.theme)
+
+	if c.credentialsPath == "" {
+		return nil
+	}
+	return saveCredentials(c.credentialsPath, creds)
+}
+
+func (c *ChatApp) saveWindowSize() {
+	size := c.window.Canvas().Size()
+	prefs := c.app.Preferences()
+	prefs.SetFloat(prefWindowWidth, float64(size.Width))
+	prefs.SetFloat(prefWindowHeight, float64(size.Height))
+}
+
+func (c *ChatApp) applyTheme() {
+	setTheme := c.app.Settings().SetTheme
+	if c.setTheme != nil {
+		setTheme = c.setTheme
+	}
+	if c.theme == themeLight {
+		setTheme(theme.LightTheme())
+	} else {
+		setTheme(theme.DarkTheme())
+	}
+}
+
+// loadChannels восстанавливает список каналов прошлого запуска и канал,
+// открытый последним (если его нет в списке — первый).
+func (c *ChatApp) loadChannels() {
+	prefs := c.app.Preferences()
+	channels := prefs.StringList(prefChannels)
+	current := prefs.String(prefLastChannel)
+	if len(channels) > 0 && !containsString(channels, current) {
+		current = channels[0]
+	}
+	if current != "" {
+		c.state.Switch(current)
+	}
+	c.state.Restore(channels, prefs.StringList(prefMuted))
+
+	// Уровни уведомлений хранятся строками «уровень:канал»: в названии
+	// канала двоеточие бывает (личная переписка), а в уровне — нет.
+	levels := make(map[string]state.NotifyLevel)
+	for _, entry := range prefs.StringList(prefNotifyLevels) {
+		if level, channelName, ok := strings.Cut(entry, ":"); ok {
+			levels[channelName] = state.NotifyLevel(level)
+		}
+	}
+	c.state.RestoreNotifyLevels(levels)
+}
+
+func (c *ChatApp) saveChannels() {
+	prefs := c.app.Preferences()
+	prefs.SetStringList(prefChannels, c.state.Channels())
+	prefs.SetStringList(prefMuted, c.state.MutedChannels())
+	levels := c.state.NotifyLevels()
+	var entries []string
+	for _, channelName := range c.state.Channels() {
+		if level, ok := levels[channelName]; ok {
+			entries = append(entries, string(level)+":"+channelName)
+		}
+	}
+	prefs.SetStringList(prefNotifyLevels, entries)
+	prefs.SetString(prefLastChannel, c.state.Channel())
+}
+
+// serverBaseURL приводит адрес сервера истории к базовому URL, как это
+// делает bunnychat.NewAPI: без схемы подставляется http://, а https://
+// сохраняется.
+func serverBaseURL(server string) string {
+	return bunnychat.NewAPI(strings.TrimSpace(server), "").BaseURL
+}
+
+// serverAddress — адрес сервера для полей ввода и подписей: http://
+// опускается, а https:// остается, чтобы не потерять его при сохранении.
+func serverAddress(baseURL string) string {
+	return strings.TrimPrefix(baseURL, "http://")
+}
+
+// applyConnection меняет параметры подключения и сообщает, изменились ли
+// они.
+func (c *ChatApp) applyConnection(username, server, rabbitMQ string, creds Credentials) bool {
+	serverURL, rabbitMQURL := serverBaseURL(server), brokerURL(rabbitMQ, creds)
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	changed := username != c.username || serverURL != c.serverURL || rabbitMQURL != c.rabbitMQURL
+	c.username, c.serverURL, c.rabbitMQURL = username, serverURL, rabbitMQURL
+	return changed
+}
+
+func (c *ChatApp) showSettingsDialog() {
+	c.mu.RLock()
+	username, server := c.username, serverAddress(c.serverURL)
+	rabbitMQ, creds := brokerParts(c.rabbitMQURL)
+	c.mu.RUnlock()
+
+	rabbitMQEntry := widget.NewEntry()
+	rabbitMQEntry.SetText(rabbitMQ)
+
+	loginEntry := widget.NewEntry()
+	loginEntry.SetPlaceHolder("guest")
+	loginEntry.SetText(creds.User)
+
+	passwordEntry := widget.NewPasswordEntry()
+	passwordEntry.SetText(creds.Password)
+
+	themeSelect := widget.NewSelect([]string{themeNames[themeDark], themeNames[themeLight]}, nil)
+	themeSelect.SetSelected(themeNames[c.theme])
+
+	dnd := c.quietHours()
+	dndCheck := widget.NewCheck("с", nil)
+	dndCheck.SetChecked(dnd.enabled)
+	dndFromEntry := widget.NewEntry()
+	dndFromEntry.SetText(formatClock(dnd.from))
+	dndToEntry := widget.NewEntry()
+	dndToEntry.SetText(formatClock(dnd.to))
+	dndFromEntry.SetPlaceHolder("ЧЧ:ММ")
+	dndToEntry.SetPlaceHolder("ЧЧ:ММ")
+
+	form := widget.NewForm(
+		widget.NewFormItem("Сервер RabbitMQ", rabbitMQEntry),
+		widget.NewFormItem("Логин RabbitMQ", loginEntry),
+		widget.NewFormItem("Пароль RabbitMQ", passwordEntry),
+		widget.NewFormItem("Тема", themeSelect),
+		widget.NewFormItem("Не беспокоить", container.NewGridWithColumns(4, dndCheck, dndFromEntry, widget.NewLabel("до"), dndToEntry)),
+	)
+
+	transfer := container.NewHBox(
+		widget.NewButtonWithIcon("Экспорт…", theme.DocumentSaveIcon(), c.showExportDialog),
+		widget.NewButtonWithIcon("Импорт…", theme.FolderOpenIcon(), c.showImportDialog),
+	)
+
+	dialog.ShowCustomConfirm("Настройки", "Сохранить", "Отмена", container.NewVBox(form, transfer), func(ok bool) {
+		if !ok {
+			return
+		}
+
+		// Имя пользователя и сервер истории задает аккаунт, см.
+		// showAccountMenu.
+		changed := c.applyConnection(username, server, strings.TrimSpace(rabbitMQEntry.Text),
+			Credentials{User: strings.TrimSpace(loginEntry.Text), Password: passwordEntry.Text})
+
+		for name, title := range themeNames {
+			if title == themeSelect.Selected {
+				c.theme = name
+			}
+		}
+		c.applyTheme()
+
+		if err := c.applyQuietHours(dndCheck.Checked, dndFromEntry.Text, dndToEntry.Text); err != nil {
+			dialog.ShowError(err, c.window)
+		}
+		if err := c.saveSettings(); err != nil {
+			dialog.ShowError(err, c.window)
+		}
+		if changed {
+			c.reconnect()
+		}
+	}, c.window)
+}
+
+// exportSettings записывает общие для команды настройки в w.
+func (c *ChatApp) exportSettings(w io.Writer) error {
+	c.mu.RLock()
+	server := serverAddress(c.serverURL)
+	rabbitMQ, _ := brokerParts(c.rabbitMQURL)
+	c.mu.RUnlock()
+
+	enc := json.NewEncoder(w)
+	enc.SetIndent("", "  ")
+	return enc.Encode(sharedSettings{
+		Server:   server,
+		RabbitMQ: rabbitMQ,
+		Channels: c.state.Channels(),
+		Theme:    c.theme,
+	})
+}
+
+// importSettings применяет настройки из файла экспорта: меняет адреса
+// серверов и тему и добавляет каналы, которых еще нет в списке. Имя
+// пользователя и пароли остаются прежними.
+func (c *ChatApp) importSettings(r io.Reader) error {
+	var shared sharedSettings
+	if err := json.NewDecoder(r).Decode(&shared); err != nil {
+		return fmt.Errorf("некорректный файл настроек: %w", err)
+	}
+	if shared.Theme != "" {
+		if _, ok := themeNames[shared.Theme]; !ok {
+			return fmt.Errorf("неизвестная тема %q", shared.Theme)
+		}
+	}
+
+	c.mu.RLock()
+	username, server := c.username, serverAddress(c.serverURL)
+	rabbitMQ, creds := brokerParts(c.rabbitMQURL)
+	c.mu.RUnlock()
+	// Токен действует только на своем сервере, поэтому, пока открыт
+	// аккаунт, адрес сервера истории из файла не применяется.
+	if shared.Server != "" && c.currentAccount() == nil {
+		server = shared.Server
+	}
+	if shared.RabbitMQ != "" {
+		rabbitMQ = shared.RabbitMQ
+	}
+	changed := c.applyConnection(username, server, rabbitMQ, creds)
+
+	if shared.Theme != "" {
+		c.theme = shared.Theme
+		c.applyTheme()
+	}
+
+	for _, channelName := range shared.Channels {
+		if channelName = strings.TrimSpace(channelName); channelName != "" {
+			c.state.AddChannel(channelName)
+		}
+	}
+	c.saveChannels()
+	c.do(c.refreshChannelList)
+
+	if err := c.saveSettings(); err != nil {
+		return err
+	}
+	if changed {
+		c.reconnect()
+	} else if client := c.currentClient(); client != nil {
+		for _, channelName := range c.state.Channels() {
+			if err := client.Join(channelName); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+func (c *ChatApp) showExportDialog() {
+	save := dialog.NewFileSave(func(w fyne.URIWriteCloser, err error) {
+		if err != nil {
+			dialog.ShowError(err, c.window)
+			return
+		}
+		if w == nil {
+			return
+		}
+		defer w.Close()
+		if err := c.exportSettings(w); err != nil {
+			dialog.ShowError(err, c.window)
+			return
+		}
+		c.setStatus("Настройки выгружены в " + w.URI().Name())
+	}, c.window)
+	save.SetFileName("bunnychat-settings.json")
+	save.Show()
+}
+
+func (c *ChatApp) showImportDialog() {
+	dialog.ShowFileOpen(func(r fyne.URIReadCloser, err error) {
+		if err != nil {
+			dialog.ShowError(err, c.window)
+			return
+		}
+		if r == nil {
+			return
+		}
+		defer r.Close()
+		if err := c.importSettings(r); err != nil {
+			dialog.ShowError(err, c.window)
+			return
+		}
+		c.setStatus("Настройки загружены из " + r.URI().Name())
+	}, c.window)
+}
+
+func containsString(items []string, item string) bool {
+	for _, i := range items {
+		if i == item {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,216 @@
+package main
+
+import (
+	"fmt"
+	"strings"
+
+	"fyne.io/fyne/v2"
+	"fyne.io/fyne/v2/container"
+	"fyne.io/fyne/v2/dialog"
+	"fyne.io/fyne/v2/theme"
+	"fyne.io/fyne/v2/widget"
+
+	"team-bunny-chat/bunnychat"
+
+	"github.com/team-bunny-chat/gui/internal/state"
+)
+
+// channelBadge — счетчик справа от названия канала. Упоминания
+// показываются всегда, непрочитанные — только у каналов со звуком.
+func channelBadge(unread, mentions int, muted bool) string {
+	switch {
+	case mentions > 0:
+		return fmt.Sprintf("@%d", mentions)
+	case unread > 0 && !muted:
+		return fmt.Sprintf("%d", unread)
+	default:
+		return ""
+	}
+}
+
+// newChannelList строит боковую панель каналов. Строка: значок
+// выключенного звука, название, счетчик и меню действий с каналом.
+func (c *ChatApp) newChannelList() *widget.List {
+	list := widget.NewList(
+		func() int {
+			return len(c.state.Channels())
+		},
+		func() fyne.CanvasObject {
+			muted := widget.NewIcon(theme.VolumeMuteIcon())
+			name := widget.NewLabel("")
+			name.Truncation = fyne.TextTruncateEllipsis
+			badge := widget.NewLabelWithStyle("", fyne.TextAlignTrailing, fyne.TextStyle{Bold: true})
+			menu := &widget.Button{Icon: theme.MoreVerticalIcon(), Importance: widget.LowImportance}
+			return container.NewBorder(nil, nil, muted, container.NewHBox(badge, menu), name)
+		},
+		func(id widget.ListItemID, obj fyne.CanvasObject) {
+			channels := c.state.Channels()
+			if id >= len(channels) {
+				return
+			}
+			channelName := channels[id]
+			row := obj.(*fyne.Container)
+			name := row.Objects[0].(*widget.Label)
+			mutedIcon := row.Objects[1].(*widget.Icon)
+			right := row.Objects[2].(*fyne.Container)
+			badge := right.Objects[0].(*widget.Label)
+			menu := right.Objects[1].(*widget.Button)
+
+			unread, mentions := c.state.Unread(channelName), c.state.Mentions(channelName)
+			muted := c.state.Muted(channelName)
+
+			name.TextStyle.Bold = mentions > 0 || (unread > 0 && !muted)
+			switch {
+			case mentions > 0:
+				name.Importance = widget.HighImportance
+			case muted:
+				name.Importance = widget.LowImportance
+			default:
+				name.Importance = widget.MediumImportance
+			}
+			name.SetText(c.channelTitle(channelName))
+
+			if muted {
+				mutedIcon.Show()
+			} else {
+				mutedIcon.Hide()
+			}
+			badge.SetText(channelBadge(unread, mentions, muted))
+			menu.OnTapped = func() {
+				c.showChannelMenu(channelName, menu)
+			}
+		},
+	)
+	list.OnSelected = func(id widget.ListItemID) {
+		channels := c.state.Channels()
+		if !c.selecting.Load() && id < len(channels) && channels[id] != c.state.Channel() {
+			c.switchChannel(channels[id])
+		}
+	}
+	return list
+}
+
+// refreshChannelList перерисовывает боковую панель и выделяет текущий
+// канал.
+func (c *ChatApp) refreshChannelList() {
+	c.showUnread()
+	current := c.state.Channel()
+	for i, name := range c.state.Channels() {
+		if name == current {
+			c.selecting.Store(true)
+			c.channelList.Select(i)
+			c.selecting.Store(false)
+			return
+		}
+	}
+}
+
+func (c *ChatApp) showChannelMenu(channelName string, anchor fyne.CanvasObject) {
+	muteLabel := "Выключить звук"
+	if c.state.Muted(channelName) {
+		muteLabel = "Включить звук"
+	}
+	menu := fyne.NewMenu("",
+		fyne.NewMenuItem("Выше", func() { c.moveChannel(channelName, -1) }),
+		fyne.NewMenuItem("Ниже", func() { c.moveChannel(channelName, 1) }),
+		fyne.NewMenuItem(muteLabel, func() { c.toggleMute(channelName) }),
+		fyne.NewMenuItemSeparator(),
+		c.notifyLevelItem(channelName, state.NotifyAll),
+		c.notifyLevelItem(channelName, state.NotifyMentions),
+		c.notifyLevelItem(channelName, state.NotifyNone),
+		fyne.NewMenuItemSeparator(),
+		fyne.NewMenuItem("Покинуть канал", func() { c.leaveChannel(channelName) }),
+	)
+	pos := c.app.Driver().AbsolutePositionForObject(anchor).Add(fyne.NewPos(0, anchor.Size().Height))
+	widget.ShowPopUpMenuAtPosition(menu, c.window.Canvas(), pos)
+}
+
+// notifyLevelItem — пункт меню канала, выбирающий уровень уведомлений;
+// текущий уровень отмечен.
+func (c *ChatApp) notifyLevelItem(channelName string, level state.NotifyLevel) *fyne.MenuItem {
+	item := fyne.NewMenuItem("Уведомления: "+notifyLevelNames[level], func() {
+		c.setNotifyLevel(channelName, level)
+	})
+	item.Checked = c.notifyLevel(channelName) == level
+	return item
+}
+
+func (c *ChatApp) showAddChannelDialog() {
+	entry := widget.NewEntry()
+	entry.SetPlaceHolder("Введите название канала")
+
+	dialog.ShowCustomConfirm("Новый канал", "Добавить", "Отмена", entry, func(ok bool) {
+		if channelName := strings.TrimSpace(entry.Text); ok && channelName != "" {
+			c.joinChannel(channelName)
+		}
+	}, c.window)
+}
+
+// joinChannel подписывается на канал, добавляет его в список и делает
+// текущим.
+func (c *ChatApp) joinChannel(channelName string) {
+	if client := c.currentClient(); client != nil {
+		if err := client.Join(channelName); err != nil {
+			c.setStatus(err.Error())
+			return
+		}
+	}
+	if c.state.AddChannel(channelName) {
+		c.saveChannels()
+	}
+	c.switchChannel(channelName)
+}
+
+// leaveChannel отписывается от канала и убирает его из списка. Если это
+// текущий канал, сначала переключаемся на соседний; последний канал
+// покинуть нельзя.
+func (c *ChatApp) leaveChannel(channelName string) {
+	channels := c.state.Channels()
+	if len(channels) < 2 {
+		c.setStatus("Нельзя покинуть единственный канал")
+		return
+	}
+	if channelName == c.state.Channel() {
+		next := channels[0]
+		if next == channelName {
+			next = channels[1]
+		}
+		c.switchChannel(next)
+	}
+
+	if client := c.currentClient(); client != nil {
+		if err := client.Leave(channelName); err != nil {
+			c.setStatus(err.Error())
+			return
+		}
+	}
+	c.state.Remove(channelName)
+	c.saveChannels()
+	c.do(c.refreshChannelList)
+	c.setStatus(fmt.Sprintf("Вы покинули канал: %s", channelName))
+}
+
+func (c *ChatApp) moveChannel(channelName string, delta int) {
+	if c.state.Move(channelName, delta) {
+		c.saveChannels()
+		c.do(c.refreshChannelList)
+	}
+}
+
+func (c *ChatApp) toggleMute(channelName string) {
+	c.state.SetMuted(channelName, !c.state.Muted(channelName))
+	c.saveChannels()
+	c.do(c.showUnread)
+}
+
+// countIncoming учитывает сообщение из другого канала в счетчиках боковой
+// панели.
+func (c *ChatApp) countIncoming(msg Message) {
+	username := c.currentUsername()
+	if msg.Username == username {
+		return
+	}
+	if c.state.Incoming(msg.ChatName, bunnychat.MentionsUser(msg.Body, username)) {
+		c.do(c.showUnread)
+	}
+}
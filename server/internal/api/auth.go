@@ -0,0 +1,253 @@
+package api
+
+import (
+	"errors"
+	"log"
+	"net/http"
+	"strings"
+	"unicode/utf8"
+
+	"team-bunny-chat/server/internal/models"
+
+	"github.com/gin-gonic/gin"
+)
+
+const (
+	maxUsernameLength = 32
+	minPasswordLength = 8
+	// bcrypt учитывает только первые 72 байта пароля.
+	maxPasswordLength = 72
+	maxProfileLength  = 250
+
+	// authUserKey — под этим ключом Authenticate кладет в контекст
+	// запроса имя владельца токена.
+	authUserKey = "auth_user"
+)
+
+type credentialsRequest struct {
+	Username string `json:"username"`
+	Password string `json:"password"`
+}
+
+func (h *Handler) Register(c *gin.Context) {
+	var request credentialsRequest
+	if err := c.ShouldBindJSON(&request); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid request body"})
+		return
+	}
+	if !models.ValidUsername(request.Username) || utf8.RuneCountInString(request.Username) > maxUsernameLength {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid username"})
+		return
+	}
+	if utf8.RuneCountInString(request.Password) < minPasswordLength || len(request.Password) > maxPasswordLength {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "password must be 8 to 72 bytes long"})
+		return
+	}
+
+	user, err := models.CreateUser(h.db, request.Username, request.Password)
+	if errors.Is(err, models.ErrUserExists) {
+		c.JSON(http.StatusConflict, gin.H{"error": "username is already taken"})
+		return
+	}
+	if err != nil {
+		log.Printf("Ошибка при регистрации пользователя %s: %v", request.Username, err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "internal server error"})
+		return
+	}
+	log.Printf("Зарегистрирован пользователь %s", user.Username)
+
+	h.startSession(c, http.StatusCreated, user)
+}
+
+func (h *Handler) Login(c *gin.Context) {
+	var request credentialsRequest
+	if err := c.ShouldBindJSON(&request); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid request body"})
+		return
+	}
+
+	user, err := models.Authenticate(h.db, request.Username, request.Password)
+	if errors.Is(err, models.ErrInvalidCredentials) {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "invalid username or password"})
+		return
+	}
+	if err != nil {
+		log.Printf("Ошибка при входе пользователя %s: %v", request.Username, err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "internal server error"})
+		return
+	}
+
+	h.startSession(c, http.StatusOK, user)
+}
+
+func (h *Handler) startSession(c *gin.Context, status int, user *models.User) {
+	session, err := models.CreateSession(h.db, user.Username)
+	if err != nil {
+		log.Printf("Ошибка при создании сеанса %s: %v", user.Username, err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "internal server error"})
+		return
+	}
+	c.JSON(status, sessionResponse(user, session))
+}
+
+func sessionResponse(user *models.User, session *models.Session) gin.H {
+	return gin.H{
+		"user":          user,
+		"access_token":  session.AccessToken,
+		"refresh_token": session.RefreshToken,
+		"expires_at":    session.ExpiresAt,
+	}
+}
+
+// Refresh обменивает токен обновления на новую пару токенов.
+func (h *Handler) Refresh(c *gin.Context) {
+	var request struct {
+		RefreshToken string `json:"refresh_token"`
+	}
+	if err := c.ShouldBindJSON(&request); err != nil || request.RefreshToken == "" {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "refresh_token is required"})
+		return
+	}
+
+	session, err := models.RefreshSession(h.db, request.RefreshToken)
+	if errors.Is(err, models.ErrInvalidToken) {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "invalid or expired refresh token"})
+		return
+	}
+	if err != nil {
+		log.Printf("Ошибка при обновлении токена: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "internal server error"})
+		return
+	}
+
+	user, err := models.GetUser(h.db, session.Username)
+	if err != nil {
+		log.Printf("Ошибка при получении пользователя %s: %v", session.Username, err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "internal server error"})
+		return
+	}
+	c.JSON(http.StatusOK, sessionResponse(user, session))
+}
+
+func (h *Handler) Logout(c *gin.Context) {
+	if _, ok := requireUser(c); !ok {
+		return
+	}
+	if err := models.DeleteSession(h.db, bearerToken(c)); err != nil {
+		log.Printf("Ошибка при выходе: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "internal server error"})
+		return
+	}
+	c.Status(http.StatusNoContent)
+}
+
+func (h *Handler) GetProfile(c *gin.Context) {
+	username, ok := requireUser(c)
+	if !ok {
+		return
+	}
+	user, err := models.GetUser(h.db, username)
+	if err != nil {
+		log.Printf("Ошибка при получении профиля %s: %v", username, err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "internal server error"})
+		return
+	}
+	c.JSON(http.StatusOK, user)
+}
+
+func (h *Handler) UpdateProfile(c *gin.Context) {
+	username, ok := requireUser(c)
+	if !ok {
+		return
+	}
+
+	var profile models.Profile
+	if err := c.ShouldBindJSON(&profile); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid request body"})
+		return
+	}
+	for _, field := range []string{profile.DisplayName, profile.AvatarURL, profile.Status} {
+		if utf8.RuneCountInString(field) > maxProfileLength {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "profile fields must be at most 250 characters"})
+			return
+		}
+	}
+
+	user, err := models.UpdateProfile(h.db, username, profile)
+	if err != nil {
+		log.Printf("Ошибка при сохранении профиля %s: %v", username, err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "internal server error"})
+		return
+	}
+	c.JSON(http.StatusOK, user)
+}
+
+// Authenticate проверяет токен из заголовка Authorization. Без токена
+// запрос проходит от имени параметра user, только если это имя не
+// зарегистрировано, — так продолжают работать клиенты без входа. С
+// токеном параметр user, если он есть, должен совпадать с его владельцем.
+func (h *Handler) Authenticate(c *gin.Context) {
+	token := bearerToken(c)
+	if token == "" {
+		if user := c.Query("user"); user != "" {
+			registered, err := models.UserExists(h.db, user)
+			if err != nil {
+				log.Printf("Ошибка при проверке пользователя %s: %v", user, err)
+				c.AbortWithStatusJSON(http.StatusInternalServerError, gin.H{"error": "internal server error"})
+				return
+			}
+			if registered {
+				c.AbortWithStatusJSON(http.StatusUnauthorized, gin.H{"error": "authorization required"})
+				return
+			}
+		}
+		c.Next()
+		return
+	}
+
+	username, err := models.SessionUser(h.db, token)
+	if errors.Is(err, models.ErrInvalidToken) {
+		c.AbortWithStatusJSON(http.StatusUnauthorized, gin.H{"error": "invalid or expired token"})
+		return
+	}
+	if err != nil {
+		log.Printf("Ошибка при проверке токена: %v", err)
+		c.AbortWithStatusJSON(http.StatusInternalServerError, gin.H{"error": "internal server error"})
+		return
+	}
+	if user := c.Query("user"); user != "" && user != username {
+		c.AbortWithStatusJSON(http.StatusForbidden, gin.H{"error": "token belongs to another user"})
+		return
+	}
+
+	c.Set(authUserKey, username)
+	c.Next()
+}
+
+// requestUser возвращает, от чьего имени пришел запрос: владельца токена,
+// а без токена — параметр user, уже проверенный в Authenticate.
+func requestUser(c *gin.Context) string {
+	if username := c.GetString(authUserKey); username != "" {
+		return username
+	}
+	return c.Query("user")
+}
+
+// requireUser возвращает владельца токена, а если токена нет — отвечает
+// 401.
+func requireUser(c *gin.Context) (string, bool) {
+	username := c.GetString(authUserKey)
+	if username == "" {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "authorization required"})
+		return "", false
+	}
+	return username, true
+}
+
+func bearerToken(c *gin.Context) string {
+	token, ok := strings.CutPrefix(c.GetHeader("Authorization"), "Bearer ")
+	if !ok {
+		return ""
+	}
+	return strings.TrimSpace(token)
+}
@@ -0,0 +1,149 @@
+package api
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"team-bunny-chat/server/internal/models"
+
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/assert"
+)
+
+type sessionBody struct {
+	User struct {
+		Username    string `json:"username"`
+		DisplayName string `json:"display_name"`
+		Status      string `json:"status"`
+	} `json:"user"`
+	AccessToken  string `json:"access_token"`
+	RefreshToken string `json:"refresh_token"`
+}
+
+func serve(router *gin.Engine, method, url, token, body string) *httptest.ResponseRecorder {
+	w := httptest.NewRecorder()
+	req, _ := http.NewRequest(method, url, strings.NewReader(body))
+	if token != "" {
+		req.Header.Set("Authorization", "Bearer "+token)
+	}
+	router.ServeHTTP(w, req)
+	return w
+}
+
+func TestRegisterAndLogin(t *testing.T) {
+	handler, cleanup := setupTestDB(t)
+	defer cleanup()
+
+	gin.SetMode(gin.TestMode)
+	router := gin.New()
+	SetupRoutes(router, handler)
+
+	tests := []struct {
+		name           string
+		url            string
+		body           string
+		expectedStatus int
+	}{
+		{"Регистрация", "/v1/auth/register", `{"username": "alice", "password": "пароль123"}`, http.StatusCreated},
+		{"Имя занято", "/v1/auth/register", `{"username": "alice", "password": "пароль456"}`, http.StatusConflict},
+		{"Недопустимое имя", "/v1/auth/register", `{"username": "a:b", "password": "пароль123"}`, http.StatusBadRequest},
+		{"Короткий пароль", "/v1/auth/register", `{"username": "bob", "password": "123"}`, http.StatusBadRequest},
+		{"Неверный пароль", "/v1/auth/login", `{"username": "alice", "password": "пароль456"}`, http.StatusUnauthorized},
+		{"Неизвестный пользователь", "/v1/auth/login", `{"username": "bob", "password": "пароль123"}`, http.StatusUnauthorized},
+		{"Вход", "/v1/auth/login", `{"username": "alice", "password": "пароль123"}`, http.StatusOK},
+		{"Неверный токен обновления", "/v1/auth/refresh", `{"refresh_token": "нет"}`, http.StatusUnauthorized},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			w := serve(router, "POST", tt.url, "", tt.body)
+			assert.Equal(t, tt.expectedStatus, w.Code)
+		})
+	}
+
+	w := serve(router, "POST", "/v1/auth/login", "", `{"username": "alice", "password": "пароль123"}`)
+	var session sessionBody
+	assert.NoError(t, json.Unmarshal(w.Body.Bytes(), &session))
+	assert.Equal(t, "alice", session.User.Username)
+	assert.NotEmpty(t, session.AccessToken)
+
+	w = serve(router, "POST", "/v1/auth/refresh", "", `{"refresh_token": "`+session.RefreshToken+`"}`)
+	assert.Equal(t, http.StatusOK, w.Code)
+	var refreshed sessionBody
+	assert.NoError(t, json.Unmarshal(w.Body.Bytes(), &refreshed))
+	assert.Equal(t, "alice", refreshed.User.Username)
+	assert.NotEqual(t, session.AccessToken, refreshed.AccessToken)
+
+	assert.Equal(t, http.StatusUnauthorized, serve(router, "GET", "/v1/profile", session.AccessToken, "").Code,
+		"старый токен после обновления не действует")
+
+	assert.Equal(t, http.StatusNoContent, serve(router, "POST", "/v1/auth/logout", refreshed.AccessToken, "").Code)
+	assert.Equal(t, http.StatusUnauthorized, serve(router, "GET", "/v1/profile", refreshed.AccessToken, "").Code)
+}
+
+func TestProfileAndAuthenticate(t *testing.T) {
+	handler, cleanup := setupTestDB(t)
+	defer cleanup()
+
+	gin.SetMode(gin.TestMode)
+	router := gin.New()
+	SetupRoutes(router, handler)
+
+	w := serve(router, "POST", "/v1/auth/register", "", `{"username": "alice", "password": "пароль123"}`)
+	var session sessionBody
+	assert.NoError(t, json.Unmarshal(w.Body.Bytes(), &session))
+	token := session.AccessToken
+
+	tests := []struct {
+		name           string
+		method         string
+		url            string
+		token          string
+		body           string
+		expectedStatus int
+	}{
+		{"Профиль без токена", "GET", "/v1/profile", "", "", http.StatusUnauthorized},
+		{"Профиль", "GET", "/v1/profile", token, "", http.StatusOK},
+		{"Слишком длинный статус", "PUT", "/v1/profile", token, `{"status": "` + strings.Repeat("я", 251) + `"}`, http.StatusBadRequest},
+		{"Изменение профиля", "PUT", "/v1/profile", token, `{"display_name": "Алиса", "status": "в отпуске"}`, http.StatusOK},
+		{"Незарегистрированное имя без токена, как раньше", "GET", "/v1/chats?user=bob", "", "", http.StatusOK},
+		{"Зарегистрированное имя без токена", "GET", "/v1/chats?user=alice", "", "", http.StatusUnauthorized},
+		{"Упоминания зарегистрированного без токена", "GET", "/v1/mentions?user=alice", "", "", http.StatusUnauthorized},
+		{"Отметка о прочтении за зарегистрированного без токена", "PUT", "/v1/chats/general/read?user=alice", "", `{"message_id": 1}`, http.StatusUnauthorized},
+		{"Изменение сообщения зарегистрированного без токена", "PUT", "/v1/chats/general/messages/1?user=alice", "", `{"body": "подделка"}`, http.StatusUnauthorized},
+		{"Закрепление от имени зарегистрированного без токена", "PUT", "/v1/chats/general/pins/1?user=alice", "", "", http.StatusUnauthorized},
+		{"Имя берется из токена", "GET", "/v1/mentions", token, "", http.StatusOK},
+		{"Запрос со своим токеном", "GET", "/v1/chats?user=alice", token, "", http.StatusOK},
+		{"Чужое имя с токеном", "GET", "/v1/chats?user=bob", token, "", http.StatusForbidden},
+		{"Неверный токен", "GET", "/v1/chats", "нет", "", http.StatusUnauthorized},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			w := serve(router, tt.method, tt.url, tt.token, tt.body)
+			assert.Equal(t, tt.expectedStatus, w.Code)
+		})
+	}
+
+	assert.NoError(t, models.SaveMessage(handler.db, "general", &models.Message{
+		Username: "alice", Body: "исходный текст", Timestamp: time.Now(),
+	}))
+	w = serve(router, "PUT", "/v1/chats/general/messages/1", token, `{"body": "исправленный текст"}`)
+	assert.Equal(t, http.StatusOK, w.Code, "автор определяется по токену, без параметра user")
+	msg, err := models.GetMessage(handler.db, "general", 1)
+	assert.NoError(t, err)
+	assert.Equal(t, "исправленный текст", msg.Body)
+
+	w = serve(router, "GET", "/v1/profile", token, "")
+	var profile struct {
+		DisplayName string `json:"display_name"`
+		Status      string `json:"status"`
+	}
+	assert.NoError(t, json.Unmarshal(w.Body.Bytes(), &profile))
+	assert.Equal(t, "Алиса", profile.DisplayName)
+	assert.Equal(t, "в отпуске", profile.Status)
+}
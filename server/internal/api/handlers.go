@@ -1,22 +1,40 @@
 package api
 
 import (
+	"crypto/rand"
 	"database/sql"
+	"encoding/hex"
+	"errors"
+	"io"
 	"log"
 	"net/http"
+	"os"
+	"path/filepath"
 	"strconv"
+	"strings"
+	"time"
 
 	"team-bunny-chat/server/internal/models"
+	"team-bunny-chat/server/internal/presence"
 
 	"github.com/gin-gonic/gin"
 )
 
+const (
+	maxTopicLength = 250
+	maxUploadSize  = 10 << 20
+)
+
 type Handler struct {
-	db *sql.DB
+	db        *sql.DB
+	roster    *presence.Roster
+	uploadDir string
 }
 
-func NewHandler(db *sql.DB) *Handler {
-	return &Handler{db: db}
+// NewHandler создает обработчики API. Загруженные изображения хранятся в
+// каталоге uploadDir.
+func NewHandler(db *sql.DB, roster *presence.Roster, uploadDir string) *Handler {
+	return &Handler{db: db, roster: roster, uploadDir: uploadDir}
 }
 
 func (h *Handler) GetChatHistory(c *gin.Context) {
@@ -49,27 +67,51 @@ func (h *Handler) GetChatHistory(c *gin.Context) {
 	}
 	log.Printf("Подключение к базе данных активно")
 
-	var tableCnt int
-	err = h.db.QueryRow("SELECT count(*) FROM sqlite_master WHERE type='table' AND name=?", "chat_"+chat).Scan(&tableCnt)
+	msgCnt, err := models.CountMessages(h.db, chat)
 	if err != nil {
-		log.Printf("Ошибка проверки таблицы: %v", err)
+		log.Printf("Ошибка подсчета сообщений: %v", err)
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "database error"})
 		return
 	}
-	log.Printf("Найдено таблиц: %d", tableCnt)
+	log.Printf("Найдено сообщений: %d", msgCnt)
 
-	if tableCnt > 0 {
-		var msgCnt int
-		err = h.db.QueryRow("SELECT count(*) FROM chat_" + chat).Scan(&msgCnt)
-		if err != nil {
-			log.Printf("Ошибка подсчета сообщений: %v", err)
-			c.JSON(http.StatusInternalServerError, gin.H{"error": "database error"})
-			return
+	sinceStr, beforeStr, afterStr := c.Query("since"), c.Query("before"), c.Query("after")
+	cursors := 0
+	for _, cursor := range []string{sinceStr, beforeStr, afterStr} {
+		if cursor != "" {
+			cursors++
 		}
-		log.Printf("Найдено сообщений: %d", msgCnt)
+	}
+	if cursors > 1 {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "since, before and after cannot be combined"})
+		return
 	}
 
-	messages, err := models.GetChatMessages(h.db, chat, limit)
+	var messages []models.Message
+	if sinceStr != "" {
+		since, parseErr := time.Parse(time.RFC3339, sinceStr)
+		if parseErr != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "invalid since parameter"})
+			return
+		}
+		messages, err = models.GetChatMessagesSince(h.db, chat, since, limit)
+	} else if beforeStr != "" {
+		beforeID, parseErr := strconv.ParseInt(beforeStr, 10, 64)
+		if parseErr != nil || beforeID < 1 {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "invalid before parameter"})
+			return
+		}
+		messages, err = models.GetChatMessagesBefore(h.db, chat, beforeID, limit)
+	} else if afterStr != "" {
+		afterID, parseErr := strconv.ParseInt(afterStr, 10, 64)
+		if parseErr != nil || afterID < 0 {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "invalid after parameter"})
+			return
+		}
+		messages, err = models.GetChatMessagesAfter(h.db, chat, afterID, limit)
+	} else {
+		messages, err = models.GetChatMessages(h.db, chat, limit)
+	}
 	if err != nil {
 		log.Printf("Ошибка при получении сообщений: %v", err)
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "internal server error"})
@@ -80,17 +122,493 @@ func (h *Handler) GetChatHistory(c *gin.Context) {
 	for i, msg := range messages {
 		log.Printf("Сообщение %d: %+v", i+1, msg)
 	}
-	log.Printf("=== Конец обработки запроса GetChatHistory ===")
 
-	c.JSON(http.StatusOK, gin.H{
+	response := gin.H{
 		"chat":     chat,
 		"messages": messages,
+	}
+
+	if user := requestUser(c); user != "" {
+		lastReadID, err := models.GetReadMarker(h.db, user, chat)
+		if err != nil {
+			log.Printf("Ошибка при получении отметки о прочтении: %v", err)
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "internal server error"})
+			return
+		}
+		response["last_read_id"] = lastReadID
+	}
+	log.Printf("=== Конец обработки запроса GetChatHistory ===")
+
+	c.JSON(http.StatusOK, response)
+}
+
+func (h *Handler) ListChats(c *gin.Context) {
+	user := requestUser(c)
+
+	names, err := models.ListChats(h.db)
+	if err != nil {
+		log.Printf("Ошибка при получении списка чатов: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "internal server error"})
+		return
+	}
+
+	chats := make([]models.ChatInfo, 0, len(names))
+	for _, name := range names {
+		info, err := h.chatInfo(name, user)
+		if err != nil {
+			log.Printf("Ошибка при получении информации о чате %s: %v", name, err)
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "internal server error"})
+			return
+		}
+		chats = append(chats, info)
+	}
+
+	c.JSON(http.StatusOK, gin.H{"chats": chats})
+}
+
+func (h *Handler) GetChat(c *gin.Context) {
+	info, err := h.chatInfo(c.Param("chat"), requestUser(c))
+	if err != nil {
+		log.Printf("Ошибка при получении информации о чате %s: %v", c.Param("chat"), err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "internal server error"})
+		return
+	}
+
+	c.JSON(http.StatusOK, info)
+}
+
+func (h *Handler) chatInfo(name, user string) (models.ChatInfo, error) {
+	info := models.ChatInfo{Name: name}
+
+	var err error
+	info.Topic, err = models.GetTopic(h.db, name)
+	if err != nil {
+		return info, err
+	}
+
+	if user != "" {
+		info.LastReadID, err = models.GetReadMarker(h.db, user, name)
+		if err != nil {
+			return info, err
+		}
+		info.Unread, err = models.CountUnread(h.db, name, user, info.LastReadID)
+		if err != nil {
+			return info, err
+		}
+	}
+
+	return info, nil
+}
+
+func (h *Handler) SetTopic(c *gin.Context) {
+	chat := c.Param("chat")
+	user := requestUser(c)
+	if user == "" {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "user parameter is required"})
+		return
+	}
+
+	var request struct {
+		Topic string `json:"topic"`
+	}
+	if err := c.ShouldBindJSON(&request); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid request body"})
+		return
+	}
+	if len([]rune(request.Topic)) > maxTopicLength {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "topic is too long"})
+		return
+	}
+
+	if err := models.SetTopic(h.db, chat, request.Topic, user); err != nil {
+		log.Printf("Ошибка при сохранении темы чата %s: %v", chat, err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "internal server error"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"chat":  chat,
+		"topic": request.Topic,
+	})
+}
+
+func (h *Handler) GetPins(c *gin.Context) {
+	chat := c.Param("chat")
+
+	pins, err := models.GetPins(h.db, chat)
+	if err != nil {
+		log.Printf("Ошибка при получении закрепленных сообщений чата %s: %v", chat, err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "internal server error"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"chat": chat,
+		"pins": pins,
+	})
+}
+
+func (h *Handler) PinMessage(c *gin.Context) {
+	chat := c.Param("chat")
+	user := requestUser(c)
+	if user == "" {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "user parameter is required"})
+		return
+	}
+
+	messageID, err := strconv.ParseInt(c.Param("id"), 10, 64)
+	if err != nil || messageID < 1 {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid message id"})
+		return
+	}
+
+	err = models.PinMessage(h.db, chat, messageID, user)
+	if errors.Is(err, models.ErrMessageNotFound) {
+		c.JSON(http.StatusNotFound, gin.H{"error": "message not found"})
+		return
+	}
+	if err != nil {
+		log.Printf("Ошибка при закреплении сообщения %d в чате %s: %v", messageID, chat, err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "internal server error"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"chat":       chat,
+		"message_id": messageID,
+	})
+}
+
+func (h *Handler) UnpinMessage(c *gin.Context) {
+	chat := c.Param("chat")
+
+	messageID, err := strconv.ParseInt(c.Param("id"), 10, 64)
+	if err != nil || messageID < 1 {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid message id"})
+		return
+	}
+
+	err = models.UnpinMessage(h.db, chat, messageID)
+	if errors.Is(err, models.ErrMessageNotFound) {
+		c.JSON(http.StatusNotFound, gin.H{"error": "message is not pinned"})
+		return
+	}
+	if err != nil {
+		log.Printf("Ошибка при откреплении сообщения %d в чате %s: %v", messageID, chat, err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "internal server error"})
+		return
+	}
+
+	c.Status(http.StatusNoContent)
+}
+
+func (h *Handler) EditMessage(c *gin.Context) {
+	chat := c.Param("chat")
+	user := requestUser(c)
+	if user == "" {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "user parameter is required"})
+		return
+	}
+
+	messageID, err := strconv.ParseInt(c.Param("id"), 10, 64)
+	if err != nil || messageID < 1 {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid message id"})
+		return
+	}
+
+	var request struct {
+		Body string `json:"body"`
+	}
+	if err := c.ShouldBindJSON(&request); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid request body"})
+		return
+	}
+	if strings.TrimSpace(request.Body) == "" {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "body is required"})
+		return
+	}
+
+	msg, err := models.EditMessage(h.db, chat, messageID, user, request.Body)
+	switch {
+	case errors.Is(err, models.ErrMessageNotFound):
+		c.JSON(http.StatusNotFound, gin.H{"error": "message not found"})
+		return
+	case errors.Is(err, models.ErrNotAuthor):
+		c.JSON(http.StatusForbidden, gin.H{"error": "only the author can edit a message"})
+		return
+	case err != nil:
+		log.Printf("Ошибка при изменении сообщения %d в чате %s: %v", messageID, chat, err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "internal server error"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"chat":    chat,
+		"message": msg,
 	})
 }
 
+func (h *Handler) MarkRead(c *gin.Context) {
+	chat := c.Param("chat")
+	user := requestUser(c)
+	if user == "" {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "user parameter is required"})
+		return
+	}
+
+	var request struct {
+		MessageID int64 `json:"message_id"`
+	}
+	if c.Request.ContentLength != 0 {
+		if err := c.ShouldBindJSON(&request); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "invalid request body"})
+			return
+		}
+	}
+	if request.MessageID < 0 {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "message_id must be positive"})
+		return
+	}
+
+	lastReadID, err := models.SetReadMarker(h.db, user, chat, request.MessageID)
+	if err != nil {
+		log.Printf("Ошибка при сохранении отметки о прочтении: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "internal server error"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"chat":         chat,
+		"last_read_id": lastReadID,
+	})
+}
+
+func (h *Handler) GetChatMembers(c *gin.Context) {
+	chat := c.Param("chat")
+	onlineOnly := c.Query("online") == "true"
+
+	online := h.roster.Online(chat)
+	if onlineOnly {
+		c.JSON(http.StatusOK, gin.H{
+			"chat":    chat,
+			"members": online,
+		})
+		return
+	}
+
+	usernames, err := models.GetChatUsernames(h.db, chat)
+	if err != nil {
+		log.Printf("Ошибка при получении участников чата %s: %v", chat, err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "internal server error"})
+		return
+	}
+
+	members := online
+	seen := make(map[string]bool, len(online))
+	for _, m := range online {
+		seen[m.Username] = true
+	}
+	for _, username := range usernames {
+		if !seen[username] {
+			members = append(members, models.Member{Username: username})
+		}
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"chat":    chat,
+		"members": members,
+	})
+}
+
+func (h *Handler) GetMentions(c *gin.Context) {
+	user := requestUser(c)
+	if user == "" {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "user parameter is required"})
+		return
+	}
+
+	limit, err := strconv.Atoi(c.DefaultQuery("limit", "50"))
+	if err != nil || limit < 1 {
+		limit = 50
+	}
+	if limit > 500 {
+		limit = 500
+	}
+
+	afterID, err := strconv.ParseInt(c.DefaultQuery("after", "0"), 10, 64)
+	if err != nil || afterID < 0 {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid after parameter"})
+		return
+	}
+
+	mentions, err := models.GetMentions(h.db, user, afterID, limit)
+	if err != nil {
+		log.Printf("Ошибка при получении упоминаний: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "internal server error"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"user":     user,
+		"mentions": mentions,
+	})
+}
+
+func (h *Handler) Search(c *gin.Context) {
+	text := c.Query("q")
+	if text == "" {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "q parameter is required"})
+		return
+	}
+
+	limit, err := strconv.Atoi(c.DefaultQuery("limit", "50"))
+	if err != nil || limit < 1 {
+		limit = 50
+	}
+	if limit > 500 {
+		limit = 500
+	}
+
+	query := models.SearchQuery{
+		Text:   text,
+		Chats:  c.QueryArray("chat"),
+		Author: c.Query("author"),
+		Limit:  limit,
+	}
+	for param, dst := range map[string]*time.Time{"from": &query.From, "to": &query.To} {
+		value := c.Query(param)
+		if value == "" {
+			continue
+		}
+		t, err := time.Parse(time.RFC3339, value)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "invalid " + param + " parameter"})
+			return
+		}
+		*dst = t
+	}
+
+	results, err := models.SearchMessages(h.db, query)
+	if err != nil {
+		log.Printf("Ошибка при поиске сообщений: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "internal server error"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"query":   text,
+		"results": results,
+	})
+}
+
+// uploadExtensions — какие файлы можно загрузить: только изображения, тип
+// определяется по содержимому.
+var uploadExtensions = map[string]string{
+	"image/png":  ".png",
+	"image/jpeg": ".jpg",
+	"image/gif":  ".gif",
+	"image/webp": ".webp",
+}
+
+// Upload сохраняет изображение под случайным именем и возвращает адрес, по
+// которому его можно вставить в сообщение.
+func (h *Handler) Upload(c *gin.Context) {
+	c.Request.Body = http.MaxBytesReader(c.Writer, c.Request.Body, maxUploadSize+1<<20)
+	header, err := c.FormFile("file")
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "file is required"})
+		return
+	}
+	if header.Size > maxUploadSize {
+		c.JSON(http.StatusRequestEntityTooLarge, gin.H{"error": "file is too large"})
+		return
+	}
+
+	file, err := header.Open()
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid file"})
+		return
+	}
+	defer file.Close()
+
+	data, err := io.ReadAll(file)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid file"})
+		return
+	}
+	ext, ok := uploadExtensions[http.DetectContentType(data)]
+	if !ok {
+		c.JSON(http.StatusUnsupportedMediaType, gin.H{"error": "only images can be uploaded"})
+		return
+	}
+
+	random := make([]byte, 16)
+	if _, err := rand.Read(random); err != nil {
+		log.Printf("Ошибка генерации имени файла: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "internal server error"})
+		return
+	}
+	name := hex.EncodeToString(random) + ext
+
+	if err := os.MkdirAll(h.uploadDir, 0o755); err != nil {
+		log.Printf("Ошибка создания каталога загрузок: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "internal server error"})
+		return
+	}
+	if err := os.WriteFile(filepath.Join(h.uploadDir, name), data, 0o644); err != nil {
+		log.Printf("Ошибка сохранения файла %s: %v", name, err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "internal server error"})
+		return
+	}
+
+	c.JSON(http.StatusCreated, gin.H{
+		"name": name,
+		"url":  "/v1/uploads/" + name,
+	})
+}
+
+func (h *Handler) GetUpload(c *gin.Context) {
+	name := c.Param("name")
+	if name != filepath.Base(name) || strings.HasPrefix(name, ".") {
+		c.JSON(http.StatusNotFound, gin.H{"error": "file not found"})
+		return
+	}
+	path := filepath.Join(h.uploadDir, name)
+	if _, err := os.Stat(path); err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "file not found"})
+		return
+	}
+	c.File(path)
+}
+
 func SetupRoutes(router *gin.Engine, handler *Handler) {
-	v1 := router.Group("/v1")
+	// Вход и обновление токена не проверяют заголовок Authorization: с
+	// истекшим токеном клиент как раз и приходит за новым.
+	auth := router.Group("/v1/auth")
+	{
+		auth.POST("/register", handler.Register)
+		auth.POST("/login", handler.Login)
+		auth.POST("/refresh", handler.Refresh)
+	}
+
+	v1 := router.Group("/v1", handler.Authenticate)
 	{
+		v1.POST("/auth/logout", handler.Logout)
+		v1.GET("/profile", handler.GetProfile)
+		v1.PUT("/profile", handler.UpdateProfile)
+		v1.GET("/chats", handler.ListChats)
 		v1.GET("/chats/history", handler.GetChatHistory)
+		v1.GET("/chats/:chat", handler.GetChat)
+		v1.PUT("/chats/:chat/topic", handler.SetTopic)
+		v1.GET("/chats/:chat/members", handler.GetChatMembers)
+		v1.PUT("/chats/:chat/read", handler.MarkRead)
+		v1.GET("/chats/:chat/pins", handler.GetPins)
+		v1.PUT("/chats/:chat/pins/:id", handler.PinMessage)
+		v1.DELETE("/chats/:chat/pins/:id", handler.UnpinMessage)
+		v1.PUT("/chats/:chat/messages/:id", handler.EditMessage)
+		v1.GET("/mentions", handler.GetMentions)
+		v1.GET("/search", handler.Search)
+		v1.POST("/uploads", handler.Upload)
+		v1.GET("/uploads/:name", handler.GetUpload)
 	}
 }
@@ -1,14 +1,20 @@
 package api
 
 import (
+	"bytes"
 	"database/sql"
 	"encoding/json"
+	"fmt"
+	"mime/multipart"
 	"net/http"
 	"net/http/httptest"
 	"os"
+	"strings"
 	"testing"
+	"time"
 
 	"team-bunny-chat/server/internal/models"
+	"team-bunny-chat/server/internal/presence"
 
 	"github.com/gin-gonic/gin"
 	_ "github.com/mattn/go-sqlite3"
@@ -21,7 +27,7 @@ func setupTestDB(t *testing.T) (*Handler, func()) {
 		t.Fatalf("Ошибка создания тестовой БД: %v", err)
 	}
 
-	handler := NewHandler(db)
+	handler := NewHandler(db, presence.NewRoster(presence.DefaultTimeout), t.TempDir())
 
 	cleanup := func() {
 		db.Close()
@@ -98,3 +104,628 @@ func TestGetChatHistory(t *testing.T) {
 		})
 	}
 }
+
+func TestGetChatHistorySince(t *testing.T) {
+	handler, cleanup := setupTestDB(t)
+	defer cleanup()
+
+	gin.SetMode(gin.TestMode)
+	router := gin.New()
+	router.GET("/v1/chats/history", handler.GetChatHistory)
+
+	base := time.Date(2025, 5, 24, 12, 0, 0, 0, time.UTC)
+	for i, body := range []string{"до обрыва", "во время обрыва"} {
+		err := models.SaveMessage(handler.db, "team", &models.Message{
+			Username:  "bob",
+			Body:      body,
+			Timestamp: base.Add(time.Duration(i) * time.Minute),
+		})
+		assert.NoError(t, err)
+	}
+
+	tests := []struct {
+		name           string
+		since          string
+		expectedStatus int
+		want           []string
+	}{
+		{
+			name:           "Сообщения после отметки",
+			since:          "2025-05-24T12:00:00Z",
+			expectedStatus: http.StatusOK,
+			want:           []string{"во время обрыва"},
+		},
+		{
+			name:           "Отметка с часовым поясом",
+			since:          "2025-05-24T14:59:59%2B03:00",
+			expectedStatus: http.StatusOK,
+			want:           []string{"до обрыва", "во время обрыва"},
+		},
+		{
+			name:           "Некорректная отметка",
+			since:          "вчера",
+			expectedStatus: http.StatusBadRequest,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			w := httptest.NewRecorder()
+			req, _ := http.NewRequest("GET", "/v1/chats/history?chat=team&since="+tt.since, nil)
+			router.ServeHTTP(w, req)
+
+			assert.Equal(t, tt.expectedStatus, w.Code)
+
+			if tt.expectedStatus == http.StatusOK {
+				var response struct {
+					Messages []models.Message `json:"messages"`
+				}
+				assert.NoError(t, json.Unmarshal(w.Body.Bytes(), &response))
+				bodies := []string{}
+				for _, msg := range response.Messages {
+					bodies = append(bodies, msg.Body)
+				}
+				assert.Equal(t, tt.want, bodies)
+			}
+		})
+	}
+}
+
+func TestGetChatHistoryBefore(t *testing.T) {
+	handler, cleanup := setupTestDB(t)
+	defer cleanup()
+
+	gin.SetMode(gin.TestMode)
+	router := gin.New()
+	router.GET("/v1/chats/history", handler.GetChatHistory)
+
+	base := time.Date(2025, 5, 24, 12, 0, 0, 0, time.UTC)
+	for i, body := range []string{"первое", "второе", "третье"} {
+		err := models.SaveMessage(handler.db, "team", &models.Message{
+			Username:  "bob",
+			Body:      body,
+			Timestamp: base.Add(time.Duration(i) * time.Minute),
+		})
+		assert.NoError(t, err)
+	}
+
+	tests := []struct {
+		name           string
+		query          string
+		expectedStatus int
+		want           []string
+	}{
+		{
+			name:           "Более ранние сообщения",
+			query:          "before=3",
+			expectedStatus: http.StatusOK,
+			want:           []string{"первое", "второе"},
+		},
+		{
+			name:           "Страница с ограничением",
+			query:          "before=3&limit=1",
+			expectedStatus: http.StatusOK,
+			want:           []string{"второе"},
+		},
+		{
+			name:           "Некорректный id",
+			query:          "before=abc",
+			expectedStatus: http.StatusBadRequest,
+		},
+		{
+			name:           "Вместе с since",
+			query:          "before=3&since=2025-05-24T12:00:00Z",
+			expectedStatus: http.StatusBadRequest,
+		},
+		{
+			name:           "Более поздние сообщения",
+			query:          "after=1",
+			expectedStatus: http.StatusOK,
+			want:           []string{"второе", "третье"},
+		},
+		{
+			name:           "Следующая страница пропущенных",
+			query:          "after=1&limit=1",
+			expectedStatus: http.StatusOK,
+			want:           []string{"второе"},
+		},
+		{
+			name:           "Некорректный after",
+			query:          "after=-1",
+			expectedStatus: http.StatusBadRequest,
+		},
+		{
+			name:           "after вместе с before",
+			query:          "after=1&before=3",
+			expectedStatus: http.StatusBadRequest,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			w := httptest.NewRecorder()
+			req, _ := http.NewRequest("GET", "/v1/chats/history?chat=team&"+tt.query, nil)
+			router.ServeHTTP(w, req)
+
+			assert.Equal(t, tt.expectedStatus, w.Code)
+
+			if tt.expectedStatus == http.StatusOK {
+				var response struct {
+					Messages []models.Message `json:"messages"`
+				}
+				assert.NoError(t, json.Unmarshal(w.Body.Bytes(), &response))
+				bodies := []string{}
+				for _, msg := range response.Messages {
+					bodies = append(bodies, msg.Body)
+				}
+				assert.Equal(t, tt.want, bodies)
+			}
+		})
+	}
+}
+
+func TestGetChatMembers(t *testing.T) {
+	handler, cleanup := setupTestDB(t)
+	defer cleanup()
+
+	gin.SetMode(gin.TestMode)
+	router := gin.New()
+	router.GET("/v1/chats/:chat/members", handler.GetChatMembers)
+
+	err := models.SaveMessage(handler.db, "team", &models.Message{
+		Username:  "bob",
+		Body:      "hello",
+		Timestamp: time.Now(),
+	})
+	assert.NoError(t, err)
+
+	handler.roster.Update(models.PresenceEvent{
+		Username: "alice",
+		ChatName: "team",
+		Status:   models.PresenceJoin,
+	})
+
+	tests := []struct {
+		name       string
+		url        string
+		wantUsers  []string
+		wantOnline []bool
+	}{
+		{
+			name:       "Все участники",
+			url:        "/v1/chats/team/members",
+			wantUsers:  []string{"alice", "bob"},
+			wantOnline: []bool{true, false},
+		},
+		{
+			name:       "Только онлайн",
+			url:        "/v1/chats/team/members?online=true",
+			wantUsers:  []string{"alice"},
+			wantOnline: []bool{true},
+		},
+		{
+			name:       "Пустой чат",
+			url:        "/v1/chats/empty/members",
+			wantUsers:  []string{},
+			wantOnline: []bool{},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			w := httptest.NewRecorder()
+			req, _ := http.NewRequest("GET", tt.url, nil)
+			router.ServeHTTP(w, req)
+
+			assert.Equal(t, http.StatusOK, w.Code)
+
+			var response struct {
+				Chat    string          `json:"chat"`
+				Members []models.Member `json:"members"`
+			}
+			err := json.Unmarshal(w.Body.Bytes(), &response)
+			assert.NoError(t, err)
+
+			users := []string{}
+			online := []bool{}
+			for _, m := range response.Members {
+				users = append(users, m.Username)
+				online = append(online, m.Online)
+			}
+			assert.Equal(t, tt.wantUsers, users)
+			assert.Equal(t, tt.wantOnline, online)
+		})
+	}
+}
+
+func TestListChatsAndMarkRead(t *testing.T) {
+	handler, cleanup := setupTestDB(t)
+	defer cleanup()
+
+	gin.SetMode(gin.TestMode)
+	router := gin.New()
+	router.GET("/v1/chats", handler.ListChats)
+	router.GET("/v1/chats/history", handler.GetChatHistory)
+	router.PUT("/v1/chats/:chat/read", handler.MarkRead)
+
+	var ids []int64
+	for _, username := range []string{"bob", "bob", "alice", "bob"} {
+		msg := &models.Message{
+			Username:  username,
+			Body:      "hello",
+			Timestamp: time.Now(),
+		}
+		assert.NoError(t, models.SaveMessage(handler.db, "team", msg))
+		ids = append(ids, msg.ID)
+	}
+
+	listChats := func() []models.ChatInfo {
+		w := httptest.NewRecorder()
+		req, _ := http.NewRequest("GET", "/v1/chats?user=alice", nil)
+		router.ServeHTTP(w, req)
+		assert.Equal(t, http.StatusOK, w.Code)
+
+		var response struct {
+			Chats []models.ChatInfo `json:"chats"`
+		}
+		assert.NoError(t, json.Unmarshal(w.Body.Bytes(), &response))
+		return response.Chats
+	}
+
+	chats := listChats()
+	assert.Equal(t, []models.ChatInfo{{Name: "team", Unread: 3}}, chats)
+
+	w := httptest.NewRecorder()
+	req, _ := http.NewRequest("PUT", "/v1/chats/team/read?user=alice",
+		strings.NewReader(fmt.Sprintf(`{"message_id": %d}`, ids[1])))
+	router.ServeHTTP(w, req)
+	assert.Equal(t, http.StatusOK, w.Code)
+
+	chats = listChats()
+	assert.Equal(t, []models.ChatInfo{{Name: "team", Unread: 1, LastReadID: ids[1]}}, chats)
+
+	w = httptest.NewRecorder()
+	req, _ = http.NewRequest("GET", "/v1/chats/history?chat=team&user=alice", nil)
+	router.ServeHTTP(w, req)
+	assert.Equal(t, http.StatusOK, w.Code)
+
+	var history struct {
+		LastReadID int64            `json:"last_read_id"`
+		Messages   []models.Message `json:"messages"`
+	}
+	assert.NoError(t, json.Unmarshal(w.Body.Bytes(), &history))
+	assert.Equal(t, ids[1], history.LastReadID)
+	assert.Len(t, history.Messages, 4)
+	assert.Equal(t, ids[0], history.Messages[0].ID)
+
+	w = httptest.NewRecorder()
+	req, _ = http.NewRequest("PUT", "/v1/chats/team/read?user=alice", nil)
+	router.ServeHTTP(w, req)
+	assert.Equal(t, http.StatusOK, w.Code)
+
+	chats = listChats()
+	assert.Equal(t, []models.ChatInfo{{Name: "team", Unread: 0, LastReadID: ids[3]}}, chats)
+
+	w = httptest.NewRecorder()
+	req, _ = http.NewRequest("PUT", "/v1/chats/team/read", nil)
+	router.ServeHTTP(w, req)
+	assert.Equal(t, http.StatusBadRequest, w.Code)
+}
+
+func TestGetMentions(t *testing.T) {
+	handler, cleanup := setupTestDB(t)
+	defer cleanup()
+
+	gin.SetMode(gin.TestMode)
+	router := gin.New()
+	router.GET("/v1/mentions", handler.GetMentions)
+
+	msg := &models.Message{
+		ID:        7,
+		Username:  "bob",
+		Body:      "@alice привет",
+		Timestamp: time.Now(),
+	}
+	assert.NoError(t, models.SaveMentions(handler.db, "team", msg, []string{"alice"}))
+
+	tests := []struct {
+		name           string
+		url            string
+		expectedStatus int
+		wantCount      int
+	}{
+		{
+			name:           "Упоминания пользователя",
+			url:            "/v1/mentions?user=alice",
+			expectedStatus: http.StatusOK,
+			wantCount:      1,
+		},
+		{
+			name:           "Нет упоминаний",
+			url:            "/v1/mentions?user=bob",
+			expectedStatus: http.StatusOK,
+			wantCount:      0,
+		},
+		{
+			name:           "Упоминания после последнего",
+			url:            "/v1/mentions?user=alice&after=1",
+			expectedStatus: http.StatusOK,
+			wantCount:      0,
+		},
+		{
+			name:           "Отсутствующий параметр user",
+			url:            "/v1/mentions",
+			expectedStatus: http.StatusBadRequest,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			w := httptest.NewRecorder()
+			req, _ := http.NewRequest("GET", tt.url, nil)
+			router.ServeHTTP(w, req)
+
+			assert.Equal(t, tt.expectedStatus, w.Code)
+
+			if tt.expectedStatus == http.StatusOK {
+				var response struct {
+					Mentions []models.Mention `json:"mentions"`
+				}
+				assert.NoError(t, json.Unmarshal(w.Body.Bytes(), &response))
+				assert.Len(t, response.Mentions, tt.wantCount)
+				for _, m := range response.Mentions {
+					assert.Equal(t, int64(7), m.MessageID)
+					assert.Equal(t, "bob", m.Author)
+				}
+			}
+		})
+	}
+}
+
+func TestPinsAndTopic(t *testing.T) {
+	handler, cleanup := setupTestDB(t)
+	defer cleanup()
+
+	gin.SetMode(gin.TestMode)
+	router := gin.New()
+	SetupRoutes(router, handler)
+
+	msg := &models.Message{
+		Username:  "bob",
+		Body:      "важная ссылка",
+		Timestamp: time.Now(),
+	}
+	assert.NoError(t, models.SaveMessage(handler.db, "team", msg))
+
+	do := func(method, url, body string) *httptest.ResponseRecorder {
+		w := httptest.NewRecorder()
+		req, _ := http.NewRequest(method, url, strings.NewReader(body))
+		router.ServeHTTP(w, req)
+		return w
+	}
+
+	pinURL := fmt.Sprintf("/v1/chats/team/pins/%d", msg.ID)
+
+	tests := []struct {
+		name           string
+		method         string
+		url            string
+		body           string
+		expectedStatus int
+	}{
+		{"Закрепление сообщения", "PUT", pinURL + "?user=alice", "", http.StatusOK},
+		{"Повторное закрепление", "PUT", pinURL + "?user=alice", "", http.StatusOK},
+		{"Закрепление без пользователя", "PUT", pinURL, "", http.StatusBadRequest},
+		{"Закрепление несуществующего сообщения", "PUT", "/v1/chats/team/pins/999?user=alice", "", http.StatusNotFound},
+		{"Некорректный id", "PUT", "/v1/chats/team/pins/abc?user=alice", "", http.StatusBadRequest},
+		{"Смена темы", "PUT", "/v1/chats/team/topic?user=alice", `{"topic": "Релиз в пятницу"}`, http.StatusOK},
+		{"Слишком длинная тема", "PUT", "/v1/chats/team/topic?user=alice",
+			`{"topic": "` + strings.Repeat("а", maxTopicLength+1) + `"}`, http.StatusBadRequest},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			w := do(tt.method, tt.url, tt.body)
+			assert.Equal(t, tt.expectedStatus, w.Code)
+		})
+	}
+
+	w := do("GET", "/v1/chats/team/pins", "")
+	assert.Equal(t, http.StatusOK, w.Code)
+	var pins struct {
+		Pins []models.Pin `json:"pins"`
+	}
+	assert.NoError(t, json.Unmarshal(w.Body.Bytes(), &pins))
+	assert.Len(t, pins.Pins, 1)
+	assert.Equal(t, msg.ID, pins.Pins[0].Message.ID)
+	assert.Equal(t, "важная ссылка", pins.Pins[0].Message.Body)
+	assert.Equal(t, "alice", pins.Pins[0].PinnedBy)
+
+	w = do("GET", "/v1/chats/team", "")
+	assert.Equal(t, http.StatusOK, w.Code)
+	var info models.ChatInfo
+	assert.NoError(t, json.Unmarshal(w.Body.Bytes(), &info))
+	assert.Equal(t, "Релиз в пятницу", info.Topic)
+
+	w = do("DELETE", pinURL, "")
+	assert.Equal(t, http.StatusNoContent, w.Code)
+
+	w = do("DELETE", pinURL, "")
+	assert.Equal(t, http.StatusNotFound, w.Code)
+
+	w = do("GET", "/v1/chats/team/pins", "")
+	assert.NoError(t, json.Unmarshal(w.Body.Bytes(), &pins))
+	assert.Empty(t, pins.Pins)
+}
+
+func TestSearch(t *testing.T) {
+	handler, cleanup := setupTestDB(t)
+	defer cleanup()
+
+	gin.SetMode(gin.TestMode)
+	router := gin.New()
+	SetupRoutes(router, handler)
+
+	base := time.Date(2025, 5, 24, 12, 0, 0, 0, time.UTC)
+	for i, m := range []struct{ chat, user, body string }{
+		{"team", "alice", "релиз сегодня"},
+		{"team", "bob", "релиз перенесли"},
+		{"random", "alice", "обед?"},
+	} {
+		err := models.SaveMessage(handler.db, m.chat, &models.Message{
+			Username:  m.user,
+			Body:      m.body,
+			Timestamp: base.Add(time.Duration(i) * time.Hour),
+		})
+		assert.NoError(t, err)
+	}
+
+	tests := []struct {
+		name           string
+		url            string
+		expectedStatus int
+		wantCount      int
+	}{
+		{
+			name:           "Поиск по всем чатам",
+			url:            "/v1/search?q=релиз",
+			expectedStatus: http.StatusOK,
+			wantCount:      2,
+		},
+		{
+			name:           "Поиск по автору",
+			url:            "/v1/search?q=релиз&author=bob",
+			expectedStatus: http.StatusOK,
+			wantCount:      1,
+		},
+		{
+			name:           "Поиск в другом чате",
+			url:            "/v1/search?q=релиз&chat=random",
+			expectedStatus: http.StatusOK,
+			wantCount:      0,
+		},
+		{
+			name:           "Поиск с датой начала",
+			url:            "/v1/search?q=релиз&from=2025-05-24T12:30:00Z",
+			expectedStatus: http.StatusOK,
+			wantCount:      1,
+		},
+		{
+			name:           "Некорректная дата",
+			url:            "/v1/search?q=релиз&from=вчера",
+			expectedStatus: http.StatusBadRequest,
+		},
+		{
+			name:           "Отсутствующий параметр q",
+			url:            "/v1/search",
+			expectedStatus: http.StatusBadRequest,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			w := httptest.NewRecorder()
+			req, _ := http.NewRequest("GET", tt.url, nil)
+			router.ServeHTTP(w, req)
+
+			assert.Equal(t, tt.expectedStatus, w.Code)
+
+			if tt.expectedStatus == http.StatusOK {
+				var response struct {
+					Results []models.SearchResult `json:"results"`
+				}
+				assert.NoError(t, json.Unmarshal(w.Body.Bytes(), &response))
+				assert.Len(t, response.Results, tt.wantCount)
+			}
+		})
+	}
+}
+
+func TestEditMessage(t *testing.T) {
+	handler, cleanup := setupTestDB(t)
+	defer cleanup()
+
+	gin.SetMode(gin.TestMode)
+	router := gin.New()
+	SetupRoutes(router, handler)
+
+	msg := &models.Message{Username: "alice", Body: "превет", Timestamp: time.Now()}
+	assert.NoError(t, models.SaveMessage(handler.db, "team", msg))
+	editURL := fmt.Sprintf("/v1/chats/team/messages/%d", msg.ID)
+
+	tests := []struct {
+		name           string
+		url            string
+		body           string
+		expectedStatus int
+	}{
+		{"Без пользователя", editURL, `{"body": "привет"}`, http.StatusBadRequest},
+		{"Пустой текст", editURL + "?user=alice", `{"body": "  "}`, http.StatusBadRequest},
+		{"Чужое сообщение", editURL + "?user=bob", `{"body": "привет"}`, http.StatusForbidden},
+		{"Несуществующее сообщение", "/v1/chats/team/messages/999?user=alice", `{"body": "привет"}`, http.StatusNotFound},
+		{"Свое сообщение", editURL + "?user=alice", `{"body": "привет"}`, http.StatusOK},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			w := httptest.NewRecorder()
+			req, _ := http.NewRequest("PUT", tt.url, strings.NewReader(tt.body))
+			router.ServeHTTP(w, req)
+			assert.Equal(t, tt.expectedStatus, w.Code)
+		})
+	}
+
+	stored, err := models.GetMessage(handler.db, "team", msg.ID)
+	assert.NoError(t, err)
+	assert.Equal(t, "привет", stored.Body)
+}
+
+func TestUpload(t *testing.T) {
+	handler, cleanup := setupTestDB(t)
+	defer cleanup()
+
+	gin.SetMode(gin.TestMode)
+	router := gin.New()
+	SetupRoutes(router, handler)
+
+	upload := func(data []byte) *httptest.ResponseRecorder {
+		var body bytes.Buffer
+		form := multipart.NewWriter(&body)
+		part, _ := form.CreateFormFile("file", "picture")
+		part.Write(data)
+		form.Close()
+
+		w := httptest.NewRecorder()
+		req, _ := http.NewRequest("POST", "/v1/uploads", &body)
+		req.Header.Set("Content-Type", form.FormDataContentType())
+		router.ServeHTTP(w, req)
+		return w
+	}
+	png := []byte("\x89PNG\r\n\x1a\n\x00\x00\x00\rIHDR")
+
+	w := upload([]byte("просто текст"))
+	assert.Equal(t, http.StatusUnsupportedMediaType, w.Code)
+
+	w = upload(png)
+	assert.Equal(t, http.StatusCreated, w.Code)
+	var response struct {
+		Name string `json:"name"`
+		URL  string `json:"url"`
+	}
+	assert.NoError(t, json.Unmarshal(w.Body.Bytes(), &response))
+	assert.True(t, strings.HasSuffix(response.Name, ".png"))
+	assert.Equal(t, "/v1/uploads/"+response.Name, response.URL)
+
+	w = httptest.NewRecorder()
+	req, _ := http.NewRequest("GET", response.URL, nil)
+	router.ServeHTTP(w, req)
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.Equal(t, png, w.Body.Bytes())
+
+	for _, url := range []string{"/v1/uploads/missing.png", "/v1/uploads/..%2Ftest.db"} {
+		w = httptest.NewRecorder()
+		req, _ = http.NewRequest("GET", url, nil)
+		router.ServeHTTP(w, req)
+		assert.Equal(t, http.StatusNotFound, w.Code, url)
+	}
+}
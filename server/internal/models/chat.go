@@ -0,0 +1,95 @@
+package models
+
+import (
+	"database/sql"
+	"fmt"
+	"strings"
+)
+
+type ChatInfo struct {
+	Name       string `json:"name"`
+	Topic      string `json:"topic,omitempty"`
+	Unread     int    `json:"unread"`
+	LastReadID int64  `json:"last_read_id"`
+}
+
+func chatTableExists(db *sql.DB, chatName string) (bool, error) {
+	var tableCnt int
+	err := db.QueryRow("SELECT count(*) FROM sqlite_master WHERE type='table' AND name=?", getTableName(chatName)).Scan(&tableCnt)
+	if err != nil {
+		return false, fmt.Errorf("ошибка проверки таблицы: %w", err)
+	}
+	return tableCnt > 0, nil
+}
+
+func ListChats(db *sql.DB) ([]string, error) {
+	rows, err := db.Query(`
+	SELECT name
+	FROM sqlite_master
+	WHERE type='table' AND name LIKE 'chat\_%' ESCAPE '\'
+	ORDER BY name`)
+	if err != nil {
+		return nil, fmt.Errorf("ошибка получения списка чатов: %w", err)
+	}
+	defer rows.Close()
+
+	chats := []string{}
+	for rows.Next() {
+		var tableName string
+		if err := rows.Scan(&tableName); err != nil {
+			return nil, fmt.Errorf("ошибка чтения чата: %w", err)
+		}
+		chats = append(chats, strings.TrimPrefix(tableName, "chat_"))
+	}
+
+	return chats, rows.Err()
+}
+
+func GetLastMessageID(db *sql.DB, chatName string) (int64, error) {
+	exists, err := chatTableExists(db, chatName)
+	if err != nil || !exists {
+		return 0, err
+	}
+
+	var id sql.NullInt64
+	err = db.QueryRow(fmt.Sprintf("SELECT max(rowid) FROM %s", quotedTable(chatName))).Scan(&id)
+	if err != nil {
+		return 0, fmt.Errorf("ошибка получения последнего сообщения: %w", err)
+	}
+
+	return id.Int64, nil
+}
+
+// CountMessages возвращает число сообщений чата; у чата без таблицы их 0.
+func CountMessages(db *sql.DB, chatName string) (int, error) {
+	exists, err := chatTableExists(db, chatName)
+	if err != nil || !exists {
+		return 0, err
+	}
+
+	var count int
+	if err := db.QueryRow(fmt.Sprintf("SELECT count(*) FROM %s", quotedTable(chatName))).Scan(&count); err != nil {
+		return 0, fmt.Errorf("ошибка подсчета сообщений: %w", err)
+	}
+	return count, nil
+}
+
+// CountUnread считает сообщения после afterID, не учитывая собственные
+// сообщения пользователя.
+func CountUnread(db *sql.DB, chatName, username string, afterID int64) (int, error) {
+	exists, err := chatTableExists(db, chatName)
+	if err != nil || !exists {
+		return 0, err
+	}
+
+	var count int
+	err = db.QueryRow(fmt.Sprintf(`
+	SELECT count(*)
+	FROM %s
+	WHERE rowid > ? AND username != ?`, quotedTable(chatName)), afterID, username).Scan(&count)
+	if err != nil {
+		return 0, fmt.Errorf("ошибка подсчета непрочитанных: %w", err)
+	}
+
+	return count, nil
+}
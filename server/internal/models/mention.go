@@ -0,0 +1,118 @@
+package models
+
+import (
+	"database/sql"
+	"fmt"
+	"regexp"
+	"strings"
+	"time"
+)
+
+const (
+	MentionHere    = "here"
+	MentionChannel = "channel"
+)
+
+var mentionPattern = regexp.MustCompile(`(?:^|[^\p{L}\p{N}_@])@([\p{L}\p{N}_][\p{L}\p{N}_.-]*)`)
+
+type Mention struct {
+	ID        int64     `json:"id"`
+	Chat      string    `json:"chat"`
+	MessageID int64     `json:"message_id"`
+	Username  string    `json:"username"`
+	Author    string    `json:"author"`
+	Body      string    `json:"body"`
+	Timestamp time.Time `json:"timestamp"`
+}
+
+// ParseMentions возвращает уникальные имена, упомянутые в тексте через @,
+// в порядке появления. @here и @channel возвращаются как есть.
+func ParseMentions(body string) []string {
+	var names []string
+	seen := make(map[string]bool)
+	for _, match := range mentionPattern.FindAllStringSubmatch(body, -1) {
+		name := strings.TrimRight(match[1], ".-")
+		if name == "" || seen[name] {
+			continue
+		}
+		seen[name] = true
+		names = append(names, name)
+	}
+	return names
+}
+
+func CreateMentionsTable(db *sql.DB) error {
+	_, err := db.Exec(`
+	CREATE TABLE IF NOT EXISTS mentions (
+		chat TEXT NOT NULL,
+		message_id INTEGER NOT NULL,
+		username TEXT NOT NULL,
+		author TEXT NOT NULL,
+		body TEXT NOT NULL,
+		timestamp DATETIME NOT NULL
+	);
+	CREATE INDEX IF NOT EXISTS idx_mentions_username ON mentions(username);
+	`)
+	return err
+}
+
+func SaveMentions(db *sql.DB, chatName string, msg *Message, usernames []string) error {
+	if len(usernames) == 0 {
+		return nil
+	}
+
+	err := CreateMentionsTable(db)
+	if err != nil {
+		return fmt.Errorf("ошибка создания таблицы: %w", err)
+	}
+
+	tx, err := db.Begin()
+	if err != nil {
+		return fmt.Errorf("ошибка начала транзакции: %w", err)
+	}
+	defer tx.Rollback()
+
+	for _, username := range usernames {
+		_, err := tx.Exec(`
+		INSERT INTO mentions (chat, message_id, username, author, body, timestamp)
+		VALUES (?, ?, ?, ?, ?, ?)`,
+			chatName, msg.ID, username, msg.Username, msg.Body, msg.Timestamp)
+		if err != nil {
+			return fmt.Errorf("ошибка сохранения упоминания: %w", err)
+		}
+	}
+
+	return tx.Commit()
+}
+
+// GetMentions возвращает упоминания пользователя с id больше afterID,
+// от новых к старым.
+func GetMentions(db *sql.DB, username string, afterID int64, limit int) ([]Mention, error) {
+	err := CreateMentionsTable(db)
+	if err != nil {
+		return nil, fmt.Errorf("ошибка создания таблицы: %w", err)
+	}
+
+	rows, err := db.Query(`
+	SELECT rowid, chat, message_id, username, author, body, timestamp
+	FROM mentions
+	WHERE username = ? AND rowid > ?
+	ORDER BY rowid DESC
+	LIMIT ?`, username, afterID, limit)
+	if err != nil {
+		return nil, fmt.Errorf("ошибка получения упоминаний: %w", err)
+	}
+	defer rows.Close()
+
+	mentions := []Mention{}
+	for rows.Next() {
+		var m Mention
+		err := rows.Scan(&m.ID, &m.Chat, &m.MessageID, &m.Username, &m.Author, &m.Body, &m.Timestamp)
+		if err != nil {
+			return nil, fmt.Errorf("ошибка чтения упоминания: %w", err)
+		}
+		mentions = append(mentions, m)
+	}
+
+	return mentions, rows.Err()
+}
@@ -0,0 +1,89 @@
+package models
+
+import (
+	"os"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestParseMentions(t *testing.T) {
+	tests := []struct {
+		name string
+		body string
+		want []string
+	}{
+		{
+			name: "Без упоминаний",
+			body: "просто текст",
+			want: nil,
+		},
+		{
+			name: "Одно упоминание",
+			body: "@alice привет",
+			want: []string{"alice"},
+		},
+		{
+			name: "Знаки препинания после имени",
+			body: "спроси @bob.smith, или @carol.",
+			want: []string{"bob.smith", "carol"},
+		},
+		{
+			name: "Повторы и специальные упоминания",
+			body: "@here @alice @alice @channel",
+			want: []string{"here", "alice", "channel"},
+		},
+		{
+			name: "Email не считается упоминанием",
+			body: "пиши на alice@example.com",
+			want: nil,
+		},
+		{
+			name: "Кириллица",
+			body: "@Алиса глянь",
+			want: []string{"Алиса"},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			assert.Equal(t, tt.want, ParseMentions(tt.body))
+		})
+	}
+}
+
+func TestSaveAndGetMentions(t *testing.T) {
+	db, err := SetupTestDB()
+	assert.NoError(t, err)
+	defer func() {
+		db.Close()
+		os.Remove("test.db")
+	}()
+
+	for i, body := range []string{"@alice раз", "@alice @bob два"} {
+		msg := &Message{
+			ID:        int64(i + 1),
+			Username:  "carol",
+			Body:      body,
+			Timestamp: time.Now().UTC(),
+		}
+		assert.NoError(t, SaveMentions(db, "team", msg, ParseMentions(body)))
+	}
+
+	mentions, err := GetMentions(db, "alice", 0, 10)
+	assert.NoError(t, err)
+	assert.Len(t, mentions, 2)
+	assert.Equal(t, "@alice @bob два", mentions[0].Body)
+	assert.Equal(t, "carol", mentions[0].Author)
+	assert.Equal(t, "team", mentions[0].Chat)
+	assert.Equal(t, int64(2), mentions[0].MessageID)
+
+	mentions, err = GetMentions(db, "alice", mentions[1].ID, 10)
+	assert.NoError(t, err)
+	assert.Len(t, mentions, 1)
+
+	mentions, err = GetMentions(db, "dave", 0, 10)
+	assert.NoError(t, err)
+	assert.Empty(t, mentions)
+}
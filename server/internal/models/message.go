@@ -2,12 +2,14 @@ package models
 
 import (
 	"database/sql"
+	"errors"
 	"fmt"
 	"strings"
 	"time"
 )
 
 type Message struct {
+	ID        int64     `json:"id"`
 	Username  string    `json:"username"`
 	Body      string    `json:"body"`
 	Timestamp time.Time `json:"timestamp"`
@@ -17,6 +19,17 @@ func getTableName(chatName string) string {
 	return fmt.Sprintf("chat_%s", strings.ReplaceAll(chatName, ".", "_"))
 }
 
+// quotedTable — имя таблицы чата для подстановки в запрос. Оно в
+// кавычках: в имени чата бывают «-» и «:» (личная переписка
+// dm:<имя>:<имя>).
+func quotedTable(chatName string) string {
+	return quoteIdent(getTableName(chatName))
+}
+
+func quoteIdent(name string) string {
+	return `"` + strings.ReplaceAll(name, `"`, `""`) + `"`
+}
+
 func CreateChatTable(db *sql.DB, chatName string) error {
 	tableName := getTableName(chatName)
 	query := fmt.Sprintf(`
@@ -25,8 +38,8 @@ func CreateChatTable(db *sql.DB, chatName string) error {
 		body TEXT NOT NULL,
 		timestamp DATETIME NOT NULL
 	);
-	CREATE INDEX IF NOT EXISTS idx_%s_timestamp ON %s(timestamp);
-	`, tableName, tableName, tableName)
+	CREATE INDEX IF NOT EXISTS %s ON %s(timestamp);
+	`, quoteIdent(tableName), quoteIdent("idx_"+tableName+"_timestamp"), quoteIdent(tableName))
 
 	_, err := db.Exec(query)
 	return err
@@ -38,16 +51,20 @@ func SaveMessage(db *sql.DB, chatName string, msg *Message) error {
 		return fmt.Errorf("ошибка создания таблицы: %w", err)
 	}
 
-	tableName := getTableName(chatName)
 	query := fmt.Sprintf(`
 	INSERT INTO %s (username, body, timestamp)
-	VALUES (?, ?, ?)`, tableName)
+	VALUES (?, ?, ?)`, quotedTable(chatName))
 
-	_, err = db.Exec(query, msg.Username, msg.Body, msg.Timestamp)
+	result, err := db.Exec(query, msg.Username, msg.Body, msg.Timestamp)
 	if err != nil {
 		return fmt.Errorf("ошибка сохранения сообщения: %w", err)
 	}
 
+	msg.ID, err = result.LastInsertId()
+	if err != nil {
+		return fmt.Errorf("ошибка получения id сообщения: %w", err)
+	}
+
 	return nil
 }
 
@@ -65,10 +82,10 @@ func GetChatMessages(db *sql.DB, chatName string, limit int) ([]Message, error)
 	}
 
 	query := fmt.Sprintf(`
-	SELECT username, body, timestamp
+	SELECT rowid, username, body, timestamp
 	FROM %s
 	ORDER BY timestamp DESC
-	LIMIT ?`, tableName)
+	LIMIT ?`, quotedTable(chatName))
 
 	rows, err := db.Query(query, limit)
 	if err != nil {
@@ -79,7 +96,7 @@ func GetChatMessages(db *sql.DB, chatName string, limit int) ([]Message, error)
 	var messages []Message
 	for rows.Next() {
 		var msg Message
-		err := rows.Scan(&msg.Username, &msg.Body, &msg.Timestamp)
+		err := rows.Scan(&msg.ID, &msg.Username, &msg.Body, &msg.Timestamp)
 		if err != nil {
 			return nil, fmt.Errorf("ошибка чтения сообщения: %w", err)
 		}
@@ -92,3 +109,146 @@ func GetChatMessages(db *sql.DB, chatName string, limit int) ([]Message, error)
 
 	return messages, nil
 }
+
+// GetChatMessagesBefore возвращает до limit сообщений с id меньше beforeID
+// в хронологическом порядке — следующую страницу более ранней истории.
+func GetChatMessagesBefore(db *sql.DB, chatName string, beforeID int64, limit int) ([]Message, error) {
+	exists, err := chatTableExists(db, chatName)
+	if err != nil {
+		return nil, err
+	}
+	if !exists {
+		return []Message{}, nil
+	}
+
+	rows, err := db.Query(fmt.Sprintf(`
+	SELECT rowid, username, body, timestamp
+	FROM %s
+	WHERE rowid < ?
+	ORDER BY rowid DESC
+	LIMIT ?`, quotedTable(chatName)), beforeID, limit)
+	if err != nil {
+		return nil, fmt.Errorf("ошибка получения сообщений: %w", err)
+	}
+	defer rows.Close()
+
+	messages := []Message{}
+	for rows.Next() {
+		var msg Message
+		if err := rows.Scan(&msg.ID, &msg.Username, &msg.Body, &msg.Timestamp); err != nil {
+			return nil, fmt.Errorf("ошибка чтения сообщения: %w", err)
+		}
+		messages = append(messages, msg)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("ошибка получения сообщений: %w", err)
+	}
+
+	for i, j := 0, len(messages)-1; i < j; i, j = i+1, j-1 {
+		messages[i], messages[j] = messages[j], messages[i]
+	}
+	return messages, nil
+}
+
+// GetChatMessagesSince возвращает до limit сообщений, сохраненных после
+// последнего сообщения не новее since, — то, что клиент пропустил, пока
+// был отключен. Страница начинается с самого раннего пропущенного,
+// следующую отдает GetChatMessagesAfter. Время сравниваем в Go: в базе
+// оно хранится строкой с часовым поясом отправителя, поэтому с конца
+// чата читаются только время и id пропущенных сообщений.
+func GetChatMessagesSince(db *sql.DB, chatName string, since time.Time, limit int) ([]Message, error) {
+	exists, err := chatTableExists(db, chatName)
+	if err != nil {
+		return nil, err
+	}
+	if !exists {
+		return []Message{}, nil
+	}
+
+	rows, err := db.Query(fmt.Sprintf(`
+	SELECT rowid, timestamp
+	FROM %s
+	ORDER BY rowid DESC`, quotedTable(chatName)))
+	if err != nil {
+		return nil, fmt.Errorf("ошибка получения сообщений: %w", err)
+	}
+	defer rows.Close()
+
+	var afterID int64
+	for rows.Next() {
+		var id int64
+		var timestamp time.Time
+		if err := rows.Scan(&id, &timestamp); err != nil {
+			return nil, fmt.Errorf("ошибка чтения сообщения: %w", err)
+		}
+		if !timestamp.After(since) {
+			afterID = id
+			break
+		}
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("ошибка получения сообщений: %w", err)
+	}
+	rows.Close()
+
+	return GetChatMessagesAfter(db, chatName, afterID, limit)
+}
+
+// GetChatMessagesAfter возвращает до limit сообщений с id больше afterID
+// в хронологическом порядке — следующую страницу пропущенных сообщений.
+func GetChatMessagesAfter(db *sql.DB, chatName string, afterID int64, limit int) ([]Message, error) {
+	exists, err := chatTableExists(db, chatName)
+	if err != nil {
+		return nil, err
+	}
+	if !exists {
+		return []Message{}, nil
+	}
+
+	rows, err := db.Query(fmt.Sprintf(`
+	SELECT rowid, username, body, timestamp
+	FROM %s
+	WHERE rowid > ?
+	ORDER BY rowid ASC
+	LIMIT ?`, quotedTable(chatName)), afterID, limit)
+	if err != nil {
+		return nil, fmt.Errorf("ошибка получения сообщений: %w", err)
+	}
+	defer rows.Close()
+
+	messages := []Message{}
+	for rows.Next() {
+		var msg Message
+		if err := rows.Scan(&msg.ID, &msg.Username, &msg.Body, &msg.Timestamp); err != nil {
+			return nil, fmt.Errorf("ошибка чтения сообщения: %w", err)
+		}
+		messages = append(messages, msg)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("ошибка получения сообщений: %w", err)
+	}
+	return messages, nil
+}
+
+var ErrNotAuthor = errors.New("изменить сообщение может только его автор")
+
+// EditMessage заменяет текст сообщения. Изменить сообщение может только
+// его автор.
+func EditMessage(db *sql.DB, chatName string, messageID int64, username, body string) (*Message, error) {
+	msg, err := GetMessage(db, chatName, messageID)
+	if err != nil {
+		return nil, err
+	}
+	if msg.Username != username {
+		return nil, ErrNotAuthor
+	}
+
+	_, err = db.Exec(fmt.Sprintf(`
+	UPDATE %s SET body = ? WHERE rowid = ?`, quotedTable(chatName)), body, messageID)
+	if err != nil {
+		return nil, fmt.Errorf("ошибка изменения сообщения: %w", err)
+	}
+
+	msg.Body = body
+	return msg, nil
+}
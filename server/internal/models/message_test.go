@@ -46,6 +46,11 @@ func TestCreateChatTable(t *testing.T) {
 			chatName: "test.chat.special",
 			wantErr:  false,
 		},
+		{
+			name:     "Личная переписка и дефис в имени",
+			chatName: "dm:alice:bob-smith",
+			wantErr:  false,
+		},
 	}
 
 	for _, tt := range tests {
@@ -168,3 +173,302 @@ func TestGetChatMessagesNonExistentChat(t *testing.T) {
 	assert.NoError(t, err)
 	assert.Empty(t, messages)
 }
+
+func TestGetChatUsernames(t *testing.T) {
+	db, err := SetupTestDB()
+	assert.NoError(t, err)
+	defer func() {
+		db.Close()
+		os.Remove("test.db")
+	}()
+
+	for _, username := range []string{"bob", "alice", "bob"} {
+		err := SaveMessage(db, "team", &Message{
+			Username:  username,
+			Body:      "hi",
+			Timestamp: time.Now().UTC(),
+		})
+		assert.NoError(t, err)
+	}
+
+	usernames, err := GetChatUsernames(db, "team")
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"alice", "bob"}, usernames)
+
+	usernames, err = GetChatUsernames(db, "nonexistent_chat")
+	assert.NoError(t, err)
+	assert.Empty(t, usernames)
+}
+
+func TestGetChatMessagesSince(t *testing.T) {
+	db, err := SetupTestDB()
+	assert.NoError(t, err)
+	defer func() {
+		db.Close()
+		os.Remove("test.db")
+	}()
+
+	base := time.Date(2025, 5, 24, 12, 0, 0, 0, time.UTC)
+	moscow := time.FixedZone("MSK", 3*60*60)
+	for i := 0; i < 4; i++ {
+		err := SaveMessage(db, "test_chat", &Message{
+			Username:  "user",
+			Body:      string(rune('a' + i)),
+			Timestamp: base.Add(time.Duration(i) * time.Minute).In(moscow),
+		})
+		assert.NoError(t, err)
+	}
+
+	tests := []struct {
+		name     string
+		chatName string
+		since    time.Time
+		limit    int
+		want     []string
+	}{
+		{
+			name:     "Пропущенные сообщения",
+			chatName: "test_chat",
+			since:    base.Add(time.Minute),
+			limit:    50,
+			want:     []string{"c", "d"},
+		},
+		{
+			name:     "Страница начинается с самого раннего пропущенного",
+			chatName: "test_chat",
+			since:    base.Add(-time.Hour),
+			limit:    2,
+			want:     []string{"a", "b"},
+		},
+		{
+			name:     "Ничего не пропущено",
+			chatName: "test_chat",
+			since:    base.Add(time.Hour),
+			limit:    50,
+			want:     []string{},
+		},
+		{
+			name:     "Несуществующий чат",
+			chatName: "nonexistent_chat",
+			since:    base,
+			limit:    50,
+			want:     []string{},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			messages, err := GetChatMessagesSince(db, tt.chatName, tt.since, tt.limit)
+			assert.NoError(t, err)
+
+			bodies := []string{}
+			for _, msg := range messages {
+				bodies = append(bodies, msg.Body)
+			}
+			assert.Equal(t, tt.want, bodies)
+		})
+	}
+}
+
+func TestGetChatMessagesAfter(t *testing.T) {
+	db, err := SetupTestDB()
+	assert.NoError(t, err)
+	defer func() {
+		db.Close()
+		os.Remove("test.db")
+	}()
+
+	base := time.Date(2025, 5, 24, 12, 0, 0, 0, time.UTC)
+	for i := 0; i < 5; i++ {
+		err := SaveMessage(db, "test_chat", &Message{
+			Username:  "user",
+			Body:      string(rune('a' + i)),
+			Timestamp: base.Add(time.Duration(i) * time.Minute),
+		})
+		assert.NoError(t, err)
+	}
+
+	tests := []struct {
+		name     string
+		chatName string
+		afterID  int64
+		limit    int
+		want     []string
+	}{
+		{
+			name:     "Страница после сообщения",
+			chatName: "test_chat",
+			afterID:  1,
+			limit:    2,
+			want:     []string{"b", "c"},
+		},
+		{
+			name:     "Остаток в конце истории",
+			chatName: "test_chat",
+			afterID:  3,
+			limit:    50,
+			want:     []string{"d", "e"},
+		},
+		{
+			name:     "После последнего сообщения",
+			chatName: "test_chat",
+			afterID:  5,
+			limit:    50,
+			want:     []string{},
+		},
+		{
+			name:     "Несуществующий чат",
+			chatName: "nonexistent_chat",
+			afterID:  0,
+			limit:    50,
+			want:     []string{},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			messages, err := GetChatMessagesAfter(db, tt.chatName, tt.afterID, tt.limit)
+			assert.NoError(t, err)
+
+			bodies := []string{}
+			for _, msg := range messages {
+				bodies = append(bodies, msg.Body)
+			}
+			assert.Equal(t, tt.want, bodies)
+		})
+	}
+}
+
+func TestGetChatMessagesBefore(t *testing.T) {
+	db, err := SetupTestDB()
+	assert.NoError(t, err)
+	defer func() {
+		db.Close()
+		os.Remove("test.db")
+	}()
+
+	base := time.Date(2025, 5, 24, 12, 0, 0, 0, time.UTC)
+	for i := 0; i < 5; i++ {
+		err := SaveMessage(db, "test_chat", &Message{
+			Username:  "user",
+			Body:      string(rune('a' + i)),
+			Timestamp: base.Add(time.Duration(i) * time.Minute),
+		})
+		assert.NoError(t, err)
+	}
+
+	tests := []struct {
+		name     string
+		chatName string
+		beforeID int64
+		limit    int
+		want     []string
+	}{
+		{
+			name:     "Страница перед сообщением",
+			chatName: "test_chat",
+			beforeID: 4,
+			limit:    2,
+			want:     []string{"b", "c"},
+		},
+		{
+			name:     "Остаток в начале истории",
+			chatName: "test_chat",
+			beforeID: 3,
+			limit:    50,
+			want:     []string{"a", "b"},
+		},
+		{
+			name:     "Раньше первого сообщения",
+			chatName: "test_chat",
+			beforeID: 1,
+			limit:    50,
+			want:     []string{},
+		},
+		{
+			name:     "Несуществующий чат",
+			chatName: "nonexistent_chat",
+			beforeID: 10,
+			limit:    50,
+			want:     []string{},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			messages, err := GetChatMessagesBefore(db, tt.chatName, tt.beforeID, tt.limit)
+			assert.NoError(t, err)
+
+			bodies := []string{}
+			for _, msg := range messages {
+				bodies = append(bodies, msg.Body)
+			}
+			assert.Equal(t, tt.want, bodies)
+		})
+	}
+}
+
+func TestDirectChatMessages(t *testing.T) {
+	db, err := SetupTestDB()
+	assert.NoError(t, err)
+	defer func() {
+		db.Close()
+		os.Remove("test.db")
+	}()
+
+	chatName := "dm:alice:bob"
+	assert.NoError(t, SaveMessage(db, chatName, &Message{Username: "alice", Body: "привет", Timestamp: time.Now().UTC()}))
+
+	messages, err := GetChatMessages(db, chatName, 10)
+	assert.NoError(t, err)
+	assert.Len(t, messages, 1)
+
+	count, err := CountMessages(db, chatName)
+	assert.NoError(t, err)
+	assert.Equal(t, 1, count)
+
+	chats, err := ListChats(db)
+	assert.NoError(t, err)
+	assert.Contains(t, chats, chatName)
+}
+
+func TestEditMessage(t *testing.T) {
+	db, err := SetupTestDB()
+	assert.NoError(t, err)
+	defer func() {
+		db.Close()
+		os.Remove("test.db")
+	}()
+
+	msg := &Message{Username: "alice", Body: "привет", Timestamp: time.Now()}
+	assert.NoError(t, SaveMessage(db, "test_chat", msg))
+
+	tests := []struct {
+		name     string
+		chatName string
+		id       int64
+		username string
+		wantErr  error
+	}{
+		{name: "Чужое сообщение", chatName: "test_chat", id: msg.ID, username: "bob", wantErr: ErrNotAuthor},
+		{name: "Нет сообщения", chatName: "test_chat", id: msg.ID + 1, username: "alice", wantErr: ErrMessageNotFound},
+		{name: "Нет чата", chatName: "other", id: msg.ID, username: "alice", wantErr: ErrMessageNotFound},
+		{name: "Свое сообщение", chatName: "test_chat", id: msg.ID, username: "alice"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			edited, err := EditMessage(db, tt.chatName, tt.id, tt.username, "привет всем")
+			if tt.wantErr != nil {
+				assert.ErrorIs(t, err, tt.wantErr)
+				return
+			}
+			assert.NoError(t, err)
+			assert.Equal(t, "привет всем", edited.Body)
+		})
+	}
+
+	stored, err := GetMessage(db, "test_chat", msg.ID)
+	assert.NoError(t, err)
+	assert.Equal(t, "привет всем", stored.Body)
+}
@@ -0,0 +1,134 @@
+package models
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+	"time"
+)
+
+var ErrMessageNotFound = errors.New("сообщение не найдено")
+
+type Pin struct {
+	Message  Message   `json:"message"`
+	PinnedBy string    `json:"pinned_by"`
+	PinnedAt time.Time `json:"pinned_at"`
+}
+
+func CreatePinsTable(db *sql.DB) error {
+	_, err := db.Exec(`
+	CREATE TABLE IF NOT EXISTS pins (
+		chat TEXT NOT NULL,
+		message_id INTEGER NOT NULL,
+		pinned_by TEXT NOT NULL,
+		pinned_at DATETIME NOT NULL,
+		PRIMARY KEY (chat, message_id)
+	);
+	`)
+	return err
+}
+
+func GetMessage(db *sql.DB, chatName string, messageID int64) (*Message, error) {
+	exists, err := chatTableExists(db, chatName)
+	if err != nil {
+		return nil, err
+	}
+	if !exists {
+		return nil, ErrMessageNotFound
+	}
+
+	var msg Message
+	err = db.QueryRow(fmt.Sprintf(`
+	SELECT rowid, username, body, timestamp
+	FROM %s
+	WHERE rowid = ?`, quotedTable(chatName)), messageID).Scan(&msg.ID, &msg.Username, &msg.Body, &msg.Timestamp)
+	if err == sql.ErrNoRows {
+		return nil, ErrMessageNotFound
+	}
+	if err != nil {
+		return nil, fmt.Errorf("ошибка получения сообщения: %w", err)
+	}
+
+	return &msg, nil
+}
+
+func PinMessage(db *sql.DB, chatName string, messageID int64, pinnedBy string) error {
+	if _, err := GetMessage(db, chatName, messageID); err != nil {
+		return err
+	}
+
+	err := CreatePinsTable(db)
+	if err != nil {
+		return fmt.Errorf("ошибка создания таблицы: %w", err)
+	}
+
+	_, err = db.Exec(`
+	INSERT OR IGNORE INTO pins (chat, message_id, pinned_by, pinned_at)
+	VALUES (?, ?, ?, ?)`, chatName, messageID, pinnedBy, time.Now().UTC())
+	if err != nil {
+		return fmt.Errorf("ошибка закрепления сообщения: %w", err)
+	}
+
+	return nil
+}
+
+func UnpinMessage(db *sql.DB, chatName string, messageID int64) error {
+	err := CreatePinsTable(db)
+	if err != nil {
+		return fmt.Errorf("ошибка создания таблицы: %w", err)
+	}
+
+	result, err := db.Exec(`
+	DELETE FROM pins
+	WHERE chat = ? AND message_id = ?`, chatName, messageID)
+	if err != nil {
+		return fmt.Errorf("ошибка открепления сообщения: %w", err)
+	}
+
+	removed, err := result.RowsAffected()
+	if err != nil {
+		return fmt.Errorf("ошибка открепления сообщения: %w", err)
+	}
+	if removed == 0 {
+		return ErrMessageNotFound
+	}
+
+	return nil
+}
+
+func GetPins(db *sql.DB, chatName string) ([]Pin, error) {
+	pins := []Pin{}
+
+	exists, err := chatTableExists(db, chatName)
+	if err != nil || !exists {
+		return pins, err
+	}
+
+	err = CreatePinsTable(db)
+	if err != nil {
+		return nil, fmt.Errorf("ошибка создания таблицы: %w", err)
+	}
+
+	rows, err := db.Query(fmt.Sprintf(`
+	SELECT m.rowid, m.username, m.body, m.timestamp, p.pinned_by, p.pinned_at
+	FROM pins p
+	JOIN %s m ON m.rowid = p.message_id
+	WHERE p.chat = ?
+	ORDER BY p.pinned_at`, quotedTable(chatName)), chatName)
+	if err != nil {
+		return nil, fmt.Errorf("ошибка получения закрепленных сообщений: %w", err)
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var pin Pin
+		err := rows.Scan(&pin.Message.ID, &pin.Message.Username, &pin.Message.Body, &pin.Message.Timestamp,
+			&pin.PinnedBy, &pin.PinnedAt)
+		if err != nil {
+			return nil, fmt.Errorf("ошибка чтения закрепленного сообщения: %w", err)
+		}
+		pins = append(pins, pin)
+	}
+
+	return pins, rows.Err()
+}
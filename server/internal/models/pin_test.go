@@ -0,0 +1,59 @@
+package models
+
+import (
+	"os"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestPins(t *testing.T) {
+	db, err := SetupTestDB()
+	assert.NoError(t, err)
+	defer func() {
+		db.Close()
+		os.Remove("test.db")
+	}()
+
+	pins, err := GetPins(db, "team")
+	assert.NoError(t, err)
+	assert.Empty(t, pins)
+
+	assert.ErrorIs(t, PinMessage(db, "team", 1, "alice"), ErrMessageNotFound)
+
+	msg := &Message{Username: "bob", Body: "закрепи меня", Timestamp: time.Now().UTC()}
+	assert.NoError(t, SaveMessage(db, "team", msg))
+
+	assert.NoError(t, PinMessage(db, "team", msg.ID, "alice"))
+	assert.NoError(t, PinMessage(db, "team", msg.ID, "carol"))
+
+	pins, err = GetPins(db, "team")
+	assert.NoError(t, err)
+	assert.Len(t, pins, 1)
+	assert.Equal(t, "закрепи меня", pins[0].Message.Body)
+	assert.Equal(t, "alice", pins[0].PinnedBy)
+
+	assert.NoError(t, UnpinMessage(db, "team", msg.ID))
+	assert.ErrorIs(t, UnpinMessage(db, "team", msg.ID), ErrMessageNotFound)
+}
+
+func TestTopic(t *testing.T) {
+	db, err := SetupTestDB()
+	assert.NoError(t, err)
+	defer func() {
+		db.Close()
+		os.Remove("test.db")
+	}()
+
+	topic, err := GetTopic(db, "team")
+	assert.NoError(t, err)
+	assert.Empty(t, topic)
+
+	assert.NoError(t, SetTopic(db, "team", "Первая тема", "alice"))
+	assert.NoError(t, SetTopic(db, "team", "Вторая тема", "bob"))
+
+	topic, err = GetTopic(db, "team")
+	assert.NoError(t, err)
+	assert.Equal(t, "Вторая тема", topic)
+}
@@ -0,0 +1,56 @@
+package models
+
+import (
+	"database/sql"
+	"fmt"
+	"time"
+)
+
+const (
+	PresenceJoin      = "join"
+	PresenceLeave     = "leave"
+	PresenceHeartbeat = "heartbeat"
+)
+
+type PresenceEvent struct {
+	Username  string    `json:"username"`
+	ChatName  string    `json:"chat_name"`
+	Status    string    `json:"status"`
+	Timestamp time.Time `json:"timestamp"`
+}
+
+type Member struct {
+	Username string     `json:"username"`
+	Online   bool       `json:"online"`
+	LastSeen *time.Time `json:"last_seen,omitempty"`
+}
+
+func GetChatUsernames(db *sql.DB, chatName string) ([]string, error) {
+	exists, err := chatTableExists(db, chatName)
+	if err != nil {
+		return nil, err
+	}
+	if !exists {
+		return []string{}, nil
+	}
+
+	rows, err := db.Query(fmt.Sprintf(`
+	SELECT DISTINCT username
+	FROM %s
+	ORDER BY username`, quotedTable(chatName)))
+	if err != nil {
+		return nil, fmt.Errorf("ошибка получения участников: %w", err)
+	}
+	defer rows.Close()
+
+	usernames := []string{}
+	for rows.Next() {
+		var username string
+		if err := rows.Scan(&username); err != nil {
+			return nil, fmt.Errorf("ошибка чтения участника: %w", err)
+		}
+		usernames = append(usernames, username)
+	}
+
+	return usernames, rows.Err()
+}
@@ -0,0 +1,71 @@
+package models
+
+import (
+	"database/sql"
+	"fmt"
+	"time"
+)
+
+func CreateReadMarkersTable(db *sql.DB) error {
+	_, err := db.Exec(`
+	CREATE TABLE IF NOT EXISTS read_markers (
+		username TEXT NOT NULL,
+		chat TEXT NOT NULL,
+		message_id INTEGER NOT NULL,
+		updated_at DATETIME NOT NULL,
+		PRIMARY KEY (username, chat)
+	);
+	`)
+	return err
+}
+
+// SetReadMarker отмечает сообщения чата прочитанными до messageID включительно.
+// При messageID == 0 отмечается последнее сообщение чата. Маркер никогда не
+// сдвигается назад. Возвращает итоговое значение маркера.
+func SetReadMarker(db *sql.DB, username, chatName string, messageID int64) (int64, error) {
+	err := CreateReadMarkersTable(db)
+	if err != nil {
+		return 0, fmt.Errorf("ошибка создания таблицы: %w", err)
+	}
+
+	if messageID == 0 {
+		messageID, err = GetLastMessageID(db, chatName)
+		if err != nil {
+			return 0, err
+		}
+	}
+
+	_, err = db.Exec(`
+	INSERT INTO read_markers (username, chat, message_id, updated_at)
+	VALUES (?, ?, ?, ?)
+	ON CONFLICT (username, chat) DO UPDATE SET
+		message_id = max(message_id, excluded.message_id),
+		updated_at = excluded.updated_at`,
+		username, chatName, messageID, time.Now().UTC())
+	if err != nil {
+		return 0, fmt.Errorf("ошибка сохранения отметки о прочтении: %w", err)
+	}
+
+	return GetReadMarker(db, username, chatName)
+}
+
+func GetReadMarker(db *sql.DB, username, chatName string) (int64, error) {
+	err := CreateReadMarkersTable(db)
+	if err != nil {
+		return 0, fmt.Errorf("ошибка создания таблицы: %w", err)
+	}
+
+	var messageID int64
+	err = db.QueryRow(`
+	SELECT message_id
+	FROM read_markers
+	WHERE username = ? AND chat = ?`, username, chatName).Scan(&messageID)
+	if err == sql.ErrNoRows {
+		return 0, nil
+	}
+	if err != nil {
+		return 0, fmt.Errorf("ошибка получения отметки о прочтении: %w", err)
+	}
+
+	return messageID, nil
+}
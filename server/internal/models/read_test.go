@@ -0,0 +1,77 @@
+package models
+
+import (
+	"os"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestReadMarkers(t *testing.T) {
+	db, err := SetupTestDB()
+	assert.NoError(t, err)
+	defer func() {
+		db.Close()
+		os.Remove("test.db")
+	}()
+
+	var ids []int64
+	for _, username := range []string{"bob", "alice", "bob", "bob"} {
+		msg := &Message{
+			Username:  username,
+			Body:      "hi",
+			Timestamp: time.Now().UTC(),
+		}
+		assert.NoError(t, SaveMessage(db, "team", msg))
+		assert.NotZero(t, msg.ID)
+		ids = append(ids, msg.ID)
+	}
+
+	lastReadID, err := GetReadMarker(db, "alice", "team")
+	assert.NoError(t, err)
+	assert.Zero(t, lastReadID)
+
+	unread, err := CountUnread(db, "team", "alice", lastReadID)
+	assert.NoError(t, err)
+	assert.Equal(t, 3, unread)
+
+	lastReadID, err = SetReadMarker(db, "alice", "team", ids[2])
+	assert.NoError(t, err)
+	assert.Equal(t, ids[2], lastReadID)
+
+	unread, err = CountUnread(db, "team", "alice", lastReadID)
+	assert.NoError(t, err)
+	assert.Equal(t, 1, unread)
+
+	lastReadID, err = SetReadMarker(db, "alice", "team", ids[0])
+	assert.NoError(t, err)
+	assert.Equal(t, ids[2], lastReadID, "маркер не должен сдвигаться назад")
+
+	lastReadID, err = SetReadMarker(db, "alice", "team", 0)
+	assert.NoError(t, err)
+	assert.Equal(t, ids[3], lastReadID)
+
+	lastReadID, err = GetReadMarker(db, "bob", "team")
+	assert.NoError(t, err)
+	assert.Zero(t, lastReadID)
+}
+
+func TestListChats(t *testing.T) {
+	db, err := SetupTestDB()
+	assert.NoError(t, err)
+	defer func() {
+		db.Close()
+		os.Remove("test.db")
+	}()
+
+	assert.NoError(t, CreateChatTable(db, "team"))
+	assert.NoError(t, CreateChatTable(db, "random"))
+	assert.NoError(t, CreateReadMarkersTable(db))
+	_, err = db.Exec("CREATE TABLE chats (name TEXT)")
+	assert.NoError(t, err)
+
+	chats, err := ListChats(db)
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"random", "team"}, chats)
+}
@@ -0,0 +1,96 @@
+package models
+
+import (
+	"database/sql"
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+)
+
+type SearchQuery struct {
+	Text   string
+	Chats  []string
+	Author string
+	From   time.Time
+	To     time.Time
+	Limit  int
+}
+
+type SearchResult struct {
+	Chat    string  `json:"chat"`
+	Message Message `json:"message"`
+}
+
+var likeEscaper = strings.NewReplacer(`\`, `\\`, `%`, `\%`, `_`, `\_`)
+
+// SearchMessages ищет сообщения по подстроке во всех чатах из query.Chats
+// (или во всех чатах, если список пуст). Результаты — от новых к старым.
+func SearchMessages(db *sql.DB, query SearchQuery) ([]SearchResult, error) {
+	chats := query.Chats
+	if len(chats) == 0 {
+		var err error
+		chats, err = ListChats(db)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	pattern := "%" + likeEscaper.Replace(query.Text) + "%"
+	results := []SearchResult{}
+	for _, chatName := range chats {
+		exists, err := chatTableExists(db, chatName)
+		if err != nil {
+			return nil, err
+		}
+		if !exists {
+			continue
+		}
+
+		sqlQuery := fmt.Sprintf(`
+		SELECT rowid, username, body, timestamp
+		FROM %s
+		WHERE body LIKE ? ESCAPE '\'`, quotedTable(chatName))
+		args := []interface{}{pattern}
+		if query.Author != "" {
+			sqlQuery += " AND username = ?"
+			args = append(args, query.Author)
+		}
+
+		rows, err := db.Query(sqlQuery, args...)
+		if err != nil {
+			return nil, fmt.Errorf("ошибка поиска сообщений: %w", err)
+		}
+
+		for rows.Next() {
+			var msg Message
+			if err := rows.Scan(&msg.ID, &msg.Username, &msg.Body, &msg.Timestamp); err != nil {
+				rows.Close()
+				return nil, fmt.Errorf("ошибка чтения сообщения: %w", err)
+			}
+			// Время сравниваем в Go: в базе оно хранится строкой с часовым
+			// поясом отправителя, и строковое сравнение в SQL неверно.
+			if !query.From.IsZero() && msg.Timestamp.Before(query.From) {
+				continue
+			}
+			if !query.To.IsZero() && msg.Timestamp.After(query.To) {
+				continue
+			}
+			results = append(results, SearchResult{Chat: chatName, Message: msg})
+		}
+		err = rows.Err()
+		rows.Close()
+		if err != nil {
+			return nil, fmt.Errorf("ошибка поиска сообщений: %w", err)
+		}
+	}
+
+	sort.SliceStable(results, func(i, j int) bool {
+		return results[i].Message.Timestamp.After(results[j].Message.Timestamp)
+	})
+	if query.Limit > 0 && len(results) > query.Limit {
+		results = results[:query.Limit]
+	}
+
+	return results, nil
+}
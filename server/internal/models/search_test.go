@@ -0,0 +1,94 @@
+package models
+
+import (
+	"os"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestSearchMessages(t *testing.T) {
+	db, err := SetupTestDB()
+	assert.NoError(t, err)
+	defer func() {
+		db.Close()
+		os.Remove("test.db")
+	}()
+
+	base := time.Date(2025, 5, 24, 12, 0, 0, 0, time.UTC)
+	fixtures := []struct {
+		chat     string
+		username string
+		body     string
+		offset   time.Duration
+	}{
+		{"team", "alice", "деплой в пятницу", 0},
+		{"team", "bob", "деплой отменен", time.Hour},
+		{"random", "alice", "кто на деплой?", 2 * time.Hour},
+		{"random", "bob", "100% готово", 3 * time.Hour},
+	}
+	for _, f := range fixtures {
+		err := SaveMessage(db, f.chat, &Message{
+			Username:  f.username,
+			Body:      f.body,
+			Timestamp: base.Add(f.offset),
+		})
+		assert.NoError(t, err)
+	}
+
+	tests := []struct {
+		name     string
+		query    SearchQuery
+		wantBody []string
+	}{
+		{
+			name:     "Во всех чатах",
+			query:    SearchQuery{Text: "деплой"},
+			wantBody: []string{"кто на деплой?", "деплой отменен", "деплой в пятницу"},
+		},
+		{
+			name:     "В одном чате",
+			query:    SearchQuery{Text: "деплой", Chats: []string{"team"}},
+			wantBody: []string{"деплой отменен", "деплой в пятницу"},
+		},
+		{
+			name:     "По автору",
+			query:    SearchQuery{Text: "деплой", Author: "alice"},
+			wantBody: []string{"кто на деплой?", "деплой в пятницу"},
+		},
+		{
+			name:     "По диапазону дат",
+			query:    SearchQuery{Text: "деплой", From: base.Add(30 * time.Minute), To: base.Add(90 * time.Minute)},
+			wantBody: []string{"деплой отменен"},
+		},
+		{
+			name:     "С ограничением количества",
+			query:    SearchQuery{Text: "деплой", Limit: 1},
+			wantBody: []string{"кто на деплой?"},
+		},
+		{
+			name:     "Спецсимволы LIKE экранируются",
+			query:    SearchQuery{Text: "0%"},
+			wantBody: []string{"100% готово"},
+		},
+		{
+			name:     "Несуществующий чат",
+			query:    SearchQuery{Text: "деплой", Chats: []string{"nonexistent_chat"}},
+			wantBody: []string{},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			results, err := SearchMessages(db, tt.query)
+			assert.NoError(t, err)
+
+			bodies := []string{}
+			for _, r := range results {
+				bodies = append(bodies, r.Message.Body)
+			}
+			assert.Equal(t, tt.wantBody, bodies)
+		})
+	}
+}
@@ -0,0 +1,168 @@
+package models
+
+import (
+	"crypto/rand"
+	"crypto/sha256"
+	"database/sql"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"time"
+)
+
+const (
+	AccessTokenTTL  = time.Hour
+	RefreshTokenTTL = 30 * 24 * time.Hour
+)
+
+var ErrInvalidToken = errors.New("токен недействителен или истек")
+
+// Session — пара токенов, выданная при входе. Клиент отправляет
+// AccessToken с каждым запросом, а когда тот истечет, обменивает
+// RefreshToken на новую пару. В базе хранятся только хеши токенов.
+type Session struct {
+	Username     string    `json:"-"`
+	AccessToken  string    `json:"access_token"`
+	RefreshToken string    `json:"refresh_token"`
+	ExpiresAt    time.Time `json:"expires_at"`
+}
+
+func CreateSessionsTable(db *sql.DB) error {
+	_, err := db.Exec(`
+	CREATE TABLE IF NOT EXISTS sessions (
+		access_hash TEXT PRIMARY KEY,
+		refresh_hash TEXT NOT NULL UNIQUE,
+		username TEXT NOT NULL,
+		access_expires DATETIME NOT NULL,
+		refresh_expires DATETIME NOT NULL
+	);
+	`)
+	return err
+}
+
+// CreateSession выдает пользователю новую пару токенов.
+func CreateSession(db *sql.DB, username string) (*Session, error) {
+	err := CreateSessionsTable(db)
+	if err != nil {
+		return nil, fmt.Errorf("ошибка создания таблицы: %w", err)
+	}
+	return insertSession(db, username)
+}
+
+// SessionUser возвращает владельца действующего токена доступа.
+func SessionUser(db *sql.DB, accessToken string) (string, error) {
+	err := CreateSessionsTable(db)
+	if err != nil {
+		return "", fmt.Errorf("ошибка создания таблицы: %w", err)
+	}
+
+	var username string
+	err = db.QueryRow(`
+	SELECT username
+	FROM sessions
+	WHERE access_hash = ? AND access_expires > ?`,
+		tokenHash(accessToken), time.Now().UTC()).Scan(&username)
+	if err == sql.ErrNoRows {
+		return "", ErrInvalidToken
+	}
+	if err != nil {
+		return "", fmt.Errorf("ошибка проверки токена: %w", err)
+	}
+	return username, nil
+}
+
+// RefreshSession обменивает токен обновления на новую пару. Старая пара
+// удаляется: повторно тот же токен обновления не сработает.
+func RefreshSession(db *sql.DB, refreshToken string) (*Session, error) {
+	err := CreateSessionsTable(db)
+	if err != nil {
+		return nil, fmt.Errorf("ошибка создания таблицы: %w", err)
+	}
+
+	tx, err := db.Begin()
+	if err != nil {
+		return nil, fmt.Errorf("ошибка начала транзакции: %w", err)
+	}
+	defer tx.Rollback()
+
+	var username string
+	err = tx.QueryRow(`
+	DELETE FROM sessions
+	WHERE refresh_hash = ? AND refresh_expires > ?
+	RETURNING username`,
+		tokenHash(refreshToken), time.Now().UTC()).Scan(&username)
+	if err == sql.ErrNoRows {
+		return nil, ErrInvalidToken
+	}
+	if err != nil {
+		return nil, fmt.Errorf("ошибка обновления токена: %w", err)
+	}
+
+	session, err := insertSession(tx, username)
+	if err != nil {
+		return nil, err
+	}
+	if err := tx.Commit(); err != nil {
+		return nil, fmt.Errorf("ошибка сохранения токена: %w", err)
+	}
+	return session, nil
+}
+
+// DeleteSession завершает сеанс, которому принадлежит токен доступа.
+func DeleteSession(db *sql.DB, accessToken string) error {
+	err := CreateSessionsTable(db)
+	if err != nil {
+		return fmt.Errorf("ошибка создания таблицы: %w", err)
+	}
+
+	_, err = db.Exec(`DELETE FROM sessions WHERE access_hash = ?`, tokenHash(accessToken))
+	if err != nil {
+		return fmt.Errorf("ошибка удаления сеанса: %w", err)
+	}
+	return nil
+}
+
+// execer — *sql.DB или *sql.Tx.
+type execer interface {
+	Exec(query string, args ...interface{}) (sql.Result, error)
+}
+
+func insertSession(db execer, username string) (*Session, error) {
+	access, err := newToken()
+	if err != nil {
+		return nil, err
+	}
+	refresh, err := newToken()
+	if err != nil {
+		return nil, err
+	}
+
+	now := time.Now().UTC()
+	session := &Session{
+		Username:     username,
+		AccessToken:  access,
+		RefreshToken: refresh,
+		ExpiresAt:    now.Add(AccessTokenTTL),
+	}
+	_, err = db.Exec(`
+	INSERT INTO sessions (access_hash, refresh_hash, username, access_expires, refresh_expires)
+	VALUES (?, ?, ?, ?, ?)`,
+		tokenHash(access), tokenHash(refresh), username, session.ExpiresAt, now.Add(RefreshTokenTTL))
+	if err != nil {
+		return nil, fmt.Errorf("ошибка сохранения сеанса: %w", err)
+	}
+	return session, nil
+}
+
+func newToken() (string, error) {
+	random := make([]byte, 32)
+	if _, err := rand.Read(random); err != nil {
+		return "", fmt.Errorf("ошибка генерации токена: %w", err)
+	}
+	return hex.EncodeToString(random), nil
+}
+
+func tokenHash(token string) string {
+	sum := sha256.Sum256([]byte(token))
+	return hex.EncodeToString(sum[:])
+}
@@ -0,0 +1,47 @@
+package models
+
+import (
+	"os"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestSessions(t *testing.T) {
+	db, err := SetupTestDB()
+	assert.NoError(t, err)
+	defer func() {
+		db.Close()
+		os.Remove("test.db")
+	}()
+
+	session, err := CreateSession(db, "alice")
+	assert.NoError(t, err)
+	assert.NotEqual(t, session.AccessToken, session.RefreshToken)
+	assert.WithinDuration(t, time.Now().Add(AccessTokenTTL), session.ExpiresAt, time.Minute)
+
+	username, err := SessionUser(db, session.AccessToken)
+	assert.NoError(t, err)
+	assert.Equal(t, "alice", username)
+
+	_, err = SessionUser(db, session.RefreshToken)
+	assert.ErrorIs(t, err, ErrInvalidToken, "токен обновления не подходит для запросов")
+
+	refreshed, err := RefreshSession(db, session.RefreshToken)
+	assert.NoError(t, err)
+	assert.Equal(t, "alice", refreshed.Username)
+	_, err = SessionUser(db, session.AccessToken)
+	assert.ErrorIs(t, err, ErrInvalidToken, "старая пара удалена")
+	_, err = RefreshSession(db, session.RefreshToken)
+	assert.ErrorIs(t, err, ErrInvalidToken, "токен обновления одноразовый")
+
+	_, err = db.Exec(`UPDATE sessions SET access_expires = ?`, time.Now().UTC().Add(-time.Minute))
+	assert.NoError(t, err)
+	_, err = SessionUser(db, refreshed.AccessToken)
+	assert.ErrorIs(t, err, ErrInvalidToken, "истекший токен")
+
+	assert.NoError(t, DeleteSession(db, refreshed.AccessToken))
+	_, err = RefreshSession(db, refreshed.RefreshToken)
+	assert.ErrorIs(t, err, ErrInvalidToken, "после выхода обновить нельзя")
+}
@@ -0,0 +1,58 @@
+package models
+
+import (
+	"database/sql"
+	"fmt"
+	"time"
+)
+
+func CreateTopicsTable(db *sql.DB) error {
+	_, err := db.Exec(`
+	CREATE TABLE IF NOT EXISTS topics (
+		chat TEXT PRIMARY KEY,
+		topic TEXT NOT NULL,
+		updated_by TEXT NOT NULL,
+		updated_at DATETIME NOT NULL
+	);
+	`)
+	return err
+}
+
+func SetTopic(db *sql.DB, chatName, topic, updatedBy string) error {
+	err := CreateTopicsTable(db)
+	if err != nil {
+		return fmt.Errorf("ошибка создания таблицы: %w", err)
+	}
+
+	_, err = db.Exec(`
+	INSERT INTO topics (chat, topic, updated_by, updated_at)
+	VALUES (?, ?, ?, ?)
+	ON CONFLICT (chat) DO UPDATE SET
+		topic = excluded.topic,
+		updated_by = excluded.updated_by,
+		updated_at = excluded.updated_at`,
+		chatName, topic, updatedBy, time.Now().UTC())
+	if err != nil {
+		return fmt.Errorf("ошибка сохранения темы: %w", err)
+	}
+
+	return nil
+}
+
+func GetTopic(db *sql.DB, chatName string) (string, error) {
+	err := CreateTopicsTable(db)
+	if err != nil {
+		return "", fmt.Errorf("ошибка создания таблицы: %w", err)
+	}
+
+	var topic string
+	err = db.QueryRow("SELECT topic FROM topics WHERE chat = ?", chatName).Scan(&topic)
+	if err == sql.ErrNoRows {
+		return "", nil
+	}
+	if err != nil {
+		return "", fmt.Errorf("ошибка получения темы: %w", err)
+	}
+
+	return topic, nil
+}
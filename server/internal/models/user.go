@@ -0,0 +1,165 @@
+package models
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+	"regexp"
+	"strings"
+	"time"
+
+	"golang.org/x/crypto/bcrypt"
+)
+
+var (
+	ErrUserExists         = errors.New("пользователь уже зарегистрирован")
+	ErrUserNotFound       = errors.New("пользователь не найден")
+	ErrInvalidCredentials = errors.New("неверное имя пользователя или пароль")
+)
+
+// usernamePattern совпадает с именем в упоминании (см. mentionPattern),
+// чтобы любого зарегистрированного пользователя можно было упомянуть.
+var usernamePattern = regexp.MustCompile(`^[\p{L}\p{N}_][\p{L}\p{N}_.-]*$`)
+
+// passwordCost — сложность bcrypt; тесты ее снижают.
+var passwordCost = bcrypt.DefaultCost
+
+type User struct {
+	Username    string    `json:"username"`
+	DisplayName string    `json:"display_name"`
+	AvatarURL   string    `json:"avatar_url"`
+	Status      string    `json:"status"`
+	CreatedAt   time.Time `json:"created_at"`
+}
+
+// Profile — то, что пользователь может изменить о себе.
+type Profile struct {
+	DisplayName string `json:"display_name"`
+	AvatarURL   string `json:"avatar_url"`
+	Status      string `json:"status"`
+}
+
+// ValidUsername сообщает, можно ли зарегистрировать такое имя.
+func ValidUsername(username string) bool {
+	return usernamePattern.MatchString(username)
+}
+
+func CreateUsersTable(db *sql.DB) error {
+	_, err := db.Exec(`
+	CREATE TABLE IF NOT EXISTS users (
+		username TEXT PRIMARY KEY,
+		password_hash TEXT NOT NULL,
+		display_name TEXT NOT NULL DEFAULT '',
+		avatar_url TEXT NOT NULL DEFAULT '',
+		status TEXT NOT NULL DEFAULT '',
+		created_at DATETIME NOT NULL
+	);
+	`)
+	return err
+}
+
+// CreateUser регистрирует пользователя. Пароль хранится только в виде
+// хеша bcrypt.
+func CreateUser(db *sql.DB, username, password string) (*User, error) {
+	err := CreateUsersTable(db)
+	if err != nil {
+		return nil, fmt.Errorf("ошибка создания таблицы: %w", err)
+	}
+
+	hash, err := bcrypt.GenerateFromPassword([]byte(password), passwordCost)
+	if err != nil {
+		return nil, fmt.Errorf("ошибка хеширования пароля: %w", err)
+	}
+
+	user := &User{Username: username, CreatedAt: time.Now().UTC()}
+	result, err := db.Exec(`
+	INSERT INTO users (username, password_hash, created_at)
+	VALUES (?, ?, ?)
+	ON CONFLICT (username) DO NOTHING`,
+		user.Username, string(hash), user.CreatedAt)
+	if err != nil {
+		return nil, fmt.Errorf("ошибка сохранения пользователя: %w", err)
+	}
+	if n, _ := result.RowsAffected(); n == 0 {
+		return nil, ErrUserExists
+	}
+	return user, nil
+}
+
+// Authenticate проверяет пароль. Для неизвестного имени и неверного
+// пароля ошибка одна — ErrInvalidCredentials.
+func Authenticate(db *sql.DB, username, password string) (*User, error) {
+	err := CreateUsersTable(db)
+	if err != nil {
+		return nil, fmt.Errorf("ошибка создания таблицы: %w", err)
+	}
+
+	var hash string
+	err = db.QueryRow(`SELECT password_hash FROM users WHERE username = ?`, username).Scan(&hash)
+	if err == sql.ErrNoRows {
+		return nil, ErrInvalidCredentials
+	}
+	if err != nil {
+		return nil, fmt.Errorf("ошибка получения пользователя: %w", err)
+	}
+	if bcrypt.CompareHashAndPassword([]byte(hash), []byte(password)) != nil {
+		return nil, ErrInvalidCredentials
+	}
+	return GetUser(db, username)
+}
+
+func GetUser(db *sql.DB, username string) (*User, error) {
+	err := CreateUsersTable(db)
+	if err != nil {
+		return nil, fmt.Errorf("ошибка создания таблицы: %w", err)
+	}
+
+	var user User
+	err = db.QueryRow(`
+	SELECT username, display_name, avatar_url, status, created_at
+	FROM users
+	WHERE username = ?`, username).Scan(&user.Username, &user.DisplayName, &user.AvatarURL, &user.Status, &user.CreatedAt)
+	if err == sql.ErrNoRows {
+		return nil, ErrUserNotFound
+	}
+	if err != nil {
+		return nil, fmt.Errorf("ошибка получения пользователя: %w", err)
+	}
+	return &user, nil
+}
+
+// UserExists сообщает, зарегистрировано ли имя. От имени
+// зарегистрированного пользователя можно действовать только с токеном.
+func UserExists(db *sql.DB, username string) (bool, error) {
+	err := CreateUsersTable(db)
+	if err != nil {
+		return false, fmt.Errorf("ошибка создания таблицы: %w", err)
+	}
+
+	var exists bool
+	err = db.QueryRow(`SELECT EXISTS (SELECT 1 FROM users WHERE username = ?)`, username).Scan(&exists)
+	if err != nil {
+		return false, fmt.Errorf("ошибка получения пользователя: %w", err)
+	}
+	return exists, nil
+}
+
+// UpdateProfile заменяет имя для отображения, аватар и статус.
+func UpdateProfile(db *sql.DB, username string, profile Profile) (*User, error) {
+	err := CreateUsersTable(db)
+	if err != nil {
+		return nil, fmt.Errorf("ошибка создания таблицы: %w", err)
+	}
+
+	result, err := db.Exec(`
+	UPDATE users SET display_name = ?, avatar_url = ?, status = ?
+	WHERE username = ?`,
+		strings.TrimSpace(profile.DisplayName), strings.TrimSpace(profile.AvatarURL), strings.TrimSpace(profile.Status), username)
+	if err != nil {
+		return nil, fmt.Errorf("ошибка сохранения профиля: %w", err)
+	}
+	if n, _ := result.RowsAffected(); n == 0 {
+		return nil, ErrUserNotFound
+	}
+	return GetUser(db, username)
+}
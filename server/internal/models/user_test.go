@@ -0,0 +1,75 @@
+package models
+
+import (
+	"os"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"golang.org/x/crypto/bcrypt"
+)
+
+func TestValidUsername(t *testing.T) {
+	tests := []struct {
+		name     string
+		username string
+		want     bool
+	}{
+		{"Латиница", "alice", true},
+		{"Кириллица с точкой", "вася.пупкин", true},
+		{"Подчеркивание", "_bot", true},
+		{"Пустое имя", "", false},
+		{"Двоеточие", "a:b", false},
+		{"Пробел", "alice smith", false},
+		{"Начинается с точки", ".alice", false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			assert.Equal(t, tt.want, ValidUsername(tt.username))
+		})
+	}
+}
+
+func TestUsers(t *testing.T) {
+	passwordCost = bcrypt.MinCost
+	db, err := SetupTestDB()
+	assert.NoError(t, err)
+	defer func() {
+		db.Close()
+		os.Remove("test.db")
+	}()
+
+	user, err := CreateUser(db, "alice", "пароль123")
+	assert.NoError(t, err)
+	assert.Equal(t, "alice", user.Username)
+
+	_, err = CreateUser(db, "alice", "другой пароль")
+	assert.ErrorIs(t, err, ErrUserExists)
+
+	_, err = Authenticate(db, "alice", "другой пароль")
+	assert.ErrorIs(t, err, ErrInvalidCredentials)
+	_, err = Authenticate(db, "bob", "пароль123")
+	assert.ErrorIs(t, err, ErrInvalidCredentials)
+
+	user, err = Authenticate(db, "alice", "пароль123")
+	assert.NoError(t, err)
+	assert.Equal(t, "alice", user.Username)
+
+	user, err = UpdateProfile(db, "alice", Profile{DisplayName: " Алиса ", AvatarURL: "/v1/uploads/a.png", Status: "в отпуске"})
+	assert.NoError(t, err)
+	assert.Equal(t, "Алиса", user.DisplayName)
+	assert.Equal(t, "/v1/uploads/a.png", user.AvatarURL)
+	assert.Equal(t, "в отпуске", user.Status)
+
+	_, err = UpdateProfile(db, "bob", Profile{DisplayName: "Боб"})
+	assert.ErrorIs(t, err, ErrUserNotFound)
+	_, err = GetUser(db, "bob")
+	assert.ErrorIs(t, err, ErrUserNotFound)
+
+	exists, err := UserExists(db, "alice")
+	assert.NoError(t, err)
+	assert.True(t, exists)
+	exists, err = UserExists(db, "bob")
+	assert.NoError(t, err)
+	assert.False(t, exists)
+}
@@ -0,0 +1,84 @@
+package presence
+
+import (
+	"sort"
+	"sync"
+	"time"
+
+	"team-bunny-chat/server/internal/models"
+)
+
+// DefaultTimeout — через сколько после последнего heartbeat пользователь
+// считается ушедшим. Клиенты шлют heartbeat втрое чаще.
+const DefaultTimeout = 45 * time.Second
+
+type Roster struct {
+	mu      sync.Mutex
+	timeout time.Duration
+	chats   map[string]map[string]time.Time
+	now     func() time.Time
+}
+
+func NewRoster(timeout time.Duration) *Roster {
+	return &Roster{
+		timeout: timeout,
+		chats:   make(map[string]map[string]time.Time),
+		now:     time.Now,
+	}
+}
+
+func (r *Roster) Update(event models.PresenceEvent) {
+	if event.Username == "" || event.ChatName == "" {
+		return
+	}
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	users := r.chats[event.ChatName]
+	switch event.Status {
+	case models.PresenceJoin, models.PresenceHeartbeat:
+		if users == nil {
+			users = make(map[string]time.Time)
+			r.chats[event.ChatName] = users
+		}
+		users[event.Username] = r.now()
+	case models.PresenceLeave:
+		delete(users, event.Username)
+		if len(users) == 0 {
+			delete(r.chats, event.ChatName)
+		}
+	}
+}
+
+// Online возвращает пользователей чата, приславших событие не позже timeout
+// назад. Просроченные записи удаляются при чтении.
+func (r *Roster) Online(chatName string) []models.Member {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	now := r.now()
+	users := r.chats[chatName]
+	members := make([]models.Member, 0, len(users))
+	for username, seen := range users {
+		if now.Sub(seen) > r.timeout {
+			delete(users, username)
+			continue
+		}
+		lastSeen := seen
+		members = append(members, models.Member{
+			Username: username,
+			Online:   true,
+			LastSeen: &lastSeen,
+		})
+	}
+	if len(users) == 0 {
+		delete(r.chats, chatName)
+	}
+
+	sort.Slice(members, func(i, j int) bool {
+		return members[i].Username < members[j].Username
+	})
+
+	return members
+}
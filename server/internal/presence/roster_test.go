@@ -0,0 +1,67 @@
+package presence
+
+import (
+	"testing"
+	"time"
+
+	"team-bunny-chat/server/internal/models"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func newTestRoster(now *time.Time) *Roster {
+	r := NewRoster(DefaultTimeout)
+	r.now = func() time.Time { return *now }
+	return r
+}
+
+func usernames(members []models.Member) []string {
+	result := []string{}
+	for _, m := range members {
+		result = append(result, m.Username)
+	}
+	return result
+}
+
+func TestRosterJoinLeave(t *testing.T) {
+	now := time.Now()
+	r := newTestRoster(&now)
+
+	r.Update(models.PresenceEvent{Username: "bob", ChatName: "team", Status: models.PresenceJoin})
+	r.Update(models.PresenceEvent{Username: "alice", ChatName: "team", Status: models.PresenceJoin})
+	r.Update(models.PresenceEvent{Username: "carol", ChatName: "other", Status: models.PresenceJoin})
+
+	assert.Equal(t, []string{"alice", "bob"}, usernames(r.Online("team")))
+	assert.Equal(t, []string{"carol"}, usernames(r.Online("other")))
+
+	r.Update(models.PresenceEvent{Username: "bob", ChatName: "team", Status: models.PresenceLeave})
+	assert.Equal(t, []string{"alice"}, usernames(r.Online("team")))
+}
+
+func TestRosterTimeout(t *testing.T) {
+	now := time.Now()
+	r := newTestRoster(&now)
+
+	r.Update(models.PresenceEvent{Username: "alice", ChatName: "team", Status: models.PresenceJoin})
+	r.Update(models.PresenceEvent{Username: "bob", ChatName: "team", Status: models.PresenceJoin})
+
+	now = now.Add(DefaultTimeout / 2)
+	r.Update(models.PresenceEvent{Username: "bob", ChatName: "team", Status: models.PresenceHeartbeat})
+
+	now = now.Add(DefaultTimeout/2 + time.Second)
+	assert.Equal(t, []string{"bob"}, usernames(r.Online("team")))
+
+	now = now.Add(DefaultTimeout)
+	assert.Empty(t, r.Online("team"))
+}
+
+func TestRosterIgnoresIncompleteEvents(t *testing.T) {
+	now := time.Now()
+	r := newTestRoster(&now)
+
+	r.Update(models.PresenceEvent{ChatName: "team", Status: models.PresenceJoin})
+	r.Update(models.PresenceEvent{Username: "alice", Status: models.PresenceJoin})
+
+	assert.Empty(t, r.Online("team"))
+	assert.Empty(t, r.Online(""))
+}
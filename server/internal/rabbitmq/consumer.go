@@ -4,10 +4,12 @@ import (
 	"database/sql"
 	"encoding/json"
 	"log"
+	"sort"
 	"strings"
 	"time"
 
 	"team-bunny-chat/server/internal/models"
+	"team-bunny-chat/server/internal/presence"
 
 	amqp "github.com/rabbitmq/amqp091-go"
 )
@@ -16,9 +18,10 @@ type Consumer struct {
 	conn    *amqp.Connection
 	channel *amqp.Channel
 	db      *sql.DB
+	roster  *presence.Roster
 }
 
-func NewConsumer(amqpURL string, db *sql.DB) (*Consumer, error) {
+func NewConsumer(amqpURL string, db *sql.DB, roster *presence.Roster) (*Consumer, error) {
 	log.Printf("Подключение к RabbitMQ: %s", amqpURL)
 	conn, err := amqp.Dial(amqpURL)
 	if err != nil {
@@ -37,6 +40,7 @@ func NewConsumer(amqpURL string, db *sql.DB) (*Consumer, error) {
 		conn:    conn,
 		channel: ch,
 		db:      db,
+		roster:  roster,
 	}, nil
 }
 
@@ -90,6 +94,18 @@ func (c *Consumer) SubscribeToChats() error {
 	}
 	log.Printf("Очередь привязана к exchange с паттерном bunny.*")
 
+	err = c.channel.QueueBind(
+		q.Name,        // имя очереди
+		"presence.*",  // routing key
+		"bunny.chats", // exchange
+		false,         // no-wait
+		nil,           // arguments
+	)
+	if err != nil {
+		return err
+	}
+	log.Printf("Очередь привязана к exchange с паттерном presence.*")
+
 	msgs, err := c.channel.Consume(
 		q.Name, // queue
 		"",     // consumer
@@ -118,6 +134,17 @@ func (c *Consumer) handleMessages(msgs <-chan amqp.Delivery) {
 		}
 		chatName := parts[1]
 
+		switch parts[0] {
+		case "presence":
+			c.handlePresence(chatName, d.Body)
+			continue
+		case "bunny":
+		default:
+			// Эфемерные события (например, typing.*) в историю не пишем.
+			log.Printf("Пропускаем событие %s", d.RoutingKey)
+			continue
+		}
+
 		var msg models.Message
 		err := json.Unmarshal(d.Body, &msg)
 		if err != nil {
@@ -134,8 +161,66 @@ func (c *Consumer) handleMessages(msgs <-chan amqp.Delivery) {
 		err = models.SaveMessage(c.db, chatName, &msg)
 		if err != nil {
 			log.Printf("Ошибка при сохранении сообщения: %v", err)
-		} else {
-			log.Printf("Сообщение успешно сохранено в базу")
+			continue
 		}
+		log.Printf("Сообщение успешно сохранено в базу")
+
+		if err := c.saveMentions(chatName, &msg); err != nil {
+			log.Printf("Ошибка при сохранении упоминаний: %v", err)
+		}
+	}
+}
+
+// saveMentions раскрывает @here (все, кто в сети) и @channel (все участники
+// чата) в конкретных пользователей. Автор сообщения упоминаний не получает.
+func (c *Consumer) saveMentions(chatName string, msg *models.Message) error {
+	names := models.ParseMentions(msg.Body)
+	if len(names) == 0 {
+		return nil
+	}
+
+	recipients := make(map[string]bool)
+	for _, name := range names {
+		switch name {
+		case models.MentionHere, models.MentionChannel:
+			if c.roster != nil {
+				for _, m := range c.roster.Online(chatName) {
+					recipients[m.Username] = true
+				}
+			}
+			if name == models.MentionChannel {
+				usernames, err := models.GetChatUsernames(c.db, chatName)
+				if err != nil {
+					return err
+				}
+				for _, username := range usernames {
+					recipients[username] = true
+				}
+			}
+		default:
+			recipients[name] = true
+		}
+	}
+	delete(recipients, msg.Username)
+
+	usernames := make([]string, 0, len(recipients))
+	for username := range recipients {
+		usernames = append(usernames, username)
+	}
+	sort.Strings(usernames)
+
+	return models.SaveMentions(c.db, chatName, msg, usernames)
+}
+
+func (c *Consumer) handlePresence(chatName string, body []byte) {
+	var event models.PresenceEvent
+	if err := json.Unmarshal(body, &event); err != nil {
+		log.Printf("Ошибка при разборе события присутствия: %v", err)
+		return
+	}
+	event.ChatName = chatName
+
+	if c.roster != nil {
+		c.roster.Update(event)
 	}
 }
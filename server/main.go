@@ -8,6 +8,7 @@ import (
 	"syscall"
 
 	"team-bunny-chat/server/internal/api"
+	"team-bunny-chat/server/internal/presence"
 	"team-bunny-chat/server/internal/rabbitmq"
 
 	"github.com/gin-gonic/gin"
@@ -34,6 +35,11 @@ func main() {
 		dbPath = "/data/chat.db"
 	}
 
+	uploadDir := os.Getenv("UPLOAD_DIR")
+	if uploadDir == "" {
+		uploadDir = "/data/uploads"
+	}
+
 	log.Printf("Используем базу данных: %s", dbPath)
 
 	db, err := sql.Open("sqlite3", dbPath)
@@ -63,7 +69,9 @@ func main() {
 		log.Printf("Найдено сообщений в таблице chat_aboba: %d", msgCnt)
 	}
 
-	consumer, err := rabbitmq.NewConsumer(rabbitURL, db)
+	roster := presence.NewRoster(presence.DefaultTimeout)
+
+	consumer, err := rabbitmq.NewConsumer(rabbitURL, db, roster)
 	if err != nil {
 		log.Fatalf("Ошибка подключения к RabbitMQ: %v", err)
 	}
@@ -88,7 +96,7 @@ func main() {
 		log.Printf("=== Конец HTTP запроса ===")
 	})
 
-	handler := api.NewHandler(db)
+	handler := api.NewHandler(db, roster, uploadDir)
 	api.SetupRoutes(router, handler)
 
 	sigChan := make(chan os.Signal, 1)